@@ -0,0 +1,178 @@
+// Package affinity pins the process to a set of CPUs and reads which CPUs
+// belong to which NUMA node, for experiments on how placement changes
+// throughput on large multi-socket machines. Pinning is implemented for
+// Linux, through sched_setaffinity; elsewhere Get and Pin return
+// errors.ErrUnsupported.
+//
+// The Go runtime reads the CPU mask once at startup and sizes GOMAXPROCS by
+// it. Callers that pin later should set GOMAXPROCS to the size of the set
+// themselves, or the scheduler keeps more Ps than there are CPUs to run them.
+package affinity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CPUSet is a sorted list of distinct CPU numbers.
+type CPUSet []int
+
+// Parse parses a CPU list in the kernel's format, "0-3,8,10-11".
+func Parse(list string) (CPUSet, error) {
+	var set CPUSet
+	for _, f := range strings.Split(strings.TrimSpace(list), ",") {
+		lo, hi, isRange := strings.Cut(f, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("affinity: invalid CPU %q in %q", lo, list)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("affinity: invalid range %q in %q", f, list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			set = append(set, cpu)
+		}
+	}
+	slices.Sort(set)
+	return slices.Compact(set), nil
+}
+
+// String formats the set as a CPU list, collapsing runs into ranges.
+func (s CPUSet) String() string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		j := i
+		for j+1 < len(s) && s[j+1] == s[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(s[i]))
+		if j > i {
+			fmt.Fprintf(&b, "-%d", s[j])
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// Intersects reports whether s and t share a CPU.
+func (s CPUSet) Intersects(t CPUSet) bool {
+	for _, cpu := range s {
+		if _, ok := slices.BinarySearch(t, cpu); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Node is a NUMA node and the CPUs attached to it.
+type Node struct {
+	ID   int
+	CPUs CPUSet
+}
+
+// sysfs is where Online and Nodes read the topology.
+const sysfs = "/sys/devices/system"
+
+// Online returns the CPUs the kernel has online. Where that cannot be read,
+// it returns the first runtime.NumCPU CPUs.
+func Online() CPUSet {
+	if data, err := os.ReadFile(filepath.Join(sysfs, "cpu/online")); err == nil {
+		if set, err := Parse(string(data)); err == nil {
+			return set
+		}
+	}
+	set := make(CPUSet, runtime.NumCPU())
+	for i := range set {
+		set[i] = i
+	}
+	return set
+}
+
+// started is the mask the process started with, read before anything can
+// Pin it narrower.
+var started = func() CPUSet {
+	if set, err := Get(); err == nil && len(set) > 0 {
+		return set
+	}
+	return Online()
+}()
+
+// Allowed returns the CPUs the process was allowed to run on when it
+// started: the mask of a taskset or a container's cpuset, which may be far
+// fewer than Online, or every online CPU where the mask cannot be read.
+// It is the set the runtime sized GOMAXPROCS by.
+func Allowed() CPUSet {
+	return slices.Clone(started)
+}
+
+// Nodes returns the machine's NUMA nodes that have CPUs, in ID order. A
+// machine without NUMA information is reported as one node with every
+// online CPU.
+func Nodes() []Node {
+	dirs, _ := filepath.Glob(filepath.Join(sysfs, "node/node[0-9]*"))
+	var nodes []Node
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil || strings.TrimSpace(string(data)) == "" {
+			continue // a memory-only node
+		}
+		cpus, err := Parse(string(data))
+		if err != nil {
+			continue
+		}
+		nodes = append(nodes, Node{ID: id, CPUs: cpus})
+	}
+	if len(nodes) == 0 {
+		return []Node{{ID: 0, CPUs: Online()}}
+	}
+	slices.SortFunc(nodes, func(a, b Node) int { return a.ID - b.ID })
+	return nodes
+}
+
+// Resolve turns a CPU specification into a set: a CPU list ("0-3,8"), a
+// NUMA node ("node1"), or "all" for every CPU the process was allowed at
+// startup, as Allowed.
+func Resolve(spec string) (CPUSet, error) {
+	switch {
+	case spec == "all":
+		return Allowed(), nil
+	case strings.HasPrefix(spec, "node"):
+		id, err := strconv.Atoi(strings.TrimPrefix(spec, "node"))
+		if err != nil {
+			return nil, fmt.Errorf("affinity: invalid node %q", spec)
+		}
+		for _, n := range Nodes() {
+			if n.ID == id {
+				return n.CPUs, nil
+			}
+		}
+		return nil, fmt.Errorf("affinity: no NUMA node %d with CPUs", id)
+	}
+	return Parse(spec)
+}
+
+// NodesOf returns the IDs of the nodes whose CPUs s uses.
+func NodesOf(s CPUSet, nodes []Node) []int {
+	var ids []int
+	for _, n := range nodes {
+		if s.Intersects(n.CPUs) {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,88 @@
+package affinity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// mask is the kernel's cpu_set_t: one bit per CPU, in words.
+type mask []uint64
+
+const wordBits = 64
+
+func newMask(s CPUSet) mask {
+	n := 1
+	if len(s) > 0 {
+		n = s[len(s)-1]/wordBits + 1
+	}
+	m := make(mask, max(n, 16)) // at least 1024 CPUs, the size glibc uses
+	for _, cpu := range s {
+		m[cpu/wordBits] |= 1 << (cpu % wordBits)
+	}
+	return m
+}
+
+func (m mask) set() CPUSet {
+	var s CPUSet
+	for i, w := range m {
+		for b := range wordBits {
+			if w&(1<<b) != 0 {
+				s = append(s, i*wordBits+b)
+			}
+		}
+	}
+	return s
+}
+
+// Get returns the CPUs the calling thread may run on. Pin gives every
+// thread of the process the same set, so after Pin it is the process's.
+func Get() (CPUSet, error) {
+	m := newMask(nil)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, uintptr(len(m)*8), uintptr(unsafe.Pointer(&m[0])))
+	if errno != 0 {
+		return nil, fmt.Errorf("affinity: sched_getaffinity: %w", errno)
+	}
+	return m.set(), nil
+}
+
+// Pin restricts every thread of the process to the CPUs in s.
+// sched_setaffinity applies to one thread, so Pin walks /proc/self/task
+// and repeats until a pass finds no thread it has not pinned; threads the
+// runtime starts afterwards inherit the mask of the thread that creates
+// them.
+func Pin(s CPUSet) error {
+	if len(s) == 0 {
+		return errors.New("affinity: empty CPU set")
+	}
+	m := newMask(s)
+	pinned := make(map[int]bool)
+	for {
+		tasks, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return fmt.Errorf("affinity: %w", err)
+		}
+		found := false
+		for _, t := range tasks {
+			tid, err := strconv.Atoi(t.Name())
+			if err != nil || pinned[tid] {
+				continue
+			}
+			_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), uintptr(len(m)*8), uintptr(unsafe.Pointer(&m[0])))
+			if errno == syscall.ESRCH {
+				continue // the thread exited
+			}
+			if errno != 0 {
+				return fmt.Errorf("affinity: sched_setaffinity %s: %w", s, errno)
+			}
+			pinned[tid] = true
+			found = true
+		}
+		if !found {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package affinity
+
+import "errors"
+
+// Get returns the CPUs the process may run on. It is implemented on Linux
+// only.
+func Get() (CPUSet, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Pin restricts the process to the CPUs in s. It is implemented on Linux
+// only.
+func Pin(s CPUSet) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,140 @@
+// Package advisor reads a diff of two profiles and says what the changes
+// point at: more time allocating, in the garbage collector, on locks, in
+// system calls, or scheduling goroutines, from the share of the runtime
+// functions that do those, and the functions outside the runtime whose own
+// share grew the most.
+package advisor
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/analysis/diff"
+)
+
+// DefaultMinChange is the smallest change in share, 2 points of the total,
+// that Advise reports.
+const DefaultMinChange = 0.02
+
+// Finding is one change Advise found worth a look.
+type Finding struct {
+	// Kind names what changed, such as "allocation", or "code" for a
+	// function outside the runtime.
+	Kind string `json:"kind"`
+	// Function is the function whose share changed most, and Change that
+	// change in its cumulative share, positive when head spends more.
+	Function string  `json:"function"`
+	Change   float64 `json:"change"`
+	Advice   string  `json:"advice"`
+}
+
+// rule matches the runtime functions of one kind of cost, by prefix.
+type rule struct {
+	kind        string
+	prefixes    []string
+	more, fewer string
+}
+
+var rules = []rule{
+	{"allocation", []string{"runtime.mallocgc", "runtime.newobject", "runtime.makeslice", "runtime.growslice", "runtime.makemap"},
+		"head allocates more; compare heap profiles by alloc_space to find where, then preallocate or reuse",
+		"head allocates less"},
+	{"garbage collection", []string{"runtime.gcBgMarkWorker", "runtime.gcDrain", "runtime.scanobject", "runtime.gcAssistAlloc"},
+		"the GC runs more; allocate less, or set GOMEMLIMIT so it runs only near the limit",
+		"the GC runs less"},
+	{"lock contention", []string{"sync.(*Mutex).", "sync.(*RWMutex).", "internal/sync.", "runtime.lock2", "runtime.semacquire", "runtime.semrelease"},
+		"head spends more on locks; the mutex profile shows which ones are contended",
+		"head spends less on locks"},
+	{"system calls", []string{"syscall.", "internal/poll.", "runtime.futex", "runtime/internal/syscall.", "internal/runtime/syscall."},
+		"head spends more in system calls; batch small reads and writes behind a bufio.Reader or Writer",
+		"head spends less in system calls"},
+	{"scheduling", []string{"runtime.schedule", "runtime.findRunnable", "runtime.park_m", "runtime.gopark"},
+		"the scheduler works more, often from goroutines that block and wake for little work each",
+		"the scheduler works less"},
+}
+
+// Advise returns the changes of r of at least minChange (DefaultMinChange
+// for 0): for each kind of runtime cost, the function of that kind whose
+// cumulative share changed most, and up to three functions outside the
+// runtime whose flat share grew most, largest change first.
+func Advise(r *diff.Report, minChange float64) []Finding {
+	if minChange <= 0 {
+		minChange = DefaultMinChange
+	}
+	var out []Finding
+	for _, ru := range rules {
+		var best *diff.Entry
+		for i, e := range r.Entries {
+			if ru.matches(e.Function) && (best == nil || abs(cumChange(e)) > abs(cumChange(*best))) {
+				best = &r.Entries[i]
+			}
+		}
+		if best == nil || abs(cumChange(*best)) < minChange {
+			continue
+		}
+		advice := ru.more
+		if cumChange(*best) < 0 {
+			advice = ru.fewer
+		}
+		out = append(out, Finding{Kind: ru.kind, Function: best.Function, Change: cumChange(*best), Advice: advice})
+	}
+
+	var code []Finding
+	for _, e := range r.Entries {
+		if runtimeFunc(e.Function) || e.Delta() < minChange {
+			continue
+		}
+		code = append(code, Finding{Kind: "code", Function: e.Function, Change: e.Delta(),
+			Advice: "spends more of the total itself; look at its lines with pprof -list"})
+	}
+	slices.SortFunc(code, func(a, b Finding) int { return cmp.Compare(b.Change, a.Change) })
+	out = append(out, code[:min(len(code), 3)]...)
+
+	slices.SortStableFunc(out, func(a, b Finding) int { return cmp.Compare(abs(b.Change), abs(a.Change)) })
+	return out
+}
+
+func (ru rule) matches(fn string) bool {
+	for _, p := range ru.prefixes {
+		if strings.HasPrefix(fn, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeFunc reports whether fn belongs to the runtime or a package a rule
+// covers, or is a C function the runtime calls, which has no package.
+func runtimeFunc(fn string) bool {
+	if !strings.Contains(fn, ".") {
+		return true
+	}
+	for _, p := range []string{"runtime.", "runtime/", "internal/", "syscall.", "sync."} {
+		if strings.HasPrefix(fn, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func cumChange(e diff.Entry) float64 { return e.HeadCum - e.BaseCum }
+
+func abs(f float64) float64 { return max(f, -f) }
+
+// WriteText writes the findings, one a line, or a line saying there are
+// none.
+func WriteText(w io.Writer, findings []Finding) error {
+	if len(findings) == 0 {
+		_, err := fmt.Fprintln(w, "No change large enough to advise on.")
+		return err
+	}
+	for _, f := range findings {
+		if _, err := fmt.Fprintf(w, "%+7.2f%%  %s, %s: %s\n", 100*f.Change, f.Kind, f.Function, f.Advice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package blocktimeline
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"time"
+)
+
+const (
+	labelWidth = 320
+	plotWidth  = 900
+	rowHeight  = 22
+)
+
+type band struct {
+	X, Width float64
+	Opacity  float64
+	Title    string
+}
+
+type row struct {
+	Group string
+	Total time.Duration
+	Y     int
+	Bands []band
+}
+
+type page struct {
+	Title      string
+	Duration   time.Duration
+	Width      int
+	Height     int
+	LabelWidth int
+	PlotWidth  int
+	Rows       []row
+}
+
+var pageTemplate = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+text { font-size: 12px; font-family: monospace; }
+rect.band { fill: #c0392b; }
+rect.bg { fill: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Run length {{.Duration}}. Each row is a goroutine group; band opacity is the
+blocked time in that interval relative to the busiest interval. Hover a band for
+its blocking sites.</p>
+<svg width="{{.Width}}" height="{{.Height}}">
+{{- range .Rows}}
+<text x="0" y="{{.Y}}" dy="15">{{.Group}} ({{.Total}})</text>
+<rect class="bg" x="{{$.LabelWidth}}" y="{{.Y}}" width="{{$.PlotWidth}}" height="20"></rect>
+{{- $y := .Y}}
+{{- range .Bands}}
+<rect class="band" x="{{.X}}" y="{{$y}}" width="{{.Width}}" height="20" fill-opacity="{{.Opacity}}"><title>{{.Title}}</title></rect>
+{{- end}}
+{{- end}}
+</svg>
+</body>
+</html>
+`))
+
+// WriteHTML renders the timeline as a standalone HTML page with one row of
+// blocking bands per goroutine group.
+func (t *Timeline) WriteHTML(w io.Writer, title string) error {
+	p := page{Title: title, LabelWidth: labelWidth, PlotWidth: plotWidth}
+	if len(t.Intervals) == 0 {
+		return pageTemplate.Execute(w, p)
+	}
+
+	end := t.Intervals[len(t.Intervals)-1].End
+	p.Duration = end.Sub(t.Start).Round(time.Millisecond)
+	scale := plotWidth / float64(max(end.Sub(t.Start), 1))
+
+	var peak time.Duration
+	for _, iv := range t.Intervals {
+		for _, d := range iv.Groups {
+			peak = max(peak, d)
+		}
+	}
+
+	totals := t.Totals()
+	for i, g := range t.Groups() {
+		r := row{Group: g, Total: totals[g].Round(time.Microsecond), Y: i * rowHeight}
+		for _, iv := range t.Intervals {
+			d := iv.Groups[g]
+			if d == 0 {
+				continue
+			}
+			r.Bands = append(r.Bands, band{
+				X:       labelWidth + float64(iv.Start.Sub(t.Start))*scale,
+				Width:   max(float64(iv.End.Sub(iv.Start))*scale, 1),
+				Opacity: max(float64(d)/float64(peak), 0.05),
+				Title:   bandTitle(t.Start, iv, g),
+			})
+		}
+		p.Rows = append(p.Rows, r)
+	}
+	p.Width = labelWidth + plotWidth
+	p.Height = len(p.Rows) * rowHeight
+	return pageTemplate.Execute(w, p)
+}
+
+func bandTitle(start time.Time, iv Interval, group string) string {
+	title := fmt.Sprintf("%v-%v: %v blocked",
+		iv.Start.Sub(start).Round(time.Millisecond),
+		iv.End.Sub(start).Round(time.Millisecond),
+		iv.Groups[group].Round(time.Microsecond))
+
+	type site struct {
+		name  string
+		delay time.Duration
+	}
+	var sites []site
+	for name, d := range iv.Sites[group] {
+		sites = append(sites, site{name, d})
+	}
+	slices.SortFunc(sites, func(a, b site) int { return cmp.Compare(b.delay, a.delay) })
+	for _, s := range sites {
+		title += fmt.Sprintf("\n  %v %s", s.delay.Round(time.Microsecond), s.name)
+	}
+	return title
+}
@@ -0,0 +1,224 @@
+// Package blocktimeline shows when, not just where, goroutines blocked during
+// a run. It snapshots the cumulative block profile at a fixed interval,
+// subtracts consecutive snapshots, and attributes each interval's blocking to
+// goroutine groups (the entry function of the blocked goroutine).
+package blocktimeline
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Interval is the blocking observed between two snapshots.
+type Interval struct {
+	Start time.Time
+	End   time.Time
+	// Groups maps a goroutine group to the time it spent blocked.
+	Groups map[string]time.Duration
+	// Sites maps a goroutine group to its blocking call sites and their delay.
+	Sites map[string]map[string]time.Duration
+}
+
+// Timeline is the sequence of intervals of one run.
+type Timeline struct {
+	Start     time.Time
+	Intervals []Interval
+}
+
+// Groups returns every group that blocked at some point, ordered by total
+// blocked time, highest first.
+func (t *Timeline) Groups() []string {
+	totals := t.Totals()
+	groups := make([]string, 0, len(totals))
+	for g := range totals {
+		groups = append(groups, g)
+	}
+	slices.SortFunc(groups, func(a, b string) int {
+		return cmp.Or(cmp.Compare(totals[b], totals[a]), strings.Compare(a, b))
+	})
+	return groups
+}
+
+// Totals returns the blocked time of each group over the whole run.
+func (t *Timeline) Totals() map[string]time.Duration {
+	totals := make(map[string]time.Duration)
+	for _, iv := range t.Intervals {
+		for g, d := range iv.Groups {
+			totals[g] += d
+		}
+	}
+	return totals
+}
+
+// Sampler records a Timeline. Block profiling must be enabled with
+// runtime.SetBlockProfileRate for there to be anything to record.
+type Sampler struct {
+	interval time.Duration
+
+	mu       sync.Mutex
+	timeline Timeline
+	prev     map[string]int64 // stack key -> cumulative delay in ns
+	last     time.Time
+}
+
+// NewSampler returns a sampler taking a snapshot every interval.
+func NewSampler(interval time.Duration) *Sampler {
+	return &Sampler{interval: interval}
+}
+
+// Run samples until ctx is done, then takes a final snapshot.
+func (s *Sampler) Run(ctx context.Context) error {
+	if err := s.Snapshot(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return s.Snapshot()
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Snapshot reads the block profile now and closes the current interval.
+func (s *Sampler) Snapshot() error {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("block").WriteTo(&buf, 0); err != nil {
+		return err
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return fmt.Errorf("blocktimeline: parse block profile: %w", err)
+	}
+	now := time.Now()
+
+	delayIdx := -1
+	for i, st := range p.SampleType {
+		if st.Type == "delay" {
+			delayIdx = i
+		}
+	}
+	if delayIdx < 0 {
+		return fmt.Errorf("blocktimeline: block profile has no delay samples")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Stacks are keyed by their frames; the profile may split one stack
+	// across several samples.
+	cur := make(map[string]int64, len(p.Sample))
+	for _, sample := range p.Sample {
+		frames := functions(sample)
+		if slices.ContainsFunc(frames, isSampler) {
+			continue
+		}
+		cur[strings.Join(frames, ";")] += sample.Value[delayIdx]
+	}
+
+	if s.prev != nil {
+		iv := Interval{
+			Start:  s.last,
+			End:    now,
+			Groups: make(map[string]time.Duration),
+			Sites:  make(map[string]map[string]time.Duration),
+		}
+		for key, total := range cur {
+			d := time.Duration(total - s.prev[key])
+			if d <= 0 {
+				continue
+			}
+			frames := strings.Split(key, ";")
+			group, site := classify(frames)
+			iv.Groups[group] += d
+			if iv.Sites[group] == nil {
+				iv.Sites[group] = make(map[string]time.Duration)
+			}
+			iv.Sites[group][site] += d
+		}
+		s.timeline.Intervals = append(s.timeline.Intervals, iv)
+		// Mark the interval boundary so it can be lined up with an execution
+		// trace of the same run; a no-op when tracing is off.
+		trace.Log(context.Background(), "blocktimeline", fmt.Sprintf("interval %d", len(s.timeline.Intervals)))
+	} else {
+		s.timeline.Start = now
+	}
+	s.prev = cur
+	s.last = now
+	return nil
+}
+
+// Timeline returns the intervals recorded so far.
+func (s *Sampler) Timeline() Timeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.timeline
+	t.Intervals = slices.Clone(t.Intervals)
+	return t
+}
+
+// functions returns the function names of a sample, leaf first.
+func functions(s *profile.Sample) []string {
+	var frames []string
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				frames = append(frames, line.Function.Name)
+			}
+		}
+	}
+	return frames
+}
+
+// classify returns the goroutine group (outermost application frame) and the
+// blocking site (innermost application frame) of a leaf-first stack.
+func classify(frames []string) (group, site string) {
+	for _, fn := range frames {
+		if !isRuntime(fn) {
+			site = fn
+			break
+		}
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		if !isRuntime(frames[i]) {
+			group = frames[i]
+			break
+		}
+	}
+	if group == "" {
+		group = "(runtime)"
+	}
+	if site == "" {
+		site = group
+	}
+	return group, site
+}
+
+// isSampler reports whether fn belongs to this package, so the sampler's own
+// waiting is left out of the timeline.
+func isSampler(fn string) bool {
+	return strings.HasPrefix(fn, "github.com/vdntruong/gosamurai/analysis/blocktimeline.")
+}
+
+func isRuntime(fn string) bool {
+	return strings.HasPrefix(fn, "runtime.") ||
+		strings.HasPrefix(fn, "sync.") ||
+		strings.HasPrefix(fn, "internal/")
+}
@@ -0,0 +1,190 @@
+// Package contention turns a mutex profile into a ranked report of lock
+// sites: where contended locks were released, how often, and for how long
+// waiters were delayed, with sites mapped to human-readable lock names.
+package contention
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Names maps functions to the lock they hold, for example
+// "main.createUsersHandler" to "cacheMu". A key ending in "." or "/" matches
+// every function with that prefix; the longest matching key wins.
+type Names map[string]string
+
+func (n Names) lookup(function string) string {
+	if name, ok := n[function]; ok {
+		return name
+	}
+	best := ""
+	for key := range n {
+		if (strings.HasSuffix(key, ".") || strings.HasSuffix(key, "/")) &&
+			strings.HasPrefix(function, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	return n[best]
+}
+
+// Site is the first frame outside the sync and runtime packages, which is
+// where application code released (or acquired, for RWMutex readers) the
+// contended lock.
+type Site struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int64  `json:"line"`
+}
+
+func (s Site) String() string {
+	return fmt.Sprintf("%s (%s:%d)", s.Function, shortFile(s.File), s.Line)
+}
+
+// Entry is the contention attributed to one site.
+type Entry struct {
+	Lock        string        `json:"lock"`
+	Site        Site          `json:"site"`
+	Contentions int64         `json:"contentions"`
+	Delay       time.Duration `json:"delay_ns"`
+	Share       float64       `json:"share"`
+	// Stack is a sample call stack leading to the site, innermost first.
+	Stack []string `json:"stack"`
+}
+
+// Report ranks sites by delay, highest first.
+type Report struct {
+	TotalDelay       time.Duration `json:"total_delay_ns"`
+	TotalContentions int64         `json:"total_contentions"`
+	Entries          []Entry       `json:"entries"`
+}
+
+// Analyze builds a report from a mutex (or block) profile. Frames are
+// resolved to lock names with names, which may be nil.
+func Analyze(p *profile.Profile, names Names) (*Report, error) {
+	countIdx, delayIdx := -1, -1
+	for i, st := range p.SampleType {
+		switch st.Type {
+		case "contentions":
+			countIdx = i
+		case "delay":
+			delayIdx = i
+		}
+	}
+	if countIdx < 0 || delayIdx < 0 {
+		return nil, fmt.Errorf("contention: profile has no contentions/delay samples")
+	}
+	delayUnit := unitDuration(p.SampleType[delayIdx].Unit)
+
+	bySite := make(map[Site]*Entry)
+	report := &Report{}
+	for _, s := range p.Sample {
+		count := s.Value[countIdx]
+		delay := time.Duration(s.Value[delayIdx]) * delayUnit
+		if count == 0 && delay == 0 {
+			continue
+		}
+		site, stack := siteOf(s)
+		e := bySite[site]
+		if e == nil {
+			e = &Entry{Site: site, Lock: names.lookup(site.Function), Stack: stack}
+			if e.Lock == "" {
+				e.Lock = "?"
+			}
+			bySite[site] = e
+		}
+		e.Contentions += count
+		e.Delay += delay
+		report.TotalContentions += count
+		report.TotalDelay += delay
+	}
+
+	for _, e := range bySite {
+		if report.TotalDelay > 0 {
+			e.Share = float64(e.Delay) / float64(report.TotalDelay)
+		}
+		report.Entries = append(report.Entries, *e)
+	}
+	slices.SortFunc(report.Entries, func(a, b Entry) int {
+		if a.Delay != b.Delay {
+			return int(b.Delay - a.Delay)
+		}
+		return strings.Compare(a.Site.Function, b.Site.Function)
+	})
+	return report, nil
+}
+
+func siteOf(s *profile.Sample) (Site, []string) {
+	var (
+		site  Site
+		found bool
+		stack []string
+	)
+	for _, loc := range s.Location {
+		// Inlined frames are listed innermost first within a location.
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			fn := line.Function.Name
+			stack = append(stack, fmt.Sprintf("%s (%s:%d)", fn, shortFile(line.Function.Filename), line.Line))
+			if !found && !isRuntimeFrame(fn) {
+				site = Site{Function: fn, File: line.Function.Filename, Line: line.Line}
+				found = true
+			}
+		}
+	}
+	if !found {
+		site = Site{Function: "(runtime)"}
+	}
+	return site, stack
+}
+
+func isRuntimeFrame(fn string) bool {
+	return strings.HasPrefix(fn, "sync.") ||
+		strings.HasPrefix(fn, "runtime.") ||
+		strings.HasPrefix(fn, "internal/")
+}
+
+func unitDuration(unit string) time.Duration {
+	switch unit {
+	case "nanoseconds":
+		return time.Nanosecond
+	case "microseconds":
+		return time.Microsecond
+	case "milliseconds":
+		return time.Millisecond
+	case "seconds":
+		return time.Second
+	}
+	return time.Nanosecond
+}
+
+func shortFile(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		if j := strings.LastIndex(path[:i], "/"); j >= 0 {
+			return path[j+1:]
+		}
+	}
+	return path
+}
+
+// WriteText prints the top n entries (all if n <= 0) as an aligned table.
+func (r *Report) WriteText(w io.Writer, n int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total delay: %s over %d contentions\n\n", r.TotalDelay, r.TotalContentions)
+	fmt.Fprintln(tw, "RANK\tLOCK\tDELAY\tSHARE\tCONTENTIONS\tSITE")
+	for i, e := range r.Entries {
+		if n > 0 && i == n {
+			break
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%.1f%%\t%d\t%s\n",
+			i+1, e.Lock, e.Delay.Round(time.Microsecond), 100*e.Share, e.Contentions, e.Site)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,144 @@
+// Package diff compares two profiles function by function. Values are
+// normalized to each profile's total, so profiles covering different amounts
+// of time or load can be compared.
+package diff
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// Entry is one function's share of the base and head profiles.
+type Entry struct {
+	Function string  `json:"function"`
+	BaseFlat float64 `json:"base_flat"`
+	HeadFlat float64 `json:"head_flat"`
+	BaseCum  float64 `json:"base_cum"`
+	HeadCum  float64 `json:"head_cum"`
+}
+
+// Delta is the change in flat share, positive when head spends more.
+func (e Entry) Delta() float64 { return e.HeadFlat - e.BaseFlat }
+
+// Report lists the functions of both profiles, largest flat change first.
+type Report struct {
+	SampleType string  `json:"sample_type"`
+	BaseTotal  int64   `json:"base_total"`
+	HeadTotal  int64   `json:"head_total"`
+	Entries    []Entry `json:"entries"`
+}
+
+// Compare diffs the default sample type of base and head, which must have
+// the same sample types.
+func Compare(base, head *profile.Profile) (*Report, error) {
+	idx, st, err := sampleIndex(base)
+	if err != nil {
+		return nil, err
+	}
+	if hidx, hst, err := sampleIndex(head); err != nil || hidx != idx || hst != st {
+		return nil, fmt.Errorf("diff: profiles have different sample types")
+	}
+
+	b, bTotal := shares(base, idx)
+	h, hTotal := shares(head, idx)
+	byFn := make(map[string]*Entry)
+	entry := func(fn string) *Entry {
+		if e, ok := byFn[fn]; ok {
+			return e
+		}
+		e := &Entry{Function: fn}
+		byFn[fn] = e
+		return e
+	}
+	for fn, s := range b {
+		e := entry(fn)
+		e.BaseFlat, e.BaseCum = s.flat, s.cum
+	}
+	for fn, s := range h {
+		e := entry(fn)
+		e.HeadFlat, e.HeadCum = s.flat, s.cum
+	}
+
+	r := &Report{SampleType: st, BaseTotal: bTotal, HeadTotal: hTotal}
+	for _, e := range byFn {
+		r.Entries = append(r.Entries, *e)
+	}
+	slices.SortFunc(r.Entries, func(a, b Entry) int {
+		return cmp.Or(
+			cmp.Compare(math.Abs(b.Delta()), math.Abs(a.Delta())),
+			cmp.Compare(math.Abs(b.HeadCum-b.BaseCum), math.Abs(a.HeadCum-a.BaseCum)),
+			cmp.Compare(a.Function, b.Function))
+	})
+	return r, nil
+}
+
+type share struct{ flat, cum float64 }
+
+func shares(p *profile.Profile, idx int) (map[string]share, int64) {
+	flat := make(map[string]int64)
+	cum := make(map[string]int64)
+	var total int64
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		total += v
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				fn := line.Function.Name
+				if i == 0 && j == 0 {
+					flat[fn] += v
+				}
+				if !seen[fn] {
+					seen[fn] = true
+					cum[fn] += v
+				}
+			}
+		}
+	}
+
+	out := make(map[string]share, len(cum))
+	if total == 0 {
+		return out, 0
+	}
+	for fn, c := range cum {
+		out[fn] = share{flat: float64(flat[fn]) / float64(total), cum: float64(c) / float64(total)}
+	}
+	return out, total
+}
+
+func sampleIndex(p *profile.Profile) (int, string, error) {
+	if len(p.SampleType) == 0 {
+		return 0, "", fmt.Errorf("diff: profile has no sample types")
+	}
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			return i, st.Type, nil
+		}
+	}
+	i := len(p.SampleType) - 1
+	return i, p.SampleType[i].Type, nil
+}
+
+// WriteText writes the n largest changes as a table (all for n <= 0).
+func (r *Report) WriteText(w io.Writer, n int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Sample type: %s (base total %d, head total %d)\n\n", r.SampleType, r.BaseTotal, r.HeadTotal)
+	fmt.Fprintln(tw, "DELTA\tBASE FLAT\tHEAD FLAT\tBASE CUM\tHEAD CUM\tFUNCTION")
+	for i, e := range r.Entries {
+		if n > 0 && i == n {
+			break
+		}
+		fmt.Fprintf(tw, "%+.2f%%\t%.2f%%\t%.2f%%\t%.2f%%\t%.2f%%\t%s\n",
+			100*e.Delta(), 100*e.BaseFlat, 100*e.HeadFlat, 100*e.BaseCum, 100*e.HeadCum, e.Function)
+	}
+	return tw.Flush()
+}
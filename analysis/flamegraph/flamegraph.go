@@ -0,0 +1,198 @@
+// Package flamegraph renders a pprof profile as a flame graph in a
+// standalone SVG file: every stack is a tower of frames with the root at the
+// bottom, each frame as wide as its share of the samples, so a profile can
+// be shared and read in a browser without go tool pprof -http.
+package flamegraph
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"slices"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	width       = 1200
+	frameHeight = 16
+	header      = 48
+	padding     = 10
+	// charWidth is the width of one character of the 12px monospace labels.
+	charWidth = 7.2
+	// minWidth drops frames too narrow to see, and their children.
+	minWidth = 0.1
+)
+
+// Node is one frame of the merged call tree; Value is the samples of every
+// stack through it.
+type Node struct {
+	Name     string
+	Value    int64
+	Children []*Node
+}
+
+// child returns n's child for name, adding it if needed.
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Node{Name: name}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// depth is the number of levels under n, n included.
+func (n *Node) depth() int {
+	d := 0
+	for _, c := range n.Children {
+		d = max(d, c.depth())
+	}
+	return d + 1
+}
+
+// Build merges the stacks of p, weighted by the values of sampleType such
+// as "cpu" (empty picks the profile's default), into a tree under a root
+// named "all", and returns it with the unit of the values. Children are
+// sorted by name, as flame graphs order them, so the same code paths sit in
+// the same place in two graphs.
+func Build(p *profile.Profile, sampleType string) (*Node, string, error) {
+	if sampleType == "" {
+		sampleType = p.DefaultSampleType
+	}
+	idx := -1
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		if sampleType != "" || len(p.SampleType) == 0 {
+			return nil, "", fmt.Errorf("flamegraph: profile has no %q samples", sampleType)
+		}
+		idx = len(p.SampleType) - 1
+	}
+
+	root := &Node{Name: "all"}
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		if v == 0 {
+			continue
+		}
+		root.Value += v
+		n := root
+		// pprof lists locations innermost first, and the inlined lines of
+		// a location innermost first too; the tree grows from the root.
+		for l := len(s.Location) - 1; l >= 0; l-- {
+			lines := s.Location[l].Line
+			for j := len(lines) - 1; j >= 0; j-- {
+				name := "?"
+				if fn := lines[j].Function; fn != nil {
+					name = fn.Name
+				}
+				n = n.child(name)
+				n.Value += v
+			}
+		}
+	}
+	sortTree(root)
+	return root, p.SampleType[idx].Unit, nil
+}
+
+func sortTree(n *Node) {
+	slices.SortFunc(n.Children, func(a, b *Node) int { return cmp.Compare(a.Name, b.Name) })
+	for _, c := range n.Children {
+		sortTree(c)
+	}
+}
+
+// WriteSVG writes the tree as an SVG flame graph titled title. unit is the
+// unit of the values, as Build returns it, for the frames' tooltips.
+func (n *Node) WriteSVG(w io.Writer, title, unit string) error {
+	height := header + n.depth()*frameHeight + padding
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">
+<style>
+text { font-family: monospace; font-size: 12px; fill: #000; }
+text.title { font-family: sans-serif; font-size: 17px; }
+rect:hover { stroke: #000; stroke-width: 0.5; }
+</style>
+<rect x="0" y="0" width="%d" height="%d" fill="#f8f8f8"/>
+<text class="title" x="%d" y="24" text-anchor="middle">%s</text>
+<text x="%d" y="40">Hover a frame for its samples. Width is the share of %s.</text>
+`, width, height, width, height, width, height, width/2, html.EscapeString(title), padding, html.EscapeString(describe(unit)))
+	if n.Value > 0 {
+		scale := float64(width-2*padding) / float64(n.Value)
+		writeFrame(bw, n, n.Value, unit, padding, height-padding-frameHeight, scale)
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// writeFrame draws n at x, y and its children side by side above it.
+func writeFrame(w io.Writer, n *Node, total int64, unit string, x float64, y int, scale float64) {
+	fw := float64(n.Value) * scale
+	if fw < minWidth {
+		return
+	}
+	name := html.EscapeString(n.Name)
+	fmt.Fprintf(w, `<g><title>%s (%s, %.2f%%)</title><rect x="%.1f" y="%d" width="%.1f" height="%d" rx="2" fill="%s"/>`,
+		name, format(n.Value, unit), 100*float64(n.Value)/float64(total), x, y, fw, frameHeight-1, color(n.Name))
+	if label := fit(n.Name, fw); label != "" {
+		fmt.Fprintf(w, `<text x="%.1f" y="%d">%s</text>`, x+3, y+frameHeight-4, html.EscapeString(label))
+	}
+	fmt.Fprintln(w, "</g>")
+	for _, c := range n.Children {
+		writeFrame(w, c, total, unit, x, y-frameHeight, scale)
+		x += float64(c.Value) * scale
+	}
+}
+
+// fit shortens name to the characters that fit in a frame width px wide,
+// or nothing when not even a few do.
+func fit(name string, px float64) string {
+	chars := int((px - 6) / charWidth)
+	r := []rune(name)
+	switch {
+	case chars < 3:
+		return ""
+	case len(r) <= chars:
+		return name
+	}
+	return string(r[:chars-2]) + ".."
+}
+
+// color picks a warm color from the frame's name, so a function keeps its
+// color across graphs.
+func color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, (v>>8)%230, (v>>16)%55)
+}
+
+func describe(unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return "time on the CPU"
+	case "bytes":
+		return "memory"
+	}
+	return "samples"
+}
+
+func format(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return fmt.Sprintf("%.2fms", float64(v)/1e6)
+	case "bytes":
+		return fmt.Sprintf("%.2fkB", float64(v)/(1<<10))
+	}
+	return fmt.Sprintf("%d %s", v, unit)
+}
@@ -0,0 +1,195 @@
+// Package goroutinediff compares two goroutine profiles of one process,
+// taken some time apart, and reports where the goroutine count grew:
+// grouped by the value of a profile label, such as the route whose handler
+// started the goroutines, and within a group by the function each goroutine
+// started in. In a busy process the total moves with the load; a group that
+// keeps growing while the others hold steady is where goroutines leak.
+//
+// Goroutines inherit the labels of the goroutine that starts them, so a
+// goroutine started by a labeled handler is counted under that handler for
+// as long as it lives.
+package goroutinediff
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Site is the function a goroutine started in, the outermost frame of its
+// stack: the function or closure named by its go statement.
+type Site struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int64  `json:"line"`
+}
+
+func (s Site) String() string {
+	return fmt.Sprintf("%s (%s:%d)", s.Function, shortFile(s.File), s.Line)
+}
+
+// SiteDiff is the change in the goroutines started in one site.
+type SiteDiff struct {
+	Site   Site  `json:"site"`
+	Before int64 `json:"before"`
+	After  int64 `json:"after"`
+	Growth int64 `json:"growth"`
+	// Stack is the call stack of one of the goroutines, innermost first,
+	// from the later profile if the site is still in it.
+	Stack []string `json:"stack"`
+}
+
+// Group is the change in the goroutines with one value of the label.
+type Group struct {
+	// Label is the value of the label, empty for goroutines without it.
+	Label  string     `json:"label"`
+	Before int64      `json:"before"`
+	After  int64      `json:"after"`
+	Growth int64      `json:"growth"`
+	Sites  []SiteDiff `json:"sites"`
+}
+
+// Report ranks groups by growth, highest first, and the sites within each
+// group the same way.
+type Report struct {
+	Label    string        `json:"label"`
+	Interval time.Duration `json:"interval_ns"`
+	Before   int64         `json:"before"`
+	After    int64         `json:"after"`
+	Groups   []Group       `json:"groups"`
+}
+
+type key struct {
+	label string
+	site  Site
+}
+
+// Diff compares the goroutine profiles before and after, grouping their
+// goroutines by the value of label.
+func Diff(before, after *profile.Profile, label string) (*Report, error) {
+	report := &Report{Label: label}
+	if before.TimeNanos > 0 && after.TimeNanos > 0 {
+		report.Interval = time.Duration(after.TimeNanos - before.TimeNanos)
+	}
+
+	diffs := make(map[key]*SiteDiff)
+	for i, p := range []*profile.Profile{before, after} {
+		if len(p.SampleType) != 1 || p.SampleType[0].Type != "goroutine" {
+			return nil, fmt.Errorf("goroutinediff: not a goroutine profile")
+		}
+		for _, s := range p.Sample {
+			site, stack := siteOf(s)
+			k := key{label: strings.Join(s.Label[label], ","), site: site}
+			d := diffs[k]
+			if d == nil {
+				d = &SiteDiff{Site: site}
+				diffs[k] = d
+			}
+			n := s.Value[0]
+			if i == 0 {
+				d.Before += n
+				report.Before += n
+				if d.Stack == nil {
+					d.Stack = stack
+				}
+			} else {
+				d.After += n
+				report.After += n
+				d.Stack = stack
+			}
+		}
+	}
+
+	groups := make(map[string]*Group)
+	for k, d := range diffs {
+		d.Growth = d.After - d.Before
+		g := groups[k.label]
+		if g == nil {
+			g = &Group{Label: k.label}
+			groups[k.label] = g
+		}
+		g.Before += d.Before
+		g.After += d.After
+		g.Growth += d.Growth
+		g.Sites = append(g.Sites, *d)
+	}
+	for _, g := range groups {
+		slices.SortFunc(g.Sites, func(a, b SiteDiff) int {
+			return cmp.Or(cmp.Compare(b.Growth, a.Growth), cmp.Compare(b.After, a.After),
+				strings.Compare(a.Site.Function, b.Site.Function), cmp.Compare(a.Site.Line, b.Site.Line))
+		})
+		report.Groups = append(report.Groups, *g)
+	}
+	slices.SortFunc(report.Groups, func(a, b Group) int {
+		return cmp.Or(cmp.Compare(b.Growth, a.Growth), cmp.Compare(b.After, a.After), strings.Compare(a.Label, b.Label))
+	})
+	return report, nil
+}
+
+func siteOf(s *profile.Sample) (Site, []string) {
+	var (
+		site  Site
+		stack []string
+	)
+	for _, loc := range s.Location {
+		// Inlined frames are listed innermost first within a location.
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			fn := line.Function.Name
+			stack = append(stack, fmt.Sprintf("%s (%s:%d)", fn, shortFile(line.Function.Filename), line.Line))
+			site = Site{Function: fn, File: line.Function.Filename, Line: line.Line}
+		}
+	}
+	if site.Function == "" {
+		site.Function = "(unknown)"
+	}
+	return site, stack
+}
+
+func shortFile(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		if j := strings.LastIndex(path[:i], "/"); j >= 0 {
+			return path[j+1:]
+		}
+	}
+	return path
+}
+
+// WriteText prints the sites of the groups that grew or shrank, the top n
+// groups of them (all if n <= 0), as an aligned table.
+func (r *Report) WriteText(w io.Writer, n int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Goroutines: %d -> %d (%+d) over %s, by label %q\n\n",
+		r.Before, r.After, r.After-r.Before, r.Interval.Round(time.Millisecond), r.Label)
+	fmt.Fprintf(tw, "GROWTH\tBEFORE\tAFTER\t%s\tSTARTED IN\n", strings.ToUpper(r.Label))
+	shown, unchanged := 0, 0
+	for _, g := range r.Groups {
+		if g.Growth == 0 {
+			unchanged++
+			continue
+		}
+		if n > 0 && shown == n {
+			continue
+		}
+		shown++
+		label := g.Label
+		if label == "" {
+			label = "-"
+		}
+		for _, s := range g.Sites {
+			fmt.Fprintf(tw, "%+d\t%d\t%d\t%s\t%s\n", s.Growth, s.Before, s.After, label, s.Site)
+		}
+	}
+	if unchanged > 0 {
+		fmt.Fprintf(tw, "\nUnchanged groups: %d\n", unchanged)
+	}
+	return tw.Flush()
+}
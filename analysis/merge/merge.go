@@ -0,0 +1,74 @@
+// Package merge combines many profiles of the same kind into one, turning
+// selected sample labels into pseudo-frames at the root of every stack. A
+// day of CPU profiles labelled by handler then renders as one flame graph
+// with a subtree per route.
+package merge
+
+import (
+	"errors"
+
+	"github.com/google/pprof/profile"
+)
+
+// Missing is the pseudo-frame value for samples without a grouped label.
+const Missing = "(none)"
+
+// Options configures Merge.
+type Options struct {
+	// GroupBy lists the string labels to turn into root frames, outermost
+	// first.
+	GroupBy []string
+}
+
+// Merge merges profiles, which must share sample and period types, and
+// adds a "label=value" frame for each GroupBy label at the root of every
+// sample. Labels are kept on the samples either way, so pprof's -tagfocus
+// and -tagroot still work on the result.
+func Merge(profiles []*profile.Profile, opts Options) (*profile.Profile, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("merge: no profiles")
+	}
+	p, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.GroupBy) == 0 {
+		return p, nil
+	}
+
+	var nextLoc, nextFn uint64
+	for _, l := range p.Location {
+		nextLoc = max(nextLoc, l.ID)
+	}
+	for _, f := range p.Function {
+		nextFn = max(nextFn, f.ID)
+	}
+
+	frames := make(map[string]*profile.Location)
+	frame := func(name string) *profile.Location {
+		if loc, ok := frames[name]; ok {
+			return loc
+		}
+		nextLoc++
+		nextFn++
+		fn := &profile.Function{ID: nextFn, Name: name, SystemName: name}
+		loc := &profile.Location{ID: nextLoc, Line: []profile.Line{{Function: fn}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		frames[name] = loc
+		return loc
+	}
+
+	for _, s := range p.Sample {
+		// Locations are leaf first, so the outermost label goes last.
+		for i := len(opts.GroupBy) - 1; i >= 0; i-- {
+			key := opts.GroupBy[i]
+			value := Missing
+			if vs := s.Label[key]; len(vs) > 0 {
+				value = vs[0]
+			}
+			s.Location = append(s.Location, frame(key+"="+value))
+		}
+	}
+	return p, p.CheckValid()
+}
@@ -0,0 +1,177 @@
+// Package offcpu turns the output of an eBPF off-CPU sampler into a pprof
+// profile. Off-CPU time is the wall time a thread spent blocked in the
+// kernel: in a syscall, a page fault, a futex, or waiting for I/O. The Go
+// block and mutex profiles only see goroutines waiting on Go channels and
+// locks; a thread stuck in read(2) on a slow disk, in a cgo call, or on a
+// page fault shows up only here.
+//
+// The samplers are external tools, such as BCC's offcputime, that print
+// folded stacks. Stacks they could not symbolize (stripped binaries, raw
+// addresses) are looked up in the Go symbol table of the target binary, and
+// Go frames get their file and line, so the profile reads like a runtime
+// one in go tool pprof.
+package offcpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Stack is one line of folded output.
+type Stack struct {
+	// Thread is the name of the thread (comm) that blocked.
+	Thread string
+	// User and Kernel are the frames, outermost first.
+	User, Kernel []string
+	// Value is the time blocked, in microseconds.
+	Value int64
+}
+
+// kernelDelimiter separates the user frames from the kernel frames in
+// offcputime -d output.
+const kernelDelimiter = "-"
+
+// ParseFolded reads folded stacks, one per line:
+//
+//	comm;user outermost;...;user innermost;-;kernel outermost;...;kernel innermost 1234
+//
+// Without the "-" delimiter every frame is taken as a user frame.
+func ParseFolded(r io.Reader) ([]Stack, error) {
+	var stacks []Stack
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("offcpu: line %d: no value", n)
+		}
+		v, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("offcpu: line %d: invalid value %q", n, line[i+1:])
+		}
+		frames := strings.Split(line[:i], ";")
+		st := Stack{Thread: frames[0], Value: v}
+		frames = frames[1:]
+		for j, f := range frames {
+			if f == kernelDelimiter {
+				st.User, st.Kernel = frames[:j], frames[j+1:]
+				break
+			}
+		}
+		if st.User == nil && st.Kernel == nil {
+			st.User = frames
+		}
+		stacks = append(stacks, st)
+	}
+	return stacks, sc.Err()
+}
+
+// idleFrames are Go runtime functions that park an idle thread. A Go
+// program's threads spend most of their off-CPU time here, waiting for
+// goroutines to run, which says nothing about what the program waited for.
+var idleFrames = []string{"runtime.stopm", "runtime.sysmon", "runtime.templateThread"}
+
+func idle(s *profile.Sample) bool {
+	for _, loc := range s.Location {
+		if slices.Contains(idleFrames, loc.Line[0].Function.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Options configure ToProfile.
+type Options struct {
+	// Symbols resolves the user frames; nil leaves them as the tool printed
+	// them.
+	Symbols *Symbolizer
+	// Duration is how long the sampler ran.
+	Duration time.Duration
+	// KeepIdle keeps the stacks of idle runtime threads, which are
+	// otherwise dropped.
+	KeepIdle bool
+}
+
+// ToProfile builds a pprof profile of the stacks, with the time blocked as
+// its off_cpu/microseconds sample type and the thread name as a "thread"
+// label. Kernel frames come from a [kernel] mapping.
+func ToProfile(stacks []Stack, opts Options) *profile.Profile {
+	p := &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "off_cpu", Unit: "microseconds"}},
+		PeriodType:    &profile.ValueType{Type: "off_cpu", Unit: "microseconds"},
+		Period:        1,
+		TimeNanos:     time.Now().Add(-opts.Duration).UnixNano(),
+		DurationNanos: opts.Duration.Nanoseconds(),
+	}
+	exe := &profile.Mapping{ID: 1, File: "[user]"}
+	if opts.Symbols != nil {
+		exe.File = opts.Symbols.Path
+		exe.HasFunctions, exe.HasFilenames, exe.HasLineNumbers = true, true, true
+	}
+	kernel := &profile.Mapping{ID: 2, File: "[kernel]", HasFunctions: true}
+	p.Mapping = []*profile.Mapping{exe, kernel}
+
+	functions := make(map[string]*profile.Function)
+	locations := make(map[string]*profile.Location)
+	location := func(frame string, m *profile.Mapping) *profile.Location {
+		name, file, line := frame, "", 0
+		if m == exe && opts.Symbols != nil {
+			if n, f, l, ok := opts.Symbols.Lookup(frame); ok {
+				name, file, line = n, f, l
+			}
+		}
+		key := fmt.Sprintf("%d\x00%s\x00%d", m.ID, name, line)
+		if loc, ok := locations[key]; ok {
+			return loc
+		}
+		loc := &profile.Location{
+			ID:      uint64(len(p.Location) + 1),
+			Mapping: m,
+			Line:    []profile.Line{{Function: function(functions, p, name, file), Line: int64(line)}},
+		}
+		p.Location = append(p.Location, loc)
+		locations[key] = loc
+		return loc
+	}
+
+	for _, st := range stacks {
+		s := &profile.Sample{
+			Value: []int64{st.Value},
+			Label: map[string][]string{"thread": {st.Thread}},
+		}
+		// pprof wants the innermost frame first.
+		for i := len(st.Kernel) - 1; i >= 0; i-- {
+			s.Location = append(s.Location, location(st.Kernel[i], kernel))
+		}
+		for i := len(st.User) - 1; i >= 0; i-- {
+			s.Location = append(s.Location, location(st.User[i], exe))
+		}
+		if !opts.KeepIdle && idle(s) {
+			continue
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	// Compact drops the locations only idle stacks used.
+	return p.Compact()
+}
+
+func function(functions map[string]*profile.Function, p *profile.Profile, name, file string) *profile.Function {
+	if fn, ok := functions[name]; ok {
+		return fn
+	}
+	fn := &profile.Function{ID: uint64(len(p.Function) + 1), Name: name, SystemName: name, Filename: file}
+	p.Function = append(p.Function, fn)
+	functions[name] = fn
+	return fn
+}
@@ -0,0 +1,96 @@
+package offcpu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Sampler records the off-CPU stacks of a process for a while.
+type Sampler interface {
+	Sample(ctx context.Context, pid int, d time.Duration) ([]Stack, error)
+}
+
+// BCC samples with BCC's offcputime, which needs root or CAP_BPF and
+// CAP_PERFMON. It is packaged as offcputime-bpfcc on Debian and Ubuntu and
+// lives in /usr/share/bcc/tools on Fedora.
+type BCC struct {
+	// Path is the offcputime script; empty looks for it on PATH and in
+	// /usr/share/bcc/tools.
+	Path string
+	// MinBlock ignores blocks shorter than this, which keeps the many short
+	// futex waits of a busy program out of the profile. Zero keeps all.
+	MinBlock time.Duration
+	// UserOnly drops the kernel frames.
+	UserOnly bool
+}
+
+// bccNames are where distributions install offcputime.
+var bccNames = []string{"offcputime", "offcputime-bpfcc", "/usr/share/bcc/tools/offcputime"}
+
+func (b BCC) Sample(ctx context.Context, pid int, d time.Duration) ([]Stack, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("offcpu: eBPF needs Linux: %w", errors.ErrUnsupported)
+	}
+	path := b.Path
+	if path == "" {
+		for _, name := range bccNames {
+			if p, err := exec.LookPath(name); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("offcpu: offcputime not found, install BCC (bpfcc-tools) or set the path")
+		}
+	}
+	// -f prints folded stacks, -d puts "-" between user and kernel frames.
+	args := []string{path, "-f", "-d", "-p", strconv.Itoa(pid)}
+	if b.UserOnly {
+		args = append(args, "-U")
+	}
+	if b.MinBlock > 0 {
+		args = append(args, "-m", strconv.FormatInt(b.MinBlock.Microseconds(), 10))
+	}
+	args = append(args, strconv.Itoa(seconds(d)))
+	return run(ctx, args)
+}
+
+// Command samples with any tool that prints folded stacks with the time
+// blocked in microseconds, such as a bpftrace script. Every {pid} and
+// {seconds} in Args is replaced with the target and the duration.
+type Command struct {
+	Args []string
+}
+
+func (c Command) Sample(ctx context.Context, pid int, d time.Duration) ([]Stack, error) {
+	if len(c.Args) == 0 {
+		return nil, errors.New("offcpu: empty command")
+	}
+	r := strings.NewReplacer("{pid}", strconv.Itoa(pid), "{seconds}", strconv.Itoa(seconds(d)))
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = r.Replace(a)
+	}
+	return run(ctx, args)
+}
+
+func seconds(d time.Duration) int {
+	return max(int(d.Round(time.Second).Seconds()), 1)
+}
+
+func run(ctx context.Context, args []string) ([]Stack, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("offcpu: %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return ParseFolded(&stdout)
+}
@@ -0,0 +1,135 @@
+package offcpu
+
+import (
+	"bufio"
+	"debug/elf"
+	"debug/gosym"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Symbolizer resolves frames of a running Go process with the symbol table
+// the Go linker writes into every binary (.gopclntab), which survives
+// stripping. It reads the binary through /proc/PID/exe, so it works when the
+// file has been replaced or deleted since the process started.
+type Symbolizer struct {
+	// Path is the binary the process runs.
+	Path  string
+	table *gosym.Table
+	// bias is where a position-independent binary was loaded, relative to
+	// the addresses in its symbol table.
+	bias uint64
+}
+
+// NewSymbolizer reads the symbol table of process pid.
+func NewSymbolizer(pid int) (*Symbolizer, error) {
+	exe := fmt.Sprintf("/proc/%d/exe", pid)
+	path, err := os.Readlink(exe)
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pclntab := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("offcpu: %s: no Go symbol table", path)
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, fmt.Errorf("offcpu: %s: %w", path, err)
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("offcpu: %s: %w", path, err)
+	}
+	s := &Symbolizer{Path: path, table: table}
+	if f.Type == elf.ET_DYN {
+		if s.bias, err = loadBias(pid, path, f); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loadBias finds where the first segment of the binary is mapped in
+// /proc/PID/maps and returns how far that is from its link address.
+func loadBias(pid int, path string, f *elf.File) (uint64, error) {
+	var first *elf.Prog
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Off == 0 {
+			first = p
+			break
+		}
+	}
+	if first == nil {
+		return 0, fmt.Errorf("offcpu: %s: no loadable segment at offset 0", path)
+	}
+	maps, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer maps.Close()
+	// 55d0c2a00000-55d0c2b4c000 r--p 00000000 fd:01 1234 /usr/local/bin/app
+	sc := bufio.NewScanner(maps)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[2] != "00000000" || filepath.Clean(fields[5]) != path {
+			continue
+		}
+		start, _, _ := strings.Cut(fields[0], "-")
+		addr, err := strconv.ParseUint(start, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("offcpu: maps: %w", err)
+		}
+		return addr - first.Vaddr&^(first.Align-1), nil
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("offcpu: %s is not mapped in process %d", path, pid)
+}
+
+// Lookup resolves a frame as a sampler printed it: a raw address
+// ("0x4a3b2c"), a function and offset ("main.handler+0x1f"), or a function
+// name. It reports false for frames that are not in the binary, such as
+// "[unknown]" or a libc function.
+func (s *Symbolizer) Lookup(frame string) (name, file string, line int, ok bool) {
+	if hex, ok := strings.CutPrefix(frame, "0x"); ok {
+		pc, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return "", "", 0, false
+		}
+		// Every user frame of an off-CPU stack is a return address, the
+		// instruction after the call or syscall; the one before is the line
+		// that waited.
+		return s.pc(pc - s.bias - 1)
+	}
+	fname, off, _ := strings.Cut(frame, "+")
+	fn := s.table.LookupFunc(fname)
+	if fn == nil {
+		return "", "", 0, false
+	}
+	if off != "" {
+		if o, err := strconv.ParseUint(strings.TrimPrefix(off, "0x"), 16, 64); err == nil {
+			return s.pc(fn.Entry + max(o, 1) - 1)
+		}
+	}
+	file, line, _ = s.table.PCToLine(fn.Entry)
+	return fn.Name, file, line, true
+}
+
+func (s *Symbolizer) pc(pc uint64) (name, file string, line int, ok bool) {
+	file, line, fn := s.table.PCToLine(pc)
+	if fn == nil {
+		return "", "", 0, false
+	}
+	return fn.Name, file, line, true
+}
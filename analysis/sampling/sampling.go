@@ -0,0 +1,113 @@
+// Package sampling measures how faithful CPU profiles are at a given sampling
+// rate and stack depth: how many samples arrived compared to how many were
+// due, how many stacks the runtime truncated, and what enabling the profiler
+// cost in wall time.
+package sampling
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// StackLimit is the number of frames the runtime records per CPU profile
+// sample; deeper stacks are cut off at the outermost end.
+const StackLimit = 64
+
+// Fidelity summarizes the samples of one CPU profile.
+type Fidelity struct {
+	Samples   int64   `json:"samples"`
+	Truncated int64   `json:"truncated"`
+	MaxDepth  int     `json:"max_depth"`
+	MeanDepth float64 `json:"mean_depth"`
+}
+
+// TruncatedShare is the fraction of samples whose stack hit StackLimit.
+func (f Fidelity) TruncatedShare() float64 {
+	if f.Samples == 0 {
+		return 0
+	}
+	return float64(f.Truncated) / float64(f.Samples)
+}
+
+// Analyze counts the samples of a CPU profile. The cpu values are ignored:
+// runtime/pprof records them at its default 100 Hz period whatever rate was
+// really in effect. Stack depth counts locations, which is what the runtime's
+// depth limit applies to.
+func Analyze(p *profile.Profile) (Fidelity, error) {
+	countIdx := -1
+	for i, st := range p.SampleType {
+		if st.Type == "samples" {
+			countIdx = i
+		}
+	}
+	if countIdx < 0 {
+		return Fidelity{}, fmt.Errorf("sampling: profile has no samples values")
+	}
+
+	var f Fidelity
+	var depthSum int64
+	for _, s := range p.Sample {
+		n := s.Value[countIdx]
+		f.Samples += n
+		f.MaxDepth = max(f.MaxDepth, len(s.Location))
+		depthSum += n * int64(len(s.Location))
+		if len(s.Location) >= StackLimit {
+			f.Truncated += n
+		}
+	}
+	if f.Samples > 0 {
+		f.MeanDepth = float64(depthSum) / float64(f.Samples)
+	}
+	return f, nil
+}
+
+// Cell is one measured combination of sampling rate and stack depth. The
+// same fixed amount of work runs once without and once with the profiler.
+type Cell struct {
+	Rate     int           `json:"rate_hz"`
+	Depth    int           `json:"depth"`
+	Baseline time.Duration `json:"baseline_ns"`
+	Profiled time.Duration `json:"profiled_ns"`
+	Fidelity Fidelity      `json:"fidelity"`
+}
+
+// Overhead is the extra wall time of the profiled run, as a fraction of the
+// baseline.
+func (c Cell) Overhead() float64 {
+	if c.Baseline == 0 {
+		return 0
+	}
+	return float64(c.Profiled-c.Baseline) / float64(c.Baseline)
+}
+
+// Expected is the number of samples due for a single busy goroutine running
+// the profiled work at Rate.
+func (c Cell) Expected() int64 {
+	return int64(c.Profiled.Seconds() * float64(c.Rate))
+}
+
+// Captured is the fraction of expected samples that arrived.
+func (c Cell) Captured() float64 {
+	if e := c.Expected(); e > 0 {
+		return float64(c.Fidelity.Samples) / float64(e)
+	}
+	return 0
+}
+
+// WriteText writes the cells as a table.
+func WriteText(w io.Writer, cells []Cell) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "RATE\tDEPTH\tBASELINE\tPROFILED\tOVERHEAD\tSAMPLES\tEXPECTED\tCAPTURED\tTRUNCATED\tMAX DEPTH\t")
+	for _, c := range cells {
+		fmt.Fprintf(tw, "%d Hz\t%d\t%s\t%s\t%+.1f%%\t%d\t%d\t%.1f%%\t%.1f%%\t%d\t\n",
+			c.Rate, c.Depth,
+			c.Baseline.Round(time.Millisecond), c.Profiled.Round(time.Millisecond),
+			100*c.Overhead(), c.Fidelity.Samples, c.Expected(),
+			100*c.Captured(), 100*c.Fidelity.TruncatedShare(), c.Fidelity.MaxDepth)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,121 @@
+// Package speedscope converts pprof profiles into the speedscope file format
+// (https://www.speedscope.app/file-format-schema.json), which speedscope and
+// the Firefox Profiler can open as flame charts and sandwich views.
+package speedscope
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/pprof/profile"
+)
+
+const schema = "https://www.speedscope.app/file-format-schema.json"
+
+// File is a speedscope document.
+type File struct {
+	Schema             string    `json:"$schema"`
+	Name               string    `json:"name,omitempty"`
+	Exporter           string    `json:"exporter,omitempty"`
+	ActiveProfileIndex int       `json:"activeProfileIndex"`
+	Shared             Shared    `json:"shared"`
+	Profiles           []Profile `json:"profiles"`
+}
+
+// Shared holds the frames referenced by index from every profile.
+type Shared struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Frame is one function.
+type Frame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	Line int64  `json:"line,omitempty"`
+}
+
+// Profile is a sampled profile: each sample is a stack of frame indices,
+// outermost first, with a weight.
+type Profile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+// Convert turns every sample type of p into a speedscope profile. The
+// profile's default sample type is the one shown first.
+func Convert(p *profile.Profile, name string) *File {
+	f := &File{Schema: schema, Name: name, Exporter: "gosamurai"}
+
+	index := make(map[Frame]int)
+	frameOf := func(line profile.Line) int {
+		fr := Frame{Name: "?"}
+		if fn := line.Function; fn != nil {
+			fr = Frame{Name: fn.Name, File: fn.Filename, Line: fn.StartLine}
+		}
+		i, ok := index[fr]
+		if !ok {
+			i = len(f.Shared.Frames)
+			index[fr] = i
+			f.Shared.Frames = append(f.Shared.Frames, fr)
+		}
+		return i
+	}
+
+	stacks := make([][]int, len(p.Sample))
+	for i, s := range p.Sample {
+		// pprof lists locations innermost first, and the inlined lines of
+		// a location innermost first too; speedscope wants outermost first.
+		var stack []int
+		for l := len(s.Location) - 1; l >= 0; l-- {
+			lines := s.Location[l].Line
+			for j := len(lines) - 1; j >= 0; j-- {
+				stack = append(stack, frameOf(lines[j]))
+			}
+		}
+		stacks[i] = stack
+	}
+
+	for t, st := range p.SampleType {
+		prof := Profile{
+			Type: "sampled",
+			Name: fmt.Sprintf("%s (%s)", st.Type, st.Unit),
+			Unit: unit(st.Unit),
+		}
+		for i, s := range p.Sample {
+			if s.Value[t] == 0 {
+				continue
+			}
+			prof.Samples = append(prof.Samples, stacks[i])
+			prof.Weights = append(prof.Weights, s.Value[t])
+			prof.EndValue += s.Value[t]
+		}
+		if st.Type == p.DefaultSampleType {
+			f.ActiveProfileIndex = t
+		}
+		f.Profiles = append(f.Profiles, prof)
+	}
+	if p.DefaultSampleType == "" && len(f.Profiles) > 0 {
+		f.ActiveProfileIndex = len(f.Profiles) - 1
+	}
+	return f
+}
+
+// Write encodes f as JSON.
+func (f *File) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(f)
+}
+
+func unit(pprofUnit string) string {
+	switch pprofUnit {
+	case "nanoseconds", "microseconds", "milliseconds", "seconds", "bytes":
+		return pprofUnit
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,128 @@
+// Package top ranks the functions of a profile by their own (flat) value,
+// as go tool pprof -top does, for a quick read without launching pprof.
+package top
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Entry is one function's flat and cumulative value.
+type Entry struct {
+	Function string `json:"function"`
+	Flat     int64  `json:"flat"`
+	Cum      int64  `json:"cum"`
+}
+
+// Report lists the functions of one sample type, largest flat value first.
+type Report struct {
+	SampleType string  `json:"sample_type"`
+	Unit       string  `json:"unit"`
+	Total      int64   `json:"total"`
+	Entries    []Entry `json:"entries"`
+}
+
+// Compute ranks the functions of p by the values of sampleType, such as
+// "cpu" or "inuse_space"; empty picks the profile's default sample type.
+func Compute(p *profile.Profile, sampleType string) (*Report, error) {
+	idx := -1
+	if sampleType == "" {
+		sampleType = p.DefaultSampleType
+	}
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		if sampleType != "" || len(p.SampleType) == 0 {
+			return nil, fmt.Errorf("top: profile has no %q samples", sampleType)
+		}
+		idx = len(p.SampleType) - 1
+	}
+
+	r := &Report{SampleType: p.SampleType[idx].Type, Unit: p.SampleType[idx].Unit}
+	flat := make(map[string]int64)
+	cum := make(map[string]int64)
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		r.Total += v
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				fn := line.Function.Name
+				// The first line of the first location is the innermost
+				// frame; inlined calls come before their callers.
+				if i == 0 && j == 0 {
+					flat[fn] += v
+				}
+				if !seen[fn] {
+					seen[fn] = true
+					cum[fn] += v
+				}
+			}
+		}
+	}
+	for fn, c := range cum {
+		// Heap profiles keep samples of objects since freed, with no
+		// in-use value; pprof leaves them out too.
+		if c == 0 {
+			continue
+		}
+		r.Entries = append(r.Entries, Entry{Function: fn, Flat: flat[fn], Cum: c})
+	}
+	slices.SortFunc(r.Entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(b.Flat, a.Flat), cmp.Compare(b.Cum, a.Cum), cmp.Compare(a.Function, b.Function))
+	})
+	return r, nil
+}
+
+// WriteText writes the n functions with the largest flat value as a table
+// (all for n <= 0), in the layout of go tool pprof -top.
+func (r *Report) WriteText(w io.Writer, n int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s total %s\n", r.SampleType, r.format(r.Total))
+	fmt.Fprintln(tw, "FLAT\tFLAT%\tCUM\tCUM%\t\tFUNCTION")
+	for i, e := range r.Entries {
+		if n > 0 && i == n {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\t%s\n", r.format(e.Flat), r.percent(e.Flat), r.format(e.Cum), r.percent(e.Cum), e.Function)
+	}
+	return tw.Flush()
+}
+
+func (r *Report) percent(v int64) string {
+	if r.Total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(v)/float64(r.Total))
+}
+
+// format writes v in the report's unit: a duration, a size, or a count.
+func (r *Report) format(v int64) string {
+	switch r.Unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Microsecond).String()
+	case "bytes":
+		switch {
+		case v >= 1<<30:
+			return fmt.Sprintf("%.2fGB", float64(v)/(1<<30))
+		case v >= 1<<20:
+			return fmt.Sprintf("%.2fMB", float64(v)/(1<<20))
+		case v >= 1<<10:
+			return fmt.Sprintf("%.2fkB", float64(v)/(1<<10))
+		}
+		return fmt.Sprintf("%dB", v)
+	}
+	return fmt.Sprint(v)
+}
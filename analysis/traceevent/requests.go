@@ -0,0 +1,82 @@
+package traceevent
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// pidRequests is the process ID of the request rows.
+const pidRequests = 3
+
+// Request is an archived request as served by the webpprof example's
+// /debug/requests/{id} endpoint.
+type Request struct {
+	ID        string                   `json:"id"`
+	Method    string                   `json:"method"`
+	Path      string                   `json:"path"`
+	Status    int                      `json:"status"`
+	Start     time.Time                `json:"start"`
+	Duration  time.Duration            `json:"duration_ns"`
+	Timings   []Phase                  `json:"timings"`
+	Breakdown map[string]time.Duration `json:"breakdown_ns"`
+}
+
+// Phase is a named part of a request, offset from the request start.
+type Phase struct {
+	Name     string        `json:"name"`
+	Start    time.Duration `json:"start_ns"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// FromRequests lays archived requests out on a timeline: each request is a
+// span with its phases nested inside, and overlapping requests are spread
+// over as many rows as needed. Timestamps are relative to the earliest
+// request.
+func FromRequests(reqs []Request) *File {
+	f := newFile()
+	if len(reqs) == 0 {
+		return f
+	}
+	f.nameProcess(pidRequests, "Requests")
+
+	reqs = slices.Clone(reqs)
+	slices.SortFunc(reqs, func(a, b Request) int { return a.Start.Compare(b.Start) })
+	origin := reqs[0].Start
+
+	var lanes []time.Time // end of the last request placed in each row
+	for _, r := range reqs {
+		end := r.Start.Add(r.Duration)
+		lane := slices.IndexFunc(lanes, func(busy time.Time) bool { return !busy.After(r.Start) })
+		if lane < 0 {
+			lane = len(lanes)
+			lanes = append(lanes, end)
+			f.nameThread(pidRequests, int64(lane), fmt.Sprintf("lane %d", lane))
+		} else {
+			lanes[lane] = end
+		}
+
+		args := map[string]any{"id": r.ID, "status": r.Status}
+		for name, d := range r.Breakdown {
+			args[name] = d.String()
+		}
+		start := r.Start.Sub(origin)
+		f.add(Event{
+			Name: r.Method + " " + r.Path, Cat: "request", Phase: PhaseComplete,
+			Ts: micros(start), Dur: micros(r.Duration),
+			Pid: pidRequests, Tid: int64(lane), Args: args,
+		})
+
+		phases := slices.Clone(r.Timings)
+		slices.SortFunc(phases, func(a, b Phase) int { return cmp.Compare(a.Start, b.Start) })
+		for _, p := range phases {
+			f.add(Event{
+				Name: p.Name, Cat: "phase", Phase: PhaseComplete,
+				Ts: micros(start + p.Start), Dur: micros(p.Duration),
+				Pid: pidRequests, Tid: int64(lane),
+			})
+		}
+	}
+	return f
+}
@@ -0,0 +1,232 @@
+package traceevent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/trace"
+)
+
+// Process IDs of the runtime trace rows.
+const (
+	pidGoroutines = 1
+	pidProcs      = 2
+)
+
+// tidRuntime is the row of globally scoped ranges such as GC phases.
+const tidRuntime = 0
+
+type region struct {
+	name  string
+	start trace.Time
+}
+
+type converter struct {
+	f     *File
+	start trace.Time
+	last  trace.Time
+
+	running map[trace.GoID]trace.Time
+	regions map[trace.GoID][]region
+	ranges  map[trace.ResourceID]map[string]trace.Time
+	named   map[trace.GoID]bool
+}
+
+// FromRuntimeTrace converts an execution trace, as written by runtime/trace
+// or fetched from /debug/pprof/trace, into trace events. Each goroutine gets
+// a row showing when it ran, with its regions nested below and its log
+// messages as instant events. Tasks become async spans, runtime metrics
+// become counters, and GC and other runtime ranges get their own rows.
+func FromRuntimeTrace(r io.Reader) (*File, error) {
+	tr, err := trace.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("traceevent: %w", err)
+	}
+	c := &converter{
+		f:       newFile(),
+		start:   -1,
+		running: make(map[trace.GoID]trace.Time),
+		regions: make(map[trace.GoID][]region),
+		ranges:  make(map[trace.ResourceID]map[string]trace.Time),
+		named:   make(map[trace.GoID]bool),
+	}
+	c.f.nameProcess(pidGoroutines, "Goroutines")
+	c.f.nameProcess(pidProcs, "Procs")
+	c.f.nameThread(pidGoroutines, tidRuntime, "Runtime")
+
+	for {
+		ev, err := tr.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("traceevent: %w", err)
+		}
+		c.event(ev)
+	}
+	c.finish()
+	return c.f, nil
+}
+
+func (c *converter) ts(t trace.Time) float64 {
+	return micros(t.Sub(c.start))
+}
+
+func (c *converter) event(ev trace.Event) {
+	t := ev.Time()
+	if c.start < 0 {
+		c.start = t
+	}
+	c.last = t
+
+	switch ev.Kind() {
+	case trace.EventStateTransition:
+		c.transition(ev)
+	case trace.EventRegionBegin:
+		g := ev.Goroutine()
+		c.regions[g] = append(c.regions[g], region{ev.Region().Type, t})
+	case trace.EventRegionEnd:
+		g := ev.Goroutine()
+		stack := c.regions[g]
+		if len(stack) == 0 {
+			return // began before the trace did
+		}
+		reg := stack[len(stack)-1]
+		c.regions[g] = stack[:len(stack)-1]
+		c.f.add(Event{
+			Name: reg.name, Cat: "region", Phase: PhaseComplete,
+			Ts: c.ts(reg.start), Dur: micros(t.Sub(reg.start)),
+			Pid: pidGoroutines, Tid: int64(g),
+		})
+	case trace.EventTaskBegin, trace.EventTaskEnd:
+		task := ev.Task()
+		ph := PhaseAsyncBegin
+		if ev.Kind() == trace.EventTaskEnd {
+			ph = PhaseAsyncEnd
+		}
+		c.f.add(Event{
+			Name: task.Type, Cat: "task", Phase: ph, Ts: c.ts(t),
+			Pid: pidGoroutines, Tid: int64(ev.Goroutine()), ID: fmt.Sprint(task.ID),
+		})
+	case trace.EventLog:
+		log := ev.Log()
+		c.f.add(Event{
+			Name: log.Category, Cat: "log", Phase: PhaseInstant, Scope: "t", Ts: c.ts(t),
+			Pid: pidGoroutines, Tid: int64(ev.Goroutine()),
+			Args: map[string]any{"message": log.Message},
+		})
+	case trace.EventMetric:
+		m := ev.Metric()
+		if m.Value.Kind() == trace.ValueUint64 {
+			c.f.add(Event{
+				Name: m.Name, Cat: "metric", Phase: PhaseCounter, Ts: c.ts(t),
+				Pid: pidGoroutines, Args: map[string]any{"value": m.Value.Uint64()},
+			})
+		}
+	case trace.EventRangeBegin, trace.EventRangeActive:
+		rng := ev.Range()
+		if c.ranges[rng.Scope] == nil {
+			c.ranges[rng.Scope] = make(map[string]trace.Time)
+		}
+		if ev.Kind() == trace.EventRangeActive {
+			t = c.start // already running when the trace began
+		}
+		c.ranges[rng.Scope][rng.Name] = t
+	case trace.EventRangeEnd:
+		rng := ev.Range()
+		begin, ok := c.ranges[rng.Scope][rng.Name]
+		if !ok {
+			return
+		}
+		delete(c.ranges[rng.Scope], rng.Name)
+		c.emitRange(rng, begin, t)
+	}
+}
+
+func (c *converter) transition(ev trace.Event) {
+	st := ev.StateTransition()
+	if st.Resource.Kind != trace.ResourceGoroutine {
+		return
+	}
+	g := st.Resource.Goroutine()
+	from, to := st.Goroutine()
+
+	if !c.named[g] {
+		if name := startFunc(st.Stack); name != "" {
+			c.named[g] = true
+			c.f.nameThread(pidGoroutines, int64(g), fmt.Sprintf("G%d %s", g, name))
+		}
+	}
+
+	t := ev.Time()
+	switch {
+	case !from.Executing() && to.Executing():
+		c.running[g] = t
+	case from.Executing() && !to.Executing():
+		begin, ok := c.running[g]
+		if !ok {
+			begin = c.start
+		}
+		delete(c.running, g)
+		args := map[string]any{"to": to.String()}
+		if st.Reason != "" {
+			args["reason"] = st.Reason
+		}
+		c.f.add(Event{
+			Name: "running", Cat: "goroutine", Phase: PhaseComplete,
+			Ts: c.ts(begin), Dur: micros(t.Sub(begin)),
+			Pid: pidGoroutines, Tid: int64(g), Args: args,
+		})
+	}
+}
+
+func (c *converter) emitRange(rng trace.Range, begin, end trace.Time) {
+	e := Event{
+		Name: rng.Name, Cat: "runtime", Phase: PhaseComplete,
+		Ts: c.ts(begin), Dur: micros(end.Sub(begin)),
+		Pid: pidGoroutines, Tid: tidRuntime,
+	}
+	switch rng.Scope.Kind {
+	case trace.ResourceGoroutine:
+		e.Tid = int64(rng.Scope.Goroutine())
+	case trace.ResourceProc:
+		e.Pid, e.Tid = pidProcs, int64(rng.Scope.Proc())
+	}
+	c.f.add(e)
+}
+
+// finish closes everything still open when the trace ended.
+func (c *converter) finish() {
+	for g, begin := range c.running {
+		c.f.add(Event{
+			Name: "running", Cat: "goroutine", Phase: PhaseComplete,
+			Ts: c.ts(begin), Dur: micros(c.last.Sub(begin)),
+			Pid: pidGoroutines, Tid: int64(g),
+		})
+	}
+	for scope, open := range c.ranges {
+		for name, begin := range open {
+			c.emitRange(trace.Range{Name: name, Scope: scope}, begin, c.last)
+		}
+	}
+	for g, stack := range c.regions {
+		for _, reg := range stack {
+			c.f.add(Event{
+				Name: reg.name, Cat: "region", Phase: PhaseComplete,
+				Ts: c.ts(reg.start), Dur: micros(c.last.Sub(reg.start)),
+				Pid: pidGoroutines, Tid: int64(g),
+			})
+		}
+	}
+}
+
+// startFunc returns the outermost function of a goroutine's stack, which
+// names what the goroutine was started to do.
+func startFunc(s trace.Stack) string {
+	var name string
+	for frame := range s.Frames() {
+		name = frame.Func
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+// Package traceevent writes the Chrome trace-event JSON format, which
+// Perfetto (https://ui.perfetto.dev) and chrome://tracing open, from Go
+// runtime execution traces and from archived request timings.
+package traceevent
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Event is one trace event. Timestamps and durations are in microseconds.
+type Event struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Phase string         `json:"ph"`
+	Ts    float64        `json:"ts"`
+	Dur   float64        `json:"dur,omitempty"`
+	Pid   int            `json:"pid"`
+	Tid   int64          `json:"tid"`
+	ID    string         `json:"id,omitempty"`
+	Scope string         `json:"s,omitempty"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// Event phases used by this package.
+const (
+	PhaseComplete   = "X"
+	PhaseInstant    = "i"
+	PhaseCounter    = "C"
+	PhaseAsyncBegin = "b"
+	PhaseAsyncEnd   = "e"
+	PhaseMetadata   = "M"
+)
+
+// File is a trace-event document.
+type File struct {
+	TraceEvents     []Event `json:"traceEvents"`
+	DisplayTimeUnit string  `json:"displayTimeUnit"`
+}
+
+func newFile() *File {
+	return &File{DisplayTimeUnit: "ns"}
+}
+
+// Write encodes f as JSON.
+func (f *File) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(f)
+}
+
+func (f *File) add(e Event) {
+	f.TraceEvents = append(f.TraceEvents, e)
+}
+
+// nameProcess and nameThread label a row group and a row.
+func (f *File) nameProcess(pid int, name string) {
+	f.add(Event{Name: "process_name", Phase: PhaseMetadata, Pid: pid, Args: map[string]any{"name": name}})
+}
+
+func (f *File) nameThread(pid int, tid int64, name string) {
+	f.add(Event{Name: "thread_name", Phase: PhaseMetadata, Pid: pid, Tid: tid, Args: map[string]any{"name": name}})
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
@@ -0,0 +1,181 @@
+// Package wallclock profiles wall-clock time, on the CPU and off it, as
+// fgprof does: it samples the stack of every goroutine at a fixed rate, and
+// each stack gets a sample whether its goroutine was running, runnable,
+// sleeping, or blocked. The CPU profile only samples running goroutines, so
+// a program that spends its time in time.Sleep, on channels, or waiting for
+// the network looks idle there; here that time is charged to where it was
+// spent.
+//
+// A goroutine that slept the whole run has as much wall time as one that
+// computed for all of it, so the profile reads best focused on one
+// goroutine group, as go tool pprof -focus does.
+package wallclock
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// stack is one distinct goroutine stack, how often it was seen, and the
+// wall time charged to it.
+type stack struct {
+	pcs     []uintptr
+	count   int64
+	wall    time.Duration
+	sampler bool // the sampler's own goroutine, left out of the profile
+}
+
+// Sampler records a wall-clock profile.
+type Sampler struct {
+	hz int
+
+	mu      sync.Mutex
+	stacks  map[[32]uintptr]*stack
+	records []runtime.StackRecord
+	start   time.Time
+	end     time.Time
+}
+
+// NewSampler returns a sampler taking hz samples a second. Each sample stops
+// the world for a moment to read every stack, so the cost grows with the
+// number of goroutines; fgprof uses 99 Hz.
+func NewSampler(hz int) *Sampler {
+	return &Sampler{hz: max(hz, 1), stacks: make(map[[32]uintptr]*stack)}
+}
+
+// Period is the wall time one sample stands for.
+func (s *Sampler) Period() time.Duration {
+	return time.Second / time.Duration(s.hz)
+}
+
+// Run samples until ctx is done.
+func (s *Sampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Period())
+	defer ticker.Stop()
+
+	s.Sample()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.Sample()
+		}
+	}
+}
+
+// Sample records the stack of every goroutine now, charging each the wall
+// time since the previous sample, or one period for the first. Reading the
+// stacks waits for running goroutines to stop, so under load the sampler
+// falls behind its rate; charging the time that passed keeps the profile's
+// total at the wall time of the goroutines anyway. Stacks deeper than 32
+// frames are cut at the bottom, as they are in runtime.StackRecord.
+func (s *Sampler) Sample() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := runtime.GoroutineProfile(s.records)
+	for !ok {
+		// Room for goroutines started since the count was taken.
+		s.records = make([]runtime.StackRecord, n+n/4+8)
+		n, ok = runtime.GoroutineProfile(s.records)
+	}
+	now := time.Now()
+	dt := s.Period()
+	if s.start.IsZero() {
+		s.start = now
+	} else {
+		dt = now.Sub(s.end)
+	}
+	s.end = now
+	for _, r := range s.records[:n] {
+		st := s.stacks[r.Stack0]
+		if st == nil {
+			st = &stack{pcs: slices.Clone(r.Stack())}
+			st.sampler = slices.ContainsFunc(frames(st.pcs), func(f runtime.Frame) bool { return isSampler(f.Function) })
+			s.stacks[r.Stack0] = st
+		}
+		st.count++
+		st.wall += dt
+	}
+}
+
+// Profile returns the samples taken so far as a pprof profile with two
+// sample types: samples, the count, and wall, the time charged. Its start
+// and duration span the first sample to the last.
+func (s *Sampler) Profile() *profile.Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	period := s.Period().Nanoseconds()
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "wall", Unit: "nanoseconds"},
+		},
+		DefaultSampleType: "wall",
+		PeriodType:        &profile.ValueType{Type: "wall", Unit: "nanoseconds"},
+		Period:            period,
+	}
+	if !s.start.IsZero() {
+		p.TimeNanos = s.start.UnixNano()
+		p.DurationNanos = s.end.Sub(s.start).Nanoseconds()
+	}
+
+	type lineKey struct {
+		fn, file string
+		line     int
+	}
+	locations := make(map[lineKey]*profile.Location)
+	functions := make(map[string]*profile.Function)
+	for _, st := range s.stacks {
+		if st.sampler {
+			continue
+		}
+		sample := &profile.Sample{Value: []int64{st.count, st.wall.Nanoseconds()}}
+		for _, f := range frames(st.pcs) {
+			key := lineKey{f.Function, f.File, f.Line}
+			loc := locations[key]
+			if loc == nil {
+				fn := functions[f.Function]
+				if fn == nil {
+					fn = &profile.Function{ID: uint64(len(functions) + 1), Name: f.Function, SystemName: f.Function, Filename: f.File}
+					functions[f.Function] = fn
+					p.Function = append(p.Function, fn)
+				}
+				loc = &profile.Location{ID: uint64(len(locations) + 1), Address: uint64(f.PC), Line: []profile.Line{{Function: fn, Line: int64(f.Line)}}}
+				locations[key] = loc
+				p.Location = append(p.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	return p
+}
+
+// frames expands a stack of return addresses into its frames, leaf first,
+// inlined calls included.
+func frames(pcs []uintptr) []runtime.Frame {
+	var out []runtime.Frame
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		out = append(out, f)
+		if !more {
+			return out
+		}
+	}
+}
+
+// isSampler reports whether fn belongs to this package, so the sampler's own
+// goroutine, waiting for its next tick, is left out of the profile.
+func isSampler(fn string) bool {
+	return strings.HasPrefix(fn, "github.com/vdntruong/gosamurai/analysis/wallclock.")
+}
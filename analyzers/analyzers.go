@@ -0,0 +1,76 @@
+// Package analyzers holds go/analysis analyzers for the pitfalls
+// SUBTLETIES.md teaches, so they can be found in any codebase rather than
+// learned one review at a time. cmd/samuraivet runs them all.
+package analyzers
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// All lists every analyzer in the package.
+var All = []*analysis.Analyzer{
+	TimeAfterLoop,
+	WaitGroupAddInGoroutine,
+	TypedNilError,
+	DeferInLoop,
+	ContextlessCall,
+}
+
+// inLoop reports whether n, the last node of stack, runs once per iteration
+// of a for or range loop in the same function: it is in the loop's body,
+// with no function literal in between.
+func inLoop(stack []ast.Node) bool {
+	n := stack[len(stack)-1]
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch s := stack[i].(type) {
+		case *ast.FuncLit, *ast.FuncDecl:
+			return false
+		case *ast.ForStmt:
+			if within(n, s.Body) {
+				return true
+			}
+		case *ast.RangeStmt:
+			if within(n, s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func within(n, outer ast.Node) bool {
+	return outer.Pos() <= n.Pos() && n.End() <= outer.End()
+}
+
+// isFunc reports whether call calls the package-level function or method
+// name of the package at path, such as "time", "After" or "sync",
+// "WaitGroup.Add".
+func isFunc(info *types.Info, call *ast.CallExpr, path, name string) bool {
+	p, n, ok := callee(info, call)
+	return ok && p == path && n == name
+}
+
+// callee returns the package path and name of the function or method call
+// calls, in the form isFunc takes.
+func callee(info *types.Info, call *ast.CallExpr) (path, name string, ok bool) {
+	fn, ok := typeutil.Callee(info, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return "", "", false
+	}
+	if recv := fn.Signature().Recv(); recv != nil {
+		t := recv.Type()
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok {
+			return "", "", false
+		}
+		return fn.Pkg().Path(), named.Obj().Name() + "." + fn.Name(), true
+	}
+	return fn.Pkg().Path(), fn.Name(), true
+}
@@ -0,0 +1,19 @@
+package analyzers_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"github.com/vdntruong/gosamurai/analyzers"
+)
+
+// Each analyzer has a package of its name under testdata/src, whose
+// // want comments mark the lines it must report and nothing else.
+func TestAnalyzers(t *testing.T) {
+	for _, a := range analyzers.All {
+		t.Run(a.Name, func(t *testing.T) {
+			analysistest.Run(t, analysistest.TestData(), a, a.Name)
+		})
+	}
+}
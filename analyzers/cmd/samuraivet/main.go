@@ -0,0 +1,21 @@
+// Command samuraivet runs the analyzers for the pitfalls SUBTLETIES.md
+// teaches over Go packages, as go vet runs its own:
+//
+//	samuraivet [-timeafterloop=false ...] ./...
+//	go vet -vettool=$(which samuraivet) ./...
+//
+// It reports time.After in loops, sync.WaitGroup.Add inside the goroutine it
+// counts, typed nil values returned as errors, defer in loops, and blocking
+// calls that have a variant taking a context. Each analyzer can be turned
+// off by its name; samuraivet help lists them.
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/multichecker"
+
+	"github.com/vdntruong/gosamurai/analyzers"
+)
+
+func main() {
+	multichecker.Main(analyzers.All...)
+}
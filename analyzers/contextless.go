@@ -0,0 +1,125 @@
+package analyzers
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// ContextlessCall reports calls to blocking standard library functions that
+// have a variant taking a context.Context, such as http.Get, net.Dial,
+// exec.Command, and sql.DB.Query, and time.Sleep in a function that has a
+// context. Without the context, a caller that gives up, an expired deadline,
+// or a shutdown cannot stop the call: it blocks as long as the network, the
+// child process, or the database does. The same holds for select cases that
+// wait without ctx.Done(), which SUBTLETIES.md shows in "37. Context-Aware
+// Functions with Select".
+var ContextlessCall = &analysis.Analyzer{
+	Name:     "contextless",
+	Doc:      "report blocking calls that have a variant taking a context.Context, which cancellation and deadlines cannot stop",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      runContextlessCall,
+}
+
+// contextVariants maps the package path and name of a blocking function, as
+// callee returns them, to what to call instead.
+var contextVariants = map[[2]string]string{
+	{"net/http", "Get"}:             "http.NewRequestWithContext and Client.Do",
+	{"net/http", "Head"}:            "http.NewRequestWithContext and Client.Do",
+	{"net/http", "Post"}:            "http.NewRequestWithContext and Client.Do",
+	{"net/http", "PostForm"}:        "http.NewRequestWithContext and Client.Do",
+	{"net/http", "NewRequest"}:      "http.NewRequestWithContext",
+	{"net/http", "Client.Get"}:      "http.NewRequestWithContext and Client.Do",
+	{"net/http", "Client.Head"}:     "http.NewRequestWithContext and Client.Do",
+	{"net/http", "Client.Post"}:     "http.NewRequestWithContext and Client.Do",
+	{"net/http", "Client.PostForm"}: "http.NewRequestWithContext and Client.Do",
+
+	{"net", "Dial"}:                  "net.Dialer.DialContext",
+	{"net", "DialTimeout"}:           "net.Dialer.DialContext",
+	{"net", "Dialer.Dial"}:           "net.Dialer.DialContext",
+	{"net", "LookupHost"}:            "net.Resolver.LookupHost",
+	{"net", "LookupIP"}:              "net.Resolver.LookupIP",
+	{"net", "LookupAddr"}:            "net.Resolver.LookupAddr",
+	{"net", "LookupCNAME"}:           "net.Resolver.LookupCNAME",
+	{"net", "LookupMX"}:              "net.Resolver.LookupMX",
+	{"net", "LookupNS"}:              "net.Resolver.LookupNS",
+	{"net", "LookupPort"}:            "net.Resolver.LookupPort",
+	{"net", "LookupSRV"}:             "net.Resolver.LookupSRV",
+	{"net", "LookupTXT"}:             "net.Resolver.LookupTXT",
+	{"crypto/tls", "Dial"}:           "tls.Dialer.DialContext",
+	{"crypto/tls", "Conn.Handshake"}: "tls.Conn.HandshakeContext",
+	{"crypto/tls", "DialWithDialer"}: "tls.Dialer.DialContext",
+
+	{"os/exec", "Command"}: "exec.CommandContext",
+
+	{"database/sql", "DB.Begin"}:      "sql.DB.BeginTx",
+	{"database/sql", "DB.Exec"}:       "sql.DB.ExecContext",
+	{"database/sql", "DB.Ping"}:       "sql.DB.PingContext",
+	{"database/sql", "DB.Prepare"}:    "sql.DB.PrepareContext",
+	{"database/sql", "DB.Query"}:      "sql.DB.QueryContext",
+	{"database/sql", "DB.QueryRow"}:   "sql.DB.QueryRowContext",
+	{"database/sql", "Tx.Exec"}:       "sql.Tx.ExecContext",
+	{"database/sql", "Tx.Prepare"}:    "sql.Tx.PrepareContext",
+	{"database/sql", "Tx.Query"}:      "sql.Tx.QueryContext",
+	{"database/sql", "Tx.QueryRow"}:   "sql.Tx.QueryRowContext",
+	{"database/sql", "Tx.Stmt"}:       "sql.Tx.StmtContext",
+	{"database/sql", "Stmt.Exec"}:     "sql.Stmt.ExecContext",
+	{"database/sql", "Stmt.Query"}:    "sql.Stmt.QueryContext",
+	{"database/sql", "Stmt.QueryRow"}: "sql.Stmt.QueryRowContext",
+}
+
+func runContextlessCall(pass *analysis.Pass) (any, error) {
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+		path, name, ok := callee(pass.TypesInfo, call)
+		if !ok {
+			return true
+		}
+		if use, ok := contextVariants[[2]string{path, name}]; ok {
+			pass.Reportf(call.Pos(), "%s.%s cannot be canceled; use %s", pkgName(path), name, use)
+		} else if path == "time" && name == "Sleep" && hasContext(pass.TypesInfo, stack) {
+			pass.Reportf(call.Pos(), "time.Sleep ignores the function's context; select on ctx.Done() and a time.Timer")
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// hasContext reports whether a function in stack, the innermost or one it
+// is nested in, has a context.Context parameter.
+func hasContext(info *types.Info, stack []ast.Node) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		var sig *types.Signature
+		switch f := stack[i].(type) {
+		case *ast.FuncLit:
+			sig, _ = info.TypeOf(f).(*types.Signature)
+		case *ast.FuncDecl:
+			if fn, ok := info.Defs[f.Name].(*types.Func); ok {
+				sig = fn.Signature()
+			}
+		}
+		if sig == nil {
+			continue
+		}
+		for v := range sig.Params().Variables() {
+			if named, ok := v.Type().(*types.Named); ok && named.Obj().Pkg() != nil &&
+				named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pkgName is the name the standard library package at path is imported as.
+func pkgName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,32 @@
+package analyzers
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// DeferInLoop reports defer statements in the body of a loop. A deferred
+// call runs when the function returns, not at the end of the iteration, so
+// a loop that opens a file and defers its Close keeps every file open until
+// the loop is done. Moving the body into a function of its own runs the
+// defer once per iteration. See SUBTLETIES.md, "Defer, Panic, Recover".
+var DeferInLoop = &analysis.Analyzer{
+	Name:     "deferinloop",
+	Doc:      "report defer in a loop, which runs when the function returns rather than per iteration",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      runDeferInLoop,
+}
+
+func runDeferInLoop(pass *analysis.Pass) (any, error) {
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.WithStack([]ast.Node{(*ast.DeferStmt)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if push && inLoop(stack) {
+			pass.Reportf(n.Pos(), "defer in a loop runs when the function returns, not at the end of the iteration; move the loop body into a function")
+		}
+		return true
+	})
+	return nil, nil
+}
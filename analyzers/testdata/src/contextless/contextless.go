@@ -0,0 +1,52 @@
+package contextless
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+func fetch(url string) {
+	http.Get(url)                             // want `http.Get cannot be canceled; use http.NewRequestWithContext and Client.Do`
+	http.NewRequest(http.MethodGet, url, nil) // want `http.NewRequest cannot be canceled; use http.NewRequestWithContext`
+	http.DefaultClient.Get(url)               // want `http.Client.Get cannot be canceled`
+}
+
+func dial() {
+	net.Dial("tcp", "localhost:80") // want `net.Dial cannot be canceled; use net.Dialer.DialContext`
+	net.LookupHost("localhost")     // want `net.LookupHost cannot be canceled; use net.Resolver.LookupHost`
+	var d net.Dialer
+	d.Dial("tcp", "localhost:80") // want `net.Dialer.Dial cannot be canceled`
+}
+
+func run() {
+	exec.Command("true") // want `exec.Command cannot be canceled; use exec.CommandContext`
+}
+
+func query(db *sql.DB) {
+	db.Query("SELECT 1") // want `sql.DB.Query cannot be canceled; use sql.DB.QueryContext`
+}
+
+func sleeps(ctx context.Context) {
+	time.Sleep(time.Second) // want `time.Sleep ignores the function's context`
+	go func() {
+		time.Sleep(time.Second) // want `time.Sleep ignores the function's context`
+	}()
+}
+
+func sleepsWithoutContext() {
+	time.Sleep(time.Second)
+}
+
+func withContext(ctx context.Context, db *sql.DB, url string) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	http.DefaultClient.Do(req)
+	var d net.Dialer
+	d.DialContext(ctx, "tcp", "localhost:80")
+	net.DefaultResolver.LookupHost(ctx, "localhost")
+	exec.CommandContext(ctx, "true")
+	db.QueryContext(ctx, "SELECT 1")
+}
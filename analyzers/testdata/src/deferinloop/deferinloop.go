@@ -0,0 +1,51 @@
+package deferinloop
+
+import "os"
+
+func open(names []string) error {
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close() // want `defer in a loop runs when the function returns, not at the end of the iteration`
+	}
+	return nil
+}
+
+func counted(n int) {
+	for i := 0; i < n; i++ {
+		defer println(i) // want `defer in a loop`
+	}
+}
+
+func perIteration(names []string) error {
+	for _, name := range names {
+		err := func() error {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func afterLoop(names []string) {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		if f, err := os.Open(name); err == nil {
+			files = append(files, f)
+		}
+	}
+}
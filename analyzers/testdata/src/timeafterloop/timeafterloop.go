@@ -0,0 +1,51 @@
+package timeafterloop
+
+import "time"
+
+func work(c <-chan int) {
+	for {
+		select {
+		case <-c:
+		case <-time.After(time.Second): // want `time.After in a loop starts a new timer on every iteration`
+			return
+		}
+	}
+}
+
+func ranged(c []int) {
+	for range c {
+		<-time.After(time.Millisecond) // want `time.After in a loop`
+	}
+}
+
+func once(c <-chan int) {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case <-c:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func timer(c <-chan int) {
+	t := time.NewTimer(time.Second)
+	defer t.Stop()
+	for {
+		t.Reset(time.Second)
+		select {
+		case <-c:
+		case <-t.C:
+			return
+		}
+	}
+}
+
+func literal(c []int) {
+	for range c {
+		// Each call of f starts one timer, whenever it is called.
+		f := func() { <-time.After(time.Millisecond) }
+		_ = f
+	}
+}
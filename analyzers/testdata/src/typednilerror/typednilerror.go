@@ -0,0 +1,60 @@
+package typednilerror
+
+import "errors"
+
+type myError struct{}
+
+func (*myError) Error() string { return "my error" }
+
+type codes map[string]int
+
+func (codes) Error() string { return "codes" }
+
+func pointer(fail bool) error {
+	var err *myError
+	if fail {
+		err = &myError{}
+	}
+	return err // want `err of type \*myError returned as error is a non-nil error even when it is nil`
+}
+
+func mapType() (int, error) {
+	var c codes
+	return 0, c // want `c of type codes returned as error`
+}
+
+type holder struct{ err *myError }
+
+func field(h holder) error {
+	return h.err // want `h.err of type \*myError returned as error`
+}
+
+func explicit(fail bool) error {
+	if fail {
+		return &myError{}
+	}
+	return nil
+}
+
+func declared(fail bool) error {
+	var err error
+	if fail {
+		err = &myError{}
+	}
+	return err
+}
+
+func newError() *myError { return &myError{} }
+
+func call() error {
+	return newError()
+}
+
+func wrapped() error {
+	return errors.New("plain")
+}
+
+func value() error {
+	var e myError
+	return &e
+}
@@ -0,0 +1,49 @@
+package wgaddingoroutine
+
+import "sync"
+
+func inside() {
+	var wg sync.WaitGroup
+	go func() {
+		wg.Add(1) // want `WaitGroup.Add inside the goroutine it counts races with Wait`
+		defer wg.Done()
+	}()
+	wg.Wait()
+}
+
+func pointer(wg *sync.WaitGroup) {
+	go func() {
+		wg.Add(1) // want `WaitGroup.Add inside the goroutine`
+		wg.Done()
+	}()
+}
+
+func before() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+	}()
+	wg.Wait()
+}
+
+func spawner() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Adding for the goroutines this one starts is fine.
+		start := func() {
+			wg.Add(1)
+			go wg.Done()
+		}
+		start()
+	}()
+	wg.Wait()
+}
+
+func goMethod() {
+	var wg sync.WaitGroup
+	wg.Go(func() {})
+	wg.Wait()
+}
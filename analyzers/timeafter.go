@@ -0,0 +1,37 @@
+package analyzers
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// TimeAfterLoop reports time.After called on every iteration of a loop,
+// as in a select that waits for work or a timeout. Every call starts a new
+// timer, and in a select the timeout starts over with each message, so a
+// steady trickle of messages never times out. A time.Timer made before the
+// loop and Reset, or a time.Ticker, does it once. See SUBTLETIES.md, "59.
+// time.After Leaks".
+var TimeAfterLoop = &analysis.Analyzer{
+	Name:     "timeafterloop",
+	Doc:      "report time.After called in a loop, which starts a new timer on every iteration",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      runTimeAfterLoop,
+}
+
+func runTimeAfterLoop(pass *analysis.Pass) (any, error) {
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+		if isFunc(pass.TypesInfo, call, "time", "After") && inLoop(stack) {
+			pass.Reportf(call.Pos(), "time.After in a loop starts a new timer on every iteration; make a time.Timer before the loop and Reset it")
+		}
+		return true
+	})
+	return nil, nil
+}
@@ -0,0 +1,88 @@
+package analyzers
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// TypedNilError reports a variable of a concrete pointer, map, slice,
+// channel, or function type returned as an error, as in
+//
+//	var err *MyError
+//	...
+//	return err
+//
+// When the variable is nil, the error is not: it holds a nil *MyError, and
+// the caller's err != nil is true. Returning nil explicitly on success, or
+// declaring the variable as error, avoids it. Calls are not reported, since
+// a constructor returning a concrete error type is usually never nil. See
+// SUBTLETIES.md, "22. Interface Nil Is Not Always Nil".
+var TypedNilError = &analysis.Analyzer{
+	Name:     "typednilerror",
+	Doc:      "report variables of a concrete nilable type returned as an error, which are non-nil errors even when nil",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      runTypedNilError,
+}
+
+func runTypedNilError(pass *analysis.Pass) (any, error) {
+	errorType := types.Universe.Lookup("error").Type()
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.WithStack([]ast.Node{(*ast.ReturnStmt)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		sig := enclosingSignature(pass.TypesInfo, stack)
+		ret := n.(*ast.ReturnStmt)
+		if sig == nil || sig.Results().Len() != len(ret.Results) {
+			return true
+		}
+		for i, res := range ret.Results {
+			if !types.Identical(sig.Results().At(i).Type(), errorType) {
+				continue
+			}
+			switch ast.Unparen(res).(type) {
+			case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr:
+			default:
+				continue
+			}
+			tv, ok := pass.TypesInfo.Types[res]
+			if !ok || !tv.IsValue() || types.IsInterface(tv.Type) || !nilable(tv.Type) {
+				continue
+			}
+			pass.Reportf(res.Pos(), "%s of type %s returned as error is a non-nil error even when it is nil; return nil explicitly or declare it as error",
+				types.ExprString(res), types.TypeString(tv.Type, types.RelativeTo(pass.Pkg)))
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// enclosingSignature returns the signature of the innermost function in
+// stack.
+func enclosingSignature(info *types.Info, stack []ast.Node) *types.Signature {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch f := stack[i].(type) {
+		case *ast.FuncLit:
+			sig, _ := info.TypeOf(f).(*types.Signature)
+			return sig
+		case *ast.FuncDecl:
+			if fn, ok := info.Defs[f.Name].(*types.Func); ok {
+				return fn.Signature()
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func nilable(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Map, *types.Slice, *types.Chan, *types.Signature:
+		return true
+	}
+	return false
+}
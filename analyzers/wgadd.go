@@ -0,0 +1,46 @@
+package analyzers
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// WaitGroupAddInGoroutine reports sync.WaitGroup.Add called by the
+// goroutine it counts, as in go func() { wg.Add(1); ... }(). The go
+// statement returns before the goroutine runs, so Wait can see a zero
+// counter and return before the goroutine has started. Add belongs before
+// the go statement, or wg.Go does both. See SUBTLETIES.md, "38.
+// sync.WaitGroup.Go".
+var WaitGroupAddInGoroutine = &analysis.Analyzer{
+	Name:     "wgaddingoroutine",
+	Doc:      "report sync.WaitGroup.Add called inside the goroutine it counts",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      runWaitGroupAdd,
+}
+
+func runWaitGroupAdd(pass *analysis.Pass) (any, error) {
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.Preorder([]ast.Node{(*ast.GoStmt)(nil)}, func(n ast.Node) {
+		lit, ok := n.(*ast.GoStmt).Call.Fun.(*ast.FuncLit)
+		if !ok {
+			return
+		}
+		ast.Inspect(lit.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				// A function the goroutine defines runs when it is
+				// called, which may be after an Add outside it.
+				return false
+			case *ast.CallExpr:
+				if isFunc(pass.TypesInfo, n, "sync", "WaitGroup.Add") {
+					pass.Reportf(n.Pos(), "WaitGroup.Add inside the goroutine it counts races with Wait; call Add before the go statement, or use WaitGroup.Go")
+				}
+			}
+			return true
+		})
+	})
+	return nil, nil
+}
@@ -0,0 +1,71 @@
+// Command contention prints a ranked lock contention report from a mutex
+// profile file, such as one written by clipprof -mutexprofile or fetched
+// from /debug/pprof/mutex.
+//
+//	contention [-top 20] [-names cacheMu=main.createUsersHandler,...] mutex.prof
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/contention"
+)
+
+var (
+	top      = flag.Int("top", 20, "number of sites to print (0 for all)")
+	names    = flag.String("names", "", "comma-separated lock=function mappings; a function ending in . or / is a prefix")
+	jsonMode = flag.Bool("json", false, "print the report as JSON")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: contention [flags] mutex.prof\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	p, err := profile.Parse(f)
+	if err != nil {
+		log.Fatal("parse profile: ", err)
+	}
+
+	lockNames := contention.Names{}
+	for pair := range strings.SplitSeq(*names, ",") {
+		if lock, fn, ok := strings.Cut(pair, "="); ok {
+			lockNames[fn] = lock
+		}
+	}
+
+	report, err := contention.Analyze(p, lockNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *jsonMode {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := report.WriteText(os.Stdout, *top); err != nil {
+		log.Fatal(err)
+	}
+}
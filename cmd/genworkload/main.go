@@ -0,0 +1,241 @@
+// Command genworkload adds a workload to clipprof: it writes <name>.go with
+// the workload function, its flags, and the line it reports at the end,
+// registers the function in the workloads map of main.go, and adds the
+// name to the -workload usage. What is left is the work itself, marked
+// TODO in the new file, and the README entry.
+//
+//	genworkload [-dir examples/clipprof] [-flag name=type:default:usage]... [-test] name
+//
+// A flag is int, float64, bool, string, or duration, as
+// -flag cache-size=int:1024:"entries in the cache". -test also writes a
+// <name>_test.go that runs the workload briefly and checks that it counted
+// its work. -n prints the files instead of writing them.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+var (
+	dir      = flag.String("dir", "examples/clipprof", "clipprof source directory")
+	withTest = flag.Bool("test", false, "also write a test skeleton, <name>_test.go")
+	dryRun   = flag.Bool("n", false, "print the generated files instead of writing them")
+	flags    flagSpecs
+)
+
+func init() {
+	flag.Var(&flags, "flag", "a flag of the workload, as name=type:default:usage (repeatable)")
+}
+
+// workload is what the templates are executed with.
+type workload struct {
+	Name  string // as given to -workload
+	Title string // the name in Go identifiers: runTitleWorkload
+	Flags []flagSpec
+}
+
+func (w workload) Func() string { return "run" + w.Title + "Workload" }
+
+// HasFlags decides whether the file imports flag.
+func (w workload) HasFlags() bool { return len(w.Flags) > 0 }
+
+// flagSpec is one -flag.
+type flagSpec struct {
+	Name    string // flag name
+	Var     string // Go variable
+	Func    string // flag package function: Int, String, ...
+	Default string // Go expression of the default value
+	Usage   string
+}
+
+type flagSpecs []flagSpec
+
+func (f *flagSpecs) String() string { return fmt.Sprint(len(*f), " flags") }
+
+// Set parses name=type:default:usage.
+func (f *flagSpecs) Set(s string) error {
+	name, rest, ok := strings.Cut(s, "=")
+	typ, rest, ok2 := strings.Cut(rest, ":")
+	def, usage, ok3 := strings.Cut(rest, ":")
+	if !ok || !ok2 || !ok3 || !validName.MatchString(name) {
+		return fmt.Errorf("want name=type:default:usage, got %q", s)
+	}
+	spec := flagSpec{Name: name, Var: identifier(name, false), Usage: usage}
+	var err error
+	switch typ {
+	case "int":
+		spec.Func, spec.Default = "Int", def
+		_, err = strconv.Atoi(def)
+	case "float64":
+		spec.Func, spec.Default = "Float64", def
+		_, err = strconv.ParseFloat(def, 64)
+	case "bool":
+		spec.Func, spec.Default = "Bool", def
+		_, err = strconv.ParseBool(def)
+	case "string":
+		spec.Func, spec.Default = "String", strconv.Quote(def)
+	case "duration":
+		var d time.Duration
+		d, err = time.ParseDuration(def)
+		spec.Func, spec.Default = "Duration", durationExpr(d)
+	default:
+		return fmt.Errorf("flag %s: unknown type %q, want int, float64, bool, string, or duration", name, typ)
+	}
+	if err != nil {
+		return fmt.Errorf("flag %s: invalid %s default %q", name, typ, def)
+	}
+	*f = append(*f, spec)
+	return nil
+}
+
+// validName is a workload or flag name: lower case words joined by dashes.
+var validName = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// identifier turns a dashed name into camel case, exported or not:
+// "cache-size" is cacheSize or CacheSize.
+func identifier(name string, exported bool) string {
+	var b strings.Builder
+	for i, part := range strings.Split(name, "-") {
+		r := []rune(part)
+		if i > 0 || exported {
+			r[0] = unicode.ToUpper(r[0])
+		}
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// durationExpr writes d the way the flags in main.go do: 250 *
+// time.Millisecond rather than 250000000.
+func durationExpr(d time.Duration) string {
+	for _, u := range []struct {
+		unit time.Duration
+		name string
+	}{{time.Hour, "Hour"}, {time.Minute, "Minute"}, {time.Second, "Second"}, {time.Millisecond, "Millisecond"}, {time.Microsecond, "Microsecond"}} {
+		if d != 0 && d%u.unit == 0 {
+			if d == u.unit {
+				return "time." + u.name
+			}
+			return fmt.Sprintf("%d * time.%s", d/u.unit, u.name)
+		}
+	}
+	return fmt.Sprintf("%d", d)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: genworkload [flags] name\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	if !validName.MatchString(name) || name == "all" {
+		log.Fatalf("invalid workload name %q: use lower case letters, digits, and dashes", name)
+	}
+	w := workload{Name: name, Title: identifier(name, true), Flags: flags}
+
+	mainPath := filepath.Join(*dir, "main.go")
+	mainSrc, err := os.ReadFile(mainPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	registered, err := register(mainSrc, w)
+	if err != nil {
+		log.Fatalf("%s: %v", mainPath, err)
+	}
+
+	files := []struct {
+		path string
+		tmpl *template.Template
+	}{{filepath.Join(*dir, strings.ReplaceAll(name, "-", "")+".go"), workloadTemplate}}
+	if *withTest {
+		files = append(files, struct {
+			path string
+			tmpl *template.Template
+		}{filepath.Join(*dir, strings.ReplaceAll(name, "-", "")+"_test.go"), testTemplate})
+	}
+	out := make([][]byte, len(files))
+	for i, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			log.Fatalf("%s already exists", f.path)
+		}
+		if out[i], err = generate(f.tmpl, w); err != nil {
+			log.Fatalf("%s: %v", f.path, err)
+		}
+	}
+
+	if *dryRun {
+		for i, f := range files {
+			fmt.Printf("// %s\n\n%s\n", f.path, out[i])
+		}
+		return
+	}
+	for i, f := range files {
+		if err := os.WriteFile(f.path, out[i], 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("wrote", f.path)
+	}
+	if err := os.WriteFile(mainPath, registered, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("registered %s in %s\n", w.Func(), mainPath)
+	fmt.Printf("next: fill in the TODOs in %s and describe -workload=%s in the README\n", files[0].path, name)
+}
+
+// generate executes tmpl with w and formats the result as Go source.
+func generate(tmpl *template.Template, w workload) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, w); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %w", err)
+	}
+	return src, nil
+}
+
+var (
+	// allEntry is the last entry of the workloads map, before which the
+	// new one goes.
+	allEntry = regexp.MustCompile(`(?m)^([ \t]*)"all":\s*runAllWorkloads,\n`)
+	// workloadUsage is the list of names in the -workload usage.
+	workloadUsage = regexp.MustCompile(`("workload type: [^"]*), all"`)
+)
+
+// register adds w to the workloads map and the -workload usage of main.go.
+func register(src []byte, w workload) ([]byte, error) {
+	if bytes.Contains(src, []byte(strconv.Quote(w.Name)+":")) {
+		return nil, fmt.Errorf("workload %q is already registered", w.Name)
+	}
+	loc := allEntry.FindSubmatchIndex(src)
+	if loc == nil {
+		return nil, fmt.Errorf(`no "all" entry in the workloads map`)
+	}
+	indent := src[loc[2]:loc[3]]
+	entry := fmt.Sprintf("%s%q: %s,\n", indent, w.Name, w.Func())
+	out := append(append(append([]byte(nil), src[:loc[0]]...), entry...), src[loc[0]:]...)
+
+	if !workloadUsage.Match(out) {
+		return nil, fmt.Errorf("no -workload usage to add %q to", w.Name)
+	}
+	out = workloadUsage.ReplaceAll(out, []byte("${1}, "+w.Name+`, all"`))
+	return format.Source(out)
+}
@@ -0,0 +1,69 @@
+package main
+
+import "text/template"
+
+// workloadTemplate is the workload file. The loop is the shape of the other
+// workloads: run for -duration, call pace once per unit of work so the mix
+// weights and the work count apply, and print what was done at the end.
+var workloadTemplate = template.Must(template.New("workload").Parse(`package main
+
+import (
+	"context"
+{{- if .HasFlags}}
+	"flag"
+{{- end}}
+	"fmt"
+	"time"
+)
+{{if .HasFlags}}
+// Flags of the {{.Name}} workload.
+var (
+{{- range .Flags}}
+	{{.Var}} = flag.{{.Func}}({{printf "%q" .Name}}, {{.Default}}, {{printf "%q" .Usage}})
+{{- end}}
+)
+{{end}}
+// {{.Func}} TODO: what it does and which profile shows it.
+// Its samples carry the workload={{.Name}} pprof label from ctx.
+func {{.Func}}(context.Context) {
+	fmt.Println("Running {{.Name}} workload...")
+	endTime := time.Now().Add(time.Duration(*duration) * time.Second)
+
+	var result uint64
+	rounds := 0
+	p := newPacer({{printf "%q" .Name}})
+	for time.Now().Before(endTime) {
+		result += computeFibonacci(20) // TODO: one unit of the work to profile
+		rounds++
+		p.pace()
+	}
+
+	fmt.Printf("{{.Name}} workload: %d rounds, result: %d\n", rounds, result)
+}
+`))
+
+// testTemplate is a test that runs the workload for a second and checks
+// that it did some work.
+var testTemplate = template.Must(template.New("test").Parse(`package main
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/vdntruong/gosamurai/randsource"
+)
+
+func Test{{.Title}}Workload(t *testing.T) {
+	random = randsource.New(1)
+	flag.Set("duration", "1")
+	before := workDone.Load()
+
+	{{.Func}}(context.Background())
+
+	if workDone.Load() == before {
+		t.Fatal("the workload counted no work; does its loop call pace?")
+	}
+	// TODO: check what the workload is meant to produce.
+}
+`))
@@ -0,0 +1,96 @@
+// Command loadgen drives the webpprof example with simulated user sessions.
+// Each session walks a journey (home, create users, look them up, compute,
+// stats) with think times between steps and its own cookie jar, which gives
+// cache and allocation patterns closer to real traffic than uniform random
+// endpoint hits. -mode=uniform keeps the uniform hits for comparison, and
+// -mode=stampede hammers a few hot keys of /api/stampede, and -mode=catalog
+// looks up random /api/catalog items.
+//
+// Every worker draws from its own stream of -seed, so two runs with the same
+// seed and -sessions send the same sequence of requests from each worker.
+//
+//	loadgen [-url http://localhost:8080] [-sessions 50] [-duration 1m] [-think 500ms] [-seed 42]
+//	loadgen -mode stampede [-coalesce=false] [-hot-keys 1]
+//	loadgen -mode catalog [-catalog-items 5000]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/randsource"
+)
+
+var (
+	baseURL  = flag.String("url", "http://localhost:8080", "base URL of the webpprof server")
+	mode     = flag.String("mode", "sessions", "load model: sessions, uniform, stampede, or catalog")
+	sessions = flag.Int("sessions", 50, "concurrent sessions (or workers in uniform mode)")
+	duration = flag.Duration("duration", time.Minute, "how long to generate load")
+	think    = flag.Duration("think", 500*time.Millisecond, "mean think time between steps of a session")
+	timeout  = flag.Duration("timeout", 30*time.Second, "per-request timeout")
+	coalesce = flag.Bool("coalesce", true, "stampede mode: read through the coalescing cache")
+	hotKeys  = flag.Int("hot-keys", 1, "stampede mode: number of hot keys")
+
+	catalogItems = flag.Int("catalog-items", 5000, "catalog mode: the server's -catalog-size")
+
+	seed = flag.Uint64("seed", 0, "random seed for the request sequence (0 picks one and prints it)")
+)
+
+func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	var run func(ctx context.Context, r *rand.Rand, stats *stats)
+	switch *mode {
+	case "sessions":
+		run = runSessions
+	case "uniform":
+		run = runUniform
+	case "stampede":
+		if *hotKeys < 1 {
+			log.Fatal("-hot-keys must be at least 1")
+		}
+		run = runStampede
+	case "catalog":
+		if *catalogItems < 1 {
+			log.Fatal("-catalog-items must be at least 1")
+		}
+		run = runCatalog
+	default:
+		log.Fatalf("unknown mode %q", *mode)
+	}
+
+	random := randsource.New(*seed)
+	fmt.Printf("Generating %s load against %s with %d sessions for %s (seed %d)\n", *mode, *baseURL, *sessions, *duration, random.Seed())
+	st := newStats()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range *sessions {
+		r := random.Stream(fmt.Sprintf("%s/%d", *mode, i))
+		wg.Go(func() { run(ctx, r, st) })
+	}
+	wg.Wait()
+
+	st.write(os.Stdout, time.Since(start))
+}
+
+// runUniform hits a random step of the journey as fast as possible.
+func runUniform(ctx context.Context, r *rand.Rand, st *stats) {
+	client := &http.Client{Timeout: *timeout}
+	for ctx.Err() == nil {
+		s := journey[r.IntN(len(journey))]
+		st.do(ctx, client, s.name, s.path(newSessionParams(r)))
+	}
+}
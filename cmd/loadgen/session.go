@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+// sessionParams are drawn once per session, so one user keeps working on the
+// same set of records the way a real user would.
+type sessionParams struct {
+	users      int
+	iterations int
+}
+
+func newSessionParams(r *rand.Rand) sessionParams {
+	return sessionParams{
+		users:      50 + r.IntN(450),
+		iterations: 100_000 * (1 + r.IntN(20)),
+	}
+}
+
+// step is one page or API call of a journey.
+type step struct {
+	name string
+	path func(p sessionParams) string
+	// repeat is how many times a session does the step in a row.
+	repeat func(r *rand.Rand) int
+}
+
+func once(*rand.Rand) int { return 1 }
+
+// journey is what a typical session does, in order.
+var journey = []step{
+	{"home", func(sessionParams) string { return "/" }, once},
+	{"create users", func(p sessionParams) string { return fmt.Sprintf("/api/users?count=%d", p.users) }, once},
+	{"look up users", func(p sessionParams) string { return fmt.Sprintf("/api/users/lookup?count=%d", p.users) },
+		func(r *rand.Rand) int { return 1 + r.IntN(3) }},
+	{"compute", func(p sessionParams) string { return fmt.Sprintf("/api/compute?iterations=%d", p.iterations) }, once},
+	{"stats", func(sessionParams) string { return "/api/stats" }, func(r *rand.Rand) int { return r.IntN(2) + 1 }},
+}
+
+// runSessions starts one session after another until ctx is done. Every
+// session gets a fresh cookie jar, so server-side sessions come and go the
+// way they do with real visitors.
+func runSessions(ctx context.Context, r *rand.Rand, st *stats) {
+	// Stagger the start so sessions do not move in lockstep.
+	if !sleep(ctx, thinkTime(r)) {
+		return
+	}
+	for ctx.Err() == nil {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar, Timeout: *timeout}
+		params := newSessionParams(r)
+		st.sessionStarted()
+
+		for _, s := range journey {
+			for range s.repeat(r) {
+				st.do(ctx, client, s.name, s.path(params))
+				if !sleep(ctx, thinkTime(r)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// thinkTime is exponentially distributed around -think.
+func thinkTime(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(*think))
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+)
+
+// runStampede hammers a few hot keys of /api/stampede, so every expiry of a
+// hot entry finds many requests waiting for it. Compare runs with
+// -coalesce=true and -coalesce=false in the server's backend_calls and
+// peak_in_flight counters.
+func runStampede(ctx context.Context, r *rand.Rand, st *stats) {
+	client := &http.Client{Timeout: *timeout}
+	for ctx.Err() == nil {
+		key := fmt.Sprintf("hot-%d", r.IntN(*hotKeys))
+		st.do(ctx, client, "stampede", fmt.Sprintf("/api/stampede?key=%s&coalesce=%t", key, *coalesce))
+	}
+}
+
+// runCatalog looks up random catalog items, a fifth of which do not exist,
+// as fast as possible. All workers start at once, like traffic arriving
+// after a deploy, so the first lookups of every item land in the same few
+// seconds and the server's fixed-TTL cache then expires them together.
+func runCatalog(ctx context.Context, r *rand.Rand, st *stats) {
+	client := &http.Client{Timeout: *timeout}
+	for ctx.Err() == nil {
+		id := r.IntN(*catalogItems * 5 / 4)
+		st.do(ctx, client, "catalog", fmt.Sprintf("/api/catalog?id=%d", id))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects per-step latencies and errors.
+type stats struct {
+	mu       sync.Mutex
+	sessions int
+	steps    map[string]*stepStats
+	order    []string
+}
+
+type stepStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+func newStats() *stats {
+	return &stats{steps: make(map[string]*stepStats)}
+}
+
+func (s *stats) sessionStarted() {
+	s.mu.Lock()
+	s.sessions++
+	s.mu.Unlock()
+}
+
+// do issues one GET and records its outcome. Requests cut short by the end
+// of the run are not counted.
+func (s *stats) do(ctx context.Context, client *http.Client, name, path string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *baseURL+path, nil)
+	if err != nil {
+		s.record(name, 0, err)
+		return
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	s.record(name, time.Since(start), err)
+}
+
+func (s *stats) record(name string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.steps[name]
+	if st == nil {
+		st = &stepStats{}
+		s.steps[name] = st
+		s.order = append(s.order, name)
+	}
+	if err != nil {
+		st.errors++
+		return
+	}
+	st.latencies = append(st.latencies, d)
+}
+
+func (s *stats) write(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "\n%d sessions started in %s\n\n", s.sessions, elapsed.Round(time.Millisecond))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tREQUESTS\tERRORS\tRATE\tP50\tP90\tP99")
+	for _, name := range s.order {
+		st := s.steps[name]
+		slices.Sort(st.latencies)
+		n := len(st.latencies)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f/s\t%s\t%s\t%s\n", name, n, st.errors,
+			float64(n)/elapsed.Seconds(),
+			percentile(st.latencies, 0.50), percentile(st.latencies, 0.90), percentile(st.latencies, 0.99))
+	}
+	tw.Flush()
+}
+
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1))].Round(time.Microsecond)
+}
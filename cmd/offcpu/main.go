@@ -0,0 +1,101 @@
+// Command offcpu records where the threads of a running process block in
+// the kernel, using an eBPF off-CPU sampler, and writes a pprof profile of
+// the time blocked with the frames resolved through the binary's Go symbol
+// table. Linux only; the sampler needs root or CAP_BPF and CAP_PERFMON.
+//
+//	offcpu -pid 1234 [-seconds 30] [-min-block 1ms] [-o offcpu.prof]
+//	offcpu -pid 1234 -tool 'bpftrace -p {pid} ./offcpu.bt {seconds}'
+//	offcpu -folded stacks.txt -pid 1234
+//
+// By default it runs BCC's offcputime. -tool runs any other command that
+// prints folded stacks in microseconds instead; -folded converts output
+// recorded earlier (the process must still be running to symbolize it).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/gosamurai/analysis/offcpu"
+)
+
+var (
+	pid      = flag.Int("pid", 0, "process to sample")
+	seconds  = flag.Int("seconds", 30, "how long to sample")
+	output   = flag.String("o", "offcpu.prof", "output profile")
+	tool     = flag.String("tool", "", "sampler command, with {pid} and {seconds} placeholders (default: BCC offcputime)")
+	folded   = flag.String("folded", "", "convert this folded stacks file instead of sampling")
+	minBlock = flag.Duration("min-block", time.Millisecond, "ignore blocks shorter than this (offcputime)")
+	userOnly = flag.Bool("user-only", false, "drop kernel frames (offcputime)")
+	keepIdle = flag.Bool("keep-idle", false, "keep the stacks of idle Go runtime threads")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: offcpu -pid PID [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *pid == 0 || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if runtime.GOOS != "linux" {
+		log.Fatal("offcpu needs Linux")
+	}
+
+	// Symbolize first: the binary must be read while the process runs.
+	symbols, err := offcpu.NewSymbolizer(*pid)
+	if err != nil {
+		log.Printf("no Go symbols, keeping the frames as sampled: %v", err)
+	}
+
+	d := time.Duration(*seconds) * time.Second
+	var stacks []offcpu.Stack
+	if *folded != "" {
+		f, err := os.Open(*folded)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stacks, err = offcpu.ParseFolded(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		var sampler offcpu.Sampler = offcpu.BCC{MinBlock: *minBlock, UserOnly: *userOnly}
+		if *tool != "" {
+			sampler = offcpu.Command{Args: strings.Fields(*tool)}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		log.Printf("sampling process %d off-CPU for %s...", *pid, d)
+		if stacks, err = sampler.Sample(ctx, *pid, d); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	p := offcpu.ToProfile(stacks, offcpu.Options{Symbols: symbols, Duration: d, KeepIdle: *keepIdle})
+	out, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := p.Write(out); err != nil {
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+	var total int64
+	for _, s := range p.Sample {
+		total += s.Value[0]
+	}
+	fmt.Printf("%d stacks, %s blocked; wrote %s\n", len(p.Sample), time.Duration(total)*time.Microsecond, *output)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runRetention(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	dir := storeFlag(fs)
+	service := fs.String("service", profilestore.DefaultPolicy, "service to configure; * is the default for services without a policy")
+	var p profilestore.Policy
+	fs.DurationVar(&p.MaxAge, "max-age", 0, "remove profiles older than this")
+	fs.IntVar(&p.MaxCount, "max-count", 0, "keep at most this many profiles per type")
+	fs.Int64Var(&p.MaxBytes, "max-bytes", 0, "remove the oldest profiles above this many bytes")
+	clear := fs.Bool("clear", false, "remove the service's policy")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	if *clear || p != (profilestore.Policy{}) {
+		if err := store.SetPolicy(*service, p); err != nil {
+			return err
+		}
+	}
+
+	policies := store.Policies()
+	services := make([]string, 0, len(policies))
+	for s := range policies {
+		services = append(services, s)
+	}
+	slices.Sort(services)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tMAX AGE\tMAX COUNT\tMAX BYTES")
+	for _, s := range services {
+		pol := policies[s]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", s, pol.MaxAge, pol.MaxCount, pol.MaxBytes)
+	}
+	return tw.Flush()
+}
+
+func runCompact(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	dir := storeFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	res, err := store.Compact(ctx, time.Now(), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, rm := range res.Removed {
+		fmt.Printf("%s %s (%s %s): %s\n", verb, rm.Meta.ID, rm.Meta.Service, rm.Meta.Type, rm.Reason)
+	}
+	fmt.Printf("%s %d profiles and %d orphaned files, %d bytes; fingerprinted %d\n",
+		verb, len(res.Removed), res.Orphans, res.FreedBytes, res.Fingerprinted)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/advisor"
+	"github.com/vdntruong/gosamurai/analysis/diff"
+	"github.com/vdntruong/gosamurai/analysis/merge"
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runCompare(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	dir := storeFlag(fs)
+	service := fs.String("service", "", "only profiles of this service")
+	typ := fs.String("type", "cpu", "profile type to compare")
+	base := fs.String("base", "", "release version or commit to compare against (required)")
+	head := fs.String("head", "HEAD", "release version or commit to compare; git refs such as HEAD are resolved in the current repository")
+	top := fs.Int("top", 20, "number of functions to print (0 for all)")
+	minChange := fs.Float64("min-change", 100*advisor.DefaultMinChange, "smallest change, in percentage points of the total, to advise on")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+	if *base == "" {
+		return errors.New("--base is required")
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	q := profilestore.Query{Service: *service, Type: *typ}
+	baseProfile, err := representative(ctx, store, q, *base)
+	if err != nil {
+		return err
+	}
+	headProfile, err := representative(ctx, store, q, *head)
+	if err != nil {
+		return err
+	}
+
+	report, err := diff.Compare(baseProfile, headProfile)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteText(os.Stdout, *top); err != nil {
+		return err
+	}
+	fmt.Println("\nAdvice:")
+	return advisor.WriteText(os.Stdout, advisor.Advise(report, *minChange/100))
+}
+
+// representative merges every stored profile of ref into one, so a single
+// noisy profile does not decide the comparison.
+func representative(ctx context.Context, store *profilestore.Store, q profilestore.Query, ref string) (*profile.Profile, error) {
+	q.Ref = ref
+	metas, err := store.List(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) == 0 {
+		if commit, ok := resolveGitRef(ctx, ref); ok {
+			q.Ref = commit
+			if metas, err = store.List(q); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("no %s profiles tagged %s", q.Type, ref)
+	}
+
+	profiles := make([]*profile.Profile, 0, len(metas))
+	for _, m := range metas {
+		_, p, err := store.Profile(ctx, m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.ID, err)
+		}
+		profiles = append(profiles, p)
+	}
+	fmt.Printf("%s: merged %d profiles\n", ref, len(profiles))
+	return merge.Merge(profiles, merge.Options{})
+}
+
+// resolveGitRef turns a ref such as HEAD or a tag into a commit hash.
+func resolveGitRef(ctx context.Context, ref string) (string, bool) {
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := storeFlag(fs)
+	service := fs.String("service", "", "service the profiles belong to (required)")
+	lbls := labels{}
+	fs.Var(lbls, "labels", "comma-separated k=v labels to attach; may be repeated")
+	version := fs.String("version", "", "release the profiles were collected from, e.g. v1.2.0")
+	commit := fs.String("commit", "", "commit the profiles were collected from")
+	binary := fs.String("binary", "", "profiled Go binary to read -version and -commit from")
+	files, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *binary != "" {
+		bi, err := buildinfo.ReadFile(*binary)
+		if err != nil {
+			return err
+		}
+		v, c := profilestore.BuildTags(bi)
+		*version = cmp.Or(*version, v)
+		*commit = cmp.Or(*commit, c)
+	}
+	if *service == "" {
+		return errors.New("--service is required")
+	}
+	if len(files) == 0 {
+		return errors.New("no profile files given")
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		meta, err := store.Put(ctx, data, profilestore.Meta{
+			Service: *service,
+			Labels:  lbls,
+			Source:  filepath.Base(file),
+			Version: *version,
+			Commit:  *commit,
+		})
+		if errors.Is(err, profilestore.ErrDuplicate) {
+			fmt.Printf("%s\t%s\t%s (already stored)\n", meta.ID, meta.Type, file)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Printf("%s\t%s\t%s\n", meta.ID, meta.Type, file)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runKeygen(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	id := fs.String("id", time.Now().UTC().Format("k20060102"), "key ID")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+	fmt.Println(profilestore.NewKey(*id))
+	return nil
+}
+
+func runRotateKeys(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	dir := storeFlag(fs)
+	encrypt := fs.Bool("encrypt-existing", false, "also encrypt profiles stored unencrypted")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	res, err := store.RotateKeys(ctx, *encrypt)
+	fmt.Printf("rewrapped %d data keys, encrypted %d profiles\n", res.Rewrapped, res.Encrypted)
+	return err
+}
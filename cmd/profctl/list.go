@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := storeFlag(fs)
+	q := profilestore.Query{Labels: labels{}}
+	fs.StringVar(&q.Service, "service", "", "only profiles of this service")
+	fs.StringVar(&q.Type, "type", "", "only profiles of this type, e.g. cpu or inuse_space")
+	fs.Var(labels(q.Labels), "labels", "only profiles with these k=v labels")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	metas, err := store.List(q)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSERVICE\tTYPE\tTIME\tBUILD\tSIZE\tLABELS\tSOURCE")
+	for _, m := range metas {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			m.ID, m.Service, m.Type, m.Time.Local().Format(time.DateTime), build(m), m.Size, labels(m.Labels), m.Source)
+	}
+	return tw.Flush()
+}
+
+// build names the release, or the short commit, a profile was collected from.
+func build(m profilestore.Meta) string {
+	switch {
+	case m.Version != "":
+		return m.Version
+	case len(m.Commit) > 12:
+		return m.Commit[:12]
+	case m.Commit != "":
+		return m.Commit
+	}
+	return "-"
+}
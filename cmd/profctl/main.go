@@ -0,0 +1,142 @@
+// Command profctl manages a local profile store (package profilestore).
+//
+//	profctl import [-store dir] --service api [--labels env=prod,host=a] [--binary ./api] cpu.prof heap.prof ...
+//	profctl list [-store dir] [--service api] [--type cpu] [--labels env=prod]
+//	profctl retention [--service api] [--max-age 720h] [--max-count 100] [--max-bytes 1073741824]
+//	profctl compact [--dry-run]
+//	profctl compare --base v1.2.0 [--head HEAD] [--service api] [--type cpu] [--min-change 2]
+//	profctl merge [--service api] [--type cpu] [--since 24h] [--group-by handler] [-o merged.pb.gz]
+//	profctl serve [--addr localhost:7070] [--rate 10] [--burst 20]
+//	profctl keygen [--id k2]
+//	profctl rotate-keys [--encrypt-existing]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+const defaultStore = "profiles"
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"import", "store profile files collected elsewhere", runImport},
+	{"list", "list stored profiles", runList},
+	{"retention", "show or set per-service retention policies", runRetention},
+	{"compact", "deduplicate and apply retention policies", runCompact},
+	{"merge", "merge stored profiles, grouped by sample labels", runMerge},
+	{"compare", "diff the profiles of two releases or commits", runCompare},
+	{"serve", "serve stored profiles over HTTP", runServe},
+	{"keygen", "print a new encryption key for $PROFILESTORE_KEYS", runKeygen},
+	{"rotate-keys", "rewrap data keys with the current encryption key", runRotateKeys},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			// An interrupt cancels the command's KMS calls and store walks
+			// rather than killing it halfway through writing a file.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err := c.run(ctx, os.Args[2:])
+			stop()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "profctl %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: profctl <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+}
+
+// storeFlag registers the flag selecting the store directory, which defaults
+// to $PROFCTL_STORE or ./profiles.
+func storeFlag(fs *flag.FlagSet) *string {
+	dir := os.Getenv("PROFCTL_STORE")
+	if dir == "" {
+		dir = defaultStore
+	}
+	return fs.String("store", dir, "profile store directory")
+}
+
+// openStore opens the store in dir with the encryption keys configured in
+// the environment ($PROFILESTORE_KEYS or $PROFILESTORE_KMS_COMMAND).
+func openStore(dir string) (*profilestore.Store, error) {
+	keys, err := profilestore.LoadKeys()
+	if err != nil {
+		return nil, err
+	}
+	store, err := profilestore.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		store.SetKeys(keys)
+	}
+	return store, nil
+}
+
+// parse parses flags that may appear before, between, or after the
+// positional arguments, and returns the positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// labels is a flag of comma-separated k=v pairs; it may be repeated.
+type labels map[string]string
+
+func (l labels) String() string {
+	var pairs []string
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l labels) Set(s string) error {
+	for pair := range strings.SplitSeq(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("label %q is not k=v", pair)
+		}
+		l[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/merge"
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+func runMerge(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	dir := storeFlag(fs)
+	q := profilestore.Query{Labels: labels{}}
+	fs.StringVar(&q.Service, "service", "", "only profiles of this service")
+	fs.StringVar(&q.Type, "type", "cpu", "profile type to merge")
+	fs.Var(labels(q.Labels), "labels", "only profiles with these k=v labels")
+	since := fs.Duration("since", 0, "only profiles collected within this long, e.g. 24h")
+	groupBy := fs.String("group-by", "", "comma-separated sample labels to show as root frames, e.g. handler")
+	output := fs.String("o", "merged.pb.gz", "output file")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+	if *since > 0 {
+		q.From = time.Now().Add(-*since)
+	}
+	metas, err := store.List(q)
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		return errors.New("no matching profiles")
+	}
+
+	profiles := make([]*profile.Profile, 0, len(metas))
+	for _, m := range metas {
+		_, p, err := store.Profile(ctx, m.ID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.ID, err)
+		}
+		profiles = append(profiles, p)
+	}
+
+	var opts merge.Options
+	if *groupBy != "" {
+		opts.GroupBy = strings.Split(*groupBy, ",")
+	}
+	merged, err := merge.Merge(profiles, opts)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d profiles into %s\n", len(profiles), *output)
+	return nil
+}
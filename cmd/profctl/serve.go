@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/gosamurai/throttle"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dir := storeFlag(fs)
+	addr := fs.String("addr", "localhost:7070", "listen address")
+	rate := fs.Float64("rate", 0, "download bandwidth per client in MB/s (0 is unlimited)")
+	burst := fs.Float64("burst", 0, "download burst per client in MB (default one second of -rate)")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir)
+	if err != nil {
+		return err
+	}
+
+	var download http.Handler = http.HandlerFunc(store.DownloadHandler)
+	if *rate > 0 {
+		download = throttle.NewLimiter(int64(*rate*1e6), int64(*burst*1e6)).Handler(download)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /profiles", store.ListHandler)
+	mux.HandleFunc("GET /profiles/{id}/meta", store.MetaHandler)
+	mux.Handle("GET /profiles/{id}", download)
+
+	// An interrupt lets downloads in progress finish for a few seconds.
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("serving %s on http://%s/profiles", *dir, *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-stopped
+}
@@ -0,0 +1,103 @@
+// Command schedtest runs the concurrent programs of subtleties.Races many
+// times under varied GOMAXPROCS values and injected yields and sleeps, and
+// reports which ones gave different results under different schedules.
+//
+//	schedtest [-runs 200] [-procs 1,2,4,8] [-seed N] [LostUpdate ...]
+//	schedtest -replay 'GOMAXPROCS=4 run=17' -seed N LostUpdate
+//
+// It exits with status 1 when any program was divergent, 0 when all gave
+// one result. The programs that are broken on purpose are meant to fail.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/schedtest"
+	"github.com/vdntruong/gosamurai/subtleties"
+)
+
+var (
+	runs      = flag.Int("runs", 200, "runs per program and GOMAXPROCS value")
+	procs     = flag.String("procs", "", "comma-separated GOMAXPROCS values (default 1,2,4 and the number of CPUs)")
+	seed      = flag.Uint64("seed", 0, "perturbation seed (0 picks one and prints it)")
+	yieldRate = flag.Float64("yield", 0.3, "chance that a yield point calls runtime.Gosched")
+	sleepRate = flag.Float64("sleep", 0.05, "chance that a yield point sleeps")
+	replay    = flag.String("replay", "", "run one schedule of one program, as printed under FIRST SCHEDULE, 20 times")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: schedtest [flags] [program ...]\n\nprograms:\n")
+		for _, r := range subtleties.Races {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-20s %s\n", r.Name, r.Summary)
+		}
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg := schedtest.Config{Runs: *runs, Seed: *seed, YieldRate: *yieldRate, SleepRate: *sleepRate}
+	if *procs != "" {
+		for f := range strings.SplitSeq(*procs, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || n < 1 {
+				log.Fatalf("-procs: %q is not a GOMAXPROCS value", f)
+			}
+			cfg.Procs = append(cfg.Procs, n)
+		}
+	}
+	for cfg.Seed == 0 {
+		cfg.Seed = rand.Uint64()
+	}
+
+	var selected []subtleties.Race
+	for _, r := range subtleties.Races {
+		if flag.NArg() == 0 || slices.Contains(flag.Args(), r.Name) {
+			selected = append(selected, r)
+		}
+	}
+	if len(selected) < max(flag.NArg(), 1) {
+		log.Fatalf("unknown program in %v; schedtest -h lists them", flag.Args())
+	}
+
+	if *replay != "" {
+		if len(selected) != 1 {
+			log.Fatal("-replay needs exactly one program")
+		}
+		var s schedtest.Schedule
+		if _, err := fmt.Sscanf(*replay, "GOMAXPROCS=%d run=%d", &s.GOMAXPROCS, &s.Run); err != nil {
+			log.Fatalf("-replay: want 'GOMAXPROCS=N run=N', got %q", *replay)
+		}
+		runtime.GOMAXPROCS(s.GOMAXPROCS)
+		for range 20 {
+			result, yields, sleeps := schedtest.Replay(selected[0].Run, cfg, s)
+			fmt.Printf("%s (%d yields, %d sleeps)\n", result, yields, sleeps)
+		}
+		return
+	}
+
+	divergent := 0
+	for _, r := range selected {
+		fmt.Printf("=== %s: %s\n", r.Name, r.Summary)
+		rep := schedtest.Explore(r.Run, cfg)
+		if err := rep.WriteText(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println()
+		if rep.Divergent() {
+			divergent++
+		}
+	}
+	fmt.Printf("%d of %d programs divergent (seed %d)\n", divergent, len(selected), cfg.Seed)
+	if divergent > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+// Command speedscope converts a pprof profile into a speedscope JSON file
+// and, with -open, serves it to https://www.speedscope.app in the browser.
+//
+//	speedscope [-o cpu.speedscope.json] [-open] cpu.prof
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/speedscope"
+)
+
+const viewer = "https://www.speedscope.app"
+
+var (
+	output = flag.String("o", "", "output file (default: input with a .speedscope.json extension)")
+	open   = flag.Bool("open", false, "serve the converted profile and open it in speedscope")
+	addr   = flag.String("http", "localhost:0", "listen address for -open")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: speedscope [flags] profile.prof\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+
+	f, err := os.Open(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, err := profile.Parse(f)
+	f.Close()
+	if err != nil {
+		log.Fatal("parse profile: ", err)
+	}
+
+	var buf bytes.Buffer
+	if err := speedscope.Convert(p, filepath.Base(input)).Write(&buf); err != nil {
+		log.Fatal(err)
+	}
+
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(input, filepath.Ext(input)) + ".speedscope.json"
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s\n", out)
+
+	if *open {
+		serve(filepath.Base(out), buf.Bytes())
+	}
+}
+
+// serve makes the file available to the hosted viewer, which fetches it from
+// the URL given in its profileURL fragment, and blocks until interrupted.
+func serve(name string, data []byte) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", viewer)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	profileURL := fmt.Sprintf("http://%s/%s", ln.Addr(), name)
+	link := viewer + "/#profileURL=" + url.QueryEscape(profileURL)
+	fmt.Printf("Serving %s\nOpen %s\n", profileURL, link)
+	if err := browse(ctx, link); err != nil {
+		fmt.Println("Could not start a browser:", err)
+	}
+	srv := &http.Server{}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+func browse(ctx context.Context, link string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.CommandContext(ctx, "open", link).Start()
+	case "windows":
+		return exec.CommandContext(ctx, "rundll32", "url.dll,FileProtocolHandler", link).Start()
+	default:
+		return exec.CommandContext(ctx, "xdg-open", link).Start()
+	}
+}
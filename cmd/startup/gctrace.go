@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcStats is the GC work done over some span of the server's life.
+type gcStats struct {
+	Cycles int
+	// Pause is the stop-the-world time of those cycles.
+	Pause time.Duration
+}
+
+func (s gcStats) sub(t gcStats) gcStats {
+	return gcStats{Cycles: s.Cycles - t.Cycles, Pause: s.Pause - t.Pause}
+}
+
+// gcTrace totals the cycles the server reports with GODEBUG=gctrace=1.
+type gcTrace struct {
+	mu    sync.Mutex
+	total gcStats
+}
+
+func newGCTrace() *gcTrace {
+	return &gcTrace{}
+}
+
+// read consumes the server's stderr until it is closed, echoing it when
+// echo is set.
+func (g *gcTrace) read(r io.Reader, echo bool) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if echo {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		if pause, ok := parseGCLine(line); ok {
+			g.mu.Lock()
+			g.total.Cycles++
+			g.total.Pause += pause
+			g.mu.Unlock()
+		}
+	}
+	// Keep draining after an overlong line, or the server blocks writing.
+	io.Copy(io.Discard, r)
+}
+
+func (g *gcTrace) snapshot() gcStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.total
+}
+
+// parseGCLine reads the stop-the-world pause of a gctrace line,
+//
+//	gc 3 @0.021s 4%: 0.015+1.1+0.021 ms clock, 0.12+0.3/0.9/0+0.17 ms cpu, ...
+//
+// where the first and last of the clock times are the sweep termination and
+// mark termination pauses.
+func parseGCLine(line string) (time.Duration, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 7 || fields[0] != "gc" || !strings.HasPrefix(fields[2], "@") || fields[6] != "clock," {
+		return 0, false
+	}
+	phases := strings.Split(fields[4], "+")
+	if len(phases) != 3 {
+		return 0, false
+	}
+	var pause time.Duration
+	for _, ms := range []string{phases[0], phases[2]} {
+		v, err := strconv.ParseFloat(ms, 64)
+		if err != nil {
+			return 0, false
+		}
+		pause += time.Duration(v * float64(time.Millisecond))
+	}
+	return pause, true
+}
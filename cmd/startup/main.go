@@ -0,0 +1,270 @@
+// Command startup measures how a server behaves cold and warm. It starts the
+// server -runs times, and for each start measures the time until -ready
+// answers, the latency of the first request to -path, and the GC cycles run
+// by then (cold), then sends -warmup requests and measures -requests more
+// (warm). GC activity is read from the server's GODEBUG=gctrace=1 output, so
+// any Go server works without changes.
+//
+// With -store, every run is kept in a profile store (package profilestore)
+// as a profile of the phases, tagged with the server's version and commit,
+// so releases can be compared with profctl compare --type time.
+//
+//	startup [flags] ./webpprof [server args...]
+//	startup -path '/api/users?count=1000' -runs 10 -store profiles ./webpprof -seed 1
+package main
+
+import (
+	"cmp"
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+var (
+	baseURL      = flag.String("url", "http://localhost:8080", "base URL the server listens on")
+	readyPath    = flag.String("ready", "/", "path polled until the server answers")
+	readyTimeout = flag.Duration("ready-timeout", 30*time.Second, "how long to wait for the server to answer")
+	path         = flag.String("path", "/api/users?count=100", "path of the first request and the warm requests")
+	runs         = flag.Int("runs", 5, "number of cold starts")
+	warmup       = flag.Int("warmup", 100, "requests sent after the first one before measuring warm latency")
+	requests     = flag.Int("requests", 200, "warm requests measured")
+	verbose      = flag.Bool("v", false, "pass the server's output through")
+
+	storeDir = flag.String("store", "", "profile store directory to keep every run in (not stored if empty)")
+	service  = flag.String("service", "", "service name in the store (default <server>-startup)")
+	version  = flag.String("version", "", "release of the server (default read from its build info)")
+	commit   = flag.String("commit", "", "commit of the server (default read from its build info)")
+)
+
+// result is what one start of the server measured.
+type result struct {
+	Started time.Time
+
+	// Cold: process start until the ready path answers, the first request,
+	// and the GC work done by the end of it.
+	Ready        time.Duration
+	FirstRequest time.Duration
+	ColdGC       gcStats
+
+	// Warm: latency of the measured requests and the GC work during them.
+	WarmP50, WarmP99 time.Duration
+	WarmGC           gcStats
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: startup [flags] server [args...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *runs < 1 {
+		log.Fatal("-runs must be at least 1")
+	}
+	server, args := flag.Arg(0), flag.Args()[1:]
+	// An interrupt stops the run in progress, and the server with it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var store *profilestore.Store
+	if *storeDir != "" {
+		s, err := profilestore.Open(*storeDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = s
+		if bi, err := buildinfo.ReadFile(server); err == nil {
+			v, c := profilestore.BuildTags(bi)
+			*version = cmp.Or(*version, v)
+			*commit = cmp.Or(*commit, c)
+		}
+		*service = cmp.Or(*service, serviceName(server))
+	}
+
+	var results []result
+	for i := range *runs {
+		res, err := measure(ctx, server, args)
+		if err != nil {
+			log.Fatalf("run %d: %v", i+1, err)
+		}
+		fmt.Printf("run %d: ready %s, first request %s, warm p50 %s\n", i+1, res.Ready, res.FirstRequest, res.WarmP50)
+		results = append(results, res)
+
+		if store != nil {
+			meta, err := storeResult(ctx, store, res)
+			if err != nil {
+				log.Fatalf("run %d: store: %v", i+1, err)
+			}
+			fmt.Printf("  stored as %s/%s\n", meta.Service, meta.ID)
+		}
+	}
+	fmt.Println()
+	writeSummary(os.Stdout, results)
+}
+
+// measure starts the server once and takes it through the cold and warm
+// phases.
+func measure(ctx context.Context, server string, args []string) (result, error) {
+	cmd := exec.CommandContext(ctx, server, args...)
+	godebug := "gctrace=1"
+	if v := os.Getenv("GODEBUG"); v != "" {
+		godebug = v + "," + godebug
+	}
+	cmd.Env = append(os.Environ(), "GODEBUG="+godebug)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return result{}, err
+	}
+	if *verbose {
+		cmd.Stdout = os.Stdout
+	}
+	gc := newGCTrace()
+
+	res := result{Started: time.Now()}
+	if err := cmd.Start(); err != nil {
+		return result{}, err
+	}
+	go gc.read(stderr, *verbose)
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	client := &http.Client{Timeout: *readyTimeout}
+	if err := waitReady(ctx, client, res.Started); err != nil {
+		return result{}, err
+	}
+	res.Ready = time.Since(res.Started)
+
+	d, err := get(ctx, client, *path)
+	if err != nil {
+		return result{}, fmt.Errorf("first request: %w", err)
+	}
+	res.FirstRequest = d
+	res.ColdGC = gc.snapshot()
+
+	for range *warmup {
+		if _, err := get(ctx, client, *path); err != nil {
+			return result{}, fmt.Errorf("warmup: %w", err)
+		}
+	}
+	before := gc.snapshot()
+	latencies := make([]time.Duration, 0, *requests)
+	for range *requests {
+		d, err := get(ctx, client, *path)
+		if err != nil {
+			return result{}, fmt.Errorf("warm request: %w", err)
+		}
+		latencies = append(latencies, d)
+	}
+	res.WarmGC = gc.snapshot().sub(before)
+	slices.Sort(latencies)
+	res.WarmP50, res.WarmP99 = percentile(latencies, 0.50), percentile(latencies, 0.99)
+	return res, nil
+}
+
+// waitReady polls the ready path until the server answers with anything
+// but a server error.
+func waitReady(ctx context.Context, client *http.Client, started time.Time) error {
+	ctx, cancel := context.WithDeadline(ctx, started.Add(*readyTimeout))
+	defer cancel()
+	retry := time.NewTimer(5 * time.Millisecond)
+	defer retry.Stop()
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, *baseURL+*readyPath, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				return nil
+			}
+		}
+		retry.Reset(5 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready after %s", *readyTimeout)
+		case <-retry.C:
+		}
+	}
+}
+
+// get issues one GET and returns its latency, including reading the body.
+func get(ctx context.Context, client *http.Client, path string) (time.Duration, error) {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *baseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode >= 400 {
+		return 0, errors.New(resp.Status)
+	}
+	return time.Since(start), nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(int(float64(len(sorted))*p), len(sorted)-1)]
+}
+
+// writeSummary prints the median of every measurement over the runs.
+func writeSummary(w io.Writer, results []result) {
+	median := func(f func(result) time.Duration) time.Duration {
+		ds := make([]time.Duration, len(results))
+		for i, r := range results {
+			ds[i] = f(r)
+		}
+		slices.Sort(ds)
+		return percentile(ds, 0.5)
+	}
+	medianGC := func(f func(result) gcStats) gcStats {
+		cycles := make([]int, len(results))
+		pauses := make([]time.Duration, len(results))
+		for i, r := range results {
+			s := f(r)
+			cycles[i], pauses[i] = s.Cycles, s.Pause
+		}
+		slices.Sort(cycles)
+		slices.Sort(pauses)
+		return gcStats{Cycles: cycles[len(cycles)/2], Pause: percentile(pauses, 0.5)}
+	}
+
+	cold := medianGC(func(r result) gcStats { return r.ColdGC })
+	warm := medianGC(func(r result) gcStats { return r.WarmGC })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "median of %d runs\tcold\twarm\n", len(results))
+	fmt.Fprintf(tw, "start to ready\t%s\t\n", median(func(r result) time.Duration { return r.Ready }))
+	fmt.Fprintf(tw, "request latency\t%s\t%s p50, %s p99\n",
+		median(func(r result) time.Duration { return r.FirstRequest }),
+		median(func(r result) time.Duration { return r.WarmP50 }),
+		median(func(r result) time.Duration { return r.WarmP99 }))
+	fmt.Fprintf(tw, "GC cycles\t%d\t%d over %d requests\n", cold.Cycles, warm.Cycles, *requests)
+	fmt.Fprintf(tw, "GC pause\t%s\t%s\n", cold.Pause, warm.Pause)
+	tw.Flush()
+}
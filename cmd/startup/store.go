@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/profilestore"
+)
+
+// serviceName names the store service after the server binary, so startup
+// runs are kept apart from the server's own profiles.
+func serviceName(server string) string {
+	return strings.TrimSuffix(filepath.Base(server), filepath.Ext(server)) + "-startup"
+}
+
+// phaseProfile turns a result into a profile with one sample per phase,
+// each named as a function, so the diff and merge tools work on it like on
+// any other profile. Its sample types are the phase's time, GC cycles, and
+// GC pause.
+func phaseProfile(res result) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "time", Unit: "nanoseconds"},
+			{Type: "gc_cycles", Unit: "count"},
+			{Type: "gc_pause", Unit: "nanoseconds"},
+		},
+		DefaultSampleType: "time",
+		TimeNanos:         res.Started.UnixNano(),
+	}
+	add := func(name string, values ...int64) {
+		id := uint64(len(p.Function) + 1)
+		fn := &profile.Function{ID: id, Name: name}
+		loc := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: values})
+	}
+	add("cold/start_to_ready", int64(res.Ready), 0, 0)
+	add("cold/first_request", int64(res.FirstRequest), int64(res.ColdGC.Cycles), int64(res.ColdGC.Pause))
+	add("warm/request_p50", int64(res.WarmP50), int64(res.WarmGC.Cycles), int64(res.WarmGC.Pause))
+	add("warm/request_p99", int64(res.WarmP99), 0, 0)
+	return p
+}
+
+// storeResult keeps one run in the store, labeled harness=startup.
+func storeResult(ctx context.Context, store *profilestore.Store, res result) (profilestore.Meta, error) {
+	var buf bytes.Buffer
+	if err := phaseProfile(res).Write(&buf); err != nil {
+		return profilestore.Meta{}, err
+	}
+	return store.Put(ctx, buf.Bytes(), profilestore.Meta{
+		Service: *service,
+		Labels:  map[string]string{"harness": "startup", "path": *path},
+		Source:  "startup",
+		Version: *version,
+		Commit:  *commit,
+		Time:    res.Started,
+	})
+}
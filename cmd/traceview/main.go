@@ -0,0 +1,144 @@
+// Command traceview converts Go execution traces, or request timings from
+// the webpprof example's request archive, into Chrome trace-event JSON for
+// Perfetto (https://ui.perfetto.dev) or chrome://tracing.
+//
+//	traceview [-o trace.json] trace.out
+//	traceview -archive http://localhost:8080 [-limit 200] [-o requests.json]
+//	traceview -archive record.json [-o requests.json]
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/analysis/traceevent"
+)
+
+var (
+	output  = flag.String("o", "", "output file (default: input with a .json extension, or requests.json)")
+	archive = flag.Bool("archive", false, "read archived requests instead of an execution trace: a webpprof base URL or a JSON file of one record or an array of records")
+	limit   = flag.Int("limit", 200, "number of recent requests to fetch with -archive from a URL")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: traceview [flags] trace.out | traceview -archive URL|records.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+
+	var (
+		file *traceevent.File
+		err  error
+		out  = *output
+	)
+	if *archive {
+		var reqs []traceevent.Request
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		reqs, err = loadRequests(ctx, input)
+		stop()
+		if err == nil {
+			file = traceevent.FromRequests(reqs)
+		}
+		if out == "" {
+			out = "requests.json"
+		}
+	} else {
+		var f *os.File
+		if f, err = os.Open(input); err == nil {
+			file, err = traceevent.FromRuntimeTrace(f)
+			f.Close()
+		}
+		if out == "" {
+			out = strings.TrimSuffix(input, ".out") + ".json"
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w, err := os.Create(out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := file.Write(w); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %d events to %s; open it in https://ui.perfetto.dev\n", len(file.TraceEvents), out)
+}
+
+// loadRequests reads records from a file, or fetches the most recent ones
+// from a running webpprof server.
+func loadRequests(ctx context.Context, src string) ([]traceevent.Request, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return fetchRequests(ctx, strings.TrimSuffix(src, "/"))
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var reqs []traceevent.Request
+		return reqs, json.Unmarshal(data, &reqs)
+	}
+	var req traceevent.Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return []traceevent.Request{req}, nil
+}
+
+func fetchRequests(ctx context.Context, base string) ([]traceevent.Request, error) {
+	var summaries []struct {
+		ID string `json:"id"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf("%s/debug/requests?limit=%d", base, *limit), &summaries); err != nil {
+		return nil, err
+	}
+	reqs := make([]traceevent.Request, 0, len(summaries))
+	for _, s := range summaries {
+		var req traceevent.Request
+		if err := getJSON(ctx, base+"/debug/requests/"+url.PathEscape(s.ID), &req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+func getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GET %s: %s: %s", u, resp.Status, bytes.TrimSpace(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
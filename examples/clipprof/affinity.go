@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/affinity"
+)
+
+// pinCPUs pins the process to the CPUs of spec and sizes GOMAXPROCS to
+// them, returning the set.
+func pinCPUs(spec string) affinity.CPUSet {
+	set, err := affinity.Resolve(spec)
+	if err == nil {
+		err = affinity.Pin(set)
+	}
+	if err != nil {
+		log.Fatalf("could not pin to CPUs %s: %v", spec, err)
+	}
+	runtime.GOMAXPROCS(len(set))
+	return set
+}
+
+// runAffinityWorkload measures throughput pinned to each of -cpusets in turn,
+// splitting -duration between them: first CPU-bound work (Fibonacci numbers)
+// on every CPU of the set, then memory-bound work, chasing pointers through
+// -affinity-mem MB. The memory is first touched while pinned to the first
+// set, so the kernel places it on that set's NUMA node; a set on another
+// node reads it remotely, and its reads per second show what that costs.
+// The process is pinned back to its original CPUs at the end.
+func runAffinityWorkload(ctx context.Context) {
+	original, err := affinity.Get()
+	if err != nil {
+		log.Fatal("the affinity workload needs CPU pinning: ", err)
+	}
+	procs := runtime.GOMAXPROCS(0)
+	defer func() {
+		if err := affinity.Pin(original); err != nil {
+			log.Print("could not restore the CPU affinity: ", err)
+		}
+		runtime.GOMAXPROCS(procs)
+	}()
+
+	nodes := affinity.Nodes()
+	specs := strings.Fields(*cpuSetList)
+	for _, spec := range specs {
+		if _, err := affinity.Resolve(spec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(specs) == 0 {
+		specs = defaultCPUSets(original, nodes)
+	}
+	fmt.Printf("Running affinity workload (%d CPU sets, %d NUMA nodes, %d MB)...\n", len(specs), len(nodes), *affinityMem)
+
+	home := pinCPUs(specs[0])
+	ring := newPointerRing(*affinityMem << 20 / 8)
+	fmt.Printf("Memory placed from CPUs %s (node %s)\n", home, joinInts(affinity.NodesOf(home, nodes)))
+
+	phase := time.Duration(*duration) * time.Second / time.Duration(2*len(specs))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CPUS\tNODES\tFIB/S\tPER CPU\tREADS/S\tPER CPU\t")
+	for _, spec := range specs {
+		set := pinCPUs(spec)
+		var fib, reads float64
+		trace.WithRegion(ctx, "cpus "+spec+" fibonacci", func() {
+			fib = measureParallel(len(set), phase, func(uint64) uint64 { return computeFibonacci(20) })
+		})
+		trace.WithRegion(ctx, "cpus "+spec+" pointer chase", func() {
+			reads = measureParallel(len(set), phase, ring.chase)
+		})
+		n := float64(len(set))
+		fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.0f\t%.3g\t%.3g\t\n", set, joinInts(affinity.NodesOf(set, nodes)), fib, fib/n, reads, reads/n)
+	}
+	tw.Flush()
+}
+
+// defaultCPUSets returns the sets measured without -cpusets: the first
+// allowed CPU, every NUMA node if there is more than one, and all allowed
+// CPUs.
+func defaultCPUSets(allowed affinity.CPUSet, nodes []affinity.Node) []string {
+	specs := []string{fmt.Sprint(allowed[0])}
+	if len(nodes) > 1 {
+		for _, n := range nodes {
+			specs = append(specs, fmt.Sprintf("node%d", n.ID))
+		}
+	}
+	if len(allowed) > 1 {
+		specs = append(specs, allowed.String())
+	}
+	return specs
+}
+
+// measureParallel runs op on workers goroutines for d and returns the
+// operations per second. Each call of op is one operation; it gets the
+// result of the worker's previous call, which chains dependent work.
+func measureParallel(workers int, d time.Duration, op func(uint64) uint64) float64 {
+	var ops atomic.Uint64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(d)
+	for w := range workers {
+		wg.Go(func() {
+			var n uint64
+			v := uint64(w) * 7919
+			for time.Now().Before(deadline) {
+				for range 64 {
+					v = op(v)
+				}
+				n += 64
+			}
+			ops.Add(n)
+			atomic.AddUint64(&sink, v)
+		})
+	}
+	wg.Wait()
+	return float64(ops.Load()) / d.Seconds()
+}
+
+// pointerRing is one random cycle through a large array: following it reads
+// every element once, in an order no prefetcher can guess, so each read
+// waits for memory.
+type pointerRing []uint64
+
+// newPointerRing builds the cycle with Sattolo's shuffle, which writes, and
+// so places, every page.
+func newPointerRing(n int) pointerRing {
+	rng := random.Stream("affinity")
+	ring := make(pointerRing, max(n, 2))
+	for i := range ring {
+		ring[i] = uint64(i)
+	}
+	for i := len(ring) - 1; i > 0; i-- {
+		j := rng.IntN(i)
+		ring[i], ring[j] = ring[j], ring[i]
+	}
+	return ring
+}
+
+func (r pointerRing) chase(i uint64) uint64 {
+	return r[i%uint64(len(r))]
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// benchResult is one run as a benchmark result.
+type benchResult struct {
+	Report procReport
+	// CPU is the user and system time of the run's process, known only
+	// when a parent measured it; zero leaves it out.
+	CPU time.Duration
+}
+
+// benchResults turns the runs a parent measured into benchmark results.
+func benchResults(runs []procRun) []benchResult {
+	results := make([]benchResult, len(runs))
+	for i, r := range runs {
+		results[i] = benchResult{Report: r.Reports[0], CPU: r.CPU}
+	}
+	return results
+}
+
+// benchName names the benchmark after the workload, as a Go benchmark
+// function would be: BenchmarkCPU, BenchmarkGoroutines, BenchmarkMix/cpu=50,
+// BenchmarkScenario/steps. Runs of the same settings get the same name, so
+// benchstat pools them as samples of one benchmark.
+func benchName() string {
+	switch {
+	case *configFile != "":
+		return "BenchmarkScenario/" + strings.TrimSuffix(filepath.Base(*configFile), filepath.Ext(*configFile))
+	case *mixFlag != "":
+		return "BenchmarkMix/" + strings.ReplaceAll(*mixFlag, ",", "+")
+	}
+	var b strings.Builder
+	b.WriteString("Benchmark")
+	for part := range strings.SplitSeq(*workload, "-") {
+		if len(part) <= 3 {
+			// Short names are initialisms: CPU, GC.
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// writeBench writes results in the Go benchmark format to path, or stdout
+// for "-", after the configuration lines benchstat shows:
+//
+//	goos: linux
+//	goarch: amd64
+//	pkg: github.com/vdntruong/gosamurai/examples/clipprof
+//	BenchmarkCPU-8   1   10001234567 ns/op   139.2 work/s   371200 B/op   1203 allocs/op   0 gcs/op   0 gc-pause-ns/op
+//
+// Every run is one iteration, N = 1, of an operation that is the whole
+// workload; the -N suffix is its GOMAXPROCS, as go test prints it. Compare
+// two settings with benchstat old.txt new.txt.
+func writeBench(path string, results []benchResult) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "goos: %s\ngoarch: %s\npkg: github.com/vdntruong/gosamurai/examples/clipprof\n", runtime.GOOS, runtime.GOARCH)
+	name := benchName()
+	for _, r := range results {
+		rep := r.Report
+		fmt.Fprintf(bw, "%s-%d\t1\t%d ns/op", name, rep.GOMAXPROCS, rep.Elapsed.Nanoseconds())
+		if rep.Work > 0 && rep.Elapsed > 0 {
+			fmt.Fprintf(bw, "\t%.1f work/s", float64(rep.Work)/rep.Elapsed.Seconds())
+		}
+		if r.CPU > 0 {
+			fmt.Fprintf(bw, "\t%d cpu-ns/op", r.CPU.Nanoseconds())
+		}
+		fmt.Fprintf(bw, "\t%d B/op\t%d allocs/op\t%d gcs/op\t%d gc-pause-ns/op\n",
+			rep.TotalAlloc, rep.Mallocs, rep.NumGC, rep.PauseTotal.Nanoseconds())
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if path != "-" {
+		fmt.Printf("Benchmark results written to: %s\n", path)
+	}
+	return nil
+}
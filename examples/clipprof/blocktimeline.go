@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/vdntruong/gosamurai/analysis/blocktimeline"
+)
+
+// startBlockTimeline samples the block profile while the workload runs. The
+// returned function stops sampling and writes the HTML timeline.
+func startBlockTimeline(path string) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sampler := blocktimeline.NewSampler(*blockTimelineInterval)
+	done := make(chan error, 1)
+	go func() { done <- sampler.Run(ctx) }()
+
+	return func() error {
+		cancel()
+		if err := <-done; err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		timeline := sampler.Timeline()
+		title := fmt.Sprintf("Blocking timeline: %s workload", *workload)
+		return timeline.WriteHTML(f, title)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// runChannelsWorkload passes messages from -producers to -consumers over one
+// channel per buffer size in -chan-buffers, splitting -duration between
+// them. Consumers do a little work per message, so the channel is the
+// bottleneck: with no buffer every send waits for a receiver, and a buffer
+// lets producers run ahead until it fills. The block profile shows the
+// waiting in chansend and chanrecv; in the execution trace each buffer size
+// is a region, "channels buffer=N", with a "produce" or "consume" region
+// on each of its goroutines.
+func runChannelsWorkload(ctx context.Context) {
+	buffers := parseInts(*chanBuffers, 0)
+	fmt.Printf("Running channels workload (%d producers, %d consumers, buffers %v)...\n", *producers, *consumers, buffers)
+	phase := time.Duration(*duration) * time.Second / time.Duration(len(buffers))
+
+	for _, size := range buffers {
+		var sent, received uint64
+		var wait time.Duration
+		trace.WithRegion(ctx, fmt.Sprintf("channels buffer=%d", size), func() {
+			sent, received, wait = runChannelPhase(ctx, size, phase)
+		})
+		fmt.Printf("  buffer %-5d %10d messages (%.0f/s), producers blocked %s per message\n",
+			size, received, float64(received)/phase.Seconds(), wait/time.Duration(max(sent, 1)))
+	}
+}
+
+// runChannelPhase runs producers and consumers over a channel with size
+// buffered slots for d. It returns the messages sent and received and the
+// total time producers spent in send.
+func runChannelPhase(ctx context.Context, size int, d time.Duration) (sent, received uint64, wait time.Duration) {
+	ch := make(chan uint64, size)
+	deadline := time.Now().Add(d)
+
+	var mu sync.Mutex
+	var producersWG, consumersWG sync.WaitGroup
+	for i := range *producers {
+		producersWG.Go(func() {
+			defer trace.StartRegion(ctx, "produce").End()
+			var n uint64
+			var blocked time.Duration
+			p := newPacer("channels")
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				ch <- uint64(i)
+				blocked += time.Since(start)
+				n++
+				p.pace()
+			}
+			mu.Lock()
+			sent += n
+			wait += blocked
+			mu.Unlock()
+		})
+	}
+	for range *consumers {
+		consumersWG.Go(func() {
+			defer trace.StartRegion(ctx, "consume").End()
+			var n, result uint64
+			for v := range ch {
+				result += computeFibonacci(int(10 + v%5))
+				n++
+			}
+			mu.Lock()
+			received += n
+			sink += result
+			mu.Unlock()
+		})
+	}
+	producersWG.Wait()
+	close(ch)
+	consumersWG.Wait()
+	return sent, received, wait
+}
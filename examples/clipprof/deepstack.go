@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runDeepStackWorkload does fibonacci work at the bottom of an artificial
+// call chain of -stackdepth frames. Each round starts on a fresh goroutine,
+// so the runtime has to grow (copy) the stack every time, and CPU samples
+// carry stacks deeper than pprof's recording limit.
+func runDeepStackWorkload(context.Context) {
+	fmt.Printf("Running deep stack workload (%d frames)...\n", *stackDepth)
+	endTime := time.Now().Add(time.Duration(*duration) * time.Second)
+
+	var result uint64
+	rounds := 0
+	p := newPacer("deepstack")
+	for time.Now().Before(endTime) {
+		done := make(chan uint64)
+		go func() { done <- descend(*stackDepth) }()
+		result += <-done
+		rounds++
+		p.pace()
+	}
+
+	fmt.Printf("Deep stack workload: %d rounds, result: %d\n", rounds, result)
+}
+
+// descend recurses depth times before doing the actual work.
+//
+//go:noinline
+func descend(depth int) uint64 {
+	if depth <= 0 {
+		return computeFibonacci(25)
+	}
+	return descend(depth-1) + 1
+}
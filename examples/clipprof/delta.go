@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// contentionBase is the block and mutex profile as they stood when the
+// workload started, which -delta-profiles subtracts from the ones written
+// at the end.
+type contentionBase struct {
+	block, mutex *profile.Profile
+	at           time.Time
+}
+
+// snapshotContention reads the block and mutex profiles for a later delta,
+// or returns nil without -delta-profiles.
+func snapshotContention() (*contentionBase, error) {
+	if !*deltaProfiles {
+		return nil, nil
+	}
+	block, err := readRuntimeProfile("block")
+	if err != nil {
+		return nil, err
+	}
+	mutex, err := readRuntimeProfile("mutex")
+	if err != nil {
+		return nil, err
+	}
+	return &contentionBase{block: block, mutex: mutex, at: time.Now()}, nil
+}
+
+func readRuntimeProfile(name string) (*profile.Profile, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return profile.Parse(&buf)
+}
+
+// writeContentionProfile writes the named block or mutex profile to path.
+// With a base it writes only what was added since the base was taken:
+// the runtime keeps both profiles since the process started, so without it
+// the contention of the setup before the workload is in them too.
+func writeContentionProfile(path, name string, base *contentionBase) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if base == nil {
+		return pprof.Lookup(name).WriteTo(f, 0)
+	}
+
+	start := base.block
+	if name == "mutex" {
+		start = base.mutex
+	}
+	end, err := readRuntimeProfile(name)
+	if err != nil {
+		return err
+	}
+	delta, err := subtractProfile(end, start)
+	if err != nil {
+		return fmt.Errorf("%s delta: %w", name, err)
+	}
+	delta.TimeNanos = base.at.UnixNano()
+	delta.DurationNanos = time.Since(base.at).Nanoseconds()
+	return delta.Write(f)
+}
+
+// subtractProfile returns end minus start, without the stacks whose values
+// did not change, as net/http/pprof computes its ?seconds= deltas.
+func subtractProfile(end, start *profile.Profile) (*profile.Profile, error) {
+	start = start.Copy()
+	start.Scale(-1)
+	delta, err := profile.Merge([]*profile.Profile{end, start})
+	if err != nil {
+		return nil, err
+	}
+	samples := delta.Sample[:0]
+	for _, s := range delta.Sample {
+		for _, v := range s.Value {
+			if v != 0 {
+				samples = append(samples, s)
+				break
+			}
+		}
+	}
+	delta.Sample = samples
+	return delta, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// fibImpls are the Fibonacci implementations -fib-impl can pick for the cpu
+// workload. They compute the same numbers at very different costs, which a
+// CPU profile of each shows: recursive spends everything in one function
+// calling itself, exponentially often; iterative all but disappears from
+// the profile; memoized is linear too, but allocates its table on every
+// call, so it shows in the memory profile and as GC work.
+var fibImpls = map[string]func(int) uint64{
+	"recursive": computeFibonacci,
+	"iterative": fibIterative,
+	"memoized":  fibMemoized,
+}
+
+// parseFibImpls checks -fib-impl, a comma-separated list of fibImpls.
+func parseFibImpls(s string) ([]string, error) {
+	var names []string
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := fibImpls[name]; !ok {
+			return nil, fmt.Errorf("-fib-impl must be recursive, iterative, or memoized, or a list of them, got %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func fibIterative(n int) uint64 {
+	var a, b uint64 = 0, 1
+	for range n {
+		a, b = b, a+b
+	}
+	return a
+}
+
+func fibMemoized(n int) uint64 {
+	memo := make([]uint64, n+1)
+	var fib func(int) uint64
+	fib = func(n int) uint64 {
+		if n <= 1 {
+			return uint64(n)
+		}
+		if memo[n] == 0 {
+			memo[n] = fib(n-1) + fib(n-2)
+		}
+		return memo[n]
+	}
+	return fib(n)
+}
+
+// fibRun is the share of the cpu workload one implementation ran.
+type fibRun struct {
+	impl       string
+	iterations int
+	elapsed    time.Duration
+	// fib is the time spent in the Fibonacci calls alone.
+	fib time.Duration
+}
+
+func (r fibRun) perSecond() float64 { return float64(r.iterations) / r.elapsed.Seconds() }
+
+// fibMicros is the mean time of one Fibonacci call in microseconds.
+func (r fibRun) fibMicros() float64 {
+	if r.iterations == 0 {
+		return 0
+	}
+	return float64(r.fib.Nanoseconds()) / 1e3 / float64(r.iterations)
+}
+
+// printFibRuns compares the implementations. Iterations also compute primes,
+// which cost the same in every row and hide how far apart fast
+// implementations are, so the comparison is of the Fibonacci calls, timed
+// on their own.
+func printFibRuns(runs []fibRun) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "fib-impl\titerations\titerations/s\tµs/fib(30)\tfib vs "+runs[0].impl+"\t")
+	for _, r := range runs {
+		var speedup float64
+		if us := r.fibMicros(); us > 0 {
+			speedup = runs[0].fibMicros() / us
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%.3f\t%.0fx\t\n", r.impl, r.iterations, r.perSecond(), r.fibMicros(), speedup)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/flamegraph"
+	"github.com/vdntruong/gosamurai/analysis/speedscope"
+)
+
+// writeFlamegraphFile converts the CPU profile, once it is written, into the
+// -flamegraph file: a speedscope document for a .json name, an SVG flame
+// graph for any other.
+func writeFlamegraphFile() {
+	if *flamegraphFile == "" {
+		return
+	}
+	if err := writeFlamegraph(*cpuProfile, *flamegraphFile); err != nil {
+		fmt.Printf("could not write flame graph: %v\n", err)
+		return
+	}
+	fmt.Printf("Flame graph written to: %s\n", *flamegraphFile)
+}
+
+func writeFlamegraph(profilePath, path string) error {
+	in, err := os.Open(profilePath)
+	if err != nil {
+		return err
+	}
+	p, err := profile.Parse(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", profilePath, err)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	run := "workload " + *workload
+	switch {
+	case *configFile != "":
+		run = "scenario " + filepath.Base(*configFile)
+	case *mixFlag != "":
+		run = "mix " + *mixFlag
+	}
+	title := fmt.Sprintf("clipprof %s: %s", run, filepath.Base(profilePath))
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return speedscope.Convert(p, title).Write(out)
+	}
+	root, unit, err := flamegraph.Build(p, "cpu")
+	if err != nil {
+		return err
+	}
+	return root.WriteSVG(out, title, unit)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"runtime/metrics"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object size classes of the gc workload. Tiny objects are served by the
+// runtime's tiny allocator, small ones by the size-classed spans, and large
+// ones get spans of their own.
+var gcClasses = []struct {
+	name     string
+	min, max int
+}{
+	{"tiny", 1, 16},
+	{"small", 17, 32 << 10},
+	{"large", 32<<10 + 1, 1 << 20},
+}
+
+// parseGCMix parses -gc-mix, a percentage for each of gcClasses that are not
+// all zero.
+func parseGCMix(s string) ([]int, error) {
+	var mix []int
+	total := 0
+	for f := range strings.SplitSeq(s, ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("-gc-mix: invalid percentage %q in %q", f, s)
+		}
+		mix = append(mix, p)
+		total += p
+	}
+	if len(mix) != len(gcClasses) {
+		return nil, fmt.Errorf("-gc-mix needs %d percentages (tiny, small, large), got %q", len(gcClasses), s)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("-gc-mix %q allocates nothing", s)
+	}
+	return mix, nil
+}
+
+// runGCWorkload allocates for -duration from GOMAXPROCS goroutines, picking
+// every object's size class by -gc-mix and its size log-uniformly within the
+// class, so small sizes dominate as they do in real programs. A -gc-longlived
+// share of the objects replaces a random one of -gc-retain kept alive, which
+// gives them exponentially distributed lifetimes; the rest are dropped almost
+// at once. At the end it reports the collector's work from runtime/metrics:
+// cycles, CPU, live heap, and stop-the-world pause percentiles. Each
+// goroutine is an "allocate" region in the execution trace.
+func runGCWorkload(ctx context.Context) {
+	mix, _ := parseGCMix(*gcMix) // checked by checkWorkloadFlags
+	total := 0
+	for _, p := range mix {
+		total += p
+	}
+	workers := runtime.GOMAXPROCS(0)
+	fmt.Printf("Running GC workload (%d goroutines, mix %s tiny/small/large, %.0f%% long-lived, %d retained)...\n",
+		workers, *gcMix, *gcLongLived*100, *gcRetain)
+
+	before := readGCMetrics()
+	start := time.Now()
+	endTime := start.Add(time.Duration(*duration) * time.Second)
+
+	var (
+		mu             sync.Mutex
+		objects, sizes [3]uint64
+		wg             sync.WaitGroup
+	)
+	for i := range workers {
+		rng := random.Stream(fmt.Sprintf("gc/%d", i))
+		retained := make([][]byte, max(*gcRetain/workers, 1))
+		wg.Go(func() {
+			defer trace.StartRegion(ctx, "allocate").End()
+			var n, b [3]uint64
+			recent := make([][]byte, 16)
+			p := newPacer("gc")
+			for j := 0; time.Now().Before(endTime) || j%1024 != 0; j++ {
+				if j%64 == 0 {
+					p.pace()
+				}
+				class := pickClass(rng, mix, total)
+				obj := make([]byte, gcObjectSize(rng, class))
+				obj[0] = byte(j)
+				if rng.Float64() < *gcLongLived {
+					retained[rng.IntN(len(retained))] = obj
+				} else {
+					recent[j%len(recent)] = obj
+				}
+				n[class]++
+				b[class] += uint64(len(obj))
+			}
+			mu.Lock()
+			for c := range n {
+				objects[c] += n[c]
+				sizes[c] += b[c]
+			}
+			sink += uint64(len(retained[0]) + len(recent[0]))
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	after := readGCMetrics()
+
+	var count, size uint64
+	for c := range objects {
+		count += objects[c]
+		size += sizes[c]
+	}
+	fmt.Printf("GC workload: %d objects, %d MB in %s (%.0f MB/s)\n",
+		count, size>>20, elapsed.Round(time.Millisecond), float64(size>>20)/elapsed.Seconds())
+	for c, class := range gcClasses {
+		fmt.Printf("  %-6s %12d objects %8d MB\n", class.name, objects[c], sizes[c]>>20)
+	}
+	after.report(before)
+}
+
+// pickClass returns the index of a size class, weighted by mix.
+func pickClass(rng *rand.Rand, mix []int, total int) int {
+	n := rng.IntN(total)
+	for c, p := range mix {
+		if n < p {
+			return c
+		}
+		n -= p
+	}
+	return len(mix) - 1
+}
+
+// gcObjectSize returns a size in the class, log-uniformly distributed.
+func gcObjectSize(rng *rand.Rand, class int) int {
+	lo, hi := float64(gcClasses[class].min), float64(gcClasses[class].max)
+	return int(lo * math.Pow(hi/lo, rng.Float64()))
+}
+
+// gcMetrics is a reading of the runtime/metrics the gc workload reports.
+type gcMetrics struct {
+	cycles     uint64
+	gcCPU, cpu float64
+	liveHeap   uint64
+	pauses     *metrics.Float64Histogram
+	heapGoal   uint64
+	// limiterCycle is the last GC cycle the GC CPU limiter was on in.
+	limiterCycle uint64
+	pauseTotalNs uint64
+}
+
+func readGCMetrics() gcMetrics {
+	samples := []metrics.Sample{
+		{Name: "/gc/cycles/total:gc-cycles"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/gc/heap/live:bytes"},
+		{Name: "/sched/pauses/total/gc:seconds"},
+		{Name: "/gc/heap/goal:bytes"},
+		{Name: "/gc/limiter/last-enabled:gc-cycle"},
+	}
+	metrics.Read(samples)
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return gcMetrics{
+		cycles:       samples[0].Value.Uint64(),
+		gcCPU:        samples[1].Value.Float64(),
+		cpu:          samples[2].Value.Float64(),
+		liveHeap:     samples[3].Value.Uint64(),
+		pauses:       samples[4].Value.Float64Histogram(),
+		heapGoal:     samples[5].Value.Uint64(),
+		limiterCycle: samples[6].Value.Uint64(),
+		pauseTotalNs: m.PauseTotalNs,
+	}
+}
+
+// report prints what the collector did between before and m.
+func (m gcMetrics) report(before gcMetrics) {
+	// The pause histogram is cumulative; take the difference of the counts.
+	// Both readings share the runtime's fixed bucket boundaries.
+	counts := make([]uint64, len(m.pauses.Counts))
+	var pauses uint64
+	for i := range counts {
+		counts[i] = m.pauses.Counts[i] - before.pauses.Counts[i]
+		pauses += counts[i]
+	}
+	cpu := m.cpu - before.cpu
+	gcShare := 0.0
+	if cpu > 0 {
+		gcShare = (m.gcCPU - before.gcCPU) / cpu * 100
+	}
+
+	fmt.Printf("  GC cycles   %d\n", m.cycles-before.cycles)
+	fmt.Printf("  GC CPU      %.1f%% of %.1f CPU-seconds\n", gcShare, cpu)
+	fmt.Printf("  live heap   %d MB\n", m.liveHeap>>20)
+	fmt.Printf("  GC pauses   %d, p50 %s, p99 %s, max %s\n", pauses,
+		pauseQuantile(m.pauses.Buckets, counts, pauses, 0.50),
+		pauseQuantile(m.pauses.Buckets, counts, pauses, 0.99),
+		pauseQuantile(m.pauses.Buckets, counts, pauses, 1))
+}
+
+// pauseQuantile returns the upper bound of the histogram bucket holding the
+// q quantile of n pauses. Buckets has one more boundary than counts.
+func pauseQuantile(buckets []float64, counts []uint64, n uint64, q float64) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(n)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= max(rank, 1) {
+			bound := buckets[i+1]
+			if math.IsInf(bound, 1) {
+				bound = buckets[i]
+			}
+			return time.Duration(bound * float64(time.Second)).Round(time.Microsecond)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+)
+
+// ballast is the -ballast allocation. It is never read or written, only
+// kept reachable, so it counts in the heap the GC paces itself by but its
+// pages are never touched and take no resident memory.
+var ballast []byte
+
+// gcTuned reports whether -gogc, -gomemlimit, or -ballast is set.
+func gcTuned() bool {
+	return *gogc != "" || *goMemLimit != "" || *ballastSize != ""
+}
+
+// applyGCTuning sets the GC percent and memory limit from -gogc and
+// -gomemlimit, as the GOGC and GOMEMLIMIT environment variables would before
+// the program starts, and allocates the -ballast.
+func applyGCTuning() error {
+	if *gogc != "" {
+		percent := -1
+		if *gogc != "off" {
+			n, err := strconv.Atoi(*gogc)
+			if err != nil || n < 0 {
+				return fmt.Errorf("-gogc must be a percentage or off, got %q", *gogc)
+			}
+			percent = n
+		}
+		debug.SetGCPercent(percent)
+	}
+	if *goMemLimit != "" {
+		limit, err := parseMemLimit(*goMemLimit)
+		if err != nil {
+			return fmt.Errorf("-gomemlimit: %w", err)
+		}
+		debug.SetMemoryLimit(limit)
+	}
+	if *ballastSize != "" {
+		size, err := parseSize(*ballastSize, ballastUnits)
+		if err != nil || size == 0 {
+			return fmt.Errorf("-ballast: want a size such as 512MB, got %q", *ballastSize)
+		}
+		ballast = make([]byte, size)
+	}
+	return nil
+}
+
+// sizeUnit is a size suffix and the bytes it stands for.
+type sizeUnit struct {
+	suffix string
+	size   int64
+}
+
+// memLimitUnits are the suffixes GOMEMLIMIT accepts. Longer suffixes come
+// first, so MiB is not read as a number ending in B.
+var memLimitUnits = []sizeUnit{{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40}, {"B", 1}}
+
+// ballastUnits also take KB, MB, and GB, which ballast sizes are usually
+// written in, as the same powers of two.
+var ballastUnits = append([]sizeUnit{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}}, memLimitUnits...)
+
+// parseMemLimit reads a GOMEMLIMIT value: bytes with an optional B, KiB,
+// MiB, GiB, or TiB suffix, or off.
+func parseMemLimit(s string) (int64, error) {
+	if s == "off" {
+		return math.MaxInt64, nil
+	}
+	n, err := parseSize(s, memLimitUnits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit %q, want a size such as 512MiB or off", s)
+	}
+	return n, nil
+}
+
+// parseSize reads bytes with an optional suffix of units.
+func parseSize(s string, units []sizeUnit) (int64, error) {
+	num, unit := s, int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			num, unit = n, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// gcSettings describes the GC percent, memory limit, and ballast in effect.
+func gcSettings() string {
+	percent := debug.SetGCPercent(-1)
+	debug.SetGCPercent(percent)
+	limit := debug.SetMemoryLimit(-1)
+	gc, ml := "off", "off"
+	if percent >= 0 {
+		gc = strconv.Itoa(percent)
+	}
+	if limit != math.MaxInt64 {
+		ml = fmt.Sprintf("%d MiB", limit>>20)
+	}
+	s := fmt.Sprintf("GOGC %s, GOMEMLIMIT %s", gc, ml)
+	if ballast != nil {
+		s += fmt.Sprintf(", ballast %d MiB", len(ballast)>>20)
+	}
+	return s
+}
+
+// printGCTuning prints what the collector did during the run under the
+// -gogc, -gomemlimit, and -ballast settings, to compare against other
+// settings.
+func printGCTuning(before gcMetrics, elapsed time.Duration) {
+	after := readGCMetrics()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	fmt.Println("\n=== GC Tuning ===")
+	fmt.Printf("Settings:          %s\n", gcSettings())
+	after.report(before)
+	cycles := after.cycles - before.cycles
+	fmt.Printf("  pause total %s (%.2f%% of %s)\n", time.Duration(m.PauseTotalNs-before.pauseTotalNs).Round(time.Microsecond),
+		float64(m.PauseTotalNs-before.pauseTotalNs)/float64(elapsed)*100, elapsed.Round(time.Millisecond))
+	if cycles > 0 {
+		fmt.Printf("  GC rate     one cycle every %s\n", (elapsed / time.Duration(cycles)).Round(time.Microsecond))
+	}
+	fmt.Printf("  heap goal   %d MB at the end, %d MB of heap held from the OS\n", after.heapGoal>>20, (m.HeapSys-m.HeapReleased)>>20)
+	if after.limiterCycle > before.limiterCycle {
+		fmt.Printf("  CPU limiter last on in cycle %d: GC was capped at 50%% of the CPU and the heap grew past the memory limit\n", after.limiterCycle)
+	}
+	if ballast != nil {
+		rss := "unknown"
+		if ps, err := procstats.Read(); err == nil && ps.RSS > 0 {
+			rss = fmt.Sprintf("%d MB", ps.RSS>>20)
+		}
+		fmt.Printf("  ballast     %d MiB of the live heap, never touched: resident memory %s\n", len(ballast)>>20, rss)
+	}
+}
@@ -1,3 +1,9 @@
 module github.com/vdntruong/gosamurai/examples/clipprof
 
-go 1.25
+go 1.25.0
+
+require github.com/vdntruong/gosamurai v0.0.0
+
+require github.com/google/pprof v0.0.0-20260926063103-aaccee046517
+
+replace github.com/vdntruong/gosamurai => ../..
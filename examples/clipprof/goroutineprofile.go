@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// writeGoroutineProfile writes the stacks of all current goroutines to path.
+func writeGoroutineProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// midRunPath is where the mid-run goroutine profile goes: goroutine.prof
+// becomes goroutine.mid.prof.
+func midRunPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".mid" + ext
+}
+
+// scheduleGoroutineProfile writes a goroutine profile after the given delay,
+// while the workload's goroutines are still alive; by the time the workload
+// ends most of them have returned. The returned function cancels it if the
+// workload ends first.
+func scheduleGoroutineProfile(path string, after time.Duration) (cancel func()) {
+	t := time.AfterFunc(after, func() {
+		n := pprof.Lookup("goroutine").Count()
+		if err := writeGoroutineProfile(path); err != nil {
+			log.Printf("could not write mid-run goroutine profile: %v", err)
+			return
+		}
+		fmt.Printf("Goroutine profile (%d goroutines after %s) written to: %s\n", n, after, path)
+	})
+	return func() { t.Stop() }
+}
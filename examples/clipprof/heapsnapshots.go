@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// numberedPath inserts a sequence number before the extension:
+// heap.pprof becomes heap.003.pprof.
+func numberedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%03d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// writeHeapProfile forces a collection, so in-use numbers are current like
+// those of the final profile, and writes the heap profile to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// startHeapSnapshots writes a numbered heap profile next to path every
+// interval while the workload runs. The returned function stops and
+// reports how many were written.
+func startHeapSnapshots(path string, interval time.Duration) (stop func() int) {
+	done := make(chan struct{})
+	count := make(chan int)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		n := 0
+		for {
+			select {
+			case <-done:
+				count <- n
+				return
+			case <-ticker.C:
+				n++
+				p := numberedPath(path, n)
+				if err := writeHeapProfile(p); err != nil {
+					log.Printf("could not write heap snapshot: %v", err)
+					continue
+				}
+				fmt.Printf("Heap snapshot %d written to: %s\n", n, p)
+			}
+		}
+	}()
+	return func() int {
+		close(done)
+		return <-count
+	}
+}
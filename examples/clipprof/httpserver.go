@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"time"
+)
+
+// startPprofServer serves net/http/pprof on addr while the workload runs,
+// so go tool pprof can attach to the live process. The returned function
+// shuts the server down, letting profile downloads in progress finish for
+// a few seconds.
+func startPprofServer(addr string) (shutdown func()) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal("could not start pprof server: ", err)
+	}
+	srv := &http.Server{Handler: http.DefaultServeMux}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("pprof server: %v", err)
+		}
+	}()
+	fmt.Printf("pprof server listening on http://%s/debug/pprof/\n", l.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("pprof server shutdown: %v", err)
+			srv.Close()
+		}
+		<-done
+		fmt.Println("pprof server stopped")
+	}
+}
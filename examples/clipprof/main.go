@@ -1,41 +1,417 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/vdntruong/gosamurai/affinity"
+	"github.com/vdntruong/gosamurai/randsource"
 )
 
 var (
-	cpuProfile   = flag.String("cpuprofile", "", "write cpu profile to file")
-	memProfile   = flag.String("memprofile", "", "write memory profile to file")
-	traceFile    = flag.String("trace", "", "write execution trace to file")
-	blockProfile = flag.String("blockprofile", "", "write block profile to file")
-	mutexProfile = flag.String("mutexprofile", "", "write mutex profile to file")
-
-	workload   = flag.String("workload", "all", "workload type: cpu, memory, goroutines, all")
+	cpuProfile     = flag.String("cpuprofile", "", "write cpu profile to file")
+	memProfile     = flag.String("memprofile", "", "write memory profile to file")
+	traceFile      = flag.String("trace", "", "write execution trace to file")
+	blockProfile   = flag.String("blockprofile", "", "write block profile to file")
+	mutexProfile   = flag.String("mutexprofile", "", "write mutex profile to file")
+	deltaProfiles  = flag.Bool("delta-profiles", false, "write the block and mutex profiles as the delta over the workload, without the contention before it")
+	flamegraphFile = flag.String("flamegraph", "", "convert the CPU profile into a flame graph in this file at the end: SVG, or speedscope JSON for a .json name")
+	topN           = flag.Int("top", 10, "after writing the CPU and heap profiles, print their top N functions (0 disables)")
+	heapInterval   = flag.Duration("heapinterval", 0, "also write a numbered heap profile this often while the workload runs (0 disables)")
+	httpAddr       = flag.String("http", "", "serve net/http/pprof on this address (e.g. :6060) while the workload runs")
+	selfTest       = flag.Bool("selftest", false, "check that profiling works in this environment and exit")
+	outDir         = flag.String("outdir", "", "write every profile, the trace, and metadata.json into a new timestamped directory under this one")
+	bundle         = flag.String("bundle", "", "write every profile, the trace, and metadata.json as with -outdir and pack the run directory into this .tar.gz archive at the end")
+	sinksFile      = flag.String("sinks", "", "after the run, send its profiles and reports to the sinks listed in this JSON file, as in the \"sinks\" block of -config")
+	pushURL        = flag.String("push-url", "", "after the run, push its pprof profiles to the Pyroscope or Parca server at this URL, such as http://localhost:4040")
+	pushBackend    = flag.String("push-backend", "pyroscope", "API of the -push-url server: pyroscope or parca")
+	pushApp        = flag.String("push-app", "clipprof", "application name of the profiles pushed to -push-url")
+	pushLabels     = flag.String("push-labels", "", "labels of the profiles pushed to -push-url, name=value separated by commas, next to the workload label")
+	upload         = flag.String("upload", "", "write every profile as with -outdir and copy the run directory, or the -bundle archive, to this s3://bucket/prefix or gs://bucket/prefix after the run, with the aws or gcloud CLI")
+	configFile     = flag.String("config", "", "run the steps of this JSON scenario file instead of -workload")
+	mixFlag        = flag.String("mix", "", "run these workloads together at weighted intensity instead of -workload, as cpu=50,memory=30,goroutines=20")
+	pitfallFlag    = flag.String("pitfall", "", "run the broken and the fixed variant of this subtlety pitfall, or all, instead of -workload, and compare their cost")
+	procs          = flag.Int("procs", 1, "run the workload in this many processes side by side, then in one with as many times -goroutines, and compare")
+	runCount       = flag.Int("runs", 1, "run the workload this many times, each in a new process, and report the mean, spread, and p95 of its timing and throughput")
+	sweepProcs     = flag.String("sweep-gomaxprocs", "", "rerun the workload once at each of these GOMAXPROCS values, as 1,2,4,8, and compare")
+
+	goroutineProfile   = flag.String("goroutineprofile", "", "write goroutine profile to file at the end of the workload, and to <file>.mid<ext> during it")
+	goroutineProfileAt = flag.Duration("goroutineprofile-at", 0, "when to write the mid-run goroutine profile (default half of -duration, negative disables)")
+
+	pitfallRounds = flag.Int("pitfall-rounds", 1000, "rounds of each variant -pitfall runs")
+
+	blockTimeline         = flag.String("blocktimeline", "", "write an HTML timeline of when goroutines blocked to file")
+	blockTimelineInterval = flag.Duration("blocktimeline-interval", 250*time.Millisecond, "block profile sampling interval for -blocktimeline")
+
+	wallProfile   = flag.String("wallprofile", "", "write a wall-clock profile, sampling every goroutine on or off the CPU, to file")
+	wallProfileHz = flag.Int("wallprofile-hz", 99, "goroutine stack samples per second for -wallprofile")
+
+	pluginFiles    = flag.String("plugin", "", "load workloads, sinks, and analyzers from these comma-separated Go plugin files (needs a build with -tags plugins)")
+	pluginArgsFlag = flag.String("plugin-args", "", "name=value settings for plugin workloads, separated by commas")
+
+	workload   = flag.String("workload", "all", "workload type: cpu, memory, goroutines, deepstack, sampling, mutex, channels, gc, affinity, network, stack, all")
 	iterations = flag.Int("iterations", 1000, "number of iterations for CPU workload")
+	fibImpl    = flag.String("fib-impl", "recursive", "Fibonacci implementation of the cpu workload: recursive, iterative, or memoized, or a comma-separated list of them to compare, splitting -duration between them")
 	allocSize  = flag.Int("allocsize", 1000, "size in MB for memory workload")
 	goroutines = flag.Int("goroutines", 100, "number of goroutines to spawn")
 	duration   = flag.Int("duration", 10, "duration in seconds to run workload")
+	stackDepth = flag.Int("stackdepth", 500, "call depth for the deepstack and stack workloads")
+	stackFrame = flag.Int("stack-frame", 1024, "frame size in bytes for the stack workload: 64, 1024, or 8192")
+	mutexHold  = flag.Duration("mutex-hold", 100*time.Microsecond, "how long the mutex workload holds its lock per acquisition")
+
+	producers   = flag.Int("producers", 4, "sending goroutines of the channels workload")
+	consumers   = flag.Int("consumers", 4, "receiving goroutines of the channels workload")
+	chanBuffers = flag.String("chan-buffers", "0,1,64", "comma-separated channel buffer sizes the channels workload runs in turn")
+	gcMix       = flag.String("gc-mix", "70,25,5", "percentages of tiny, small, and large objects the gc workload allocates")
+	gcLongLived = flag.Float64("gc-longlived", 0.05, "share of the gc workload's objects kept alive past the next few allocations")
+	gcRetain    = flag.Int("gc-retain", 20000, "long-lived objects the gc workload keeps alive at once")
+	connections = flag.Int("connections", 16, "concurrent clients of the network workload")
+	payload     = flag.Int("payload", 4096, "response size in bytes of the network workload")
+	keepAlive   = flag.Bool("keepalive", true, "reuse connections in the network workload; false dials one per request")
+	cpus        = flag.String("cpus", "", "pin the process to these CPUs, a list (0-3,8), a NUMA node (node1), or all, and size GOMAXPROCS to them (Linux)")
+	cpuSetList  = flag.String("cpusets", "", "space-separated CPU sets the affinity workload measures in turn, in -cpus syntax (default one CPU, each NUMA node, all)")
+	affinityMem = flag.Int("affinity-mem", 256, "size in MB of the memory the affinity workload reads")
+	gogc        = flag.String("gogc", "", "GC percent to run with, as GOGC: a percentage or off (default: GOGC or 100)")
+	goMemLimit  = flag.String("gomemlimit", "", "memory limit to run with, as GOMEMLIMIT: a size such as 512MiB, or off")
+	ballastSize = flag.String("ballast", "", "allocate a ballast of this size, such as 512MB, before the workload, so the GC waits for more heap growth between cycles")
+	statsFormat = flag.String("stats-format", "text", "format of the final runtime statistics: text, json, or csv")
+	benchOutput = flag.String("bench-output", "", "also write the results in Go benchmark format to this file (- for stdout), one line per run, for benchstat")
+	statsFile   = flag.String("stats-file", "", "write the final runtime statistics to this file instead of stdout")
+	warmup      = flag.Duration("warmup", 0, "run the workload this long, in whole seconds, before the profilers start, then for -duration with them")
+	seed        = flag.Uint64("seed", 0, "seed for the data the workloads generate (0 picks one and prints it)")
+	progress    = flag.Duration("progress", 5*time.Second, "print a status line of elapsed time, ops/sec, heap in use, GC count, and goroutines this often while the workload runs (0 disables)")
+	quiet       = flag.Bool("quiet", false, "do not print the -progress status lines on stderr")
+	stackDump   = flag.String("stackdump", "goroutines.txt", "on SIGUSR1 or SIGQUIT while the workload runs, write the stack of every goroutine to a numbered file next to this one and keep running (empty disables)")
+
+	samplingRates  = flag.String("sampling-rates", "100,500,1000", "comma-separated CPU profile rates in Hz for the sampling workload")
+	samplingDepths = flag.String("sampling-depths", "16,128,1024", "comma-separated stack depths for the sampling workload")
+	samplingRounds = flag.Int("sampling-rounds", 2000, "rounds of work per measured run in the sampling workload")
 )
 
 func main() {
+	if run() {
+		os.Exit(exitInterrupted)
+	}
+}
+
+// checkWorkloadFlags checks the workload flags a value could make fail or
+// hang, so a bad one stops the run before the profilers start; scenario
+// steps are checked with their flags applied.
+func checkWorkloadFlags() error {
+	if _, err := parseFibImpls(*fibImpl); err != nil {
+		return err
+	}
+	if err := checkStackFrames(); err != nil {
+		return err
+	}
+	if _, err := parseGCMix(*gcMix); err != nil {
+		return err
+	}
+	if *producers < 1 || *consumers < 1 {
+		return errors.New("-producers and -consumers must be at least 1")
+	}
+	return nil
+}
+
+// run profiles the workload and reports whether it was interrupted. The
+// deferred profile Stop and Close calls run when it returns, before main
+// exits.
+func run() (interrupted bool) {
 	flag.Parse()
+	if *selfTest {
+		runSelfTest()
+	}
+	ph := &phases{}
+	ph.begin("setup")
+	random = randsource.New(*seed)
+	loadPlugins()
+	var pinned affinity.CPUSet
+	if *cpus != "" {
+		pinned = pinCPUs(*cpus)
+	}
+	if err := applyGCTuning(); err != nil {
+		log.Fatal(err)
+	}
+	if !slices.Contains(statsFormats, *statsFormat) {
+		log.Fatalf("-stats-format must be one of %s, got %q", strings.Join(statsFormats, ", "), *statsFormat)
+	}
+	if _, ok := workloads[*workload]; !ok {
+		log.Fatalf("Unknown workload: %s", *workload)
+	}
+	runWorkload := func(ctx context.Context) { runLabeled(ctx, *workload, workloads[*workload]) }
+	var sinkConfigs []sinkConfig
+	if *configFile != "" {
+		sc, err := loadScenario(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runWorkload = func(ctx context.Context) { runScenario(ctx, sc) }
+		sinkConfigs = sc.Sinks
+	}
+	if *sinksFile != "" {
+		configs, err := loadSinks(*sinksFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinkConfigs = append(sinkConfigs, configs...)
+	}
+	if *pushURL != "" {
+		if !slices.Contains(pushBackends, *pushBackend) {
+			log.Fatalf("-push-backend must be one of %s, got %q", strings.Join(pushBackends, ", "), *pushBackend)
+		}
+		labels, err := parseLabels(*pushLabels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinkConfigs = append(sinkConfigs, sinkConfig{Type: *pushBackend, URL: *pushURL, App: *pushApp, Labels: labels})
+	}
+	for _, c := range sinkConfigs {
+		s, err := c.sink()
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+	var mixNames []string
+	var mixWeights map[string]float64
+	if *mixFlag != "" {
+		if *configFile != "" {
+			log.Fatal("-mix cannot be combined with -config; give the scenario steps a mix instead")
+		}
+		entries := strings.Split(*mixFlag, ",")
+		var err error
+		if mixNames, mixWeights, err = parseMix(entries); err != nil {
+			log.Fatal("-mix: ", err)
+		}
+		runWorkload = func(ctx context.Context) { runMix(ctx, entries) }
+	}
+	if *runCount < 1 {
+		log.Fatal("-runs must be at least 1")
+	}
+	if *runCount > 1 && *procs > 1 {
+		log.Fatal("-runs cannot be combined with -procs")
+	}
+	if *benchOutput != "" && *procs > 1 {
+		log.Fatal("-bench-output cannot be combined with -procs")
+	}
+	if *pitfallFlag != "" && (*configFile != "" || *mixFlag != "" || *procs > 1 || *runCount > 1 || *sweepProcs != "") {
+		log.Fatal("-pitfall cannot be combined with -config, -mix, -procs, -runs, or -sweep-gomaxprocs")
+	}
+	if *pitfallRounds < 1 {
+		log.Fatal("-pitfall-rounds must be at least 1")
+	}
+	if err := checkWorkloadFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if *blockTimelineInterval <= 0 {
+		log.Fatal("-blocktimeline-interval must be positive")
+	}
+	if *warmup < 0 || *warmup%time.Second != 0 {
+		log.Fatal("-warmup must be a whole number of seconds, like -duration")
+	}
+	if *warmup > 0 && (*configFile != "" || *pitfallFlag != "") {
+		log.Fatal("-warmup cannot be combined with -config or -pitfall")
+	}
+	var sweep []int
+	if *sweepProcs != "" && !isChild() {
+		if *procs > 1 || *cpus != "" {
+			log.Fatal("-sweep-gomaxprocs cannot be combined with -procs or -cpus")
+		}
+		sweep = parseInts(*sweepProcs, 1)
+	}
+	started := time.Now()
+
+	if *upload != "" {
+		if err := checkUpload(*upload); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var runDir string
+	parent := *outDir
+	temporary := false
+	// The bundle and the upload run in defers; their error is reported by
+	// this one, which runs last, after the temporary run directory is gone
+	var packErr error
+	defer func() {
+		if packErr != nil {
+			log.Fatal(packErr)
+		}
+	}()
+	if (*bundle != "" || *upload != "" || len(sinks) > 0) && parent == "" {
+		// Without -outdir the run directory only lives until it is packed,
+		// uploaded, or sent
+		d, err := os.MkdirTemp("", "clipprof-run-")
+		if err != nil {
+			log.Fatal("could not create output directory: ", err)
+		}
+		defer os.RemoveAll(d)
+		parent, temporary = d, true
+	}
+	if parent != "" {
+		dir, err := applyOutDir(parent, started)
+		if err != nil {
+			log.Fatal("could not create output directory: ", err)
+		}
+		runDir = dir
+	}
+	// After -outdir, which sets -cpuprofile
+	if *flamegraphFile != "" && *cpuProfile == "" {
+		log.Fatal("-flamegraph converts the CPU profile and needs -cpuprofile or -outdir")
+	}
+	if *upload != "" {
+		// Deferred before the bundle, so it runs after it is written
+		defer func() {
+			if packErr != nil {
+				return
+			}
+			where, err := uploadRun(*upload, runDir, *bundle)
+			if err != nil {
+				packErr = fmt.Errorf("could not upload the run: %w", err)
+				return
+			}
+			fmt.Printf("Run uploaded to: %s\n", where)
+		}()
+	}
+	if *bundle != "" {
+		// Deferred before the flame graph and plugin outputs, so it runs
+		// after they are written
+		defer func() {
+			n, err := writeBundle(*bundle, runDir)
+			if err != nil {
+				packErr = fmt.Errorf("could not write bundle: %w", err)
+				return
+			}
+			fmt.Printf("Bundle of %d files written to: %s\n", n, *bundle)
+		}()
+	}
 
 	fmt.Println("CLI Application with pprof Profiling")
 	fmt.Println("=====================================")
-	fmt.Printf("Workload: %s\n", *workload)
-	fmt.Printf("Duration: %d seconds\n", *duration)
+	if *configFile != "" {
+		fmt.Printf("Scenario: %s\n", *configFile)
+	} else if *pitfallFlag != "" {
+		fmt.Printf("Pitfall:  %s (%d rounds of each variant)\n", *pitfallFlag, *pitfallRounds)
+	} else if mixNames != nil {
+		fmt.Printf("Workload: mix of %s\n", describeMix(mixNames, mixWeights))
+		fmt.Printf("Duration: %d seconds\n", *duration)
+	} else {
+		fmt.Printf("Workload: %s\n", *workload)
+		fmt.Printf("Duration: %d seconds\n", *duration)
+	}
+	if *warmup > 0 {
+		fmt.Printf("Warmup:   %s, not profiled\n", *warmup)
+	}
+	fmt.Printf("Seed:     %d\n", random.Seed())
+	if *bundle != "" {
+		fmt.Printf("Bundle:   %s\n", *bundle)
+	} else if runDir != "" && !temporary {
+		fmt.Printf("Output:   %s\n", runDir)
+	}
+	if pinned != nil {
+		fmt.Printf("CPUs:     %s (GOMAXPROCS %d)\n", pinned, runtime.GOMAXPROCS(0))
+	}
+	if gcTuned() {
+		fmt.Printf("GC:       %s\n", gcSettings())
+	}
+	if p := os.Getenv(envProc); p != "" {
+		fmt.Printf("Process:  %s\n", p)
+	}
 	fmt.Println()
 
+	// Deferred before the pitfalls and the child processes return, so their
+	// runs reach the analyzers and sinks as well
+	defer func() { runOutputs(runDir, started, time.Since(started), interrupted) }()
+
+	if *pitfallFlag != "" {
+		dir := runDir
+		if dir == "" {
+			d, err := os.MkdirTemp("", "clipprof-pitfalls-")
+			if err != nil {
+				log.Fatal("could not create profile directory: ", err)
+			}
+			dir = d
+		}
+		if err := runPitfalls(dir); err != nil {
+			log.Fatal(err)
+		}
+		if !temporary {
+			fmt.Printf("\nProfiles of every variant are under %s\n", dir)
+		}
+		if runDir != "" {
+			if err := writeMetadata(runDir, started, time.Since(started), false); err != nil {
+				log.Fatal("could not write metadata: ", err)
+			}
+		}
+		return false
+	}
+
+	if (*procs > 1 || sweep != nil || *runCount > 1) && !isChild() {
+		dir := runDir
+		if dir == "" {
+			d, err := os.MkdirTemp("", "clipprof-procs-")
+			if err != nil {
+				log.Fatal("could not create process directory: ", err)
+			}
+			dir = d
+		}
+		var err error
+		switch {
+		case sweep != nil:
+			interrupted, err = runSweep(dir, sweep)
+		case *runCount > 1:
+			interrupted, err = runRepeated(dir)
+		default:
+			interrupted, err = runProcs(dir)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !temporary {
+			what := "process"
+			if sweep != nil || *runCount > 1 {
+				what = "run"
+			}
+			fmt.Printf("\nOutput and profiles of every %s are under %s\n", what, dir)
+		}
+		if runDir != "" {
+			if err := writeMetadata(runDir, started, time.Since(started), interrupted); err != nil {
+				log.Fatal("could not write metadata: ", err)
+			}
+		}
+		return interrupted
+	}
+
+	// Deferred first, so they run last: after the CPU profile is stopped
+	// and its file closed.
+	if !isChild() {
+		defer ph.print(os.Stdout)
+	}
+	defer printTopSummaries()
+	defer writeFlamegraphFile()
+
+	// With -warmup the workload starts now, and the profilers once it has
+	// warmed up
+	var waitWorkload func() bool
+	if *warmup > 0 {
+		ph.begin("warmup")
+		waitWorkload = warmUp(runWorkload)
+		ph.begin("setup")
+	}
+
 	// Setup CPU profiling
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
@@ -70,117 +446,294 @@ func main() {
 	runtime.SetBlockProfileRate(1)
 	runtime.SetMutexProfileFraction(1)
 
-	fmt.Println("\nStarting workload...")
+	var stopBlockTimeline func() error
+	if *blockTimeline != "" {
+		stopBlockTimeline = startBlockTimeline(*blockTimeline)
+	}
+	var stopWallProfile func() error
+	if *wallProfile != "" {
+		stopWallProfile = startWallProfile(*wallProfile)
+		fmt.Printf("Wall-clock profiling enabled at %d Hz, writing to: %s\n", *wallProfileHz, *wallProfile)
+	}
+
+	stopServer := func() {}
+	if *httpAddr != "" {
+		stopServer = startPprofServer(*httpAddr)
+	}
+
+	contention, err := snapshotContention()
+	if err != nil {
+		log.Fatal("could not read block and mutex profiles: ", err)
+	}
+
+	if waitWorkload != nil {
+		fmt.Println("\nWarmup over, profiling the workload...")
+	} else {
+		fmt.Println("\nStarting workload...")
+	}
+	gcBefore := readGCMetrics()
+	ph.begin("workload")
 	startTime := time.Now()
 
+	cancelGoroutineProfile := func() {}
+	if *goroutineProfile != "" && *goroutineProfileAt >= 0 {
+		at := *goroutineProfileAt
+		if at == 0 {
+			at = measuredDuration() / 2
+		}
+		cancelGoroutineProfile = scheduleGoroutineProfile(midRunPath(*goroutineProfile), at)
+	}
+
+	stopHeapSnapshots := func() int { return 0 }
+	if *heapInterval > 0 {
+		path := *memProfile
+		if path == "" {
+			path = "heap.pprof"
+		}
+		stopHeapSnapshots = startHeapSnapshots(path, *heapInterval)
+	}
+
+	stopProgress := func() {}
+	if *progress > 0 && !*quiet {
+		stopProgress = startProgress(*progress, startTime)
+	}
+
+	stopStackDumps := func() int { return 0 }
+	if *stackDump != "" {
+		stopStackDumps = startStackDumps(*stackDump)
+	}
+
 	// Run workload
-	switch *workload {
-	case "cpu":
-		runCPUWorkload()
-	case "memory":
-		runMemoryWorkload()
-	case "goroutines":
-		runGoroutineWorkload()
-	case "all":
-		runAllWorkloads()
-	default:
-		log.Fatalf("Unknown workload: %s", *workload)
+	if waitWorkload != nil {
+		interrupted = waitWorkload()
+	} else {
+		interrupted = runUntilSignal(runWorkload)
 	}
+	stopProgress()
+	dumps := stopStackDumps()
 
 	elapsed := time.Since(startTime)
-	fmt.Printf("\nWorkload completed in %s\n", elapsed)
+	// The CPU profile stops before the other profiles are written, so it
+	// shows the workload and not the profile writes. The deferred Stop is
+	// then a no-op.
+	ph.begin("profile write")
+	pprof.StopCPUProfile()
+	if interrupted {
+		fmt.Printf("\nInterrupted after %s, writing profiles...\n", elapsed)
+	} else {
+		fmt.Printf("\nWorkload completed in %s\n", elapsed)
+	}
+	cancelGoroutineProfile()
+	stopServer()
+	if n := stopHeapSnapshots(); n > 0 {
+		fmt.Printf("%d heap snapshots written\n", n)
+	}
+	if dumps > 0 {
+		fmt.Printf("%d stack dumps written\n", dumps)
+	}
 
-	// Write memory profile
-	if *memProfile != "" {
-		f, err := os.Create(*memProfile)
-		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
+	// Write goroutine profile
+	if *goroutineProfile != "" {
+		if err := writeGoroutineProfile(*goroutineProfile); err != nil {
+			log.Fatal("could not write goroutine profile: ", err)
 		}
-		defer f.Close()
+		fmt.Printf("Goroutine profile written to: %s\n", *goroutineProfile)
+	}
+
+	if stopWallProfile != nil {
+		if err := stopWallProfile(); err != nil {
+			log.Fatal("could not write wall-clock profile: ", err)
+		}
+		fmt.Printf("Wall-clock profile written to: %s\n", *wallProfile)
+	}
+
+	if stopBlockTimeline != nil {
+		if err := stopBlockTimeline(); err != nil {
+			log.Fatal("could not write block timeline: ", err)
+		}
+		fmt.Printf("Block timeline written to: %s\n", *blockTimeline)
+	}
 
-		runtime.GC() // Get up-to-date statistics
-		if err := pprof.WriteHeapProfile(f); err != nil {
+	// Write memory profile
+	if *memProfile != "" {
+		if err := writeHeapProfile(*memProfile); err != nil {
 			log.Fatal("could not write memory profile: ", err)
 		}
 		fmt.Printf("Memory profile written to: %s\n", *memProfile)
 	}
 
-	// Write block profile
+	// Write block and mutex profiles
 	if *blockProfile != "" {
-		f, err := os.Create(*blockProfile)
-		if err != nil {
-			log.Fatal("could not create block profile: ", err)
-		}
-		defer f.Close()
-
-		if err := pprof.Lookup("block").WriteTo(f, 0); err != nil {
+		if err := writeContentionProfile(*blockProfile, "block", contention); err != nil {
 			log.Fatal("could not write block profile: ", err)
 		}
 		fmt.Printf("Block profile written to: %s\n", *blockProfile)
 	}
-
-	// Write mutex profile
 	if *mutexProfile != "" {
-		f, err := os.Create(*mutexProfile)
-		if err != nil {
-			log.Fatal("could not create mutex profile: ", err)
-		}
-		defer f.Close()
-
-		if err := pprof.Lookup("mutex").WriteTo(f, 0); err != nil {
+		if err := writeContentionProfile(*mutexProfile, "mutex", contention); err != nil {
 			log.Fatal("could not write mutex profile: ", err)
 		}
 		fmt.Printf("Mutex profile written to: %s\n", *mutexProfile)
 	}
 
+	// The trace stops after the profile writes, which it shows as the
+	// profile write task
+	trace.Stop()
+
 	// Print statistics
-	printStats()
+	ph.begin("report")
+	stats := collectStats(elapsed, interrupted)
+	stats.Phases = ph.finished()
+	if err := writeStats(stats); err != nil {
+		log.Fatal("could not write statistics: ", err)
+	}
+	report := readProcReport(elapsed)
+	if *benchOutput != "" && !isChild() {
+		if err := writeBench(*benchOutput, []benchResult{{Report: report}}); err != nil {
+			log.Fatal("could not write benchmark results: ", err)
+		}
+	}
+	if gcTuned() {
+		printGCTuning(gcBefore, elapsed)
+	}
+	if isChild() {
+		if err := writeProcReport(report); err != nil {
+			log.Fatal("could not write process report: ", err)
+		}
+	}
+
+	if runDir != "" && *configFile != "" {
+		if err := scenarioResults.write(filepath.Join(runDir, "scenario.json")); err != nil {
+			log.Fatal("could not write scenario results: ", err)
+		}
+	}
+	if runDir != "" {
+		if err := writeMetadata(runDir, started, time.Since(started), interrupted); err != nil {
+			log.Fatal("could not write metadata: ", err)
+		}
+		fmt.Printf("Metadata written to: %s\n", filepath.Join(runDir, "metadata.json"))
+	}
+	return interrupted
+}
+
+// random seeds the workloads' generated data; see -seed.
+var random *randsource.Source
+
+// workloads are the -workload values. Each runs with ctx carrying the
+// pprof labels of what it belongs to; goroutines it starts inherit them.
+var workloads = map[string]func(ctx context.Context){
+	"cpu":        runCPUWorkload,
+	"memory":     runMemoryWorkload,
+	"goroutines": runGoroutineWorkload,
+	"deepstack":  runDeepStackWorkload,
+	"sampling":   runSamplingWorkload,
+	"mutex":      runMutexWorkload,
+	"channels":   runChannelsWorkload,
+	"gc":         runGCWorkload,
+	"affinity":   runAffinityWorkload,
+	"network":    runNetworkWorkload,
+	"stack":      runStackGrowthWorkload,
+	"all":        runAllWorkloads,
 }
 
-func runCPUWorkload() {
-	fmt.Println("Running CPU-intensive workload...")
-	endTime := time.Now().Add(time.Duration(*duration) * time.Second)
+// runLabeled runs the named workload with a workload=<name> pprof label,
+// so go tool pprof -tagfocus=workload=cpu keeps only its samples, even in
+// a profile of the all workload, a mix, or a scenario. It also runs as an
+// execution trace task, "workload <name>", which the regions the workload
+// opens on ctx belong to, on whichever goroutine they run.
+func runLabeled(ctx context.Context, name string, run func(ctx context.Context)) {
+	ctx, task := trace.NewTask(ctx, "workload "+name)
+	defer task.End()
+	pprof.Do(ctx, pprof.Labels("workload", name), run)
+}
 
-	var result uint64
-	count := 0
-	for time.Now().Before(endTime) {
-		result += computeFibonacci(30)
-		result += computePrimes(10000)
-		count++
+// runCPUWorkload labels every iteration with its number, so the samples of
+// one iteration, or a range of them, can be picked out with -tagfocus. In
+// the execution trace each iteration is a "fibonacci" and a "primes" region.
+// With several -fib-impl the duration is split between them in turn, each
+// under a fib-impl label, and their throughput is compared at the end.
+func runCPUWorkload(ctx context.Context) {
+	impls, _ := parseFibImpls(*fibImpl) // checked by checkWorkloadFlags
+	fmt.Printf("Running CPU-intensive workload (%s Fibonacci)...\n", strings.Join(impls, ", "))
+	share := time.Duration(*duration) * time.Second / time.Duration(len(impls))
+
+	var (
+		result uint64
+		count  int
+		runs   []fibRun
+	)
+	p := newPacer("cpu")
+	for _, impl := range impls {
+		fib := fibImpls[impl]
+		start := time.Now()
+		endTime := start.Add(share)
+		run := fibRun{impl: impl}
+		pprof.Do(ctx, pprof.Labels("fib-impl", impl), func(ctx context.Context) {
+			for time.Now().Before(endTime) {
+				pprof.Do(ctx, pprof.Labels("iteration", strconv.Itoa(count)), func(ctx context.Context) {
+					trace.WithRegion(ctx, "fibonacci", func() {
+						t := time.Now()
+						result += fib(30)
+						run.fib += time.Since(t)
+					})
+					trace.WithRegion(ctx, "primes", func() { result += computePrimes(10000) })
+				})
+				count++
+				run.iterations++
+				p.pace()
+			}
+		})
+		run.elapsed = time.Since(start)
+		runs = append(runs, run)
 	}
 
 	fmt.Printf("CPU workload: %d iterations, result: %d\n", count, result)
+	if len(runs) > 1 {
+		printFibRuns(runs)
+	} else {
+		fmt.Printf("%s Fibonacci: %.0f iterations/s\n", runs[0].impl, runs[0].perSecond())
+	}
 }
 
-func runMemoryWorkload() {
+// runMemoryWorkload allocates -alloc-size megabytes, then holds them for
+// -duration: an "allocate" and a "hold" region in the execution trace.
+func runMemoryWorkload(ctx context.Context) {
 	fmt.Println("Running memory-intensive workload...")
 
 	// Allocate large chunks of memory
+	rng := random.Stream("memory")
 	var data [][]byte
 	totalMB := 0
 
+	allocate := trace.StartRegion(ctx, "allocate")
+	p := newPacer("memory")
 	for i := 0; i < *allocSize; i++ {
 		chunk := make([]byte, 1024*1024) // 1MB
 		// Fill with random data to prevent optimization
 		for j := 0; j < len(chunk); j += 1024 {
-			chunk[j] = byte(rand.Intn(256))
+			chunk[j] = byte(rng.IntN(256))
 		}
 		data = append(data, chunk)
 		totalMB++
+		p.pace()
 
 		if i%100 == 0 && i > 0 {
 			fmt.Printf("Allocated %d MB...\n", totalMB)
 		}
 	}
 
+	allocate.End()
 	fmt.Printf("Memory workload: allocated %d MB\n", totalMB)
 
 	// Keep data alive
-	time.Sleep(time.Duration(*duration) * time.Second)
+	trace.WithRegion(ctx, "hold", func() { sleep(ctx, time.Duration(*duration)*time.Second) })
 	_ = data
 }
 
-func runGoroutineWorkload() {
+// runGoroutineWorkload starts -goroutines goroutines that compute and sleep
+// for -duration. Each is a "wait for start" and then a "work" region in the
+// execution trace.
+func runGoroutineWorkload(ctx context.Context) {
 	fmt.Println("Running goroutine workload...")
 
 	var wg sync.WaitGroup
@@ -191,14 +744,19 @@ func runGoroutineWorkload() {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			<-startChan
+			trace.WithRegion(ctx, "wait for start", func() { <-startChan })
+			defer trace.StartRegion(ctx, "work").End()
 
 			// Each goroutine does some work
 			var result uint64
 			endTime := time.Now().Add(time.Duration(*duration) * time.Second)
+			p := newPacer("goroutines")
 			for time.Now().Before(endTime) {
 				result += computeFibonacci(20)
-				time.Sleep(10 * time.Millisecond)
+				if !sleep(ctx, 10*time.Millisecond) {
+					break
+				}
+				p.pace()
 			}
 		}(i)
 	}
@@ -210,7 +768,7 @@ func runGoroutineWorkload() {
 	fmt.Println("All goroutines completed")
 }
 
-func runAllWorkloads() {
+func runAllWorkloads(ctx context.Context) {
 	fmt.Println("Running all workloads concurrently...")
 
 	var wg sync.WaitGroup
@@ -219,21 +777,21 @@ func runAllWorkloads() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runCPUWorkload()
+		runLabeled(ctx, "cpu", runCPUWorkload)
 	}()
 
 	// Memory workload
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runMemoryWorkload()
+		runLabeled(ctx, "memory", runMemoryWorkload)
 	}()
 
 	// Goroutine workload
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runGoroutineWorkload()
+		runLabeled(ctx, "goroutines", runGoroutineWorkload)
 	}()
 
 	wg.Wait()
@@ -241,6 +799,18 @@ func runAllWorkloads() {
 
 // Helper functions
 
+// sleep waits for d, or until ctx is done, and reports whether d passed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
 func computeFibonacci(n int) uint64 {
 	if n <= 1 {
 		return uint64(n)
@@ -269,16 +839,3 @@ func isPrime(n int) bool {
 	}
 	return true
 }
-
-func printStats() {
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-
-	fmt.Println("\n=== Runtime Statistics ===")
-	fmt.Printf("Goroutines:        %d\n", runtime.NumGoroutine())
-	fmt.Printf("Heap Allocated:    %d MB\n", memStats.HeapAlloc/1024/1024)
-	fmt.Printf("Total Allocated:   %d MB\n", memStats.TotalAlloc/1024/1024)
-	fmt.Printf("System Memory:     %d MB\n", memStats.Sys/1024/1024)
-	fmt.Printf("GC Runs:           %d\n", memStats.NumGC)
-	fmt.Printf("Last GC Time:      %s\n", time.Unix(0, int64(memStats.LastGC)))
-}
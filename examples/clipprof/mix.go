@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/gosamurai/invariant"
+)
+
+// mixShares is the share of its full intensity each workload of the running
+// mix gets, from -mix or a scenario step. It is set before the workloads
+// start and only read while they run; a workload not in it runs flat out.
+var mixShares map[string]float64
+
+// parseMix reads mix entries, workload names with an optional weight:
+// "cpu=50", "memory=30", "goroutines=20". The weights are relative: each
+// workload gets its weight over their sum as its share, so the mix as a
+// whole is about as busy as one workload on its own. Without weights every
+// workload runs flat out, as the all workload does.
+func parseMix(entries []string) (names []string, shares map[string]float64, err error) {
+	weights := make(map[string]float64)
+	var total float64
+	for _, e := range entries {
+		name, w, weighted := strings.Cut(strings.TrimSpace(e), "=")
+		if _, ok := workloads[name]; !ok || name == "all" {
+			return nil, nil, fmt.Errorf("unknown workload %q in mix", name)
+		}
+		if _, dup := weights[name]; dup {
+			return nil, nil, fmt.Errorf("workload %q is in the mix twice", name)
+		}
+		weight := 0.0
+		if weighted {
+			if weight, err = strconv.ParseFloat(w, 64); err != nil || weight <= 0 {
+				return nil, nil, fmt.Errorf("invalid weight %q for %s", w, name)
+			}
+		}
+		if len(weights) > 0 && (total > 0) != weighted {
+			return nil, nil, fmt.Errorf("mix %q: give every workload a weight or none", strings.Join(entries, ","))
+		}
+		names = append(names, name)
+		weights[name] = weight
+		total += weight
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("empty mix")
+	}
+	if total == 0 {
+		return names, nil, nil
+	}
+	shares = make(map[string]float64, len(weights))
+	for name, w := range weights {
+		shares[name] = w / total
+	}
+	return names, shares, nil
+}
+
+// describeMix formats the names with their shares for the banner.
+func describeMix(names []string, shares map[string]float64) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name
+		if s, ok := shares[name]; ok {
+			parts[i] = fmt.Sprintf("%s %.0f%%", name, s*100)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pacer holds a loop to a share of the time: for every stretch of work
+// between two calls to pace, it owes share-weighted idle time, and it sleeps
+// once it owes a millisecond, coarser than which time.Sleep is not accurate.
+// Each goroutine needs its own, made on it.
+type pacer struct {
+	idle  float64 // idle time owed per unit of work
+	last  time.Time
+	owed  time.Duration
+	owner invariant.Owner
+}
+
+// newPacer returns a pacer for the named workload's share of the mix, or nil,
+// whose pace does nothing, when it runs flat out.
+func newPacer(name string) *pacer {
+	share, ok := mixShares[name]
+	if !ok || share >= 1 {
+		return nil
+	}
+	p := &pacer{idle: (1 - share) / share, last: time.Now()}
+	p.owner.Init()
+	return p
+}
+
+// pace is called after every unit of work, so it also counts the work for
+// the throughput -sweep-gomaxprocs compares.
+func (p *pacer) pace() {
+	workDone.Add(1)
+	if p == nil {
+		return
+	}
+	p.owner.Check()
+	now := time.Now()
+	p.owed += time.Duration(float64(now.Sub(p.last)) * p.idle)
+	p.last = now
+	if p.owed < time.Millisecond {
+		return
+	}
+	time.Sleep(p.owed)
+	p.last = time.Now()
+	p.owed -= p.last.Sub(now)
+}
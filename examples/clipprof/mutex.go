@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runMutexWorkload has -goroutines goroutines increment one counter behind a
+// single sync.Mutex, each holding it for -mutex-hold of busy work. With more
+// goroutines than the lock can serve, almost all of their time is spent
+// waiting, which gives -mutexprofile (who held the lock while others waited)
+// and -blockprofile (who waited) something to show. Each goroutine is a
+// "contend" region in the execution trace.
+func runMutexWorkload(ctx context.Context) {
+	fmt.Printf("Running mutex workload (%d goroutines, %s critical section)...\n", *goroutines, *mutexHold)
+	start := time.Now()
+	endTime := start.Add(time.Duration(*duration) * time.Second)
+
+	var (
+		mu      sync.Mutex
+		counter uint64
+		waited  atomic.Int64
+		wg      sync.WaitGroup
+	)
+	for range *goroutines {
+		wg.Go(func() {
+			defer trace.StartRegion(ctx, "contend").End()
+			p := newPacer("mutex")
+			for time.Now().Before(endTime) {
+				start := time.Now()
+				mu.Lock()
+				waited.Add(int64(time.Since(start)))
+				counter++
+				spin(*mutexHold)
+				mu.Unlock()
+				p.pace()
+			}
+		})
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	fmt.Printf("Mutex workload: %d acquisitions (%.0f/s), mean wait %s\n",
+		counter, float64(counter)/elapsed.Seconds(), time.Duration(waited.Load()/int64(max(counter, 1))))
+}
+
+// spin keeps the CPU busy for d, so the lock is held by a running goroutine
+// rather than a sleeping one.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
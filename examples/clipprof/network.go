@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime/metrics"
+	"runtime/trace"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+)
+
+// runNetworkWorkload starts an HTTP server on a loopback port and sends it
+// requests from -connections clients for -duration, each fetching a
+// -payload byte response, over kept-alive connections or, with
+// -keepalive=false, a new connection per request. It reports throughput,
+// latency, and how much of the wall time the process spent on the CPU: the
+// rest the goroutines spent parked in the netpoller, which a CPU profile
+// does not see and the execution trace shows as network blocking.
+func runNetworkWorkload(ctx context.Context) {
+	fmt.Printf("Running network workload (%d connections, %d byte payload, keep-alive %t)...\n", *connections, *payload, *keepAlive)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal("could not start loopback server: ", err)
+	}
+	body := make([]byte, *payload)
+	rng := random.Stream("network")
+	for i := range body {
+		body[i] = byte('a' + rng.IntN(26))
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	})}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("loopback server: %v", err)
+		}
+	}()
+	defer srv.Close()
+
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: *connections,
+		DisableKeepAlives:   !*keepAlive,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	url := "http://" + l.Addr().String() + "/"
+
+	procBefore, _ := procstats.Read()
+	cpuBefore := busyCPU()
+	start := time.Now()
+	endTime := start.Add(time.Duration(*duration) * time.Second)
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		failures  int
+		wg        sync.WaitGroup
+	)
+	for range *connections {
+		wg.Go(func() {
+			defer trace.StartRegion(ctx, "client").End()
+			var local []time.Duration
+			failed := 0
+			p := newPacer("network")
+			for ; time.Now().Before(endTime) && ctx.Err() == nil; p.pace() {
+				t := time.Now()
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				if err != nil {
+					failed++
+					continue
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					failed++
+					continue
+				}
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					failed++
+					continue
+				}
+				local = append(local, time.Since(t))
+			}
+			mu.Lock()
+			latencies = append(latencies, local...)
+			failures += failed
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	cpu := busyCPU() - cpuBefore
+
+	slices.Sort(latencies)
+	n := len(latencies)
+	q := func(p float64) time.Duration {
+		if n == 0 {
+			return 0
+		}
+		return latencies[min(int(float64(n)*p), n-1)].Round(time.Microsecond)
+	}
+	fmt.Printf("Network workload: %d requests (%.0f/s, %.1f MB/s), %d failed\n",
+		n, float64(n)/elapsed.Seconds(), float64(n*len(body))/(1<<20)/elapsed.Seconds(), failures)
+	fmt.Printf("  latency     p50 %s, p99 %s, max %s\n", q(0.50), q(0.99), q(1))
+	fmt.Printf("  CPU busy    %.2fs of %.2fs wall (%.1f CPUs)\n", cpu, elapsed.Seconds(), cpu/elapsed.Seconds())
+	// Idle keep-alive connections stay open until the deferred close; a
+	// descriptor count that keeps growing from run to run is a leak.
+	if proc, err := procstats.Read(); err == nil {
+		fmt.Printf("  descriptors %d before, %d at the end; sockets %v\n", procBefore.FDs, proc.FDs, proc.Sockets)
+	}
+}
+
+// busyCPU returns the CPU-seconds the process has spent not idle, as
+// estimated by the runtime from the time its Ps were running.
+func busyCPU() float64 {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Float64() - samples[1].Value.Float64()
+}
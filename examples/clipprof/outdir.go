@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// outDirFiles are the files -outdir writes, by the flag they stand in for.
+// The wall-clock profile is not one of them: its sampler stops the world
+// -wallprofile-hz times a second, which would skew every -outdir run, so it
+// is only written when -wallprofile names a file.
+var outDirFiles = []struct {
+	flag *string
+	name string
+}{
+	{cpuProfile, "cpu.pprof"},
+	{memProfile, "heap.pprof"},
+	{blockProfile, "block.pprof"},
+	{mutexProfile, "mutex.pprof"},
+	{goroutineProfile, "goroutine.pprof"},
+	{traceFile, "trace.out"},
+	{flamegraphFile, "cpu.svg"},
+}
+
+// applyOutDir creates a directory named after now under parent, such as
+// profiles/2024-05-01T10-00-00, and points every profile flag left empty
+// at a file in it, and the default -stackdump as well. Flags given
+// explicitly keep their path.
+func applyOutDir(parent string, now time.Time) (string, error) {
+	dir := filepath.Join(parent, now.Format("2006-01-02T15-04-05"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for _, f := range outDirFiles {
+		if *f.flag == "" {
+			*f.flag = filepath.Join(dir, f.name)
+		}
+	}
+	// -stackdump is never empty by default, so it moves into dir unless it
+	// was given
+	given := false
+	flag.Visit(func(f *flag.Flag) { given = given || f.Name == "stackdump" })
+	if !given {
+		*stackDump = filepath.Join(dir, *stackDump)
+	}
+	return dir, nil
+}
+
+// runMetadata is written to metadata.json next to the profiles, so a run
+// can be told apart from others and repeated later.
+type runMetadata struct {
+	Workload    string            `json:"workload"`
+	Config      string            `json:"config,omitempty"`
+	Mix         string            `json:"mix,omitempty"`
+	Started     time.Time         `json:"started"`
+	Elapsed     string            `json:"elapsed"`
+	Interrupted bool              `json:"interrupted"`
+	Seed        uint64            `json:"seed"`
+	Args        []string          `json:"args"`
+	Flags       map[string]string `json:"flags"`
+	GoVersion   string            `json:"go_version"`
+	GOOS        string            `json:"goos"`
+	GOARCH      string            `json:"goarch"`
+	GOMAXPROCS  int               `json:"gomaxprocs"`
+	NumCPU      int               `json:"num_cpu"`
+	Files       []string          `json:"files"`
+}
+
+// writeMetadata writes metadata.json into dir. Flags holds the value of
+// every flag, including defaults and the paths chosen by applyOutDir. The
+// file is bundled, uploaded, and sent to sinks, so passwords in URLs, as
+// -push-url may carry, are redacted there and in Args.
+func writeMetadata(dir string, started time.Time, elapsed time.Duration, interrupted bool) error {
+	md := runMetadata{
+		Workload:    *workload,
+		Config:      *configFile,
+		Mix:         *mixFlag,
+		Started:     started,
+		Elapsed:     elapsed.String(),
+		Interrupted: interrupted,
+		Seed:        random.Seed(),
+		Args:        make([]string, 0, len(os.Args)-1),
+		Flags:       make(map[string]string),
+		GoVersion:   runtime.Version(),
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		NumCPU:      runtime.NumCPU(),
+	}
+	for _, arg := range os.Args[1:] {
+		md.Args = append(md.Args, redactURL(arg))
+	}
+	flag.VisitAll(func(f *flag.Flag) { md.Flags[f.Name] = redactURL(f.Value.String()) })
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		md.Files = append(md.Files, e.Name())
+	}
+	md.Files = append(md.Files, "metadata.json")
+	slices.Sort(md.Files)
+
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "metadata.json"), append(data, '\n'), 0o644)
+}
+
+// redactURL returns s with the password of a URL in it replaced, as
+// url.URL.Redacted does. s is a URL, a -flag=URL argument, or anything else,
+// which is returned as is.
+func redactURL(s string) string {
+	name, value := "", s
+	if strings.HasPrefix(s, "-") {
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			name, value = s[:i+1], s[i+1:]
+		}
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return name + u.Redacted()
+}
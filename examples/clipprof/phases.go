@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/trace"
+	"slices"
+	"time"
+)
+
+// phase is the time a run spent in one of its steps.
+type phase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// phases times the steps of a run, one after another, on the monotonic
+// clock: setting up and starting the profilers, the warmup, the workload,
+// writing the profiles, and reporting. Without it the statistics show only
+// the workload's wall time, and a slow profile write or setup passes
+// unnoticed, or is blamed on the workload by whoever times the process.
+// Each phase is also a trace task, so -trace shows the phases it was
+// running for.
+type phases struct {
+	list  []phase
+	cur   int // index in list of the running phase
+	start time.Time
+	task  *trace.Task // nil when no phase is running
+}
+
+// begin ends the running phase and starts name. A phase begun again, such
+// as setup after the warmup, adds to the time it had.
+func (p *phases) begin(name string) {
+	p.end()
+	i := slices.IndexFunc(p.list, func(ph phase) bool { return ph.Name == name })
+	if i < 0 {
+		p.list = append(p.list, phase{Name: name})
+		i = len(p.list) - 1
+	}
+	p.cur, p.start = i, time.Now()
+	_, p.task = trace.NewTask(context.Background(), name)
+}
+
+// end ends the running phase, if any.
+func (p *phases) end() {
+	if p.task == nil {
+		return
+	}
+	p.list[p.cur].Seconds += time.Since(p.start).Seconds()
+	p.task.End()
+	p.task = nil
+}
+
+// finished returns the phases that have ended, leaving out the running one.
+func (p *phases) finished() []phase {
+	list := slices.Clone(p.list)
+	if p.task != nil {
+		list = slices.Delete(list, p.cur, p.cur+1)
+	}
+	return list
+}
+
+// print ends the running phase and prints the time and share of each.
+func (p *phases) print(w io.Writer) {
+	p.end()
+	var total float64
+	for _, ph := range p.list {
+		total += ph.Seconds
+	}
+	fmt.Fprintln(w, "\n=== Phases ===")
+	for _, ph := range p.list {
+		fmt.Fprintf(w, "%-15s %10s %6.1f%%\n", ph.Name+":", seconds(ph.Seconds), 100*ph.Seconds/total)
+	}
+	fmt.Fprintf(w, "%-15s %10s\n", "Total:", seconds(total))
+}
+
+// seconds rounds to milliseconds, or microseconds below one.
+func seconds(s float64) time.Duration {
+	d := time.Duration(s * float64(time.Second))
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/diff"
+	"github.com/vdntruong/gosamurai/subtleties"
+)
+
+// pitfallSettle is how long a variant's goroutines get to finish after its
+// last round before the ones still running are counted as leaked.
+const pitfallSettle = 50 * time.Millisecond
+
+// variantStats is what one variant of a pitfall cost over -pitfall-rounds.
+type variantStats struct {
+	Elapsed time.Duration
+	Bytes   uint64 // allocated
+	Objects uint64 // allocations
+	GCs     uint32
+	Leaked  int // goroutines still running after pitfallSettle
+	CPU     *profile.Profile
+}
+
+// runPitfalls runs the broken and then the fixed variant of each pitfall
+// named by -pitfall, or of all of them, and prints what each cost side by
+// side, followed by the functions whose CPU share differs most between the
+// two. The CPU and goroutine profiles of every variant are written into dir
+// as <pitfall>-<variant>.cpu.pprof and .goroutine.pprof.
+func runPitfalls(dir string) error {
+	var selected []subtleties.Pitfall
+	for _, p := range subtleties.Pitfalls {
+		if *pitfallFlag == "all" || p.Name == *pitfallFlag {
+			selected = append(selected, p)
+		}
+	}
+	if selected == nil {
+		return fmt.Errorf("unknown pitfall %q", *pitfallFlag)
+	}
+	for _, p := range selected {
+		fmt.Printf("\n=== %s: %s ===\n", p.Name, p.Summary)
+		broken, err := measureVariant(dir, p.Name+"-broken", p.Broken)
+		if err != nil {
+			return err
+		}
+		fixed, err := measureVariant(dir, p.Name+"-fixed", p.Fixed)
+		if err != nil {
+			return err
+		}
+		writePitfall(os.Stdout, broken, fixed)
+		if r, err := diff.Compare(fixed.CPU, broken.CPU); err == nil && r.HeadTotal > 0 && r.BaseTotal > 0 {
+			fmt.Println("\nCPU share, fixed (base) against broken (head):")
+			r.WriteText(os.Stdout, 5)
+		}
+	}
+	return nil
+}
+
+// measureVariant runs f -pitfall-rounds times under the CPU profiler and
+// measures it.
+func measureVariant(dir, name string, f func()) (variantStats, error) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	goroutinesBefore := runtime.NumGoroutine()
+
+	cpuPath := filepath.Join(dir, name+".cpu.pprof")
+	out, err := os.Create(cpuPath)
+	if err != nil {
+		return variantStats{}, err
+	}
+	defer out.Close()
+	if err := pprof.StartCPUProfile(out); err != nil {
+		return variantStats{}, err
+	}
+	start := time.Now()
+	for range *pitfallRounds {
+		f()
+	}
+	s := variantStats{Elapsed: time.Since(start)}
+	pprof.StopCPUProfile()
+	runtime.ReadMemStats(&after)
+
+	time.Sleep(pitfallSettle)
+	s.Leaked = runtime.NumGoroutine() - goroutinesBefore
+	s.Bytes = after.TotalAlloc - before.TotalAlloc
+	s.Objects = after.Mallocs - before.Mallocs
+	s.GCs = after.NumGC - before.NumGC
+	if err := writeGoroutineProfile(filepath.Join(dir, name+".goroutine.pprof")); err != nil {
+		return variantStats{}, err
+	}
+
+	if _, err := out.Seek(0, 0); err != nil {
+		return variantStats{}, err
+	}
+	if s.CPU, err = profile.Parse(out); err != nil {
+		return variantStats{}, fmt.Errorf("%s: %w", cpuPath, err)
+	}
+	return s, nil
+}
+
+// writePitfall prints the two variants side by side, with how many times
+// the broken one's cost the fixed one's is.
+func writePitfall(w *os.File, broken, fixed variantStats) {
+	rounds := uint64(*pitfallRounds)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%d ROUNDS\tBROKEN\tFIXED\tBROKEN/FIXED\t\n", rounds)
+	row := func(name, b, f string, bv, fv float64) {
+		ratio := "-"
+		if fv > 0 {
+			ratio = fmt.Sprintf("%.2fx", bv/fv)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", name, b, f, ratio)
+	}
+	row("time", broken.Elapsed.Round(time.Microsecond).String(), fixed.Elapsed.Round(time.Microsecond).String(),
+		float64(broken.Elapsed), float64(fixed.Elapsed))
+	row("allocated per round", fmt.Sprintf("%d B", broken.Bytes/rounds), fmt.Sprintf("%d B", fixed.Bytes/rounds),
+		float64(broken.Bytes), float64(fixed.Bytes))
+	row("allocations per round", fmt.Sprint(broken.Objects/rounds), fmt.Sprint(fixed.Objects/rounds),
+		float64(broken.Objects), float64(fixed.Objects))
+	row("GC runs", fmt.Sprint(broken.GCs), fmt.Sprint(fixed.GCs), float64(broken.GCs), float64(fixed.GCs))
+	row("goroutines leaked", fmt.Sprint(broken.Leaked), fmt.Sprint(fixed.Leaked), float64(broken.Leaked), float64(fixed.Leaked))
+	tw.Flush()
+}
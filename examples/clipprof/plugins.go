@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// plugins is what the -plugin files registered.
+var plugins pluginapi.Registry
+
+// loadPlugins opens every -plugin file and calls its Register, then adds
+// the workloads it registered to the workloads map. A plugin workload may
+// not take the name of another workload.
+func loadPlugins() {
+	if *pluginFiles == "" {
+		return
+	}
+	for path := range strings.SplitSeq(*pluginFiles, ",") {
+		register, err := openPlugin(path)
+		if err != nil {
+			log.Fatalf("-plugin %s: %v", path, err)
+		}
+		var r pluginapi.Registry
+		register(&r)
+		for _, w := range r.Workloads {
+			if _, dup := workloads[w.Name]; dup || w.Name == "" || w.Run == nil {
+				log.Fatalf("-plugin %s: workload %q is unnamed, has no Run, or has the name of another workload", path, w.Name)
+			}
+			workloads[w.Name] = pluginWorkload(w)
+		}
+		plugins.Workloads = append(plugins.Workloads, r.Workloads...)
+		plugins.Sinks = append(plugins.Sinks, r.Sinks...)
+		plugins.Analyzers = append(plugins.Analyzers, r.Analyzers...)
+		fmt.Printf("Plugin %s: %d workloads, %d sinks, %d analyzers\n", filepath.Base(path), len(r.Workloads), len(r.Sinks), len(r.Analyzers))
+		for _, w := range r.Workloads {
+			fmt.Printf("  -workload=%s: %s\n", w.Name, w.Summary)
+		}
+	}
+}
+
+// pluginWorkload runs a plugin workload with the settings of this run.
+func pluginWorkload(w pluginapi.Workload) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		fmt.Printf("Running %s workload (plugin)...\n", w.Name)
+		w.Run(ctx, pluginapi.Options{
+			Duration:   time.Duration(*duration) * time.Second,
+			Goroutines: *goroutines,
+			Seed:       random.Seed(),
+			Stream:     func(name string) *rand.Rand { return random.Stream(w.Name + "/" + name) },
+			Args:       pluginArgs(),
+			Work:       func(n uint64) { workDone.Add(n) },
+		})
+	}
+}
+
+// pluginArgs parses -plugin-args, name=value pairs separated by commas.
+func pluginArgs() map[string]string {
+	args := make(map[string]string)
+	if *pluginArgsFlag == "" {
+		return args
+	}
+	for kv := range strings.SplitSeq(*pluginArgsFlag, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		args[strings.TrimSpace(k)] = v
+	}
+	return args
+}
+
+// runFiles are the files this run wrote that exist, by their kind in
+// pluginapi.Run.Files: the profiles, and the reports, from the statistics
+// to the analyzers' findings. Every other file in runDir, such as those of
+// the child processes of -procs, -runs, and -sweep-gomaxprocs in their own
+// directories, or the profiles of -pitfall, is listed by its path in it.
+func runFiles(runDir string) map[string]string {
+	paths := map[string]string{
+		"cpu": *cpuProfile, "heap": *memProfile, "block": *blockProfile, "mutex": *mutexProfile,
+		"goroutine": *goroutineProfile, "wall": *wallProfile, "trace": *traceFile,
+		"flamegraph": *flamegraphFile, "stats": *statsFile,
+	}
+	if *benchOutput != "-" {
+		paths["bench"] = *benchOutput
+	}
+	if runDir != "" {
+		paths["metadata"] = filepath.Join(runDir, "metadata.json")
+		paths["scenario"] = filepath.Join(runDir, "scenario.json")
+		paths["analysis"] = filepath.Join(runDir, "analysis.txt")
+	}
+	files := make(map[string]string)
+	for kind, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			files[kind] = path
+		}
+	}
+	if runDir == "" {
+		return files
+	}
+	listed := make(map[string]bool, len(files))
+	for _, path := range files {
+		if abs, err := filepath.Abs(path); err == nil {
+			listed[abs] = true
+		}
+	}
+	root, err := filepath.Abs(runDir)
+	if err != nil {
+		return files
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || listed[path] {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			files[filepath.ToSlash(rel)] = path
+		}
+		return nil
+	})
+	return files
+}
+
+// pprofKinds are the kinds of runFiles that are pprof profiles.
+var pprofKinds = []string{"cpu", "heap", "block", "mutex", "goroutine", "wall"}
+
+// runOutputs hands the finished run to the plugins and the sinks: every
+// analyzer reads the profiles it asked for, its findings also going to
+// analysis.txt in the run directory, then every sink, the plugins' and
+// those of -sinks and -config, gets the files. A failing analyzer or sink
+// is reported and the others still run.
+func runOutputs(runDir string, started time.Time, elapsed time.Duration, interrupted bool) {
+	if len(plugins.Analyzers) == 0 && len(plugins.Sinks) == 0 && len(sinks) == 0 {
+		return
+	}
+	if len(plugins.Analyzers) > 0 {
+		if runDir == "" {
+			runAnalyzers(os.Stdout, runFiles(runDir))
+		} else if err := writeAnalysis(filepath.Join(runDir, "analysis.txt"), runFiles(runDir)); err != nil {
+			log.Fatal("could not write analysis.txt: ", err)
+		}
+	}
+
+	files := runFiles(runDir)
+	run := pluginapi.Run{
+		Workload: *workload, Started: started, Elapsed: elapsed, Interrupted: interrupted,
+		Dir: runDir, Files: files,
+	}
+	for _, s := range slices.Concat(plugins.Sinks, sinks) {
+		if err := s.Send(context.Background(), run); err != nil {
+			fmt.Printf("sink %s failed: %v\n", s.Name, err)
+			continue
+		}
+		fmt.Printf("Sent %d files to sink %s\n", len(files), s.Name)
+	}
+}
+
+// runAnalyzers runs every analyzer on the profiles of files it asked for
+// and writes what they find to w.
+func runAnalyzers(w io.Writer, files map[string]string) {
+	for _, a := range plugins.Analyzers {
+		for _, kind := range pprofKinds {
+			path, ok := files[kind]
+			if !ok || (len(a.Kinds) > 0 && !slices.Contains(a.Kinds, kind)) {
+				continue
+			}
+			fmt.Fprintf(w, "\n=== %s: %s (%s) ===\n", a.Name, kind, path)
+			if err := analyzeFile(w, a, kind, path); err != nil {
+				fmt.Fprintf(w, "analyzer %s failed: %v\n", a.Name, err)
+			}
+		}
+	}
+}
+
+// writeAnalysis runs the analyzers, printing what they find and writing it
+// to path as well.
+func writeAnalysis(path string, files map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runAnalyzers(io.MultiWriter(os.Stdout, f), files)
+	return f.Close()
+}
+
+func analyzeFile(w io.Writer, a pluginapi.Analyzer, kind, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return err
+	}
+	return a.Analyze(w, kind, p)
+}
@@ -0,0 +1,164 @@
+//go:build plugins
+
+// Command example is a clipprof plugin with one of each: a hash workload,
+// a sink that packs the files of a run into a tarball, and an analyzer that
+// ranks the packages of a profile by their flat value. Build it and
+// clipprof from the same checkout, with the same tags:
+//
+//	go build -tags plugins -buildmode=plugin -o example.so ./plugins/example
+//	go build -tags plugins -o clipprof .
+//	./clipprof -plugin=example.so -workload=hash -plugin-args=block=4096 -cpuprofile=cpu.prof
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// Register is what clipprof calls when it loads the plugin.
+func Register(r *pluginapi.Registry) {
+	r.AddWorkload(pluginapi.Workload{
+		Name:    "hash",
+		Summary: "SHA-256 of random blocks (plugin-args block=<bytes>, default 1024)",
+		Run:     runHash,
+	})
+	r.AddSink(pluginapi.Sink{Name: "tarball", Send: sendTarball})
+	r.AddAnalyzer(pluginapi.Analyzer{Name: "packages", Kinds: []string{"cpu", "wall"}, Analyze: analyzePackages})
+}
+
+// runHash hashes blocks of random bytes for the run's duration.
+func runHash(ctx context.Context, opts pluginapi.Options) {
+	size, err := strconv.Atoi(opts.Args["block"])
+	if err != nil || size <= 0 {
+		size = 1024
+	}
+	rng := opts.Stream("blocks")
+	block := make([]byte, size)
+	for i := range block {
+		block[i] = byte(rng.Uint32())
+	}
+	var n int
+	deadline := time.Now().Add(opts.Duration)
+	for ctx.Err() == nil && time.Now().Before(deadline) {
+		sum := sha256.Sum256(block)
+		block[0] ^= sum[0]
+		n++
+		opts.Work(1)
+	}
+	fmt.Printf("Hash workload: %d blocks of %d bytes\n", n, size)
+}
+
+// sendTarball writes the files of the run into a .tar.gz in
+// $CLIPPROF_SINK_DIR, or the temporary directory.
+func sendTarball(_ context.Context, run pluginapi.Run) error {
+	dir := cmp.Or(os.Getenv("CLIPPROF_SINK_DIR"), os.TempDir())
+	path := filepath.Join(dir, fmt.Sprintf("clipprof-%s-%s.tar.gz", run.Workload, run.Started.Format("20060102T150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, kind := range slices.Sorted(func(yield func(string) bool) {
+		for k := range run.Files {
+			if !yield(k) {
+				return
+			}
+		}
+	}) {
+		if err := addFile(tw, run.Files[kind]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("tarball: %s\n", path)
+	return nil
+}
+
+func addFile(tw *tar.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// analyzePackages prints the share of the profile's default sample type
+// spent in each package's own code, largest first.
+func analyzePackages(w io.Writer, _ string, p *profile.Profile) error {
+	idx := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			idx = i
+		}
+	}
+	flat := make(map[string]int64)
+	var total int64
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		total += v
+		if len(s.Location) > 0 && len(s.Location[0].Line) > 0 && s.Location[0].Line[0].Function != nil {
+			flat[packageOf(s.Location[0].Line[0].Function.Name)] += v
+		}
+	}
+	if total == 0 {
+		_, err := fmt.Fprintln(w, "no samples")
+		return err
+	}
+	pkgs := make([]string, 0, len(flat))
+	for pkg := range flat {
+		pkgs = append(pkgs, pkg)
+	}
+	slices.SortFunc(pkgs, func(a, b string) int { return cmp.Compare(flat[b], flat[a]) })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAT%\tPACKAGE")
+	for _, pkg := range pkgs[:min(len(pkgs), 8)] {
+		fmt.Fprintf(tw, "%.1f%%\t%s\n", 100*float64(flat[pkg])/float64(total), pkg)
+	}
+	return tw.Flush()
+}
+
+// packageOf returns the import path of a function name such as
+// crypto/sha256.(*digest).Write or main.runHash.func1.
+func packageOf(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
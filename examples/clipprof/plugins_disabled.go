@@ -0,0 +1,15 @@
+//go:build !plugins
+
+package main
+
+import (
+	"errors"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// openPlugin fails: loading Go plugins needs cgo, which a default build of
+// clipprof does without.
+func openPlugin(string) (func(*pluginapi.Registry), error) {
+	return nil, errors.New("clipprof was built without plugin support; build it with -tags plugins")
+}
@@ -0,0 +1,27 @@
+//go:build plugins
+
+package main
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// openPlugin loads the Go plugin at path and returns its Register function.
+func openPlugin(path string) (func(*pluginapi.Registry), error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(pluginapi.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	register, ok := sym.(func(*pluginapi.Registry))
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T, not a func(*pluginapi.Registry)", pluginapi.Symbol, sym)
+	}
+	return register, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/merge"
+)
+
+// A child started by -procs finds its index ("2/4") and the directory for
+// its profiles and report in the environment.
+const (
+	envProc    = "CLIPPROF_PROC"
+	envProcDir = "CLIPPROF_PROC_DIR"
+)
+
+// childFlags are the flags naming output files. A child writes each one
+// given to the parent into its own directory instead, under the same base
+// name.
+var childFlags = []string{"cpuprofile", "memprofile", "blockprofile", "mutexprofile", "goroutineprofile", "trace", "blocktimeline", "stats-file", "flamegraph", "wallprofile"}
+
+// mergedFlags are the profiles the parent merges from its children; the
+// others are left in the child directories.
+var mergedFlags = []string{"cpuprofile", "memprofile", "blockprofile", "mutexprofile", "goroutineprofile"}
+
+// procReport is what a child writes to report.json when its workload ends.
+type procReport struct {
+	Elapsed    time.Duration `json:"elapsed"`
+	Work       uint64        `json:"work"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	TotalAlloc uint64        `json:"total_alloc"`
+	Mallocs    uint64        `json:"mallocs"`
+	Sys        uint64        `json:"sys"`
+	NumGC      uint32        `json:"num_gc"`
+	PauseTotal time.Duration `json:"pause_total"`
+}
+
+// procRun is one side of the comparison: a group of child processes started
+// together and what they measured.
+type procRun struct {
+	Name       string
+	Procs      int
+	Goroutines int
+	Dirs       []string
+	Wall       time.Duration
+	CPU        time.Duration // user + system time of all processes
+	Reports    []procReport
+}
+
+// isChild reports whether this process was started by -procs.
+func isChild() bool { return os.Getenv(envProcDir) != "" }
+
+// readProcReport reads this process's report, for a workload that ran for
+// elapsed.
+func readProcReport(elapsed time.Duration) procReport {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return procReport{
+		Elapsed:    elapsed,
+		Work:       workDone.Load(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		TotalAlloc: m.TotalAlloc - warmupBaseline.TotalAlloc,
+		Mallocs:    m.Mallocs - warmupBaseline.Mallocs,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC - warmupBaseline.NumGC,
+		PauseTotal: time.Duration(m.PauseTotalNs - warmupBaseline.PauseTotalNs),
+	}
+}
+
+// writeProcReport writes the child's report.json.
+func writeProcReport(rep procReport) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(os.Getenv(envProcDir), "report.json"), data, 0o644)
+}
+
+// runProcs starts -procs copies of this program running the workload side
+// by side, then one copy with -procs times -goroutines, and compares the
+// two. Profiles requested with the usual flags are merged from the copies,
+// with a "process" label and root frame per process; the single copy's are
+// in dir/single. It reports whether a signal cut the comparison short.
+func runProcs(dir string) (interrupted bool, err error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	n := *procs
+	fmt.Printf("Running %d processes with %d goroutines each...\n", n, *goroutines)
+	many, err := startProcs(ctx, dir, "proc", n, *goroutines, nil)
+	if err != nil {
+		return false, err
+	}
+	runs := []procRun{many}
+	if ctx.Err() == nil {
+		fmt.Printf("Running 1 process with %d goroutines...\n", n**goroutines)
+		single, err := startProcs(ctx, dir, "single", 1, n**goroutines, nil)
+		if err != nil {
+			return false, err
+		}
+		runs = append(runs, single)
+	}
+	interrupted = ctx.Err() != nil
+
+	fmt.Println()
+	writeProcRuns(os.Stdout, runs)
+
+	for _, name := range mergedFlags {
+		path := flag.Lookup(name).Value.String()
+		if path == "" {
+			continue
+		}
+		if err := mergeChildProfiles(path, many.Dirs); err != nil {
+			return interrupted, fmt.Errorf("merge %s: %w", name, err)
+		}
+		fmt.Printf("Merged %s of %d processes into: %s\n", name, n, path)
+	}
+	return interrupted, nil
+}
+
+// startProcs runs n children with the given goroutines each and env added
+// to their environment, in dir/<name>-<i> (or dir/<name> for one), and waits
+// for all of them. A signal to the parent is passed on as SIGINT, so the
+// children still write their profiles.
+func startProcs(ctx context.Context, dir, name string, n, goroutines int, env []string) (procRun, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return procRun{}, err
+	}
+	run := procRun{Name: name, Procs: n, Goroutines: n * goroutines, Reports: make([]procReport, n)}
+	cmds := make([]*exec.Cmd, n)
+	outs := make([]*os.File, 0, n)
+	defer func() {
+		for _, out := range outs {
+			out.Close()
+		}
+	}()
+	for i := range n {
+		childDir := filepath.Join(dir, name)
+		if n > 1 {
+			childDir += "-" + strconv.Itoa(i+1)
+		}
+		if err := os.MkdirAll(childDir, 0o755); err != nil {
+			return procRun{}, err
+		}
+		out, err := os.Create(filepath.Join(childDir, "output.txt"))
+		if err != nil {
+			return procRun{}, err
+		}
+		outs = append(outs, out)
+
+		cmd := exec.CommandContext(ctx, exe, childArgs(childDir, goroutines, random.Seed()+uint64(i))...)
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d/%d", envProc, i+1, n), envProcDir+"="+childDir)
+		cmd.Env = append(cmd.Env, env...)
+		cmd.Stdout, cmd.Stderr = out, out
+		cmds[i] = cmd
+		run.Dirs = append(run.Dirs, childDir)
+	}
+
+	start := time.Now()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		if err := cmd.Start(); err != nil {
+			return procRun{}, err
+		}
+		wg.Go(func() {
+			errs[i] = cmd.Wait()
+			if errs[i] != nil && cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == exitInterrupted {
+				errs[i] = nil
+			}
+		})
+	}
+	wg.Wait()
+	run.Wall = time.Since(start)
+
+	for i, cmd := range cmds {
+		if errs[i] != nil {
+			return procRun{}, fmt.Errorf("process %d: %w, see %s", i+1, errs[i], filepath.Join(run.Dirs[i], "output.txt"))
+		}
+		run.CPU += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+		data, err := os.ReadFile(filepath.Join(run.Dirs[i], "report.json"))
+		if err != nil {
+			return procRun{}, err
+		}
+		if err := json.Unmarshal(data, &run.Reports[i]); err != nil {
+			return procRun{}, fmt.Errorf("%s: %w", run.Dirs[i], err)
+		}
+	}
+	return run, nil
+}
+
+// childArgs returns the command line of a child: every flag set on the
+// parent's, except those that would clash between processes, with output
+// files moved into dir.
+func childArgs(dir string, goroutines int, seed uint64) []string {
+	args := []string{"-goroutines=" + strconv.Itoa(goroutines), "-seed=" + strconv.FormatUint(seed, 10)}
+	for _, name := range childFlags {
+		if path := flag.Lookup(name).Value.String(); path != "" {
+			args = append(args, "-"+name+"="+filepath.Join(dir, filepath.Base(path)))
+		}
+	}
+	skip := map[string]bool{"procs": true, "sweep-gomaxprocs": true, "runs": true, "bench-output": true, "outdir": true, "bundle": true, "upload": true, "sinks": true, "push-url": true, "http": true, "goroutines": true, "seed": true}
+	for _, name := range childFlags {
+		skip[name] = true
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// mergeChildProfiles merges the profile each child wrote under path's base
+// name into path, labelling every sample with its process, "proc-2". The
+// label is a root frame as well, so a flame graph has a tower per process.
+// (A label that parses as a number would be a range to pprof's -tagfocus.)
+func mergeChildProfiles(path string, dirs []string) error {
+	var profiles []*profile.Profile
+	for _, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, filepath.Base(path)))
+		if err != nil {
+			return err
+		}
+		p, err := profile.Parse(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		for _, s := range p.Sample {
+			if s.Label == nil {
+				s.Label = make(map[string][]string)
+			}
+			s.Label["process"] = []string{filepath.Base(dir)}
+		}
+		profiles = append(profiles, p)
+	}
+	if len(profiles) == 0 {
+		return errors.New("no profiles")
+	}
+	merged, err := merge.Merge(profiles, merge.Options{GroupBy: []string{"process"}})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeProcRuns prints the comparison, one row per run with the totals of
+// its processes.
+func writeProcRuns(w *os.File, runs []procRun) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tPROCS\tGOROUTINES\tWALL\tCPU\tALLOCATED\tSYS MEMORY\tGC RUNS\tGC PAUSE")
+	for _, r := range runs {
+		var alloc, sys uint64
+		var gcs uint32
+		var pause time.Duration
+		for _, rep := range r.Reports {
+			alloc += rep.TotalAlloc
+			sys += rep.Sys
+			gcs += rep.NumGC
+			pause += rep.PauseTotal
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%d MB\t%d MB\t%d\t%s\n", r.Name, r.Procs, r.Goroutines,
+			r.Wall.Round(time.Millisecond), r.CPU.Round(time.Millisecond), alloc>>20, sys>>20, gcs, pause.Round(time.Microsecond))
+	}
+	tw.Flush()
+}
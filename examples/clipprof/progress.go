@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/metrics"
+	"time"
+)
+
+// progressMetrics are the runtime/metrics the status line reads. Unlike
+// runtime.ReadMemStats, reading them does not stop the world, so the line
+// leaves no mark in the profiles.
+var progressMetrics = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/gc/cycles/total:gc-cycles",
+	"/sched/goroutines:goroutines",
+}
+
+// startProgress prints a status line every interval while the workload
+// runs: the time since start, the work finished per second since the line
+// before, the heap in use, the GC cycles since start, and the goroutines.
+// The lines go to stderr, so output piped to a file or a script holds the
+// results alone. The returned function stops it.
+func startProgress(interval time.Duration, start time.Time) (stop func()) {
+	samples := make([]metrics.Sample, len(progressMetrics))
+	for i, name := range progressMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	cyclesBefore := samples[1].Value.Uint64()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last, lastWork := start, workDone.Load()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				work := workDone.Load()
+				metrics.Read(samples)
+				rate := float64(work-lastWork) / now.Sub(last).Seconds()
+				fmt.Fprintf(os.Stderr, "[%6s] %10.0f ops/s  heap %6.1f MiB  GC %5d  goroutines %d\n",
+					now.Sub(start).Round(time.Second), rate,
+					float64(samples[0].Value.Uint64())/(1<<20),
+					samples[1].Value.Uint64()-cyclesBefore,
+					samples[2].Value.Uint64())
+				last, lastWork = now, work
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
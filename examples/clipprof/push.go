@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// pushBackends are the values of -push-backend, the continuous profiling
+// servers a pyroscope or parca sink pushes to.
+var pushBackends = []string{"pyroscope", "parca"}
+
+// labelName is what both servers take as a label name.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseLabels parses -push-labels, name=value pairs separated by commas.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if s == "" {
+		return labels, nil
+	}
+	for kv := range strings.SplitSeq(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !labelName.MatchString(k) {
+			return nil, fmt.Errorf("-push-labels: %q is not name=value with a name of letters, digits, and _", kv)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// pushSink pushes the pprof profiles of a run to a Pyroscope or Parca
+// server, each under app with labels and a workload label.
+func pushSink(backend, base, app string, labels map[string]string) (pluginapi.Sink, error) {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return pluginapi.Sink{}, fmt.Errorf("%s sink: url must be http:// or https://, got %q", backend, base)
+	}
+	if app == "" {
+		app = "clipprof"
+	}
+	for k := range labels {
+		if !labelName.MatchString(k) {
+			return pluginapi.Sink{}, fmt.Errorf("%s sink: label name %q is not letters, digits, and _", backend, k)
+		}
+	}
+	push := pushPyroscope
+	if backend == "parca" {
+		push = pushParca
+	}
+	return pluginapi.Sink{Name: backend + ":" + u.Redacted(), Send: func(ctx context.Context, run pluginapi.Run) error {
+		all := maps.Clone(labels)
+		all["workload"] = run.Workload
+		for _, kind := range pprofKinds {
+			path, ok := run.Files[kind]
+			if !ok {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := push(ctx, u, app, kind, all, run, data); err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+		}
+		return nil
+	}}, nil
+}
+
+// pushPyroscope sends one profile to Pyroscope's /ingest, as a pprof file
+// under <app>.<kind>{labels} covering the run. The server reads the sample
+// types from the profile itself.
+func pushPyroscope(ctx context.Context, base *url.URL, app, kind string, labels map[string]string, run pluginapi.Run, data []byte) error {
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	q := url.Values{
+		"name":    {fmt.Sprintf("%s.%s{%s}", app, kind, strings.Join(pairs, ","))},
+		"from":    {strconv.FormatInt(run.Started.Unix(), 10)},
+		"until":   {strconv.FormatInt(run.Started.Add(run.Elapsed).Unix(), 10)},
+		"format":  {"pprof"},
+		"spyName": {"gospy"},
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("profile", kind+".pprof")
+	if err != nil {
+		return err
+	}
+	fw.Write(data)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	u := base.JoinPath("ingest")
+	u.RawQuery = q.Encode()
+	return post(ctx, u.String(), mw.FormDataContentType(), &body)
+}
+
+// pushParca sends one profile to Parca's WriteRaw, through the HTTP
+// mapping of its gRPC API, as a series named after the kind with the app
+// as the job label.
+func pushParca(ctx context.Context, base *url.URL, app, kind string, labels map[string]string, run pluginapi.Run, data []byte) error {
+	type label struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	series := []label{{"__name__", kind}, {"job", app}}
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		series = append(series, label{k, labels[k]})
+	}
+	req := map[string]any{
+		"normalized": false,
+		"series": []any{map[string]any{
+			"labels":  map[string]any{"labels": series},
+			"samples": []any{map[string]any{"rawProfile": data}}, // base64, as JSON carries bytes
+		}},
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return post(ctx, base.JoinPath("profiles", "writeraw").String(), "application/json", bytes.NewReader(body))
+}
+
+// post sends body to u. Credentials in u's user info go as basic auth.
+func post(ctx context.Context, u, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s: %s", req.URL.Redacted(), resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// repeatProcs runs one child -runs times, one after another, in
+// dir/<name>-run-<i> (dir/run-<i> without a name), or dir/<name> for a
+// single run. Every run gets the same
+// seed, so what varies between them is the runtime and the machine, not the
+// data. It stops early when ctx is done.
+func repeatProcs(ctx context.Context, dir, name string, env []string) ([]procRun, error) {
+	var runs []procRun
+	for i := range *runCount {
+		if ctx.Err() != nil {
+			break
+		}
+		runName := name
+		if *runCount > 1 {
+			runName = "run-" + strconv.Itoa(i+1)
+			if name != "" {
+				runName = name + "-" + runName
+			}
+			fmt.Printf("  run %d/%d\n", i+1, *runCount)
+		}
+		run, err := startProcs(ctx, dir, runName, 1, *goroutines, env)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// runRepeated runs the workload -runs times in child processes and reports
+// the spread of their timing and throughput. It reports whether a signal cut
+// the runs short.
+func runRepeated(dir string) (interrupted bool, err error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Running the workload %d times...\n", *runCount)
+	runs, err := repeatProcs(ctx, dir, "", nil)
+	if err != nil {
+		return false, err
+	}
+	interrupted = ctx.Err() != nil
+
+	fmt.Println()
+	writeRunSummary(os.Stdout, runs)
+	if *benchOutput != "" {
+		if err := writeBench(*benchOutput, benchResults(runs)); err != nil {
+			return interrupted, err
+		}
+	}
+	return interrupted, nil
+}
+
+// summary is the spread of one measurement over the runs.
+type summary struct {
+	N                           int
+	Mean, Stddev, Min, Max, P95 float64
+}
+
+// summarize computes the summary of values. Stddev is the sample standard
+// deviation, zero for one value; P95 is the nearest-rank 95th percentile,
+// which for fewer than 20 runs is the maximum.
+func summarize(values []float64) summary {
+	s := summary{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	s.Min, s.Max = sorted[0], sorted[s.N-1]
+	s.P95 = sorted[int(math.Ceil(0.95*float64(s.N)))-1]
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+	if s.N > 1 {
+		var sq float64
+		for _, v := range values {
+			sq += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(sq / float64(s.N-1))
+	}
+	return s
+}
+
+// runMetrics are the measurements summarized over repeated runs, each read
+// from one run.
+var runMetrics = []struct {
+	name string
+	unit string
+	of   func(procRun) float64
+}{
+	{"wall", "s", func(r procRun) float64 { return r.Wall.Seconds() }},
+	{"workload", "s", func(r procRun) float64 { return r.Reports[0].Elapsed.Seconds() }},
+	{"cpu", "s", func(r procRun) float64 { return r.CPU.Seconds() }},
+	{"work/s", "", workRate},
+	{"allocated", "MB", func(r procRun) float64 { return float64(r.Reports[0].TotalAlloc) / (1 << 20) }},
+	{"gc runs", "", func(r procRun) float64 { return float64(r.Reports[0].NumGC) }},
+	{"gc pause", "ms", func(r procRun) float64 { return float64(r.Reports[0].PauseTotal) / float64(time.Millisecond) }},
+}
+
+// workRate is the work per second of a run's workload, zero for workloads
+// that count none.
+func workRate(r procRun) float64 {
+	rep := r.Reports[0]
+	if rep.Elapsed <= 0 {
+		return 0
+	}
+	return float64(rep.Work) / rep.Elapsed.Seconds()
+}
+
+// writeRunSummary prints a row per measurement with its spread over runs.
+func writeRunSummary(w *os.File, runs []procRun) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%d RUNS\tMEAN\tSTDDEV\tMIN\tMAX\tP95\t\n", len(runs))
+	for _, m := range runMetrics {
+		values := make([]float64, len(runs))
+		for i, r := range runs {
+			values[i] = m.of(r)
+		}
+		s := summarize(values)
+		name := m.name
+		if m.unit != "" {
+			name += " (" + m.unit + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", name,
+			formatStat(s.Mean), formatStat(s.Stddev), formatStat(s.Min), formatStat(s.Max), formatStat(s.P95))
+	}
+	tw.Flush()
+}
+
+// formatStat prints v with three significant digits, or as a whole number
+// from 100 up.
+func formatStat(v float64) string {
+	if math.Abs(v) >= 100 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
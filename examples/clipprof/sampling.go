@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/sampling"
+)
+
+// runSamplingWorkload runs the same fixed amount of deep-stack work for every
+// combination of -sampling-rates and -sampling-depths, once without and once
+// with the CPU profiler, and reports overhead and sample fidelity.
+func runSamplingWorkload(ctx context.Context) {
+	if *cpuProfile != "" {
+		log.Fatal("the sampling workload runs its own CPU profiles; drop -cpuprofile")
+	}
+	rates := parseInts(*samplingRates, 1)
+	depths := parseInts(*samplingDepths, 1)
+	fmt.Printf("Running sampling workload (%d rounds per run)...\n", *samplingRounds)
+
+	var cells []sampling.Cell
+	for _, depth := range depths {
+		for _, rate := range rates {
+			var cell sampling.Cell
+			var err error
+			trace.WithRegion(ctx, fmt.Sprintf("sampling rate=%d depth=%d", rate, depth), func() {
+				cell, err = measureCell(rate, depth)
+			})
+			if err != nil {
+				log.Fatal("sampling measurement failed: ", err)
+			}
+			cells = append(cells, cell)
+		}
+	}
+
+	fmt.Println()
+	if err := sampling.WriteText(os.Stdout, cells); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func measureCell(rate, depth int) (sampling.Cell, error) {
+	cell := sampling.Cell{Rate: rate, Depth: depth}
+	cell.Baseline = runRounds(depth)
+
+	// StartCPUProfile always asks for 100 Hz; a rate set beforehand wins, at
+	// the cost of a warning from the runtime.
+	if rate != 100 {
+		runtime.SetCPUProfileRate(rate)
+	}
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return cell, err
+	}
+	cell.Profiled = runRounds(depth)
+	pprof.StopCPUProfile()
+
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return cell, err
+	}
+	cell.Fidelity, err = sampling.Analyze(p)
+	return cell, err
+}
+
+func runRounds(depth int) time.Duration {
+	start := time.Now()
+	var result uint64
+	for range *samplingRounds {
+		result += descend(depth)
+	}
+	sink = result
+	return time.Since(start)
+}
+
+// sink keeps the measured work from being optimized away.
+var sink uint64
+
+// parseInts parses a comma-separated list of integers, none below least.
+func parseInts(list string, least int) []int {
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < least {
+			log.Fatalf("invalid number %q in %q", f, list)
+		}
+		out = append(out, n)
+	}
+	return out
+}
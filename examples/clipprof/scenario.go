@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scenario is a -config file: steps run one after another, each a workload
+// or a mix of workloads run together, with its own flag values.
+//
+//	{
+//	  "flags": {"duration": "5"},
+//	  "steps": [
+//	    {"name": "baseline", "workload": "cpu"},
+//	    {"name": "contended", "mix": ["mutex", "channels"], "flags": {"goroutines": "200"}},
+//	    {"name": "mostly-cpu", "mix": ["cpu=80", "memory=20"]},
+//	    {"workload": "gc", "repeat": 3, "flags": {"gc-mix": "90,10,0"}}
+//	  ],
+//	  "sinks": [{"type": "s3", "url": "s3://perf-results/nightly"}]
+//	}
+type scenario struct {
+	// Flags apply to every step, before the step's own.
+	Flags map[string]string `json:"flags"`
+	Steps []scenarioStep    `json:"steps"`
+	// Sinks are where the files of the run go after it; see sinkConfig.
+	Sinks []sinkConfig `json:"sinks"`
+}
+
+type scenarioStep struct {
+	// Name labels the step's CPU profile samples and trace region; it
+	// defaults to the workload names.
+	Name     string            `json:"name"`
+	Workload string            `json:"workload"`
+	Mix      []string          `json:"mix"`
+	Repeat   int               `json:"repeat"`
+	Flags    map[string]string `json:"flags"`
+}
+
+// runFlags are the flags that configure the whole run rather than a
+// workload, which a step cannot change.
+var runFlags = []string{
+	"config", "workload", "mix", "pitfall", "pitfall-rounds", "cpuprofile", "memprofile", "trace", "blockprofile", "mutexprofile",
+	"heapinterval", "http", "selftest", "outdir", "bundle", "upload", "sinks", "push-url", "push-backend", "push-app", "push-labels", "procs", "runs", "sweep-gomaxprocs", "cpus", "gogc", "gomemlimit", "ballast", "warmup", "stats-format", "stats-file", "bench-output", "seed", "progress", "quiet", "stackdump",
+	"goroutineprofile", "goroutineprofile-at", "blocktimeline", "blocktimeline-interval", "flamegraph", "delta-profiles",
+	"wallprofile", "wallprofile-hz", "plugin", "plugin-args",
+}
+
+// loadScenario reads and checks a -config file. Every flag value is set
+// once and put back, so a typo fails before the first step runs.
+func loadScenario(path string) (*scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sc scenario
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if (st.Workload == "") == (len(st.Mix) == 0) {
+			return nil, fmt.Errorf("%s: step %d: set one of workload and mix", path, i+1)
+		}
+		names, _, err := parseMix(st.workloads())
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", path, i+1, err)
+		}
+		if st.Name == "" {
+			st.Name = strings.Join(names, "+")
+		}
+		st.Repeat = max(st.Repeat, 1)
+		restore, err := applyStepFlags(sc.Flags, st.Flags)
+		if err == nil {
+			err = checkWorkloadFlags()
+		}
+		restore()
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", path, i+1, err)
+		}
+	}
+	return &sc, nil
+}
+
+func (st scenarioStep) workloads() []string {
+	if st.Workload != "" {
+		return []string{st.Workload}
+	}
+	return st.Mix
+}
+
+// applyStepFlags sets the scenario's flags and then the step's, returning a
+// function that puts back the values they had.
+func applyStepFlags(sets ...map[string]string) (restore func(), err error) {
+	saved := make(map[string]string)
+	restore = func() {
+		for name, v := range saved {
+			flag.Set(name, v)
+		}
+	}
+	for _, set := range sets {
+		for name, v := range set {
+			f := flag.Lookup(name)
+			if f == nil {
+				return restore, fmt.Errorf("unknown flag %q", name)
+			}
+			if slices.Contains(runFlags, name) {
+				return restore, fmt.Errorf("flag %q applies to the whole run, set it on the command line", name)
+			}
+			if _, ok := saved[name]; !ok {
+				saved[name] = f.Value.String()
+			}
+			if err := flag.Set(name, v); err != nil {
+				return restore, fmt.Errorf("flag %q: %w", name, err)
+			}
+		}
+	}
+	return restore, nil
+}
+
+// runScenario runs the steps in order. CPU profile samples taken during a
+// step carry a "step" label, and the execution trace has a region per step,
+// so one profile of the whole scenario can be split by step afterwards.
+func runScenario(ctx context.Context, sc *scenario) {
+	fmt.Printf("Running scenario (%d steps)...\n", len(sc.Steps))
+	for i, st := range sc.Steps {
+		restore, err := applyStepFlags(sc.Flags, st.Flags)
+		if err != nil {
+			log.Fatal(err) // loadScenario has tried these values
+		}
+		for r := range st.Repeat {
+			label := st.Name
+			if st.Repeat > 1 {
+				label = fmt.Sprintf("%s#%d", st.Name, r+1)
+			}
+			fmt.Printf("\n--- step %d/%d: %s (%d seconds) ---\n", i+1, len(sc.Steps), label, *duration)
+			start, work := time.Now(), workDone.Load()
+			pprof.Do(ctx, pprof.Labels("step", label), func(ctx context.Context) {
+				trace.WithRegion(ctx, "step "+label, func() { runMix(ctx, st.workloads()) })
+			})
+			elapsed := time.Since(start)
+			fmt.Printf("--- step %s done in %s ---\n", label, elapsed.Round(time.Millisecond))
+			scenarioResults.add(stepResult{Step: label, Workloads: st.workloads(), Seconds: elapsed.Seconds(), Work: workDone.Load() - work})
+		}
+		restore()
+	}
+}
+
+// stepResult is the outcome of one run of a scenario step.
+type stepResult struct {
+	Step      string   `json:"step"`
+	Workloads []string `json:"workloads"`
+	Seconds   float64  `json:"seconds"`
+	// Work is the units of work the step finished; see workDone.
+	Work uint64 `json:"work"`
+}
+
+// stepResults are the steps a scenario has finished. A signal ends the run
+// while a step is still going, so they are read under the lock.
+type stepResults struct {
+	mu      sync.Mutex
+	results []stepResult
+}
+
+var scenarioResults stepResults
+
+func (r *stepResults) add(res stepResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+// write writes the finished steps to path as a JSON list, for the sinks
+// of the run.
+func (r *stepResults) write(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.results, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// runMix runs the workloads of mix entries concurrently, as the all
+// workload does, each at its share and with its workload label; see
+// parseMix.
+func runMix(ctx context.Context, entries []string) {
+	names, shares, err := parseMix(entries)
+	if err != nil {
+		log.Fatal(err) // loadScenario and main have parsed these entries
+	}
+	mixShares = shares
+	defer func() { mixShares = nil }()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Go(func() { runLabeled(ctx, name, workloads[name]) })
+	}
+	wg.Wait()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vdntruong/gosamurai/preflight"
+)
+
+// runSelfTest checks the environment for the profiles the flags ask for and
+// exits non-zero if a check failed.
+func runSelfTest() {
+	checks := []preflight.Check{
+		preflight.ProfileRates(),
+		preflight.CPUProfiler(),
+		preflight.Writable(""),
+	}
+	if *httpAddr != "" {
+		checks = append(checks, preflight.Port(*httpAddr))
+	}
+	if *outDir != "" {
+		checks = append(checks, preflight.Creatable(*outDir))
+	}
+	var dirs []string
+	for _, p := range []string{*cpuProfile, *memProfile, *blockProfile, *mutexProfile, *goroutineProfile, *traceFile, *blockTimeline, *flamegraphFile, *wallProfile} {
+		if p != "" && !slices.Contains(dirs, filepath.Dir(p)) {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+	}
+	for _, dir := range dirs {
+		checks = append(checks, preflight.Writable(dir))
+	}
+	checks = append(checks, preflight.Cgroup(), preflight.ClockResolution())
+
+	report := preflight.Run(checks...)
+	report.WriteText(os.Stdout)
+	if !report.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
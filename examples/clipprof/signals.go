@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitInterrupted is the exit status after SIGINT or SIGTERM, the 128+SIGINT
+// a shell reports for a process killed by Ctrl-C.
+const exitInterrupted = 130
+
+// runUntilSignal runs the workload and returns early, reporting true, when
+// SIGINT or SIGTERM arrives, so main can still stop the CPU profile and the
+// trace and write every requested profile. The workload's goroutines keep
+// running while that happens; a second signal kills the process as usual.
+// The context run gets is cancelled by the signal.
+func runUntilSignal(run func(ctx context.Context)) (interrupted bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	select {
+	case <-done:
+		return false
+	case <-ctx.Done():
+		return true
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/pluginapi"
+)
+
+// sinkConfig is one entry of the "sinks" block of a -config scenario, or
+// of a -sinks file: a built-in sink the files of the run go to after it,
+// next to the sinks plugins add.
+//
+//	"sinks": [
+//	  {"type": "stdout"},
+//	  {"type": "file", "path": "/mnt/results"},
+//	  {"type": "http", "url": "https://perf.example.com/runs", "headers": {"Authorization": "Bearer $PERF_TOKEN"}},
+//	  {"type": "s3", "url": "s3://perf-results/nightly"},
+//	  {"type": "pyroscope", "url": "http://localhost:4040", "app": "clipprof", "labels": {"env": "ci"}}
+//	]
+//
+// Every sink stores a file under the same name, <run>/<file>, where run is
+// the name of the run directory, as 2024-05-01T10-00-00/cpu.pprof, so the
+// reports of a run land next to its profiles wherever they go. The
+// pyroscope and parca sinks instead push the pprof profiles, under an
+// application name and labels, to a continuous profiling server.
+type sinkConfig struct {
+	Type string `json:"type"`
+	// Path is the directory of a file sink.
+	Path string `json:"path"`
+	// URL is the base URL of an http, pyroscope, or parca sink, and the
+	// s3:// or gs:// prefix of an s3 or gs sink.
+	URL string `json:"url"`
+	// Headers go with every request of an http sink. $VAR and ${VAR} in
+	// them are expanded from the environment, so tokens stay out of the
+	// file.
+	Headers map[string]string `json:"headers"`
+	// App and Labels name the profiles a pyroscope or parca sink pushes,
+	// default clipprof; every one also has a workload label.
+	App    string            `json:"app"`
+	Labels map[string]string `json:"labels"`
+}
+
+// sinkTypes are the values of sinkConfig.Type.
+var sinkTypes = []string{"stdout", "file", "http", "s3", "gs", "pyroscope", "parca"}
+
+// sinks are the built-in sinks of -sinks and the "sinks" block of -config.
+var sinks []pluginapi.Sink
+
+// loadSinks reads a -sinks file, a JSON list of sinkConfig.
+func loadSinks(path string) ([]sinkConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var configs []sinkConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// sink checks c and returns the sink it configures.
+func (c sinkConfig) sink() (pluginapi.Sink, error) {
+	switch c.Type {
+	case "stdout":
+		return pluginapi.Sink{Name: "stdout", Send: sendStdout}, nil
+	case "file":
+		if c.Path == "" {
+			return pluginapi.Sink{}, fmt.Errorf("file sink: no path")
+		}
+		return pluginapi.Sink{Name: "file:" + c.Path, Send: func(ctx context.Context, run pluginapi.Run) error {
+			return sendFiles(ctx, run, func(ctx context.Context, src, name string) error {
+				return copyFile(src, filepath.Join(c.Path, filepath.FromSlash(name)))
+			})
+		}}, nil
+	case "http":
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return pluginapi.Sink{}, fmt.Errorf("http sink: url must be http:// or https://, got %q", redactURL(c.URL))
+		}
+		return pluginapi.Sink{Name: u.Redacted(), Send: func(ctx context.Context, run pluginapi.Run) error {
+			return sendFiles(ctx, run, func(ctx context.Context, src, name string) error {
+				return putFile(ctx, src, u.JoinPath(name).String(), c.Headers)
+			})
+		}}, nil
+	case "s3", "gs":
+		if !strings.HasPrefix(c.URL, c.Type+"://") {
+			return pluginapi.Sink{}, fmt.Errorf("%s sink: url must be %s://bucket/prefix, got %q", c.Type, c.Type, redactURL(c.URL))
+		}
+		if err := checkUpload(c.URL); err != nil {
+			return pluginapi.Sink{}, err
+		}
+		u, _ := url.Parse(c.URL) // checkUpload has parsed it
+		up := uploaders[u.Scheme]
+		return pluginapi.Sink{Name: u.Redacted(), Send: func(ctx context.Context, run pluginapi.Run) error {
+			return sendFiles(ctx, run, func(ctx context.Context, src, name string) error {
+				dst := *u
+				dst.Path = path.Join("/", u.Path, name)
+				out, err := exec.CommandContext(ctx, up.cli, up.file(src, dst.String())...).CombinedOutput()
+				if err != nil {
+					return fmt.Errorf("%s: %w: %s", up.cli, err, strings.TrimSpace(string(out)))
+				}
+				return nil
+			})
+		}}, nil
+	case "pyroscope", "parca":
+		return pushSink(c.Type, c.URL, c.App, c.Labels)
+	}
+	return pluginapi.Sink{}, fmt.Errorf("sink type must be one of %s, got %q", strings.Join(sinkTypes, ", "), c.Type)
+}
+
+// runName is the directory a sink puts the files of run in.
+func runName(run pluginapi.Run) string {
+	if run.Dir != "" {
+		return filepath.Base(run.Dir)
+	}
+	return run.Started.Format("2006-01-02T15-04-05")
+}
+
+// sendFiles sends every file of run, in the order of their kinds, under
+// its name in the run: its path in run.Dir, or its base name outside it.
+func sendFiles(ctx context.Context, run pluginapi.Run, send func(ctx context.Context, src, name string) error) error {
+	for _, kind := range slices.Sorted(maps.Keys(run.Files)) {
+		src := run.Files[kind]
+		name := filepath.Base(src)
+		if run.Dir != "" {
+			dir, _ := filepath.Abs(run.Dir)
+			abs, _ := filepath.Abs(src)
+			if rel, err := filepath.Rel(dir, abs); err == nil && filepath.IsLocal(rel) {
+				name = filepath.ToSlash(rel)
+			}
+		}
+		if err := send(ctx, src, runName(run)+"/"+name); err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// sendStdout lists the files of run with their names and sizes.
+func sendStdout(ctx context.Context, run pluginapi.Run) error {
+	fmt.Printf("\n=== Run %s ===\n", runName(run))
+	return sendFiles(ctx, run, func(_ context.Context, src, name string) error {
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-40s %10d bytes  %s\n", name, info.Size(), src)
+		return nil
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// putFile uploads src to dst with a PUT, as object stores, WebDAV servers,
+// and presigned URLs take files.
+func putFile(ctx context.Context, src, dst string, headers map[string]string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dst, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	for k, v := range headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
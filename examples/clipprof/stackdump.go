@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+)
+
+// writeStackDump writes the full stack of every goroutine to path, in the
+// format of an unrecovered panic, with how long each has been blocked.
+func writeStackDump(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// startStackDumps writes a numbered stack dump next to path each time one of
+// dumpSignals arrives while the workload runs, and lets it carry on. Without
+// this SIGQUIT would print the same stacks and kill the process. The returned
+// function stops listening and reports how many dumps were written.
+func startStackDumps(path string) (stop func() int) {
+	if len(dumpSignals) == 0 {
+		return func() int { return 0 }
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, dumpSignals...)
+	done := make(chan struct{})
+	count := make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-done:
+				count <- n
+				return
+			case <-sigs:
+				n++
+				p := numberedPath(path, n)
+				goroutines := pprof.Lookup("goroutine").Count()
+				if err := writeStackDump(p); err != nil {
+					log.Printf("could not write stack dump: %v", err)
+					continue
+				}
+				fmt.Printf("Stack dump %d (%d goroutines) written to: %s\n", n, goroutines, p)
+			}
+		}
+	}()
+	return func() int {
+		signal.Stop(sigs)
+		close(done)
+		return <-count
+	}
+}
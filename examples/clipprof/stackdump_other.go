@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// dumpSignals is empty where there is no SIGUSR1 or SIGQUIT to send, so
+// -stackdump does nothing.
+var dumpSignals []os.Signal
@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// dumpSignals ask for a stack dump: kill -USR1 or kill -QUIT, or Ctrl-\ in
+// the terminal.
+var dumpSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGQUIT}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// stackFrames are the frame sizes -stack-frame can pick; a frame's size is
+// fixed at compile time, so each has its own function.
+var stackFrames = map[int]func(int) uint64{
+	64:   recurse64,
+	1024: recurse1K,
+	8192: recurse8K,
+}
+
+// maxStackGrowth is how deep the stack workload may go: half the runtime's
+// 1 GB maximum stack, which leaves room for what each frame holds beyond its
+// array. A goroutine past the maximum kills the process, profiles and all.
+const maxStackGrowth = 512 << 20
+
+// checkStackFrames checks -stack-frame, and that -stackdepth frames of it
+// fit in maxStackGrowth.
+func checkStackFrames() error {
+	if _, ok := stackFrames[*stackFrame]; !ok {
+		return fmt.Errorf("-stack-frame must be 64, 1024, or 8192, got %d", *stackFrame)
+	}
+	if *stackDepth < 1 || *stackDepth > maxStackGrowth / *stackFrame {
+		return fmt.Errorf("-stackdepth must be from 1 to %d with -stack-frame=%d, so a stack stays under %d MB; got %d",
+			maxStackGrowth / *stackFrame, *stackFrame, maxStackGrowth>>20, *stackDepth)
+	}
+	return nil
+}
+
+// runStackGrowthWorkload has -goroutines goroutines start fresh goroutines
+// that recurse -stackdepth frames of -stack-frame bytes each, do a little
+// work at the bottom, and return. A new goroutine starts with a small stack,
+// so on the way down it runs out over and over; every time, the runtime
+// allocates one twice the size and copies the stack over (runtime.morestack,
+// newstack, copystack in the CPU profile). While it runs, the workload
+// samples how much memory the stacks take, and it reports the peak along
+// with the stack size the runtime has learnt to start goroutines with.
+func runStackGrowthWorkload(ctx context.Context) {
+	recurse := stackFrames[*stackFrame] // checked by checkWorkloadFlags
+	need := *stackDepth * *stackFrame
+	fmt.Printf("Running stack growth workload (%d goroutines, %d frames of %d bytes, about %d KB per stack)...\n",
+		*goroutines, *stackDepth, *stackFrame, need>>10)
+	startSize := stackStartingSize()
+
+	start := time.Now()
+	endTime := start.Add(time.Duration(*duration) * time.Second)
+	stop := make(chan struct{})
+	peak := make(chan uint64)
+	go func() { peak <- sampleStackPeak(stop) }()
+
+	var (
+		mu     sync.Mutex
+		rounds uint64
+		wg     sync.WaitGroup
+	)
+	for range *goroutines {
+		wg.Go(func() {
+			defer trace.StartRegion(ctx, "grow stacks").End()
+			var n, result uint64
+			p := newPacer("stack")
+			for time.Now().Before(endTime) {
+				done := make(chan uint64)
+				go func() { done <- recurse(*stackDepth) }()
+				result += <-done
+				n++
+				p.pace()
+			}
+			mu.Lock()
+			rounds += n
+			sink += result
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(stop)
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Printf("Stack growth workload: %d goroutines grown to ~%d KB (%.0f/s)\n", rounds, need>>10, float64(rounds)/elapsed.Seconds())
+	fmt.Printf("  stack memory    peak %d KB in use; now %d KB in use, %d KB from the OS (MemStats.StackInuse, StackSys)\n",
+		<-peak>>10, m.StackInuse>>10, m.StackSys>>10)
+	fmt.Printf("  starting size   %d bytes before, %d bytes after\n", startSize, stackStartingSize())
+}
+
+// sampleStackPeak reads the memory held by goroutine stacks every 10ms until
+// stop is closed and returns the most it saw. runtime/metrics reads it
+// without stopping the world, unlike ReadMemStats.
+func sampleStackPeak(stop <-chan struct{}) uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/stacks:bytes"}}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	var peak uint64
+	for {
+		metrics.Read(sample)
+		peak = max(peak, sample[0].Value.Uint64())
+		select {
+		case <-stop:
+			return peak
+		case <-ticker.C:
+		}
+	}
+}
+
+// stackStartingSize returns the stack size new goroutines start with. The
+// runtime adjusts it at every GC to the average stack use it scanned.
+func stackStartingSize() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/stack/starting-size:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+//go:noinline
+func recurse64(depth int) uint64 {
+	var frame [64]byte
+	if depth <= 0 {
+		return computeFibonacci(12)
+	}
+	frame[depth%len(frame)] = byte(depth)
+	return recurse64(depth-1) + uint64(frame[depth%len(frame)])
+}
+
+//go:noinline
+func recurse1K(depth int) uint64 {
+	var frame [1024]byte
+	if depth <= 0 {
+		return computeFibonacci(12)
+	}
+	frame[depth%len(frame)] = byte(depth)
+	return recurse1K(depth-1) + uint64(frame[depth%len(frame)])
+}
+
+//go:noinline
+func recurse8K(depth int) uint64 {
+	var frame [8192]byte
+	if depth <= 0 {
+		return computeFibonacci(12)
+	}
+	frame[depth%len(frame)] = byte(depth)
+	return recurse8K(depth-1) + uint64(frame[depth%len(frame)])
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+)
+
+// statsFormats are the values of -stats-format.
+var statsFormats = []string{"text", "json", "csv"}
+
+// runStats are the runtime statistics at the end of the workload, printed
+// as text or written as JSON or CSV for scripts and CI checks. Sizes are in
+// bytes and times in seconds, so values compare without parsing units.
+type runStats struct {
+	Workload    string  `json:"workload"`
+	Seed        uint64  `json:"seed"`
+	Interrupted bool    `json:"interrupted"`
+	WallSeconds float64 `json:"wall_seconds"`
+	// Work is the units of work the workloads finished; see workDone.
+	Work       uint64  `json:"work"`
+	Goroutines int     `json:"goroutines"`
+	GOMAXPROCS int     `json:"gomaxprocs"`
+	HeapAlloc  uint64  `json:"heap_alloc_bytes"`
+	TotalAlloc uint64  `json:"total_alloc_bytes"`
+	Sys        uint64  `json:"sys_bytes"`
+	NumGC      uint32  `json:"gc_runs"`
+	GCPause    float64 `json:"gc_pause_seconds"`
+	// LastGC is zero when no collection ran.
+	LastGC time.Time `json:"last_gc,omitzero"`
+	// The process statistics are zero where procstats cannot read them.
+	RSS     uint64 `json:"rss_bytes"`
+	FDs     int    `json:"open_fds"`
+	FDLimit uint64 `json:"fd_limit"`
+	Threads int    `json:"threads"`
+	proc    bool   // the process statistics were read
+	// Phases are the phases of the run finished when the statistics are
+	// written, all but the report; the table at the end has every one.
+	Phases []phase `json:"phases,omitempty"`
+}
+
+// collectStats reads the statistics of a workload that ran for elapsed.
+func collectStats(elapsed time.Duration, interrupted bool) runStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s := runStats{
+		Workload:    *workload,
+		Seed:        random.Seed(),
+		Interrupted: interrupted,
+		WallSeconds: elapsed.Seconds(),
+		Work:        workDone.Load(),
+		Goroutines:  runtime.NumGoroutine(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		HeapAlloc:   m.HeapAlloc,
+		TotalAlloc:  m.TotalAlloc - warmupBaseline.TotalAlloc,
+		Sys:         m.Sys,
+		NumGC:       m.NumGC - warmupBaseline.NumGC,
+		GCPause:     time.Duration(m.PauseTotalNs - warmupBaseline.PauseTotalNs).Seconds(),
+	}
+	if *configFile != "" {
+		s.Workload = "config:" + *configFile
+	} else if *mixFlag != "" {
+		s.Workload = "mix:" + *mixFlag
+	}
+	if m.LastGC != 0 {
+		s.LastGC = time.Unix(0, int64(m.LastGC))
+	}
+	if proc, err := procstats.Read(); err == nil {
+		s.RSS, s.FDs, s.FDLimit, s.Threads = proc.RSS, proc.FDs, proc.FDLimit, proc.Threads
+		s.proc = true
+	}
+	return s
+}
+
+// writeStats writes s in -stats-format to -stats-file, or stdout.
+func writeStats(s runStats) error {
+	var w io.Writer = os.Stdout
+	if *statsFile != "" {
+		f, err := os.Create(*statsFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	var err error
+	switch *statsFormat {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(s)
+	case "csv":
+		err = writeStatsCSV(w, s)
+	default:
+		printStats(w, s)
+	}
+	if err != nil {
+		return err
+	}
+	if *statsFile != "" {
+		fmt.Printf("Statistics written to: %s\n", *statsFile)
+	}
+	return nil
+}
+
+// writeStatsCSV writes a header row named after the JSON keys and one row
+// of values, so the files of many runs concatenate into one table once the
+// repeated headers are dropped.
+func writeStatsCSV(w io.Writer, s runStats) error {
+	lastGC := ""
+	if !s.LastGC.IsZero() {
+		lastGC = s.LastGC.Format(time.RFC3339Nano)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"workload", "seed", "interrupted", "wall_seconds", "work", "goroutines", "gomaxprocs",
+		"heap_alloc_bytes", "total_alloc_bytes", "sys_bytes", "gc_runs", "gc_pause_seconds", "last_gc",
+		"rss_bytes", "open_fds", "fd_limit", "threads"})
+	cw.Write([]string{
+		s.Workload,
+		strconv.FormatUint(s.Seed, 10),
+		strconv.FormatBool(s.Interrupted),
+		strconv.FormatFloat(s.WallSeconds, 'f', -1, 64),
+		strconv.FormatUint(s.Work, 10),
+		strconv.Itoa(s.Goroutines),
+		strconv.Itoa(s.GOMAXPROCS),
+		strconv.FormatUint(s.HeapAlloc, 10),
+		strconv.FormatUint(s.TotalAlloc, 10),
+		strconv.FormatUint(s.Sys, 10),
+		strconv.FormatUint(uint64(s.NumGC), 10),
+		strconv.FormatFloat(s.GCPause, 'f', -1, 64),
+		lastGC,
+		strconv.FormatUint(s.RSS, 10),
+		strconv.Itoa(s.FDs),
+		strconv.FormatUint(s.FDLimit, 10),
+		strconv.Itoa(s.Threads),
+	})
+	cw.Flush()
+	return cw.Error()
+}
+
+func printStats(w io.Writer, s runStats) {
+	fmt.Fprintln(w, "\n=== Runtime Statistics ===")
+	fmt.Fprintf(w, "Wall Time:         %s\n", time.Duration(s.WallSeconds*float64(time.Second)).Round(time.Millisecond))
+	fmt.Fprintf(w, "Work Done:         %d\n", s.Work)
+	fmt.Fprintf(w, "Goroutines:        %d\n", s.Goroutines)
+	fmt.Fprintf(w, "Heap Allocated:    %d MB\n", s.HeapAlloc/1024/1024)
+	fmt.Fprintf(w, "Total Allocated:   %d MB\n", s.TotalAlloc/1024/1024)
+	fmt.Fprintf(w, "System Memory:     %d MB\n", s.Sys/1024/1024)
+	fmt.Fprintf(w, "GC Runs:           %d\n", s.NumGC)
+	if s.LastGC.IsZero() {
+		fmt.Fprintln(w, "Last GC Time:      never")
+	} else {
+		fmt.Fprintf(w, "Last GC Time:      %s\n", s.LastGC)
+	}
+	if s.proc {
+		fmt.Fprintf(w, "Resident Memory:   %d MB\n", s.RSS/1024/1024)
+		fmt.Fprintf(w, "Open FDs:          %d of %d\n", s.FDs, s.FDLimit)
+		fmt.Fprintf(w, "OS Threads:        %d\n", s.Threads)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// workDone counts the units of work the workloads have finished, one per
+// pass of their main loop: a Fibonacci round, a lock acquisition, a message
+// sent, a request served. A unit means something different in every
+// workload, so only runs of the same workload compare.
+var workDone atomic.Uint64
+
+// sweepRow is the runs of one GOMAXPROCS value.
+type sweepRow struct {
+	procs int
+	runs  []procRun
+}
+
+// runSweep runs the workload once per GOMAXPROCS value, or -runs times, one
+// child process after another in dir/gomaxprocs-<N>, and compares their
+// throughput. The children get the same -seed, and the profiles requested
+// with the usual flags are written into each child's directory under the
+// names given. It reports whether a signal cut the sweep short.
+func runSweep(dir string, values []int) (interrupted bool, err error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var rows []sweepRow
+	for _, n := range values {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("Running with GOMAXPROCS=%d...\n", n)
+		runs, err := repeatProcs(ctx, dir, "gomaxprocs-"+strconv.Itoa(n), []string{"GOMAXPROCS=" + strconv.Itoa(n)})
+		if err != nil {
+			return false, err
+		}
+		if len(runs) > 0 {
+			rows = append(rows, sweepRow{procs: n, runs: runs})
+		}
+	}
+	interrupted = ctx.Err() != nil
+
+	fmt.Println()
+	writeSweep(os.Stdout, rows)
+	if *benchOutput != "" {
+		var results []benchResult
+		for _, row := range rows {
+			results = append(results, benchResults(row.runs)...)
+		}
+		if err := writeBench(*benchOutput, results); err != nil {
+			return interrupted, err
+		}
+	}
+	return interrupted, nil
+}
+
+// writeSweep prints the comparison, one row per GOMAXPROCS value, with the
+// throughput relative to the first row. With -runs every value is the mean
+// of the runs, and the spread of the throughput gets a column of its own.
+// Workloads without a main loop to count, such as sampling, show no
+// throughput.
+func writeSweep(w *os.File, rows []sweepRow) {
+	repeated := *runCount > 1
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if repeated {
+		fmt.Fprintf(tw, "GOMAXPROCS\tWALL\tCPU\tWORK/S (MEAN OF %d)\tSTDDEV\tSPEEDUP\tGC RUNS\tGC PAUSE\n", *runCount)
+	} else {
+		fmt.Fprintln(tw, "GOMAXPROCS\tWALL\tCPU\tWORK\tWORK/S\tSPEEDUP\tGC RUNS\tGC PAUSE")
+	}
+	var base float64
+	for _, row := range rows {
+		over := func(of func(procRun) float64) summary {
+			values := make([]float64, len(row.runs))
+			for i, r := range row.runs {
+				values[i] = of(r)
+			}
+			return summarize(values)
+		}
+		wall := time.Duration(over(func(r procRun) float64 { return float64(r.Wall) }).Mean)
+		cpu := time.Duration(over(func(r procRun) float64 { return float64(r.CPU) }).Mean)
+		pause := time.Duration(over(func(r procRun) float64 { return float64(r.Reports[0].PauseTotal) }).Mean)
+		gcs := over(func(r procRun) float64 { return float64(r.Reports[0].NumGC) }).Mean
+		work := over(func(r procRun) float64 { return float64(r.Reports[0].Work) }).Mean
+		rate := over(workRate)
+
+		perSec, spread, speedup := "-", "-", "-"
+		if rate.Mean > 0 {
+			if base == 0 {
+				base = rate.Mean
+			}
+			perSec, spread, speedup = fmt.Sprintf("%.0f", rate.Mean), fmt.Sprintf("%.0f", rate.Stddev), fmt.Sprintf("%.2fx", rate.Mean/base)
+		}
+		middle := fmt.Sprintf("%.0f\t%s", work, perSec)
+		if repeated {
+			middle = perSec + "\t" + spread
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", row.procs,
+			wall.Round(time.Millisecond), cpu.Round(time.Millisecond), middle, speedup,
+			formatStat(gcs), pause.Round(time.Microsecond))
+	}
+	tw.Flush()
+}
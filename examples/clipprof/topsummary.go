@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/top"
+)
+
+// printTopSummaries prints the -top functions of the CPU profile by flat
+// CPU time, of the heap profile by in-use space, and of the wall-clock
+// profile by wall time, once they are written, for a read of the run
+// without go tool pprof.
+func printTopSummaries() {
+	if *topN <= 0 {
+		return
+	}
+	for _, p := range []struct{ path, sampleType, title string }{
+		{*cpuProfile, "cpu", "CPU"},
+		{*memProfile, "inuse_space", "Heap"},
+		{*wallProfile, "wall", "Wall clock"},
+	} {
+		if p.path == "" {
+			continue
+		}
+		fmt.Printf("\n=== Top %d: %s (%s) ===\n", *topN, p.title, p.path)
+		if err := printTop(p.path, p.sampleType); err != nil {
+			fmt.Printf("no summary: %v\n", err)
+		}
+	}
+}
+
+func printTop(path, sampleType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return err
+	}
+	r, err := top.Compute(p, sampleType)
+	if err != nil {
+		return err
+	}
+	return r.WriteText(os.Stdout, *topN)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// uploaders are the object stores -upload copies to, by URL scheme, with
+// the CLI that does the copying. The CLIs bring their own credentials,
+// from the environment, instance metadata, or a login, so a headless
+// machine needs nothing more than it already has for them.
+var uploaders = map[string]struct {
+	cli string
+	// args copy a directory's contents, or a single file, to dst.
+	dir, file func(src, dst string) []string
+}{
+	"s3": {
+		cli: "aws",
+		dir: func(src, dst string) []string {
+			return []string{"s3", "cp", "--recursive", "--only-show-errors", src, dst}
+		},
+		file: func(src, dst string) []string { return []string{"s3", "cp", "--only-show-errors", src, dst} },
+	},
+	"gs": {
+		cli:  "gcloud",
+		dir:  func(src, dst string) []string { return []string{"storage", "rsync", "--recursive", src, dst} },
+		file: func(src, dst string) []string { return []string{"storage", "cp", src, dst} },
+	},
+}
+
+// checkUpload rejects an -upload URL clipprof cannot copy to, before the
+// run rather than after it.
+func checkUpload(dst string) error {
+	u, err := url.Parse(dst)
+	if err != nil {
+		return fmt.Errorf("-upload: %w", err)
+	}
+	up, ok := uploaders[u.Scheme]
+	if !ok || u.Host == "" {
+		return fmt.Errorf("-upload must be s3://bucket/prefix or gs://bucket/prefix, got %q", dst)
+	}
+	if _, err := exec.LookPath(up.cli); err != nil {
+		return fmt.Errorf("-upload %s:// needs the %s CLI: %w", u.Scheme, up.cli, err)
+	}
+	return nil
+}
+
+// uploadRun copies the run to dst after it: the -bundle archive if there is
+// one, and otherwise the run directory, each under its own name below the
+// prefix, as s3://bucket/prefix/2024-05-01T10-00-00/cpu.pprof. It returns
+// where the run went. A signal stops the copy.
+func uploadRun(dst, runDir, bundlePath string) (string, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	u, err := url.Parse(dst)
+	if err != nil {
+		return "", err
+	}
+	up := uploaders[u.Scheme]
+	src, args := bundlePath, up.file
+	if src == "" {
+		src, args = runDir, up.dir
+	}
+	u.Path = path.Join("/", u.Path, filepath.Base(src))
+	cmd := exec.CommandContext(ctx, up.cli, args(src, u.String())...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", context.Cause(ctx)
+		}
+		return "", fmt.Errorf("%s: %w", up.cli, err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/vdntruong/gosamurai/analysis/wallclock"
+)
+
+// startWallProfile samples the stack of every goroutine -wallprofile-hz
+// times a second while the workload runs, running or not. The returned
+// function stops sampling and writes the wall-clock profile to path.
+func startWallProfile(path string) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sampler := wallclock.NewSampler(*wallProfileHz)
+	done := make(chan error, 1)
+	go func() { done <- sampler.Run(ctx) }()
+
+	return func() error {
+		cancel()
+		if err := <-done; err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return sampler.Profile().Write(f)
+	}
+}
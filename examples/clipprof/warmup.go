@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// warmupExtra is the -warmup added to -duration while the workload runs.
+// The workloads read -duration when they start, so they run through the
+// warmup and the measured window in one go, keeping what they grew during
+// the warmup.
+var warmupExtra time.Duration
+
+// warmupBaseline is the memory statistics at the end of the warmup, which
+// the final statistics count from, so they cover the measured window only.
+// It is zero without -warmup.
+var warmupBaseline runtime.MemStats
+
+// warmUp starts the workload and returns once -warmup has passed, before
+// the profilers start, so their output misses the map growth, heap growth,
+// and scheduler ramp-up at the start of a run. The returned wait does what
+// runUntilSignal does for the rest of the run.
+func warmUp(run func(ctx context.Context)) (wait func() (interrupted bool)) {
+	warmupExtra = *warmup
+	*duration += int(*warmup / time.Second)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	fmt.Printf("Warming up for %s before profiling...\n", *warmup)
+	timer := time.NewTimer(*warmup)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	case <-ctx.Done():
+	}
+	workDone.Store(0)
+	runtime.ReadMemStats(&warmupBaseline)
+
+	return func() bool {
+		defer stop()
+		defer func() { *duration, warmupExtra = *duration-int(warmupExtra/time.Second), 0 }()
+		select {
+		case <-done:
+			return false
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
+
+// measuredDuration is the -duration the profilers see.
+func measuredDuration() time.Duration {
+	return time.Duration(*duration)*time.Second - warmupExtra
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/throttle"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/rbac"
+)
+
+// accessRules is the minimum role of each route group when -rbac-config is
+// set. Read-only debug data is open to viewers; profilers that slow the
+// service down, and log level changes, need an operator, and injecting
+// faults an admin. The admin dashboard checks for the admin role itself, so
+// its login page stays reachable.
+var accessRules = rbac.Rules{
+	"/debug/":              rbac.Viewer,
+	"/debug/pprof/profile": rbac.Operator,
+	"/debug/pprof/trace":   rbac.Operator,
+	"/debug/loglevel":      rbac.Operator,
+	"/debug/chaos":         rbac.Admin,
+}
+
+// listen serves h on addr, over TLS when -tls-cert is set. With -client-ca,
+// client certificates signed by it are verified so their SANs can be mapped
+// to roles; clients without one can still use the other credentials.
+func listen(addr string, h http.Handler) error {
+	if *tlsCert == "" {
+		return http.ListenAndServe(addr, h)
+	}
+	srv := &http.Server{Addr: addr, Handler: h, TLSConfig: &tls.Config{}}
+	if *clientCA != "" {
+		pem, err := os.ReadFile(*clientCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found", *clientCA)
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+}
+
+// throttleDownloads limits the bandwidth of pprof profiles and captured
+// artifacts, the responses that can be large enough to crowd out the
+// service's own traffic during an incident.
+func throttleDownloads(next http.Handler, l *throttle.Limiter) http.Handler {
+	throttled := l.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if strings.HasPrefix(p, "/debug/pprof/") || (strings.HasPrefix(p, "/debug/requests/") && strings.Contains(p, "/artifacts/")) {
+			throttled.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
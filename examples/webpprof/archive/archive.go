@@ -0,0 +1,184 @@
+// Package archive keeps a bounded history of served requests addressable by
+// request or trace ID: a summary, a timing breakdown, the log lines emitted
+// while serving it, and any artifacts captured for it.
+package archive
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Record is everything known about one request.
+type Record struct {
+	ID       string        `json:"id"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Query    string        `json:"query,omitempty"`
+	Status   int           `json:"status"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	Timings  []Phase       `json:"timings,omitempty"`
+	// Breakdown splits Duration into where the time went (see package timing).
+	Breakdown map[string]time.Duration `json:"breakdown_ns,omitempty"`
+	Logs      []LogLine                `json:"logs,omitempty"`
+	Artifacts []Artifact               `json:"artifacts,omitempty"`
+	// Repeats lists batching candidates; it is only filled in when the record
+	// is served.
+	Repeats []Repeat `json:"repeats,omitempty"`
+}
+
+// Phase is one named part of the request's wall time.
+type Phase struct {
+	Name     string        `json:"name"`
+	Start    time.Duration `json:"start_ns"` // offset from the request start
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// LogLine is a log record emitted while the request was served.
+type LogLine struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// Artifact is a captured blob attached to a request, such as a trace window
+// or a goroutine dump.
+type Artifact struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Created     time.Time `json:"created"`
+	// SHA256 is the hex digest of Data, served as the artifact's ETag.
+	SHA256 string `json:"sha256"`
+	Data   []byte `json:"-"`
+}
+
+// Summary is the short form of a Record used in listings.
+type Summary struct {
+	ID        string        `json:"id" parquet:"id"`
+	Method    string        `json:"method" parquet:"method"`
+	Path      string        `json:"path" parquet:"path"`
+	Status    int           `json:"status" parquet:"status"`
+	Start     time.Time     `json:"start" parquet:"start,timestamp(millisecond)"`
+	Duration  time.Duration `json:"duration_ns" parquet:"duration_ns"`
+	Artifacts int           `json:"artifacts" parquet:"artifacts"`
+}
+
+func (r *Record) summary() Summary {
+	return Summary{
+		ID:        r.ID,
+		Method:    r.Method,
+		Path:      r.Path,
+		Status:    r.Status,
+		Start:     r.Start,
+		Duration:  r.Duration,
+		Artifacts: len(r.Artifacts),
+	}
+}
+
+// Archive stores the most recent records, evicting the oldest first.
+type Archive struct {
+	mu      sync.RWMutex
+	max     int
+	records map[string]*Record
+	order   []string // ring of IDs, oldest at next
+	next    int
+}
+
+// New returns an archive that keeps at most max records.
+func New(max int) *Archive {
+	return &Archive{
+		max:     max,
+		records: make(map[string]*Record, max),
+		order:   make([]string, 0, max),
+	}
+}
+
+// Put stores r unless a record with its ID is already stored, and reports
+// whether it did. The first record keeps an ID, so a client that reuses
+// another request's X-Request-ID cannot replace what was archived for it.
+func (a *Archive) Put(r *Record) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.records[r.ID]; ok {
+		return false
+	}
+	if len(a.order) < a.max {
+		a.order = append(a.order, r.ID)
+	} else {
+		delete(a.records, a.order[a.next])
+		a.order[a.next] = r.ID
+		a.next = (a.next + 1) % a.max
+	}
+	a.records[r.ID] = r
+	return true
+}
+
+// has reports whether a record with the given ID is stored.
+func (a *Archive) has(id string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.records[id]
+	return ok
+}
+
+// PutEntry stores the record collected by an entry from NewEntry, its
+// duration ending now.
+func (a *Archive) PutEntry(e *Entry) {
+	rec := e.snapshot()
+	rec.Duration = time.Since(rec.Start)
+	a.Put(rec)
+}
+
+// Get returns a copy of the record with the given ID.
+func (a *Archive) Get(id string) (Record, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	r, ok := a.records[id]
+	if !ok {
+		return Record{}, false
+	}
+	c := *r
+	c.Timings = slices.Clone(r.Timings)
+	c.Logs = slices.Clone(r.Logs)
+	c.Artifacts = slices.Clone(r.Artifacts)
+	return c, true
+}
+
+// Attach adds an artifact to an already archived record.
+func (a *Archive) Attach(id string, art Artifact) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r, ok := a.records[id]
+	if !ok {
+		return false
+	}
+	r.Artifacts = append(r.Artifacts, art)
+	return true
+}
+
+// Recent returns up to limit summaries, newest first, for which keep returns
+// true. A nil keep matches every record.
+func (a *Archive) Recent(limit int, keep func(Summary) bool) []Summary {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]Summary, 0, min(limit, len(a.order)))
+	for i := range len(a.order) {
+		// Walk backwards from the newest entry.
+		idx := (a.next - 1 - i + 2*len(a.order)) % len(a.order)
+		r := a.records[a.order[idx]]
+		if s := r.summary(); keep == nil || keep(s) {
+			out = append(out, s)
+			if len(out) == limit {
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type entryKey struct{}
+
+// Entry collects the record of an in-flight request. All methods are safe to
+// call on a nil Entry, so code can record unconditionally.
+type Entry struct {
+	mu  sync.Mutex
+	rec Record
+}
+
+// NewContext returns a context carrying e.
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// FromContext returns the entry of the request being served, or nil.
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryKey{}).(*Entry)
+	return e
+}
+
+// NewEntry starts the record of something other than a request that
+// should be archived like one, such as a capture taken in the background,
+// so its artifacts are listed and served the same way. Method and path
+// describe what it is; store it with Archive.PutEntry when it is complete.
+func NewEntry(id, method, path string) *Entry {
+	return &Entry{rec: Record{ID: id, Method: method, Path: path, Start: time.Now()}}
+}
+
+// ID returns the request ID, or "" for a nil Entry.
+func (e *Entry) ID() string {
+	if e == nil {
+		return ""
+	}
+	return e.rec.ID
+}
+
+// Phase records a named phase that began at start and ends now.
+func (e *Entry) Phase(name string, start time.Time) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.rec.Timings = append(e.rec.Timings, Phase{
+		Name:     name,
+		Start:    start.Sub(e.rec.Start),
+		Duration: time.Since(start),
+	})
+	e.mu.Unlock()
+}
+
+// SetBreakdown records how the request's wall time was split.
+func (e *Entry) SetBreakdown(b map[string]time.Duration) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.rec.Breakdown = b
+	e.mu.Unlock()
+}
+
+// Log appends a log line.
+func (e *Entry) Log(line LogLine) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.rec.Logs = append(e.rec.Logs, line)
+	e.mu.Unlock()
+}
+
+// Attach adds an artifact to the request.
+func (e *Entry) Attach(art Artifact) {
+	if e == nil {
+		return
+	}
+	if art.Created.IsZero() {
+		art.Created = time.Now()
+	}
+	art.Size = len(art.Data)
+	sum := sha256.Sum256(art.Data)
+	art.SHA256 = hex.EncodeToString(sum[:])
+	e.mu.Lock()
+	e.rec.Artifacts = append(e.rec.Artifacts, art)
+	e.mu.Unlock()
+}
+
+// Track records a phase on the request in ctx, if any. It is meant to be
+// deferred: defer archive.Track(ctx, "compute", time.Now()).
+func Track(ctx context.Context, name string, start time.Time) {
+	FromContext(ctx).Phase(name, start)
+}
+
+// snapshot returns the record as collected so far.
+func (e *Entry) snapshot() *Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r := e.rec
+	return &r
+}
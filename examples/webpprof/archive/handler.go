@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// ListHandler serves the most recent records, newest first. Supported query
+// parameters: limit (default 50), path, min_status, min_duration (e.g. 500ms),
+// and captured (only records with artifacts).
+func (a *Archive) ListHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	path := q.Get("path")
+	minStatus, _ := strconv.Atoi(q.Get("min_status"))
+	minDuration, _ := time.ParseDuration(q.Get("min_duration"))
+	captured := q.Get("captured") == "true"
+
+	respond.Write(w, r, a.Recent(limit, func(s Summary) bool {
+		return (path == "" || s.Path == path) &&
+			s.Status >= minStatus &&
+			s.Duration >= minDuration &&
+			(!captured || s.Artifacts > 0)
+	}))
+}
+
+// RecordHandler serves one record; it must be registered with an {id}
+// path wildcard.
+func (a *Archive) RecordHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := a.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "request not found in archive", http.StatusNotFound)
+		return
+	}
+	rec.Repeats = rec.RepeatedPhases(DefaultMinRepeats)
+	respond.Write(w, r, rec)
+}
+
+// ArtifactHandler serves the raw bytes of an artifact; it must be registered
+// with {id} and {name} path wildcards. Artifacts never change once attached,
+// so their digest is a strong ETag and Range requests can resume a download.
+func (a *Archive) ArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := a.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "request not found in archive", http.StatusNotFound)
+		return
+	}
+	name := r.PathValue("name")
+	for _, art := range rec.Artifacts {
+		if art.Name == name {
+			w.Header().Set("Content-Type", art.ContentType)
+			w.Header().Set("Content-Disposition", `attachment; filename="`+rec.ID+"-"+art.Name+`"`)
+			w.Header().Set("ETag", `"`+art.SHA256+`"`)
+			http.ServeContent(w, r, "", art.Created, bytes.NewReader(art.Data))
+			return
+		}
+	}
+	http.Error(w, "artifact not found", http.StatusNotFound)
+}
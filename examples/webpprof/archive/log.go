@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogHandler wraps an slog.Handler and also appends every record logged with
+// a request context to that request's archive entry.
+type LogHandler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+}
+
+// NewLogHandler returns a LogHandler that forwards to next.
+func NewLogHandler(next slog.Handler) *LogHandler {
+	return &LogHandler{next: next}
+}
+
+func (h *LogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// Lines for archived requests are kept even below the output level.
+	return FromContext(ctx) != nil || h.next.Enabled(ctx, level)
+}
+
+func (h *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if e := FromContext(ctx); e != nil {
+		line := LogLine{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+		if n := len(h.attrs) + r.NumAttrs(); n > 0 {
+			line.Attrs = make(map[string]any, n)
+			for _, a := range h.attrs {
+				line.Attrs[a.Key] = a.Value.Resolve().Any()
+			}
+			r.Attrs(func(a slog.Attr) bool {
+				line.Attrs[a.Key] = a.Value.Resolve().Any()
+				return true
+			})
+		}
+		e.Log(line)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{
+		next:  h.next.WithAttrs(attrs),
+		attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...),
+	}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	// Groups only affect the forwarded output; archived attrs stay flat.
+	return &LogHandler{next: h.next.WithGroup(name), attrs: h.attrs}
+}
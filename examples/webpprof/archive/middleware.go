@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware archives every request served by next. The request ID is taken
+// from X-Request-ID or the trace ID of a W3C traceparent header, and a new one
+// is generated otherwise: when the header's ID is not made of letters,
+// digits, '-' and '_', or is longer than 128 bytes, or when a record with it
+// is already archived. It is echoed back in the X-Request-ID response
+// header.
+func Middleware(a *Archive, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &Entry{rec: Record{
+			ID:     a.requestID(r),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Start:  time.Now(),
+		}}
+		w.Header().Set(RequestIDHeader, e.rec.ID)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), e)))
+
+		rec := e.snapshot()
+		rec.Status = sw.status
+		rec.Duration = time.Since(rec.Start)
+		a.Put(rec)
+	})
+}
+
+func (a *Archive) requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validID(id) && !a.has(id) {
+		return id
+	}
+	// traceparent: version-traceid-parentid-flags
+	if parts := strings.Split(r.Header.Get("traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 && validID(parts[1]) && !a.has(parts[1]) {
+		return parts[1]
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validID reports whether id may be used as a request ID: it goes into URLs,
+// headers, and download file names unescaped.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// statusWriter remembers the status code written by the handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
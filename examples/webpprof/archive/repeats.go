@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// DefaultMinRepeats is the number of identical phases within one request from
+// which they are reported as a batching candidate.
+const DefaultMinRepeats = 10
+
+// Repeat is a phase that ran many times within a single request, the N+1
+// pattern of doing per-item work in a loop instead of one batched call.
+type Repeat struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Total time.Duration `json:"total_ns"`
+	Mean  time.Duration `json:"mean_ns"`
+	// Share is Total as a fraction of the request's duration.
+	Share float64 `json:"share"`
+}
+
+// RepeatedPhases returns the phases of r that ran at least minCount times,
+// most expensive first.
+func (r *Record) RepeatedPhases(minCount int) []Repeat {
+	byName := make(map[string]*Repeat)
+	for _, p := range r.Timings {
+		rep := byName[p.Name]
+		if rep == nil {
+			rep = &Repeat{Name: p.Name}
+			byName[p.Name] = rep
+		}
+		rep.Count++
+		rep.Total += p.Duration
+	}
+
+	var out []Repeat
+	for _, rep := range byName {
+		if rep.Count < minCount {
+			continue
+		}
+		rep.Mean = rep.Total / time.Duration(rep.Count)
+		if r.Duration > 0 {
+			rep.Share = float64(rep.Total) / float64(r.Duration)
+		}
+		out = append(out, *rep)
+	}
+	slices.SortFunc(out, func(a, b Repeat) int { return cmp.Compare(b.Total, a.Total) })
+	return out
+}
+
+// Candidate aggregates one repeated phase of one route across the archive.
+type Candidate struct {
+	Path     string        `json:"path"`
+	Phase    string        `json:"phase"`
+	Requests int           `json:"requests"`
+	Calls    int           `json:"calls"`
+	MaxCalls int           `json:"max_calls"`
+	Total    time.Duration `json:"total_ns"`
+	Mean     time.Duration `json:"mean_ns"`
+	// Example is the ID of the request with the most calls.
+	Example string `json:"example"`
+}
+
+// Candidates scans every archived request for repeated phases and groups them
+// by route and phase, most total time first.
+func (a *Archive) Candidates(minCount int) []Candidate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	type key struct{ path, phase string }
+	byKey := make(map[key]*Candidate)
+	for _, r := range a.records {
+		for _, rep := range r.RepeatedPhases(minCount) {
+			k := key{r.Path, rep.Name}
+			c := byKey[k]
+			if c == nil {
+				c = &Candidate{Path: r.Path, Phase: rep.Name}
+				byKey[k] = c
+			}
+			c.Requests++
+			c.Calls += rep.Count
+			c.Total += rep.Total
+			if rep.Count > c.MaxCalls {
+				c.MaxCalls = rep.Count
+				c.Example = r.ID
+			}
+		}
+	}
+
+	out := make([]Candidate, 0, len(byKey))
+	for _, c := range byKey {
+		c.Mean = c.Total / time.Duration(c.Calls)
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b Candidate) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Path, b.Path), cmp.Compare(a.Phase, b.Phase))
+	})
+	return out
+}
+
+// RepeatsHandler serves batching candidates found in the archive,
+// /debug/requests/repeats?min=10
+func (a *Archive) RepeatsHandler(w http.ResponseWriter, r *http.Request) {
+	minCount := DefaultMinRepeats
+	if m, err := strconv.Atoi(r.URL.Query().Get("min")); err == nil && m > 1 {
+		minCount = m
+	}
+	respond.Write(w, r, a.Candidates(minCount))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// batchOp is one operation of a batch: a GET of an /api/ path.
+type batchOp struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+// batchResult is the outcome of one operation. Start is when it began
+// running, as an offset from the start of the batch, after waiting Queued
+// for a free worker.
+type batchResult struct {
+	ID       string        `json:"id"`
+	Path     string        `json:"path"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Start    time.Duration `json:"start_ns"`
+	Queued   time.Duration `json:"queued_ns"`
+	Duration time.Duration `json:"duration_ns"`
+	Response any           `json:"response,omitempty"`
+}
+
+// batchRecorder collects the response of an operation.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *batchRecorder) Header() http.Header { return r.header }
+
+func (r *batchRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *batchRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
+// batchHandler runs a list of operations with at most parallel of them at
+// once and reports each one's status, timing, and response. A failed or
+// timed out operation does not fail the others.
+// POST /api/batch?parallel=4&timeout=2s {"operations":[{"id":"a","path":"/api/compute?iterations=5"}]}
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "batch operations are sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Operations []batchOp `json:"operations"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "bad batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ops := body.Operations
+	if len(ops) == 0 || len(ops) > *batchMax {
+		http.Error(w, fmt.Sprintf("a batch has 1 to %d operations", *batchMax), http.StatusBadRequest)
+		return
+	}
+	for i, op := range ops {
+		if !strings.HasPrefix(op.Path, "/api/") || strings.HasPrefix(op.Path, "/api/batch") {
+			http.Error(w, fmt.Sprintf("operation %d: path must be under /api/ and not a batch", i), http.StatusBadRequest)
+			return
+		}
+		if op.ID == "" {
+			ops[i].ID = strconv.Itoa(i)
+		}
+	}
+	parallel := 4
+	fmt.Sscanf(r.URL.Query().Get("parallel"), "%d", &parallel)
+	parallel = min(max(parallel, 1), len(ops))
+	timeout := 5 * time.Second
+	if t, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && t > 0 {
+		timeout = t
+	}
+
+	ctx, task := trace.NewTask(r.Context(), "batch")
+	defer task.End()
+
+	// Fan out: one goroutine per operation, gated by a semaphore so at most
+	// parallel of them run. Fan in: each writes its own slot of results.
+	start := time.Now()
+	results := make([]batchResult, len(ops))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, op := range ops {
+		wg.Go(func() {
+			queued := time.Now()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				// The client left; do not start what is still queued.
+				results[i] = batchResult{ID: op.ID, Path: op.Path, Error: "batch abandoned", Queued: time.Since(queued)}
+				return
+			}
+			defer func() { <-sem }()
+			running := time.Now()
+			results[i] = runBatchOp(ctx, r, op, timeout)
+			results[i].Start = running.Sub(start)
+			results[i].Queued = running.Sub(queued)
+		})
+	}
+	wg.Wait()
+	archive.Track(ctx, "batch", start)
+	if clientGone(w, r, "batch") {
+		return
+	}
+
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+		}
+	}
+	incrementCounter()
+	respond.Write(w, r, map[string]any{
+		"operations":  len(ops),
+		"parallel":    parallel,
+		"failed":      failed,
+		"duration_ns": time.Since(start),
+		"results":     results,
+	})
+}
+
+// runBatchOp serves op through the application's own routes, with the
+// caller's cookies so it runs in the same session. An operation still
+// running at the timeout is reported as failed and left to finish on its
+// own goroutine; handlers that do not watch their context keep running
+// after their caller gave up on them.
+func runBatchOp(parent context.Context, r *http.Request, op batchOp, timeout time.Duration) batchResult {
+	res := batchResult{ID: op.ID, Path: op.Path}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	defer trace.StartRegion(ctx, "batch.op").End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, op.Path, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("Accept", "application/json")
+	if c := r.Header.Get("Cookie"); c != "" {
+		req.Header.Set("Cookie", c)
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.Host = r.Host
+
+	start := time.Now()
+	rec := &batchRecorder{header: make(http.Header)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		http.DefaultServeMux.ServeHTTP(rec, req)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		res.Duration = time.Since(start)
+		res.Error = ctx.Err().Error()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.Error = "timed out after " + timeout.String()
+		}
+		return res
+	}
+	res.Duration = time.Since(start)
+	archive.Track(parent, "batch.op", start)
+
+	res.Status = rec.status
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	if json.Unmarshal(rec.body.Bytes(), &res.Response) != nil {
+		res.Response = strings.TrimSpace(rec.body.String())
+	}
+	if res.Status >= 400 {
+		res.Error = http.StatusText(res.Status)
+	}
+	return res
+}
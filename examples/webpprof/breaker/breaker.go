@@ -0,0 +1,192 @@
+// Package breaker is a circuit breaker for calls to a backend. After enough
+// consecutive failures it opens and fails calls at once, without calling
+// the backend, for a cooldown; then it lets one call through as a probe and
+// closes again if it succeeds, or opens for another cooldown if it fails.
+//
+// An open breaker turns a slow or failing backend into fast errors: the
+// goroutines that would pile up waiting on it are not started, so the
+// goroutine and block profiles of a service whose breaker has opened look
+// calm while its error rate is high.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/invariant"
+)
+
+// ErrOpen is what Do returns, without calling the backend, while the breaker
+// is open.
+var ErrOpen = errors.New("breaker: open")
+
+// State is the position of a breaker.
+type State int
+
+const (
+	// Closed passes every call to the backend.
+	Closed State = iota
+	// Open fails every call until the cooldown ends.
+	Open
+	// HalfOpen lets one probe call through and fails the others.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+func (s State) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Config configures a Breaker. Zero values select the defaults.
+type Config struct {
+	// Failures is how many consecutive failures open the breaker, default 5.
+	Failures int
+	// Cooldown is how long the breaker stays open before a probe, default
+	// 5 seconds.
+	Cooldown time.Duration
+	// IsFailure reports whether an error counts against the backend. The
+	// default counts every error but the caller's own cancellation; errors
+	// such as a not-found answer should not open the breaker.
+	IsFailure func(error) bool
+}
+
+// Stats counts a breaker's calls since it was created.
+type Stats struct {
+	State State `json:"state"`
+	// Successes and Failures count the calls that reached the backend, and
+	// Rejected the calls failed with ErrOpen.
+	Successes uint64 `json:"successes"`
+	Failures  uint64 `json:"failures"`
+	Rejected  uint64 `json:"rejected"`
+	// Opened counts the times the breaker opened.
+	Opened uint64 `json:"opened"`
+	// OpenedAt is when it last opened.
+	OpenedAt time.Time `json:"opened_at,omitzero"`
+}
+
+// Breaker is safe for concurrent use.
+type Breaker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	state    State
+	failures int // consecutive, while closed
+	openedAt time.Time
+	probing  bool
+
+	successes, failed, rejected, opened atomic.Uint64
+}
+
+// New returns a closed breaker.
+func New(cfg Config) *Breaker {
+	if cfg.Failures <= 0 {
+		cfg.Failures = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 5 * time.Second
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool { return err != nil && !errors.Is(err, context.Canceled) }
+	}
+	return &Breaker{cfg: cfg}
+}
+
+// Do calls fn unless the breaker is open, and records whether it failed.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	probe, ok := b.allow(time.Now())
+	if !ok {
+		b.rejected.Add(1)
+		return ErrOpen
+	}
+	err := fn(ctx)
+	b.record(probe, b.cfg.IsFailure(err), time.Now())
+	return err
+}
+
+// allow reports whether a call may go through, and whether it is the probe
+// of a half-open breaker.
+func (b *Breaker) allow(now time.Time) (probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && now.Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.state = HalfOpen
+	}
+	switch b.state {
+	case Open:
+		return false, false
+	case HalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	}
+	return false, true
+}
+
+func (b *Breaker) record(probe, failed bool, now time.Time) {
+	if failed {
+		b.failed.Add(1)
+	} else {
+		b.successes.Add(1)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		// Only the probe's own result moves the breaker out of half-open
+		invariant.Assert(func() bool { return b.state == HalfOpen && b.probing }, "a probe finished on a breaker that was not waiting for it")
+		b.probing = false
+		if failed {
+			b.openLocked(now)
+		} else {
+			b.state, b.failures = Closed, 0
+		}
+		return
+	}
+	if b.state != Closed {
+		// A call let through before the breaker opened.
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.cfg.Failures {
+		b.openLocked(now)
+	}
+}
+
+func (b *Breaker) openLocked(now time.Time) {
+	b.state, b.failures, b.openedAt = Open, 0, now
+	b.opened.Add(1)
+}
+
+// Stats returns the breaker's state and counters.
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	state, openedAt := b.state, b.openedAt
+	if state == Open && time.Since(openedAt) >= b.cfg.Cooldown {
+		state = HalfOpen
+	}
+	b.mu.Unlock()
+	return Stats{
+		State:     state,
+		Successes: b.successes.Load(),
+		Failures:  b.failed.Load(),
+		Rejected:  b.rejected.Load(),
+		Opened:    b.opened.Load(),
+		OpenedAt:  openedAt,
+	}
+}
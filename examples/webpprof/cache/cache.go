@@ -0,0 +1,45 @@
+// Package cache holds the in-memory caches the example profiles: a classic
+// LRU bounded by entry count, and an experimental weak cache whose entries
+// the garbage collector may reclaim, so it shrinks under memory pressure.
+package cache
+
+import "sync/atomic"
+
+// Cache maps keys to values. Implementations are safe for concurrent use.
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Len() int
+	Stats() Stats
+}
+
+// Stats counts cache activity since the cache was created.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Evictions counts entries dropped to stay within capacity.
+	Evictions uint64 `json:"evictions"`
+	// Collected counts entries reclaimed by the garbage collector.
+	Collected uint64 `json:"collected"`
+}
+
+// HitRate is the share of lookups that were hits.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type counters struct {
+	hits, misses, evictions, collected atomic.Uint64
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Collected: c.collected.Load(),
+	}
+}
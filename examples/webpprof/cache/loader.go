@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is what load functions return for keys that do not exist.
+// Loaders with a NegativeTTL remember it, so lookups of missing keys do not
+// reach the backend every time.
+var ErrNotFound = errors.New("cache: not found")
+
+// LoaderConfig configures a Loader.
+type LoaderConfig struct {
+	// Capacity bounds the entries kept (LRU).
+	Capacity int
+	// TTL is how long a loaded value is served before it is loaded again;
+	// zero keeps values until they are evicted.
+	TTL time.Duration
+	// Jitter shortens each entry's TTL by a random share of up to Jitter
+	// (0 to 1), so entries loaded together do not all expire together.
+	Jitter float64
+	// NegativeTTL is how long an ErrNotFound result is cached; zero loads
+	// missing keys on every lookup.
+	NegativeTTL time.Duration
+	// Rand draws the jitter and must be safe for concurrent use; nil uses
+	// the math/rand/v2 global source.
+	Rand *rand.Rand
+	// Coalesce makes concurrent misses for the same key share one load
+	// instead of each calling the backend, which protects the backend from
+	// a stampede when a hot entry expires.
+	Coalesce bool
+}
+
+// LoaderStats counts a Loader's activity.
+type LoaderStats struct {
+	Cache Stats `json:"cache"`
+	// Loads counts calls to the load function.
+	Loads uint64 `json:"loads"`
+	// Coalesced counts misses that waited for another caller's load.
+	Coalesced uint64 `json:"coalesced"`
+	// Expired counts hits on entries older than the TTL, which were loaded
+	// again.
+	Expired uint64 `json:"expired"`
+	// NegativeHits counts lookups answered by a cached ErrNotFound.
+	NegativeHits uint64 `json:"negative_hits"`
+}
+
+// Loader is a read-through cache: misses and expired entries are filled by
+// calling the load function.
+type Loader[K comparable, V any] struct {
+	cfg    LoaderConfig
+	load   func(ctx context.Context, key K) (V, error)
+	cache  *LRU[K, loaded[V]]
+	flight *Group[K, V] // nil without Coalesce
+
+	loads, coalesced, expired, negativeHits atomic.Uint64
+}
+
+type loaded[V any] struct {
+	value   V
+	err     error     // ErrNotFound for negative entries
+	expires time.Time // zero never expires
+}
+
+// NewLoader returns a read-through cache filled by load.
+func NewLoader[K comparable, V any](load func(ctx context.Context, key K) (V, error), cfg LoaderConfig) *Loader[K, V] {
+	l := &Loader[K, V]{cfg: cfg, load: load, cache: NewLRU[K, loaded[V]](cfg.Capacity)}
+	if cfg.Coalesce {
+		l.flight = &Group[K, V]{}
+	}
+	return l
+}
+
+// Get returns the cached value of key, loading it on a miss.
+func (l *Loader[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if e, ok := l.cache.Get(key); ok {
+		if e.expires.IsZero() || time.Now().Before(e.expires) {
+			if e.err != nil {
+				l.negativeHits.Add(1)
+			}
+			return e.value, e.err
+		}
+		l.expired.Add(1)
+	}
+	if l.flight == nil {
+		return l.fill(ctx, key)
+	}
+	// The load outlives the caller that started it, so waiting callers do
+	// not fail because the first one went away.
+	ctx = context.WithoutCancel(ctx)
+	v, err, shared := l.flight.Do(key, func() (V, error) { return l.fill(ctx, key) })
+	if shared {
+		l.coalesced.Add(1)
+	}
+	return v, err
+}
+
+func (l *Loader[K, V]) fill(ctx context.Context, key K) (V, error) {
+	l.loads.Add(1)
+	v, err := l.load(ctx, key)
+	switch {
+	case err == nil:
+		l.cache.Set(key, loaded[V]{value: v, expires: l.expiry(l.cfg.TTL)})
+	case errors.Is(err, ErrNotFound) && l.cfg.NegativeTTL > 0:
+		l.cache.Set(key, loaded[V]{err: err, expires: l.expiry(l.cfg.NegativeTTL)})
+	}
+	return v, err
+}
+
+// expiry returns when an entry stored now with ttl expires, jittered.
+func (l *Loader[K, V]) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if j := min(l.cfg.Jitter, 1); j > 0 {
+		f := rand.Float64
+		if l.cfg.Rand != nil {
+			f = l.cfg.Rand.Float64
+		}
+		ttl -= time.Duration(f() * j * float64(ttl))
+	}
+	return time.Now().Add(ttl)
+}
+
+// Stats returns the loader's counters.
+func (l *Loader[K, V]) Stats() LoaderStats {
+	return LoaderStats{
+		Cache:        l.cache.Stats(),
+		Loads:        l.loads.Load(),
+		Coalesced:    l.coalesced.Load(),
+		Expired:      l.expired.Load(),
+		NegativeHits: l.negativeHits.Load(),
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU keeps at most a fixed number of entries, evicting the least recently
+// used one to make room.
+type LRU[K comparable, V any] struct {
+	capacity int
+	counters
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewLRU returns an LRU holding up to capacity entries.
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[K]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.hits.Add(1)
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry[K, V]).value, true
+}
+
+// Set implements Cache.
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key, value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+		c.evictions.Add(1)
+	}
+}
+
+// Delete removes key and reports whether it was present.
+func (c *LRU[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	return ok
+}
+
+// Range calls f for every entry, most recently used first, until f returns
+// false. It neither counts as a lookup nor changes the order; f must not
+// call the cache.
+func (c *LRU[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		ent := e.Value.(*lruEntry[K, V])
+		if !f(ent.key, ent.value) {
+			return
+		}
+	}
+}
+
+// Len implements Cache.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Stats implements Cache.
+func (c *LRU[K, V]) Stats() Stats { return c.stats() }
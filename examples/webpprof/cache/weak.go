@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// Weak holds its values through weak pointers (package weak, Go 1.24), so
+// the garbage collector may reclaim any value nothing else references. The
+// most recently used values are also kept in a small ring of strong
+// references, which protects the hot set from being dropped at every
+// collection; everything outside it lives until the next GC cycle, so the
+// cache holds more when the heap is calm and less when GC runs often.
+//
+// It implements Cache[K, *V].
+type Weak[K comparable, V any] struct {
+	counters
+
+	mu      sync.Mutex
+	entries map[K]weak.Pointer[V]
+	hot     []*V // ring of strong references to recently used values
+	next    int
+}
+
+// NewWeak returns a weak cache that keeps the hot most recently used values
+// alive regardless of GC.
+func NewWeak[K comparable, V any](hot int) *Weak[K, V] {
+	return &Weak[K, V]{
+		entries: make(map[K]weak.Pointer[V]),
+		hot:     make([]*V, max(hot, 1)),
+	}
+}
+
+// Get implements Cache.
+func (c *Weak[K, V]) Get(key K) (*V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A collected value reads as nil until its cleanup removes the entry.
+	if v := c.entries[key].Value(); v != nil {
+		c.hits.Add(1)
+		c.touchLocked(v)
+		return v, true
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// Set implements Cache. A nil value is not stored.
+func (c *Weak[K, V]) Set(key K, value *V) {
+	if value == nil {
+		return
+	}
+	wp := weak.Make(value)
+	c.mu.Lock()
+	c.entries[key] = wp
+	c.touchLocked(value)
+	c.mu.Unlock()
+	runtime.AddCleanup(value, c.collect, weakEntry[K, V]{key, wp})
+}
+
+type weakEntry[K comparable, V any] struct {
+	key K
+	wp  weak.Pointer[V]
+}
+
+// collect runs after a value was reclaimed and removes its entry, unless the
+// key has been set to another value since.
+func (c *Weak[K, V]) collect(e weakEntry[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[e.key] == e.wp {
+		delete(c.entries, e.key)
+		c.collected.Add(1)
+	}
+}
+
+func (c *Weak[K, V]) touchLocked(v *V) {
+	c.hot[c.next] = v
+	c.next = (c.next + 1) % len(c.hot)
+}
+
+// Len implements Cache. It counts entries whose cleanup has not run yet, so
+// it may include values already reclaimed.
+func (c *Weak[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Stats implements Cache.
+func (c *Weak[K, V]) Stats() Stats { return c.stats() }
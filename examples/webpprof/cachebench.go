@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/cache"
+	"github.com/vdntruong/gosamurai/examples/webpprof/memlimit"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// cachedBlob is the value type of the cache comparison, standing in for a
+// rendered response or a decoded record.
+type cachedBlob struct {
+	data []byte
+}
+
+// cacheVariant builds one of the caches compared by cacheCompareHandler.
+type cacheVariant struct {
+	name string
+	new  func(capacity, hot int) cache.Cache[int, *cachedBlob]
+}
+
+var cacheVariants = []cacheVariant{
+	{"lru", func(capacity, _ int) cache.Cache[int, *cachedBlob] {
+		return cache.NewLRU[int, *cachedBlob](capacity)
+	}},
+	{"weak", func(_, hot int) cache.Cache[int, *cachedBlob] {
+		return cache.NewWeak[int, cachedBlob](hot)
+	}},
+}
+
+// cacheRun is the outcome of replaying the same lookups against one cache.
+type cacheRun struct {
+	Cache    string        `json:"cache"`
+	HitRate  float64       `json:"hit_rate"`
+	Stats    cache.Stats   `json:"stats"`
+	Len      int           `json:"len"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	GCCycles uint32        `json:"gc_cycles"`
+	// HeapMB is the live heap once the run ends, after a forced GC, so it
+	// is what the cache itself retains.
+	HeapMB float64 `json:"heap_mb"`
+}
+
+// cacheCompareHandler replays a Zipf-distributed stream of lookups against
+// every cache variant, filling misses with freshly allocated values, and
+// reports hit rate, retained heap, and GC cycles side by side. Parameters:
+// keys, size (KB per value), capacity (LRU entries), hot (weak cache strong
+// set), and requests. What the larger of the two caches can hold is
+// reserved through memlimit first.
+func cacheCompareHandler(w http.ResponseWriter, r *http.Request) {
+	keys, ok := intParam(w, r, "keys", 100000, 10_000_000)
+	if !ok {
+		return
+	}
+	sizeKB, ok := intParam(w, r, "size", 4, 1024)
+	if !ok {
+		return
+	}
+	capacity, ok := intParam(w, r, "capacity", 10000, 1_000_000)
+	if !ok {
+		return
+	}
+	hot, ok := intParam(w, r, "hot", 1000, 1_000_000)
+	if !ok {
+		return
+	}
+	requests, ok := intParam(w, r, "requests", 200000, 10_000_000)
+	if !ok {
+		return
+	}
+	size := sizeKB * 1024
+	if err := memlimit.Reserve(r.Context(), int64(max(capacity, hot))*int64(size), "cache.compare"); err != nil {
+		rejectMemory(w, err)
+		return
+	}
+
+	runs := make([]cacheRun, 0, len(cacheVariants))
+	for _, v := range cacheVariants {
+		if clientGone(w, r, "cache.compare") {
+			return
+		}
+		runs = append(runs, runCacheVariant(v, keys, size, capacity, hot, requests))
+	}
+	incrementCounter()
+	respond.Write(w, r, runs)
+}
+
+func runCacheVariant(v cacheVariant, keys, size, capacity, hot, requests int) cacheRun {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	c := v.new(capacity, hot)
+	// The same seed for every variant, so they see the same lookups.
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.1, 1, uint64(keys-1))
+	start := time.Now()
+	for range requests {
+		key := int(zipf.Uint64())
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, &cachedBlob{data: make([]byte, size)})
+		}
+	}
+	elapsed := time.Since(start)
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	run := cacheRun{
+		Cache:    v.name,
+		Stats:    c.Stats(),
+		Len:      c.Len(),
+		Elapsed:  elapsed,
+		GCCycles: after.NumGC - before.NumGC,
+		HeapMB:   float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)) / (1 << 20),
+	}
+	run.HitRate = run.Stats.HitRate()
+	runtime.KeepAlive(c)
+	return run
+}
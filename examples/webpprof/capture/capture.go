@@ -0,0 +1,238 @@
+// Package capture implements tail-based capture of slow requests. Instead of
+// profiling everything, it keeps a flight recorder running and, when a request
+// exceeds a latency threshold, saves the recent execution trace window and a
+// goroutine snapshot into that request's archive entry.
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+)
+
+// Config controls when and what is captured.
+type Config struct {
+	// Threshold is the latency above which a request is captured.
+	Threshold time.Duration
+	// Cooldown is the minimum time between two captures, so a latency spike
+	// across all requests does not turn into a capture storm.
+	Cooldown time.Duration
+	// TraceWindow is the minimum age of events kept by the flight recorder.
+	TraceWindow time.Duration
+	// MaxTraceBytes bounds the flight recorder memory.
+	MaxTraceBytes uint64
+}
+
+// ArtifactType describes an artifact a capture attaches to an archive entry.
+type ArtifactType struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Summary     string `json:"summary"`
+}
+
+var (
+	Goroutines = ArtifactType{
+		Name:        "goroutines.txt",
+		ContentType: "text/plain; charset=utf-8",
+		Summary:     "goroutine dump taken when the request crossed the threshold",
+	}
+	Trace = ArtifactType{
+		Name:        "trace.out",
+		ContentType: "application/octet-stream",
+		Summary:     "flight recorder window ending when the request finished; open with go tool trace",
+	}
+)
+
+// ArtifactTypes lists what a capture can attach, in the order it attaches them.
+func ArtifactTypes() []ArtifactType {
+	return []ArtifactType{Goroutines, Trace}
+}
+
+// Capturer owns the flight recorder shared by all requests.
+type Capturer struct {
+	cfg Config
+	fr  *trace.FlightRecorder
+
+	mu          sync.Mutex // serializes flight recorder snapshots
+	lastCapture atomic.Int64
+
+	captured atomic.Uint64
+	skipped  atomic.Uint64
+}
+
+// New starts a flight recorder and returns a Capturer using it.
+func New(cfg Config) (*Capturer, error) {
+	if cfg.TraceWindow <= 0 {
+		cfg.TraceWindow = 10 * time.Second
+	}
+	if cfg.MaxTraceBytes == 0 {
+		cfg.MaxTraceBytes = 16 << 20
+	}
+
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{
+		MinAge:   cfg.TraceWindow,
+		MaxBytes: cfg.MaxTraceBytes,
+	})
+	if err := fr.Start(); err != nil {
+		return nil, fmt.Errorf("capture: start flight recorder: %w", err)
+	}
+	return &Capturer{cfg: cfg, fr: fr}, nil
+}
+
+// Stop stops the flight recorder.
+func (c *Capturer) Stop() {
+	c.fr.Stop()
+}
+
+// Stats reports how many slow requests were captured and how many were
+// skipped because of the cooldown.
+func (c *Capturer) Stats() (captured, skipped uint64) {
+	return c.captured.Load(), c.skipped.Load()
+}
+
+// Middleware captures requests served by next that exceed the threshold. It
+// must run inside archive.Middleware so the request has an archive entry.
+//
+// The goroutine snapshot is taken the moment the threshold is crossed, while
+// the request is still stuck, rather than after it finally completes. So is
+// the cooldown, so a spike of slow requests dumps the goroutines once rather
+// than once per request.
+func (c *Capturer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := archive.FromContext(r.Context())
+		if entry == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			fired      = make(chan struct{})
+			acquired   bool
+			goroutines []byte
+		)
+		timer := time.AfterFunc(c.cfg.Threshold, func() {
+			defer close(fired)
+			if !c.acquireCooldown() {
+				c.skipped.Add(1)
+				return
+			}
+			acquired = true
+			events.Do(r.Context(), events.SlowRequest, func(context.Context) {
+				var buf bytes.Buffer
+				pprof.Lookup("goroutine").WriteTo(&buf, 2)
+				goroutines = buf.Bytes()
+			})
+		})
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		elapsed := time.Since(start)
+
+		if timer.Stop() {
+			return
+		}
+		<-fired
+		if !acquired {
+			return
+		}
+
+		entry.Attach(archive.Artifact{Name: Goroutines.Name, ContentType: Goroutines.ContentType, Data: goroutines})
+
+		events.Do(r.Context(), events.SlowRequest, func(ctx context.Context) { c.attachTrace(ctx, entry) })
+
+		c.captured.Add(1)
+		events.Emit(r.Context(), events.SlowRequest,
+			events.Elapsed, elapsed, events.Threshold, c.cfg.Threshold, events.RequestID, entry.ID())
+	})
+}
+
+// CaptureNow attaches a goroutine dump and the flight recorder window to
+// entry, for captures triggered by something other than a slow request. It
+// shares the slow request cooldown, and reports false, capturing nothing,
+// while that runs.
+func (c *Capturer) CaptureNow(ctx context.Context, entry *archive.Entry) bool {
+	if !c.acquireCooldown() {
+		c.skipped.Add(1)
+		return false
+	}
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 2)
+	entry.Attach(archive.Artifact{Name: Goroutines.Name, ContentType: Goroutines.ContentType, Data: buf.Bytes()})
+	c.attachTrace(ctx, entry)
+	c.captured.Add(1)
+	return true
+}
+
+// Episode records an episode other than a slow request, such as sustained
+// pressure, under an archive entry of its own made from id, method, and
+// path. It emits ev with attrs in the entry's context and, unless c is nil
+// or in its cooldown, captures into the entry as CaptureNow does, stores it
+// in a, and emits events.Captured.
+func (c *Capturer) Episode(a *archive.Archive, id, method, path string, ev events.Event, attrs ...any) {
+	entry := archive.NewEntry(id, method, path)
+	ctx := archive.NewContext(context.Background(), entry)
+	events.Emit(ctx, ev, attrs...)
+	if c == nil {
+		return
+	}
+	var captured bool
+	events.Do(ctx, ev, func(ctx context.Context) { captured = c.CaptureNow(ctx, entry) })
+	if !captured {
+		return
+	}
+	a.PutEntry(entry)
+	events.Emit(context.Background(), events.Captured, events.Trigger, ev.Name, events.RequestID, entry.ID())
+}
+
+func (c *Capturer) attachTrace(ctx context.Context, entry *archive.Entry) {
+	window, err := c.snapshotTrace()
+	if err != nil {
+		events.Emit(ctx, events.CaptureFailed, events.Err, err)
+		return
+	}
+	entry.Attach(archive.Artifact{Name: Trace.Name, ContentType: Trace.ContentType, Data: window})
+}
+
+// acquireCooldown reports whether a capture may happen now and, if so,
+// starts a new cooldown period.
+func (c *Capturer) acquireCooldown() bool {
+	now := time.Now().UnixNano()
+	last := c.lastCapture.Load()
+	if last != 0 && time.Duration(now-last) < c.cfg.Cooldown {
+		return false
+	}
+	return c.lastCapture.CompareAndSwap(last, now)
+}
+
+// WriteTrace writes the flight recorder window ending now to w, for a trace
+// asked for on demand rather than by a slow request. It does not count as a
+// capture or start a cooldown.
+func (c *Capturer) WriteTrace(w io.Writer) error {
+	window, err := c.snapshotTrace()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(window)
+	return err
+}
+
+func (c *Capturer) snapshotTrace() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buf bytes.Buffer
+	if _, err := c.fr.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/breaker"
+	"github.com/vdntruong/gosamurai/examples/webpprof/cache"
+	"github.com/vdntruong/gosamurai/examples/webpprof/filter"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// catalogDemo replays every lookup against two read-through caches over
+// the same backend: one with a fixed TTL and one with jittered TTLs. Items
+// at or above size do not exist, and both caches remember that (negative
+// caching). Comparing their backend loads per second shows the expiry
+// storms a fixed TTL causes after a burst of loads, such as a cold start.
+//
+// With a membership filter of the existing items, lookups of missing items
+// are answered without calling the backend at all, even the first time.
+type catalogDemo struct {
+	size    int
+	delay   time.Duration
+	breaker *breaker.Breaker
+
+	filter         filter.Filter // nil without -catalog-filter
+	filterSkipped  atomic.Uint64
+	falsePositives atomic.Uint64
+
+	fixed, jittered         *cache.Loader[int, string]
+	fixedRate, jitteredRate *perSecond
+}
+
+func newCatalogDemo(size int, ttl, negativeTTL, delay time.Duration, jitter float64, f filter.Filter, b *breaker.Breaker) *catalogDemo {
+	d := &catalogDemo{size: size, delay: delay, breaker: b, filter: f, fixedRate: newPerSecond(60), jitteredRate: newPerSecond(60)}
+	if f != nil {
+		for id := range size {
+			f.Add(strconv.Itoa(id))
+		}
+	}
+	cfg := cache.LoaderConfig{Capacity: 2 * size, TTL: ttl, NegativeTTL: negativeTTL, Coalesce: true}
+	d.fixed = cache.NewLoader(d.backend(d.fixedRate), cfg)
+	cfg.Jitter, cfg.Rand = jitter, random.Shared("catalog.jitter")
+	d.jittered = cache.NewLoader(d.backend(d.jitteredRate), cfg)
+	return d
+}
+
+func (d *catalogDemo) backend(rate *perSecond) func(context.Context, int) (string, error) {
+	return func(ctx context.Context, id int) (string, error) {
+		if d.filter != nil && !d.filter.Contains(strconv.Itoa(id)) {
+			d.filterSkipped.Add(1)
+			return "", cache.ErrNotFound
+		}
+		defer archive.Track(ctx, "backend", time.Now())
+		err := d.breaker.Do(ctx, func(ctx context.Context) error {
+			rate.add(time.Now())
+			return faults.Call(ctx, "catalog", func(ctx context.Context) error {
+				// A coalesced load runs without the callers' cancellation, so
+				// only an uncoalesced one stops here when its request goes
+				// away.
+				wait := time.NewTimer(d.delay)
+				defer wait.Stop()
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-wait.C:
+				}
+				if id < 0 || id >= d.size {
+					if d.filter != nil {
+						d.falsePositives.Add(1)
+					}
+					return cache.ErrNotFound
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("item %d", id), nil
+	}
+}
+
+// catalogFailure is what counts against the catalog's circuit breaker: any
+// backend error but a missing item, which is an answer, and a request that
+// went away.
+func catalogFailure(err error) bool {
+	return err != nil && !errors.Is(err, cache.ErrNotFound) && !errors.Is(err, context.Canceled)
+}
+
+// CatalogCacheStats describes one of the two caches of /api/catalog.
+type CatalogCacheStats struct {
+	Loader cache.LoaderStats `json:"loader"`
+	// LoadsPerSecond is the backend calls of each of the last seconds,
+	// oldest first; PeakLoads is its maximum.
+	LoadsPerSecond []uint64 `json:"loads_per_second"`
+	PeakLoads      uint64   `json:"peak_loads"`
+}
+
+func catalogCacheStats(l *cache.Loader[int, string], rate *perSecond) CatalogCacheStats {
+	counts := rate.last(time.Now())
+	return CatalogCacheStats{Loader: l.Stats(), LoadsPerSecond: counts, PeakLoads: maxOf(counts)}
+}
+
+// catalogHandler looks up an item through both caches.
+// /api/catalog?id=42
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "id must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	var wg sync.WaitGroup
+	var item string
+	var fixedErr, jitteredErr error
+	wg.Go(func() { item, fixedErr = catalog.fixed.Get(r.Context(), id) })
+	wg.Go(func() { _, jitteredErr = catalog.jittered.Get(r.Context(), id) })
+	wg.Wait()
+	cacheKey("catalog", strconv.Itoa(id))
+
+	incrementCounter()
+	resp := map[string]any{
+		"id":       id,
+		"fixed":    catalogCacheStats(catalog.fixed, catalog.fixedRate),
+		"jittered": catalogCacheStats(catalog.jittered, catalog.jitteredRate),
+		"breaker":  catalog.breaker.Stats(),
+	}
+	if catalog.filter != nil {
+		resp["filter"] = map[string]any{
+			"size_bytes":      catalog.filter.SizeBytes(),
+			"skipped":         catalog.filterSkipped.Load(),
+			"false_positives": catalog.falsePositives.Load(),
+		}
+	}
+	status := http.StatusOK
+	switch err := errors.Join(fixedErr, jitteredErr); {
+	case errors.Is(err, cache.ErrNotFound):
+		status = http.StatusNotFound
+	case err != nil:
+		http.Error(w, err.Error(), backendErrorStatus(err))
+		return
+	default:
+		resp["item"] = item
+	}
+	respond.WriteStatus(w, r, status, resp)
+}
+
+// perSecond counts events in one-second buckets over a sliding window.
+type perSecond struct {
+	mu      sync.Mutex
+	buckets []uint64
+	seconds []int64 // the unix second each bucket counts
+}
+
+func newPerSecond(window int) *perSecond {
+	return &perSecond{buckets: make([]uint64, window), seconds: make([]int64, window)}
+}
+
+func (p *perSecond) add(t time.Time) {
+	sec := t.Unix()
+	i := int(sec % int64(len(p.buckets)))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.seconds[i] != sec {
+		p.seconds[i], p.buckets[i] = sec, 0
+	}
+	p.buckets[i]++
+}
+
+// last returns the counts of the window's seconds up to now, oldest first.
+func (p *perSecond) last(now time.Time) []uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := int64(len(p.buckets))
+	out := make([]uint64, n)
+	for k := range n {
+		sec := now.Unix() - n + 1 + k
+		if i := sec % n; p.seconds[i] == sec {
+			out[k] = p.buckets[i]
+		}
+	}
+	return out
+}
+
+func maxOf(xs []uint64) uint64 {
+	var m uint64
+	for _, x := range xs {
+		m = max(m, x)
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/breaker"
+	"github.com/vdntruong/gosamurai/examples/webpprof/chaos"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// backendBreakers are the circuit breakers of the backends faults can be
+// injected into, by backend name.
+func backendBreakers() map[string]*breaker.Breaker {
+	return map[string]*breaker.Breaker{"stampede": stampede.breaker, "catalog": catalog.breaker}
+}
+
+// backendErrorStatus is the status of a request whose backend call failed:
+// 503 while the breaker is open, 504 for a timeout, 502 otherwise.
+func backendErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, breaker.ErrOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, chaos.ErrTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// chaosStatus is what /debug/chaos reports.
+type chaosStatus struct {
+	Faults   map[string][]chaos.Fault `json:"faults"`
+	Breakers map[string]breaker.Stats `json:"breakers"`
+}
+
+func currentChaos() chaosStatus {
+	st := chaosStatus{Faults: faults.Status(), Breakers: make(map[string]breaker.Stats)}
+	for name, b := range backendBreakers() {
+		st.Breakers[name] = b.Stats()
+	}
+	return st
+}
+
+// chaosHandler reports the faults injected into every backend and the state
+// of its circuit breaker.
+// GET /debug/chaos
+func chaosHandler(w http.ResponseWriter, r *http.Request) {
+	respond.Write(w, r, currentChaos())
+}
+
+// setChaosHandler injects a fault into the calls to one backend, replacing
+// the fault of its kind, for good or, with for, for a while; rate=0 removes
+// it, and reset=true removes every fault of the backend, or of all of them:
+// PUT /debug/chaos?backend=catalog&fault=slow&rate=0.5&latency=300ms&for=5m
+// PUT /debug/chaos?reset=true
+func setChaosHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	backend := q.Get("backend")
+	if q.Get("reset") == "true" {
+		faults.Reset(backend)
+		respond.Write(w, r, currentChaos())
+		return
+	}
+	f := chaos.Fault{Kind: chaos.Kind(q.Get("fault")), Rate: 1}
+	if v := q.Get("rate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid rate %q", v), http.StatusBadRequest)
+			return
+		}
+		f.Rate = rate
+	}
+	var d time.Duration
+	for name, dst := range map[string]*time.Duration{"latency": &f.Latency, "for": &d} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *dst, err = time.ParseDuration(v); err != nil || *dst <= 0 {
+				http.Error(w, fmt.Sprintf("invalid %s %q", name, v), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if err := faults.Set(backend, f, d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respond.Write(w, r, currentChaos())
+}
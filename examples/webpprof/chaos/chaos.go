@@ -0,0 +1,264 @@
+// Package chaos injects failures into the calls a service makes to its
+// backends, on demand, so what a failing dependency does to the service can
+// be watched in its profiles, traces, and metrics: slow queries pile up
+// goroutines blocked in select, resets and timeouts open circuit breakers,
+// and serialization errors waste the work of queries that succeeded.
+//
+// Every fault hits a share of the calls to one backend, for good or until a
+// deadline. Injected faults are logged to the execution trace under the
+// "chaos" category, and the time a slow or timed-out call is held is a
+// "chaos slow" or "chaos timeout" region.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Kind is a way a backend call fails.
+type Kind string
+
+const (
+	// Slow delays the call by Latency, as a slow query does.
+	Slow Kind = "slow"
+	// Reset fails the call at once, as a connection reset by the backend.
+	Reset Kind = "reset"
+	// Timeout holds the call for Latency, then fails it with a timeout, as
+	// a query that never answers does.
+	Timeout Kind = "timeout"
+	// Serialization lets the call run, then fails it as a response that
+	// cannot be decoded.
+	Serialization Kind = "serialization"
+)
+
+// Kinds are the faults in the order a call meets them.
+var Kinds = []Kind{Reset, Timeout, Slow, Serialization}
+
+// The errors of the faults. ErrReset wraps syscall.ECONNRESET and ErrTimeout
+// os.ErrDeadlineExceeded, so they look like the network errors they stand
+// in for.
+var (
+	ErrReset         = fmt.Errorf("chaos: read: %w", syscall.ECONNRESET)
+	ErrTimeout       = fmt.Errorf("chaos: query: %w", os.ErrDeadlineExceeded)
+	ErrSerialization = errors.New("chaos: decode response: unexpected end of input")
+)
+
+// defaultLatency is the Latency of a Slow or Timeout fault that sets none.
+var defaultLatency = map[Kind]time.Duration{Slow: 100 * time.Millisecond, Timeout: time.Second}
+
+// Fault is one kind of failure injected into the calls to a backend.
+type Fault struct {
+	Kind Kind `json:"kind"`
+	// Rate is the share of calls the fault hits, above 0 and up to 1.
+	Rate float64 `json:"rate"`
+	// Latency is how long Slow delays a call and Timeout holds one.
+	Latency time.Duration `json:"latency_ns,omitempty"`
+	// Until is when the fault ends, zero for never.
+	Until time.Time `json:"until,omitzero"`
+	// Injected counts the calls the fault hit since it was set.
+	Injected uint64 `json:"injected"`
+}
+
+type key struct {
+	backend string
+	kind    Kind
+}
+
+// Injector holds the faults of a set of backends. It is safe for
+// concurrent use.
+type Injector struct {
+	backends []string
+	rand     *rand.Rand
+
+	mu     sync.Mutex
+	faults map[key]*Fault
+	totals map[key]uint64 // never reset, for Prometheus counters
+}
+
+// New returns an injector without faults for the named backends. r draws
+// which calls are hit and must be safe for concurrent use; nil uses the
+// math/rand/v2 global source.
+func New(r *rand.Rand, backends ...string) *Injector {
+	return &Injector{
+		backends: slices.Sorted(slices.Values(backends)),
+		rand:     r,
+		faults:   make(map[key]*Fault),
+		totals:   make(map[key]uint64),
+	}
+}
+
+// Backends returns the names of the backends, sorted.
+func (in *Injector) Backends() []string { return in.backends }
+
+// Set injects f into the calls to backend, replacing the fault of its kind,
+// for d or, when d is zero, until it is reset. A Rate of 0 removes the
+// fault.
+func (in *Injector) Set(backend string, f Fault, d time.Duration) error {
+	if !slices.Contains(in.backends, backend) {
+		return fmt.Errorf("chaos: unknown backend %q, want one of %s", backend, strings.Join(in.backends, ", "))
+	}
+	if !slices.Contains(Kinds, f.Kind) {
+		return fmt.Errorf("chaos: unknown fault %q, want one of slow, reset, timeout, serialization", f.Kind)
+	}
+	// NaN compares false with every bound, and would hit every call
+	if math.IsNaN(f.Rate) || f.Rate < 0 || f.Rate > 1 {
+		return fmt.Errorf("chaos: rate %g is not between 0 and 1", f.Rate)
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	k := key{backend, f.Kind}
+	if f.Rate == 0 {
+		delete(in.faults, k)
+		return nil
+	}
+	if f.Latency <= 0 {
+		f.Latency = defaultLatency[f.Kind]
+	}
+	f.Until, f.Injected = time.Time{}, 0
+	if d > 0 {
+		f.Until = time.Now().Add(d)
+	}
+	in.faults[k] = &f
+	return nil
+}
+
+// Reset removes every fault of backend, or of every backend when it is
+// empty.
+func (in *Injector) Reset(backend string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for k := range in.faults {
+		if backend == "" || k.backend == backend {
+			delete(in.faults, k)
+		}
+	}
+}
+
+// Status returns the faults of every backend, in the order of Kinds.
+func (in *Injector) Status() map[string][]Fault {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	now := time.Now()
+	out := make(map[string][]Fault, len(in.backends))
+	for _, b := range in.backends {
+		out[b] = []Fault{}
+		for _, kind := range Kinds {
+			if f := in.activeLocked(key{b, kind}, now); f != nil {
+				out[b] = append(out[b], *f)
+			}
+		}
+	}
+	return out
+}
+
+// Injected returns, for every backend and kind, how many calls faults of
+// that kind have hit since the injector was created.
+func (in *Injector) Injected() map[string]map[Kind]uint64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	out := make(map[string]map[Kind]uint64, len(in.backends))
+	for _, b := range in.backends {
+		out[b] = make(map[Kind]uint64, len(Kinds))
+		for _, kind := range Kinds {
+			out[b][kind] = in.totals[key{b, kind}]
+		}
+	}
+	return out
+}
+
+// activeLocked returns the fault of k unless it has ended, dropping it if it
+// has.
+func (in *Injector) activeLocked(k key, now time.Time) *Fault {
+	f := in.faults[k]
+	if f != nil && !f.Until.IsZero() && now.After(f.Until) {
+		delete(in.faults, k)
+		return nil
+	}
+	return f
+}
+
+// draw picks the faults that hit one call to backend, in the order of Kinds.
+func (in *Injector) draw(backend string) []Fault {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if len(in.faults) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var hits []Fault
+	for _, kind := range Kinds {
+		k := key{backend, kind}
+		f := in.activeLocked(k, now)
+		if f == nil || in.float64() >= f.Rate {
+			continue
+		}
+		f.Injected++
+		in.totals[k]++
+		hits = append(hits, *f)
+	}
+	return hits
+}
+
+func (in *Injector) float64() float64 {
+	if in.rand != nil {
+		return in.rand.Float64()
+	}
+	return rand.Float64()
+}
+
+// Call calls fn, the call to backend, through the faults that hit it: a
+// reset fails it and a timeout fails it after holding it, both without
+// calling fn; a slow fault delays it; a serialization fault fails it after
+// fn succeeds. A ctx that ends while a call is held ends it with ctx.Err().
+func (in *Injector) Call(ctx context.Context, backend string, fn func(ctx context.Context) error) error {
+	hits := in.draw(backend)
+	corrupt := false
+	for _, f := range hits {
+		trace.Log(ctx, "chaos", backend+" "+string(f.Kind))
+		switch f.Kind {
+		case Reset:
+			return ErrReset
+		case Timeout:
+			if err := hold(ctx, "chaos timeout", f.Latency); err != nil {
+				return err
+			}
+			return ErrTimeout
+		case Slow:
+			if err := hold(ctx, "chaos slow", f.Latency); err != nil {
+				return err
+			}
+		case Serialization:
+			corrupt = true
+		}
+	}
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	if corrupt {
+		return ErrSerialization
+	}
+	return nil
+}
+
+func hold(ctx context.Context, region string, d time.Duration) error {
+	defer trace.StartRegion(ctx, region).End()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+)
+
+// statusClientClosed is recorded for requests abandoned because the client
+// went away, following nginx's 499. The client never sees it.
+const statusClientClosed = 499
+
+// clientGone reports whether the request's context is done, which the
+// server does when the client closes the connection (see poll.go for when
+// that signal is late). If so, it counts the request in the client_gone
+// metric, records status 499 for the archive and route timings, and logs
+// where the handler gave up.
+//
+// Long-running handlers call it between steps and return as soon as it
+// reports true, dropping whatever they built so the memory can be
+// collected instead of being held for a response nobody reads. A handler
+// should call it once it is true only once, so each request counts once.
+func clientGone(w http.ResponseWriter, r *http.Request, during string) bool {
+	ctx := r.Context()
+	if ctx.Err() == nil {
+		return false
+	}
+	updateStats(func(s *statsSnapshot) { s.ClientGone++ })
+	w.WriteHeader(statusClientClosed)
+	events.Emit(ctx, events.ClientGone, events.During, during, events.Cause, context.Cause(ctx))
+	return true
+}
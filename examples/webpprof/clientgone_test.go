@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/gosamurai/randsource"
+)
+
+func TestClientGone(t *testing.T) {
+	before := loadStats().ClientGone
+
+	r := httptest.NewRequest(http.MethodGet, "/api/compute", nil)
+	w := httptest.NewRecorder()
+	if clientGone(w, r, "test") {
+		t.Fatal("clientGone reported a live request as gone")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	if !clientGone(w, r.WithContext(ctx), "test") {
+		t.Fatal("clientGone missed a cancelled request")
+	}
+	if w.Code != statusClientClosed {
+		t.Errorf("status %d, want %d", w.Code, statusClientClosed)
+	}
+	if got := loadStats().ClientGone - before; got != 1 {
+		t.Errorf("client_gone grew by %d, want 1", got)
+	}
+}
+
+// TestHandlersStopWhenClientCancels starts requests that would run for
+// minutes, cancels them from the client side shortly after, and checks that
+// each handler notices and returns instead of finishing the work.
+func TestHandlersStopWhenClientCancels(t *testing.T) {
+	if random == nil {
+		random = randsource.New(1)
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+	}{
+		{"compute", computeHandler, "/api/compute?iterations=1000000000"},
+		{"allocate", allocateHandler, "/api/allocate?size=100000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returned := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(returned)
+				tt.handler(w, r)
+			}))
+			defer srv.Close()
+			before := loadStats().ClientGone
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := srv.Client().Do(req)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("request finished with %s before the client cancelled it", resp.Status)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("request failed with %v, want the client's deadline", err)
+			}
+
+			select {
+			case <-returned:
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler still running 5s after the client went away")
+			}
+			if got := loadStats().ClientGone - before; got != 1 {
+				t.Errorf("client_gone grew by %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Default is the codec used when none is configured.
+const Default = "json"
+
+func init() {
+	Register(stdJSON{})
+	Register(&pooledJSON{})
+}
+
+// stdJSON streams values through encoding/json.Encoder.
+type stdJSON struct{}
+
+func (stdJSON) Name() string        { return "json" }
+func (stdJSON) ContentType() string { return "application/json" }
+
+func (stdJSON) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (stdJSON) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// pooledJSON marshals into a pooled buffer and writes it in one call. It
+// trades a buffer copy for fewer, larger writes and reused encoder memory.
+type pooledJSON struct {
+	buffers sync.Pool
+}
+
+func (*pooledJSON) Name() string        { return "json-pooled" }
+func (*pooledJSON) ContentType() string { return "application/json" }
+
+func (c *pooledJSON) Encode(w io.Writer, v any) error {
+	buf, _ := c.buffers.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = new(bytes.Buffer)
+	}
+	defer func() {
+		buf.Reset()
+		c.buffers.Put(buf)
+	}()
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (*pooledJSON) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
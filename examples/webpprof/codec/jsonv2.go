@@ -0,0 +1,26 @@
+//go:build go1.27
+
+package codec
+
+import (
+	"encoding/json/v2"
+	"io"
+)
+
+func init() {
+	Register(v2JSON{})
+}
+
+// v2JSON uses encoding/json/v2, part of the standard library since Go 1.27.
+type v2JSON struct{}
+
+func (v2JSON) Name() string        { return "jsonv2" }
+func (v2JSON) ContentType() string { return "application/json" }
+
+func (v2JSON) Encode(w io.Writer, v any) error {
+	return json.MarshalWrite(w, v)
+}
+
+func (v2JSON) Decode(r io.Reader, v any) error {
+	return json.UnmarshalRead(r, v)
+}
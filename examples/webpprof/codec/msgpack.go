@@ -0,0 +1,501 @@
+package codec
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(msgpackCodec{})
+}
+
+// msgpackCodec is a small reflection-based MessagePack implementation covering
+// the shapes the API returns: maps, slices, structs with json tags, scalars
+// and time.Time (as the standard timestamp extension).
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	bw := bufio.NewWriter(w)
+	b := appendMsgpack(nil, reflect.ValueOf(v))
+	if _, err := bw.Write(b); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("msgpack: Decode requires a non-nil pointer")
+	}
+	generic, err := readMsgpack(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), generic)
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func appendMsgpack(b []byte, v reflect.Value) []byte {
+	if !v.IsValid() {
+		return append(b, 0xc0)
+	}
+	if v.Type() == timeType {
+		return appendTimestamp(b, v.Interface().(time.Time))
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok && v.Kind() != reflect.Pointer {
+		text, err := m.MarshalText()
+		if err == nil {
+			return appendString(b, string(text))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		return appendMsgpack(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendInt(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUint(b, v.Uint())
+	case reflect.Float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float()))
+	case reflect.String:
+		return appendString(b, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBinary(b, v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		b = appendArrayHeader(b, v.Len())
+		for i := range v.Len() {
+			b = appendMsgpack(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		b = appendMapHeader(b, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			b = appendMsgpack(b, iter.Key())
+			b = appendMsgpack(b, iter.Value())
+		}
+		return b
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		b = appendMapHeader(b, len(fields))
+		for _, f := range fields {
+			b = appendString(b, f.name)
+			b = appendMsgpack(b, v.Field(f.index))
+		}
+		return b
+	default:
+		// Channels, funcs and complex numbers have no representation.
+		return append(b, 0xc0)
+	}
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendBinary(b []byte, p []byte) []byte {
+	n := len(p)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, p...)
+}
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// appendTimestamp writes the timestamp 96 extension (type -1), which holds
+// any time.Time without loss.
+func appendTimestamp(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, 0xff)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+}
+
+type field struct {
+	name  string
+	index int
+}
+
+// structFields returns the exported fields of t named the way encoding/json
+// would name them, so both codecs produce the same keys.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields = append(fields, field{name: name, index: i})
+	}
+	return fields
+}
+
+// readMsgpack decodes one value into nil, bool, int64, uint64, float64,
+// string, []byte, time.Time, []any or map[string]any.
+func readMsgpack(r *bufio.Reader) (any, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return readArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		return readString(r, int(c&0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLength(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xc7, 0xc8, 0xc9, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readExt(r, c)
+	case 0xca:
+		u, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUint(r, 8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readUint(r, 1<<(c-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := readUint(r, size)
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLength(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return readString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readLength(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readLength(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMap(r, n)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type byte 0x%02x", c)
+}
+
+// maxLength caps the lengths Decode accepts, of strings, binaries, arrays,
+// maps and extensions. Below it, memory is still allocated as the input
+// arrives rather than up front, so a corrupt length in a short input fails
+// without allocating what it claims.
+const maxLength = 16 << 20
+
+// readLength reads a 1, 2 or 4 byte length for sizeClass 0, 1 or 2.
+func readLength(r *bufio.Reader, sizeClass byte) (int, error) {
+	u, err := readUint(r, 1<<sizeClass)
+	if err == nil && u > maxLength {
+		return 0, fmt.Errorf("msgpack: length %d exceeds the limit of %d", u, maxLength)
+	}
+	return int(u), err
+}
+
+// readBytes reads n bytes, growing the buffer as they are read.
+func readBytes(r *bufio.Reader, n int) ([]byte, error) {
+	p, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err == nil && len(p) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return p, err
+}
+
+// sizeHint is the capacity to start a container of n elements with.
+func sizeHint(n int) int { return min(n, 1024) }
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func readString(r *bufio.Reader, n int) (string, error) {
+	p, err := readBytes(r, n)
+	return string(p), err
+}
+
+func readArray(r *bufio.Reader, n int) ([]any, error) {
+	out := make([]any, 0, sizeHint(n))
+	for range n {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func readMap(r *bufio.Reader, n int) (map[string]any, error) {
+	out := make(map[string]any, sizeHint(n))
+	for range n {
+		k, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		out[fmt.Sprint(k)] = v
+	}
+	return out, nil
+}
+
+func readExt(r *bufio.Reader, c byte) (any, error) {
+	var n int
+	switch c {
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		n = 1 << (c - 0xd4)
+	default:
+		var err error
+		if n, err = readLength(r, c-0xc7); err != nil {
+			return nil, err
+		}
+	}
+	typ, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBytes(r, n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != -1 {
+		return data, nil
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+}
+
+// assign stores a generic decoded value into dst, converting numbers and
+// matching struct fields by their json names.
+func assign(dst reflect.Value, src any) error {
+	if src == nil {
+		dst.SetZero()
+		return nil
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src)
+	}
+
+	sv := reflect.ValueOf(src)
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if !sv.CanConvert(dst.Type()) || sv.Kind() == reflect.String {
+			return fmt.Errorf("msgpack: cannot decode %T into %s", src, dst.Type())
+		}
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	case reflect.Slice:
+		if p, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(p)
+			return nil
+		}
+		items, ok := src.([]any)
+		if !ok {
+			return fmt.Errorf("msgpack: cannot decode %T into %s", src, dst.Type())
+		}
+		out := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(out.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+		return nil
+	case reflect.Map:
+		entries, ok := src.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("msgpack: cannot decode %T into %s", src, dst.Type())
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(entries))
+		for k, item := range entries {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, item); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(out)
+		return nil
+	case reflect.Struct:
+		entries, ok := src.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, f := range structFields(dst.Type()) {
+			if item, ok := entries[f.name]; ok {
+				if err := assign(dst.Field(f.index), item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if !sv.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("msgpack: cannot decode %T into %s", src, dst.Type())
+	}
+	dst.Set(sv)
+	return nil
+}
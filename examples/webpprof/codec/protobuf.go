@@ -0,0 +1,165 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+func init() {
+	Register(protobufCodec{})
+}
+
+// ProtoMarshaler is implemented by types that have a protobuf schema. The
+// schemas live next to the types in .proto files; the methods are written by
+// hand against them to keep the example free of generated code and of the
+// protobuf runtime dependency.
+type ProtoMarshaler interface {
+	MarshalProto(p *ProtoBuffer)
+}
+
+// protobufCodec encodes values implementing ProtoMarshaler. Responses without
+// a schema are reported through Supports so negotiation can fall back.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Supports(v any) bool {
+	_, ok := v.(ProtoMarshaler)
+	return ok
+}
+
+func (protobufCodec) Encode(w io.Writer, v any) error {
+	m, ok := v.(ProtoMarshaler)
+	if !ok {
+		return fmt.Errorf("protobuf: %T has no protobuf schema", v)
+	}
+	var p ProtoBuffer
+	m.MarshalProto(&p)
+	_, err := w.Write(p.Bytes())
+	return err
+}
+
+func (protobufCodec) Decode(r io.Reader, v any) error {
+	return errors.New("protobuf: decoding is not supported")
+}
+
+// Supporter is an optional interface for codecs that can only encode some
+// values.
+type Supporter interface {
+	Supports(v any) bool
+}
+
+// CanEncode reports whether c is able to encode v.
+func CanEncode(c Codec, v any) bool {
+	if s, ok := c.(Supporter); ok {
+		return s.Supports(v)
+	}
+	return true
+}
+
+// ProtoBuffer accumulates protobuf wire-format fields. Zero values are
+// skipped, matching proto3 implicit presence.
+type ProtoBuffer struct {
+	b []byte
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (p *ProtoBuffer) Bytes() []byte {
+	return p.b
+}
+
+func (p *ProtoBuffer) tag(num, wireType int) {
+	p.b = binary.AppendUvarint(p.b, uint64(num)<<3|uint64(wireType))
+}
+
+func (p *ProtoBuffer) Uint64(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(num, wireVarint)
+	p.b = binary.AppendUvarint(p.b, v)
+}
+
+func (p *ProtoBuffer) Int64(num int, v int64) {
+	p.Uint64(num, uint64(v))
+}
+
+func (p *ProtoBuffer) Bool(num int, v bool) {
+	if v {
+		p.Uint64(num, 1)
+	}
+}
+
+func (p *ProtoBuffer) Double(num int, v float64) {
+	if v == 0 {
+		return
+	}
+	p.tag(num, wireFixed64)
+	p.b = binary.LittleEndian.AppendUint64(p.b, math.Float64bits(v))
+}
+
+func (p *ProtoBuffer) String(num int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(num, wireBytes)
+	p.b = binary.AppendUvarint(p.b, uint64(len(v)))
+	p.b = append(p.b, v...)
+}
+
+// Message writes m as an embedded message.
+func (p *ProtoBuffer) Message(num int, m ProtoMarshaler) {
+	var inner ProtoBuffer
+	m.MarshalProto(&inner)
+	p.tag(num, wireBytes)
+	p.b = binary.AppendUvarint(p.b, uint64(len(inner.b)))
+	p.b = append(p.b, inner.b...)
+}
+
+// Timestamp writes t as a google.protobuf.Timestamp.
+func (p *ProtoBuffer) Timestamp(num int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	p.Message(num, timestamp(t))
+}
+
+// MapStringUint64 writes a map<string, uint64> field in key order.
+func (p *ProtoBuffer) MapStringUint64(num int, m map[string]uint64) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		p.Message(num, mapEntry{key: k, value: m[k]})
+	}
+}
+
+type timestamp time.Time
+
+func (t timestamp) MarshalProto(p *ProtoBuffer) {
+	p.Int64(1, time.Time(t).Unix())
+	p.Int64(2, int64(time.Time(t).Nanosecond()))
+}
+
+type mapEntry struct {
+	key   string
+	value uint64
+}
+
+func (e mapEntry) MarshalProto(p *ProtoBuffer) {
+	p.String(1, e.key)
+	p.Uint64(2, e.value)
+}
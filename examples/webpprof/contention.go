@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/contention"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+const modulePath = "github.com/vdntruong/gosamurai/examples/webpprof/"
+
+// lockNames maps the functions that release the application's locks to the
+// lock they guard, so contention reports say "cacheMu" instead of a stack.
+var lockNames = contention.Names{
+	"main.createUsersHandler": "cacheMu",
+	"main.backgroundWorker":   "cacheMu",
+	"main.lookupUsersHandler": "cacheMu",
+
+	"main.(*statsHistory).":              "statsHistory.mu",
+	modulePath + "archive.(*Archive).":   "archive.Archive.mu",
+	modulePath + "archive.(*Entry).":     "archive.Entry.mu",
+	modulePath + "capture.(*Capturer).":  "capture.Capturer.mu",
+	modulePath + "timing.(*Aggregator).": "timing.Aggregator.mu",
+	modulePath + "tsdb.(*Store).":        "tsdb.Store.mu",
+	modulePath + "codec.":                "codec.registry",
+	modulePath + "striped.(*Mutex).":     "striped.Mutex",
+	modulePath + "session.":              "session.Store",
+	modulePath + "cache.":                "cache",
+	modulePath + "hashring.(*Ring).":     "hashring.Ring.mu",
+	"main.(*shardedCache).":              "shardedCache.mu",
+	modulePath + "hotkeys.(*Tracker).":   "hotkeys.Tracker.mu",
+	"main.(*searchDemo).":                "searchDemo.mu",
+	"main.(*pollHub).":                   "pollHub.mu",
+}
+
+// contentionHandler serves the mutex profile grouped by lock site,
+// /debug/contention?format=text&top=20
+func contentionHandler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("mutex").WriteTo(&buf, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := contention.Analyze(p, lockNames)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		report.WriteText(w, top)
+		return
+	}
+	if top > 0 && top < len(report.Entries) {
+		report.Entries = report.Entries[:top]
+	}
+	respond.Write(w, r, report)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"runtime"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/rbac"
+	"github.com/vdntruong/gosamurai/examples/webpprof/secure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/session"
+)
+
+// adminPassword returns the -admin-password flag, or a random password that
+// is logged at startup when the flag is empty.
+func adminPassword() string {
+	if *adminPass != "" {
+		return *adminPass
+	}
+	var b [12]byte
+	rand.Read(b[:])
+	pw := hex.EncodeToString(b[:])
+	slog.Info("generated admin dashboard password", "password", pw)
+	return pw
+}
+
+// admin wraps the admin dashboard routes: every request runs in a session,
+// and form posts must carry the session's CSRF token.
+func admin(h http.HandlerFunc) http.Handler {
+	return sessions.Middleware(secure.CSRF(h))
+}
+
+// requireAdmin redirects visitors who have not logged in to the login page.
+// Principals with the admin role (see -rbac-config) need no login.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loggedIn := session.FromContext(r.Context()).Get("user") == "admin"
+		if !loggedIn && rbac.FromContext(r.Context()).Role < rbac.Admin {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	}
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<html>
+<head><title>Admin Login</title></head>
+<body>
+	<h1>Admin Login</h1>
+	{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+	<form method="post" action="/admin/login">
+		<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+		<input type="password" name="password" placeholder="Password" autofocus>
+		<button type="submit">Log in</button>
+	</form>
+</body>
+</html>
+`))
+
+func loginFormHandler(w http.ResponseWriter, r *http.Request) {
+	loginPage.Execute(w, map[string]string{"CSRF": secure.Token(r)})
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	pw := r.PostFormValue("password")
+	if subtle.ConstantTimeCompare([]byte(pw), []byte(dashboardPassword)) != 1 {
+		events.Emit(r.Context(), events.LoginFailed, events.Remote, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		loginPage.Execute(w, map[string]string{"CSRF": secure.Token(r), "Error": "Wrong password"})
+		return
+	}
+	sessions.Renew(w, r)
+	secure.ResetToken(r)
+	session.FromContext(r.Context()).Set("user", "admin")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessions.End(w, r)
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<html>
+<head><title>Admin Dashboard</title></head>
+<body>
+	<h1>Admin Dashboard</h1>
+	<form method="post" action="/admin/logout"><input type="hidden" name="csrf_token" value="{{.CSRF}}"><button type="submit">Log out</button></form>
+	<h2>Runtime</h2>
+	<ul>
+		<li>Goroutines: {{.Goroutines}}</li>
+		<li>Heap: {{.HeapMB}} MB</li>
+		<li>Cached users: {{.Stats.CacheSize}}</li>
+		<li>Requests: {{.Stats.RequestCount}}</li>
+		<li>Abandoned by the client: {{.Stats.ClientGone}}</li>
+	</ul>
+	<h2>Sessions</h2>
+	<ul>
+		<li>Active: {{.Sessions.Active}} (peak {{.Sessions.Peak}})</li>
+		<li>Created: {{.Sessions.Created}}, expired: {{.Sessions.Expired}}, logged out: {{.Sessions.Ended}}</li>
+	</ul>
+	<h2>Debug</h2>
+	<ul>
+		<li><a href="/debug/requests">Request archive</a></li>
+		<li><a href="/debug/requests/repeats">Repeated calls</a></li>
+		<li><a href="/debug/contention?format=text">Lock contention</a></li>
+		<li><a href="/debug/pprof/">pprof</a></li>
+		<li><a href="/api/metrics/expr?query=max_over_time(goroutines[5m])&amp;from=-6h">Goroutines, last 6 hours</a> and <a href="/api/metrics/expr?query=max_over_time(heap_alloc_mb[5m])&amp;from=-6h">heap</a> (needs -metrics-dir)</li>
+	</ul>
+</body>
+</html>
+`))
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	err := dashboardPage.Execute(w, map[string]any{
+		"Goroutines": runtime.NumGoroutine(),
+		"HeapMB":     memStats.HeapAlloc / 1024 / 1024,
+		"Stats":      loadStats(),
+		"Sessions":   sessions.Stats(),
+		"CSRF":       secure.Token(r),
+	})
+	if err != nil {
+		fmt.Fprintln(w, err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// eventsReport is the event taxonomy and what has been emitted of it.
+type eventsReport struct {
+	Catalog []events.Event      `json:"catalog"`
+	Counts  map[string]uint64   `json:"counts"`
+	Recent  []events.Occurrence `json:"recent"`
+}
+
+// eventsHandler lists every kind of event with how often it occurred and the
+// most recent occurrences, newest last; with name, only the events whose name
+// starts with it, so "access." has every refused request:
+// GET /debug/events?name=access.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("name")
+	rep := eventsReport{Counts: make(map[string]uint64)}
+	for _, e := range events.Catalog() {
+		if strings.HasPrefix(e.Name, prefix) {
+			rep.Catalog = append(rep.Catalog, e)
+		}
+	}
+	for name, n := range events.Counts() {
+		if strings.HasPrefix(name, prefix) {
+			rep.Counts[name] = n
+		}
+	}
+	for _, o := range events.Recent() {
+		if strings.HasPrefix(o.Name, prefix) {
+			rep.Recent = append(rep.Recent, o)
+		}
+	}
+	respond.Write(w, r, rep)
+}
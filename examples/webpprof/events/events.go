@@ -0,0 +1,219 @@
+// Package events is the taxonomy of the notable things the server does: a
+// slow request captured, pressure sustained, a request refused. Each kind
+// of event has one name, one level, and one set of attributes, and Emit
+// sends an occurrence everywhere it is looked for under that name:
+//
+//   - slog, with an "event" attribute, so the log line, and the request
+//     archive entry it lands in, can be found by name
+//   - the execution trace, as a user log in the current task, category the
+//     event name
+//   - the ring of recent events behind /debug/events
+//
+// Work done because of an event runs under Do, which labels its CPU profile
+// samples and goroutines with "event" in pprof and puts it in a trace region,
+// so the cost of, say, capturing a slow request shows up under the same name
+// as the log line that announced it.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute keys. An attribute means the same under the same key in every
+// event that has it.
+const (
+	Avg10     = "avg10"     // pressure "some" avg10 percentage
+	Backoff   = "backoff"   // wait before a restart
+	Cause     = "cause"     // why a context ended
+	Component = "component" // supervised background component
+	During    = "during"    // what a handler was doing
+	Elapsed   = "elapsed"   // how long something took
+	Err       = "err"       // the error
+	FDs       = "fds"       // open file descriptors
+	History   = "history"   // stats history samples
+	Limit     = "limit"     // a limit reached or approached
+	Method    = "method"    // HTTP method
+	Path      = "path"      // URL path
+	Principal = "principal" // authenticated principal
+	Remote    = "remote"    // client address
+	RequestID = "request_id"
+	Required  = "required" // role required
+	Resource  = "resource" // PSI resource: cpu, memory, io
+	Restarts  = "restarts" // times a component was restarted
+	Role      = "role"     // a principal's role
+	Scope     = "scope"    // PSI scope: system or cgroup
+	Sessions  = "sessions" // sessions in the store
+	Since     = "since"    // when a condition started
+	Sockets   = "sockets"  // sockets by state
+	Threshold = "threshold"
+	Trigger   = "trigger" // what caused a capture
+	Users     = "users"   // users in the cache
+)
+
+// Event is a kind of event.
+type Event struct {
+	Name    string     `json:"name"`
+	Level   slog.Level `json:"level"`
+	Message string     `json:"message"`
+	// Attrs are the keys every occurrence carries, no more, no fewer.
+	Attrs []string `json:"attrs"`
+}
+
+// catalog is every kind of event, in the order registered.
+var catalog []Event
+
+func register(e Event) Event {
+	catalog = append(catalog, e)
+	return e
+}
+
+// The events.
+var (
+	SlowRequest = register(Event{Name: "request.slow", Level: slog.LevelWarn,
+		Message: "slow request captured", Attrs: []string{Elapsed, Threshold, RequestID}})
+	ClientGone = register(Event{Name: "request.client_gone", Level: slog.LevelInfo,
+		Message: "client gone, abandoning request", Attrs: []string{During, Cause}})
+	Captured = register(Event{Name: "capture.archived", Level: slog.LevelInfo,
+		Message: "capture archived", Attrs: []string{Trigger, RequestID}})
+	CaptureFailed = register(Event{Name: "capture.trace_failed", Level: slog.LevelWarn,
+		Message: "flight recorder snapshot failed", Attrs: []string{Err}})
+	PressureSustained = register(Event{Name: "pressure.sustained", Level: slog.LevelWarn,
+		Message: "sustained pressure", Attrs: []string{Resource, Scope, Avg10, Threshold, Since}})
+	DescriptorsHigh = register(Event{Name: "process.fds_high", Level: slog.LevelWarn,
+		Message: "open file descriptors near the limit", Attrs: []string{FDs, Limit, Sockets}})
+	CredentialsRejected = register(Event{Name: "access.credentials_rejected", Level: slog.LevelWarn,
+		Message: "rejected credentials", Attrs: []string{Path, Remote, Err}})
+	AccessDenied = register(Event{Name: "access.denied", Level: slog.LevelWarn,
+		Message: "access denied", Attrs: []string{Path, Principal, Role, Required}})
+	CrossSiteRejected = register(Event{Name: "access.cross_site_rejected", Level: slog.LevelWarn,
+		Message: "rejected cross-site request", Attrs: []string{Method, Path}})
+	LoginFailed = register(Event{Name: "admin.login_failed", Level: slog.LevelWarn,
+		Message: "failed admin login", Attrs: []string{Remote}})
+	ComponentFailed = register(Event{Name: "supervisor.component_failed", Level: slog.LevelError,
+		Message: "background component failed, restarting", Attrs: []string{Component, Err, Restarts, Backoff}})
+	SnapshotWritten = register(Event{Name: "snapshot.written", Level: slog.LevelInfo,
+		Message: "snapshot written", Attrs: []string{Users, Sessions, History, Elapsed}})
+)
+
+// Catalog returns every kind of event.
+func Catalog() []Event {
+	return slices.Clone(catalog)
+}
+
+// Occurrence is one emitted event.
+type Occurrence struct {
+	Time  time.Time      `json:"time"`
+	Name  string         `json:"name"`
+	Attrs map[string]any `json:"attrs"`
+	// Schema lists the attributes missing or unexpected for the event, empty
+	// when the occurrence matches it.
+	Schema string `json:"schema,omitempty"`
+}
+
+// ringSize is how many recent occurrences Recent keeps.
+const ringSize = 256
+
+var (
+	mu     sync.Mutex
+	ring   [ringSize]Occurrence
+	next   int
+	total  int
+	counts = make(map[string]uint64)
+)
+
+// Emit records an occurrence of e with args, key-value pairs as for slog.
+func Emit(ctx context.Context, e Event, args ...any) {
+	r := slog.NewRecord(time.Now(), e.Level, e.Message, callerPC())
+	r.AddAttrs(slog.String("event", e.Name))
+	r.Add(args...)
+
+	o := Occurrence{Time: r.Time, Name: e.Name, Attrs: make(map[string]any, len(e.Attrs))}
+	var text []string
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != "event" {
+			o.Attrs[a.Key] = a.Value.Resolve().Any()
+			text = append(text, a.String())
+		}
+		return true
+	})
+	if o.Schema = e.check(o.Attrs); o.Schema != "" {
+		r.AddAttrs(slog.String("schema", o.Schema))
+	}
+
+	mu.Lock()
+	ring[next] = o
+	next = (next + 1) % ringSize
+	total++
+	counts[e.Name]++
+	mu.Unlock()
+
+	if trace.IsEnabled() {
+		trace.Log(ctx, e.Name, strings.Join(text, " "))
+	}
+	if h := slog.Default().Handler(); h.Enabled(ctx, e.Level) {
+		h.Handle(ctx, r)
+	}
+}
+
+// callerPC returns the program counter of Emit's caller, so the log record
+// names the logger of the code that emitted it rather than this package.
+func callerPC() uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Callers, callerPC, Emit
+	return pcs[0]
+}
+
+// check reports the attributes attrs lacks or has beyond e's schema.
+func (e Event) check(attrs map[string]any) string {
+	var missing, extra []string
+	for _, k := range e.Attrs {
+		if _, ok := attrs[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	for k := range attrs {
+		if !slices.Contains(e.Attrs, k) {
+			extra = append(extra, k)
+		}
+	}
+	if missing == nil && extra == nil {
+		return ""
+	}
+	slices.Sort(extra)
+	return fmt.Sprintf("missing %v, unexpected %v", missing, extra)
+}
+
+// Do runs f as work done for e: with an "event" pprof label, so its CPU
+// profile samples carry the event name, and in a trace region of that name.
+func Do(ctx context.Context, e Event, f func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels("event", e.Name), func(ctx context.Context) {
+		trace.WithRegion(ctx, e.Name, func() { f(ctx) })
+	})
+}
+
+// Recent returns the most recent occurrences, oldest first.
+func Recent() []Occurrence {
+	mu.Lock()
+	defer mu.Unlock()
+	if total < ringSize {
+		return slices.Clone(ring[:next])
+	}
+	return append(slices.Clone(ring[next:]), ring[:next]...)
+}
+
+// Counts returns how many times each event has been emitted.
+func Counts() map[string]uint64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return maps.Clone(counts)
+}
@@ -0,0 +1,132 @@
+// Package export writes slices of flat structs to files suited for offline
+// analysis in pandas or duckdb.
+//
+// Column names come from the json struct tags so exported files line up with
+// the API responses. Parquet schemas are derived by parquet-go from the
+// parquet struct tags.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{CSV, Parquet}
+
+// ParseFormat validates a format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("export: unknown format %q (want csv or parquet)", s)
+}
+
+// ContentType returns the media type for the format.
+func (f Format) ContentType() string {
+	if f == Parquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv"
+}
+
+// Write writes rows to w in format f.
+func Write[T any](w io.Writer, f Format, rows []T) error {
+	if f == Parquet {
+		return parquet.Write(w, rows)
+	}
+	return WriteCSV(w, rows)
+}
+
+// WriteCSV writes rows as CSV with a header line. T must be a struct whose
+// fields are scalars or time.Time.
+func WriteCSV[T any](w io.Writer, rows []T) error {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("export: %s is not a struct", t)
+	}
+
+	var (
+		header  []string
+		indexes []int
+	)
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name := columnName(sf)
+		if name == "" {
+			continue
+		}
+		header = append(header, name)
+		indexes = append(indexes, i)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(indexes))
+	for _, row := range rows {
+		v := reflect.ValueOf(row)
+		for i, idx := range indexes {
+			record[i] = formatValue(v.Field(idx))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func columnName(sf reflect.StructField) string {
+	if !sf.IsExported() {
+		return ""
+	}
+	tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	switch tag {
+	case "-":
+		return ""
+	case "":
+		return sf.Name
+	}
+	return tag
+}
+
+func formatValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return strconv.FormatInt(d.Nanoseconds(), 10)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.String:
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
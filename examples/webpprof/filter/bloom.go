@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bloom is a Bloom filter: k bits per key set in an m-bit array, with the k
+// positions derived from one 64-bit hash by double hashing.
+type Bloom struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    int    // bits set per key
+}
+
+// NewBloom returns a Bloom filter sized for n keys at false-positive rate
+// fpr: m = -n ln(fpr) / ln(2)^2 bits and k = m/n ln(2) hashes.
+func NewBloom(n int, fpr float64) *Bloom {
+	n = max(n, 1)
+	fpr = min(max(fpr, 1e-9), 0.5)
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2)))
+	m = max((m+63)/64*64, 64)
+	k := max(int(math.Round(float64(m)/float64(n)*math.Ln2)), 1)
+	return &Bloom{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// Add implements Filter; it always succeeds.
+func (b *Bloom) Add(key string) bool {
+	h1, h2 := split(hash(key))
+	for i := range b.k {
+		bit := (h1 + uint64(i)*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+	return true
+}
+
+// Contains implements Filter.
+func (b *Bloom) Contains(key string) bool {
+	h1, h2 := split(hash(key))
+	for i := range b.k {
+		bit := (h1 + uint64(i)*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SizeBytes implements Filter.
+func (b *Bloom) SizeBytes() int { return len(b.bits) * 8 }
+
+// Hashes is the number of bits set per key.
+func (b *Bloom) Hashes() int { return b.k }
+
+// FillRatio is the share of bits set; the false-positive rate is about
+// FillRatio^Hashes.
+func (b *Bloom) FillRatio() float64 {
+	var set int
+	for _, w := range b.bits {
+		set += bits.OnesCount64(w)
+	}
+	return float64(set) / float64(b.m)
+}
+
+// split derives the two hashes of double hashing from one 64-bit hash; the
+// second is odd so it cycles through every position.
+func split(h uint64) (uint64, uint64) {
+	return h, (h>>32 | h<<32) | 1
+}
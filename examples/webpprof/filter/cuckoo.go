@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"math"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	bucketSize = 4   // fingerprints per bucket
+	maxKicks   = 500 // relocations before an insert gives up
+)
+
+// Cuckoo is a cuckoo filter: a key is stored as a short fingerprint in one
+// of two buckets, the second derived from the first and the fingerprint
+// alone (partial-key cuckoo hashing), so entries can be relocated and
+// deleted without knowing their keys. A lookup touches two buckets where a
+// Bloom filter touches k bits, and keys can be deleted, but the table fills
+// up: past about 95% load, Add fails. Packed to their width, fingerprints
+// would take less space than a Bloom filter at low false-positive rates;
+// this implementation keeps them in 16-bit slots for simplicity.
+type Cuckoo struct {
+	buckets [][bucketSize]uint16 // 0 is an empty slot
+	mask    uint64               // len(buckets)-1, a power of two
+	fpBits  uint                 // fingerprint width, up to 16
+	count   int
+}
+
+// NewCuckoo returns a cuckoo filter sized for n keys at false-positive rate
+// fpr, which needs fingerprints of log2(2*bucketSize/fpr) bits.
+func NewCuckoo(n int, fpr float64) *Cuckoo {
+	n = max(n, 1)
+	fpr = min(max(fpr, 1e-5), 0.5)
+	fpBits := uint(min(math.Ceil(math.Log2(2*bucketSize/fpr)), 16))
+	nb := uint64(math.Ceil(float64(n) / bucketSize / 0.95))
+	nb = max(uint64(1)<<bits.Len64(nb-1), 1) // round up to a power of two
+	return &Cuckoo{buckets: make([][bucketSize]uint16, nb), mask: nb - 1, fpBits: fpBits}
+}
+
+func (c *Cuckoo) locate(key string) (fp uint16, i1, i2 uint64) {
+	h := hash(key)
+	fp = uint16(h>>48) & (1<<c.fpBits - 1)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 = h & c.mask
+	return fp, i1, c.alt(i1, fp)
+}
+
+// alt is the other bucket of a fingerprint; alt(alt(i, fp), fp) == i.
+func (c *Cuckoo) alt(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & c.mask
+}
+
+// Add implements Filter.
+func (c *Cuckoo) Add(key string) bool {
+	fp, i1, i2 := c.locate(key)
+	if c.insert(i1, fp) || c.insert(i2, fp) {
+		c.count++
+		return true
+	}
+	// Both buckets are full: evict a random fingerprint to its other
+	// bucket, and so on, until one finds room.
+	i := i1
+	if rand.IntN(2) == 0 {
+		i = i2
+	}
+	for range maxKicks {
+		slot := rand.IntN(bucketSize)
+		fp, c.buckets[i][slot] = c.buckets[i][slot], fp
+		i = c.alt(i, fp)
+		if c.insert(i, fp) {
+			c.count++
+			return true
+		}
+	}
+	// The fingerprint left homeless is lost, so a key already added may
+	// now be missed; callers treat a failed Add as "filter full".
+	return false
+}
+
+func (c *Cuckoo) insert(i uint64, fp uint16) bool {
+	for slot, v := range c.buckets[i] {
+		if v == 0 {
+			c.buckets[i][slot] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// Contains implements Filter.
+func (c *Cuckoo) Contains(key string) bool {
+	fp, i1, i2 := c.locate(key)
+	for _, i := range [2]uint64{i1, i2} {
+		for _, v := range c.buckets[i] {
+			if v == fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Delete removes one copy of key's fingerprint. Deleting a key that was
+// never added may remove another key's fingerprint.
+func (c *Cuckoo) Delete(key string) bool {
+	fp, i1, i2 := c.locate(key)
+	for _, i := range [2]uint64{i1, i2} {
+		for slot, v := range c.buckets[i] {
+			if v == fp {
+				c.buckets[i][slot] = 0
+				c.count--
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SizeBytes implements Filter.
+func (c *Cuckoo) SizeBytes() int { return len(c.buckets) * bucketSize * 2 }
+
+// LoadFactor is the share of slots in use.
+func (c *Cuckoo) LoadFactor() float64 {
+	return float64(c.count) / float64(len(c.buckets)*bucketSize)
+}
@@ -0,0 +1,47 @@
+// Package filter implements probabilistic membership filters: a Bloom filter
+// and a cuckoo filter. Both answer "definitely not present" or "maybe
+// present" in a few bytes per key, so a read path can skip lookups of keys
+// it knows are missing. The false-positive rate is chosen when the filter is
+// created.
+package filter
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+// Filter is a membership filter. Add must not run concurrently with other
+// methods; Contains may run concurrently with itself.
+type Filter interface {
+	// Add inserts key and reports whether it fit; a full cuckoo filter
+	// rejects keys.
+	Add(key string) bool
+	// Contains reports whether key may have been added. False means it
+	// definitely was not.
+	Contains(key string) bool
+	// SizeBytes is the memory taken by the filter's table.
+	SizeBytes() int
+}
+
+// New returns a filter of the given kind ("bloom" or "cuckoo") sized for n
+// keys at false-positive rate fpr.
+func New(kind string, n int, fpr float64) (Filter, error) {
+	switch kind {
+	case "bloom":
+		return NewBloom(n, fpr), nil
+	case "cuckoo":
+		return NewCuckoo(n, fpr), nil
+	}
+	return nil, fmt.Errorf("filter: unknown kind %q", kind)
+}
+
+// Kinds are the filter kinds New accepts.
+var Kinds = []string{"bloom", "cuckoo"}
+
+// seed is shared by all filters of the process; filters are not meant to be
+// persisted or shared between processes.
+var seed = maphash.MakeSeed()
+
+func hash(key string) uint64 {
+	return maphash.String(seed, key)
+}
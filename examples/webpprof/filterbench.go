@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/filter"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// filterRun is one filter's result in /api/filters/compare.
+type filterRun struct {
+	Kind        string  `json:"kind"`
+	SizeBytes   int     `json:"size_bytes"`
+	BitsPerKey  float64 `json:"bits_per_key"`
+	Rejected    int     `json:"rejected"` // keys Add could not fit
+	AddNs       int64   `json:"add_ns"`
+	ContainsNs  int64   `json:"contains_ns"`
+	MeasuredFPR float64 `json:"measured_fpr"`
+	// FalseNegatives must be zero unless the filter rejected keys.
+	FalseNegatives int `json:"false_negatives"`
+}
+
+// filtersCompareHandler builds every filter kind over the same n keys and
+// measures insert and lookup time and the false-positive rate on n keys
+// that were not added.
+// /api/filters/compare?n=100000&fpr=0.01
+func filtersCompareHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		n = 100000
+	}
+	fpr, err := strconv.ParseFloat(r.URL.Query().Get("fpr"), 64)
+	if err != nil || fpr <= 0 || fpr >= 1 {
+		fpr = 0.01
+	}
+
+	members := make([]string, n)
+	others := make([]string, n)
+	for i := range n {
+		members[i] = "member:" + strconv.Itoa(i)
+		others[i] = "other:" + strconv.Itoa(i)
+	}
+
+	runs := make([]filterRun, 0, len(filter.Kinds))
+	for _, kind := range filter.Kinds {
+		if clientGone(w, r, "filters.compare") {
+			return
+		}
+		f, _ := filter.New(kind, n, fpr)
+		run := filterRun{Kind: kind}
+
+		start := time.Now()
+		for _, k := range members {
+			if !f.Add(k) {
+				run.Rejected++
+			}
+		}
+		run.AddNs = time.Since(start).Nanoseconds() / int64(n)
+
+		for _, k := range members {
+			if !f.Contains(k) {
+				run.FalseNegatives++
+			}
+		}
+		var fp int
+		start = time.Now()
+		for _, k := range others {
+			if f.Contains(k) {
+				fp++
+			}
+		}
+		run.ContainsNs = time.Since(start).Nanoseconds() / int64(n)
+
+		run.SizeBytes = f.SizeBytes()
+		run.BitsPerKey = math.Round(float64(run.SizeBytes)*8/float64(n)*100) / 100
+		run.MeasuredFPR = float64(fp) / float64(n)
+		runs = append(runs, run)
+	}
+
+	incrementCounter()
+	respond.Write(w, r, map[string]any{"n": n, "target_fpr": fpr, "filters": runs})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/vdntruong/gosamurai/analysis/goroutinediff"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// goroutineSnapshot parses the current goroutine profile, labels included.
+func goroutineSnapshot() (*profile.Profile, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return profile.Parse(&buf)
+}
+
+// goroutineDiffHandler takes two goroutine profiles ?seconds= apart (10 by
+// default) and reports which values of ?label= (the "handler" label every
+// instrumented route sets, by default) gained goroutines, and where they
+// started, /debug/goroutines/diff?seconds=30&format=text&top=10
+func goroutineDiffHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	seconds := 10
+	if s := q.Get("seconds"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "seconds must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		seconds = n
+	}
+	label := q.Get("label")
+	if label == "" {
+		label = "handler"
+	}
+
+	before, err := goroutineSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+		return
+	}
+	after, err := goroutineSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := goroutinediff.Diff(before, after, label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	top, _ := strconv.Atoi(q.Get("top"))
+	if q.Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		report.WriteText(w, top)
+		return
+	}
+	if top > 0 && top < len(report.Groups) {
+		report.Groups = report.Groups[:top]
+	}
+	respond.Write(w, r, report)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"runtime/pprof"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/subtleties"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/capture"
+	"github.com/vdntruong/gosamurai/examples/webpprof/codec"
+	"github.com/vdntruong/gosamurai/examples/webpprof/export"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// Guide is the usage guide served by /debug/guide. Every section is read from
+// the registry that drives the feature, so the guide cannot drift from what
+// the binary actually serves.
+type Guide struct {
+	Groups     []GuideGroup    `json:"groups"`
+	Profiles   []GuideProfile  `json:"profiles"`
+	Codecs     []GuideCodec    `json:"codecs"`
+	Exports    []GuideExport   `json:"exports"`
+	Artifacts  []GuideArtifact `json:"artifacts"`
+	Subtleties []GuideSubtlety `json:"subtleties"`
+	Flags      []GuideFlag     `json:"flags"`
+}
+
+type GuideGroup struct {
+	Name   string  `json:"name"`
+	Routes []route `json:"routes"`
+}
+
+type GuideProfile struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Count   int    `json:"count"`
+	Summary string `json:"summary"`
+}
+
+type GuideCodec struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Default     bool   `json:"default"`
+}
+
+type GuideExport struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+}
+
+type GuideArtifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Summary     string `json:"summary"`
+}
+
+type GuideSubtlety struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+}
+
+type GuideFlag struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Value   string `json:"value"`
+	Usage   string `json:"usage"`
+}
+
+// profileSummaries describes the runtime's profiles; a profile registered
+// with pprof.NewProfile is listed without one.
+var profileSummaries = map[string]string{
+	"allocs":        "All past memory allocations",
+	"block":         "Stack traces that led to blocking on synchronization primitives",
+	"goroutine":     "Stack traces of all current goroutines",
+	"goroutineleak": "Stack traces of goroutines blocked on values no other goroutine can reach",
+	"heap":          "Memory allocations of live objects",
+	"mutex":         "Stack traces of holders of contended mutexes",
+	"threadcreate":  "Stack traces that led to the creation of new OS threads",
+}
+
+// pprofProfiles lists the profiles registered with runtime/pprof, followed by
+// the CPU profile and execution trace net/http/pprof serves on top of them.
+func pprofProfiles() []GuideProfile {
+	var profiles []GuideProfile
+	for _, p := range pprof.Profiles() {
+		profiles = append(profiles, GuideProfile{
+			Name:    p.Name(),
+			Path:    "/debug/pprof/" + p.Name(),
+			Count:   p.Count(),
+			Summary: profileSummaries[p.Name()],
+		})
+	}
+	return append(profiles,
+		GuideProfile{Name: "profile", Path: "/debug/pprof/profile?seconds=30", Summary: "CPU profile"},
+		GuideProfile{Name: "trace", Path: "/debug/pprof/trace?seconds=5", Summary: "Execution trace"},
+	)
+}
+
+// secretFlag matches the flags whose values the guide does not show, since
+// anyone who may read it would learn them. The -session-redis URL may hold
+// the server's password.
+var secretFlag = regexp.MustCompile(`password|token|secret|session-redis`)
+
+func buildGuide() Guide {
+	var g Guide
+	for _, name := range routeGroups {
+		g.Groups = append(g.Groups, GuideGroup{Name: name, Routes: routesIn(name)})
+	}
+	g.Profiles = pprofProfiles()
+
+	def := respond.Default().Name()
+	for _, c := range codec.All() {
+		g.Codecs = append(g.Codecs, GuideCodec{Name: c.Name(), ContentType: c.ContentType(), Default: c.Name() == def})
+	}
+	for _, f := range export.Formats {
+		g.Exports = append(g.Exports, GuideExport{Format: string(f), ContentType: f.ContentType()})
+	}
+	for _, a := range capture.ArtifactTypes() {
+		g.Artifacts = append(g.Artifacts, GuideArtifact{Name: a.Name, ContentType: a.ContentType, Summary: a.Summary})
+	}
+	for _, s := range subtleties.Catalog {
+		g.Subtleties = append(g.Subtleties, GuideSubtlety{Name: s.Name, Summary: s.Summary})
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlag.MatchString(f.Name) && value != f.DefValue {
+			value = "(redacted)"
+		}
+		g.Flags = append(g.Flags, GuideFlag{Name: f.Name, Default: f.DefValue, Value: value, Usage: f.Usage})
+	})
+	return g
+}
+
+var guidePage = template.Must(template.New("guide").Parse(`<html>
+<head><title>webpprof guide</title></head>
+<body>
+	<h1>webpprof usage guide</h1>
+	<p>Generated from the running binary. The same data is served through the response codecs to clients that do not ask for HTML, <a href="/debug/guide?format=json">/debug/guide?format=json</a>.</p>
+	{{range .Groups}}
+	<h2>{{.Name}}</h2>
+	<table>
+		{{range .Routes}}<tr><td><code>{{.Pattern}}</code></td><td>{{.Summary}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	<h2>pprof profiles</h2>
+	<table>
+		{{range .Profiles}}<tr><td><a href="{{.Path}}">{{.Name}}</a></td><td>{{if .Count}}{{.Count}}{{end}}</td><td>{{.Summary}}</td></tr>
+		{{end}}
+	</table>
+	<h2>Response codecs</h2>
+	<p>Chosen per request by the Accept header.</p>
+	<ul>
+		{{range .Codecs}}<li><code>{{.Name}}</code> ({{.ContentType}}){{if .Default}}, the default{{end}}</li>
+		{{end}}
+	</ul>
+	<h2>History export formats</h2>
+	<ul>
+		{{range .Exports}}<li><a href="/api/stats/export?format={{.Format}}">{{.Format}}</a> ({{.ContentType}})</li>
+		{{end}}
+	</ul>
+	<h2>Slow request captures</h2>
+	<p>Attached to the archive entry of a request slower than -slow-threshold.</p>
+	<ul>
+		{{range .Artifacts}}<li><code>{{.Name}}</code> ({{.ContentType}}): {{.Summary}}</li>
+		{{end}}
+	</ul>
+	<h2>Subtleties</h2>
+	<ul>
+		{{range .Subtleties}}<li><a href="/debug/subtleties#{{.Name}}"><code>{{.Name}}</code></a>: {{.Summary}}</li>
+		{{end}}
+	</ul>
+	<h2>Flags</h2>
+	<table>
+		{{range .Flags}}<tr><td><code>-{{.Name}}</code></td><td><code>{{.Value}}</code></td><td>{{.Usage}}{{if ne .Value .Default}} (default {{.Default}}){{end}}</td></tr>
+		{{end}}
+	</table>
+</body>
+</html>
+`))
+
+// guideHandler serves the usage guide, as HTML to browsers and through the
+// response codecs otherwise.
+// /debug/guide?format=html
+func guideHandler(w http.ResponseWriter, r *http.Request) {
+	g := buildGuide()
+	format := r.URL.Query().Get("format")
+	if format == "html" || format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := guidePage.Execute(w, g); err != nil {
+			fmt.Fprintln(w, err)
+		}
+		return
+	}
+	respond.Write(w, r, g)
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
-	"encoding/json"
+	"cmp"
 	"fmt"
-	"math/rand"
+	"log"
+	"log/slog"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/export"
+	"github.com/vdntruong/gosamurai/examples/webpprof/memlimit"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/timing"
 )
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
@@ -19,10 +28,13 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 			<h2>API Endpoints</h2>
 			<ul>
 				<li><a href="/api/users?count=100">Create 100 Users</a></li>
+				<li><a href="/api/users/lookup?count=100">Look Up 100 Users One by One</a></li>
 				<li><a href="/api/compute?iterations=1000000">CPU Intensive Task</a></li>
 				<li><a href="/api/allocate?size=1000">Memory Allocation</a></li>
 				<li><a href="/api/leak?count=10">Simulate Goroutine Leak</a></li>
 				<li><a href="/api/stats">Application Statistics</a></li>
+				<li><a href="/admin">Admin Dashboard</a></li>
+				<li><a href="/debug/guide">Usage Guide</a></li>
 			</ul>
 			<h2>pprof Profiles</h2>
 			<ul>
@@ -40,11 +52,19 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func createUsersHandler(w http.ResponseWriter, r *http.Request) {
-	count := 100
-	if c := r.URL.Query().Get("count"); c != "" {
-		fmt.Sscanf(c, "%d", &count)
+	count, ok := intParam(w, r, "count", 100, maxUsers)
+	if !ok {
+		return
 	}
 
+	ctx := r.Context()
+	if err := memlimit.Reserve(ctx, int64(count)*userSizeEstimate, "users"); err != nil {
+		rejectMemory(w, err)
+		return
+	}
+
+	generateStart := time.Now()
+	rng := random.Next("users")
 	users := make([]*User, count)
 	for i := 0; i < count; i++ {
 		user := &User{
@@ -55,27 +75,77 @@ func createUsersHandler(w http.ResponseWriter, r *http.Request) {
 			Metadata: map[string]interface{}{
 				"role":   "user",
 				"active": true,
-				"score":  rand.Intn(100),
+				"score":  rng.IntN(100),
 			},
 		}
 		users[i] = user
+	}
+	archive.Track(ctx, "generate", generateStart)
 
-		// Store in cache
-		cacheMu.Lock()
+	// Store in cache with one lock acquisition for the whole batch
+	cacheStart := time.Now()
+	added := 0
+	lockStart := time.Now()
+	cacheMu.Lock()
+	timing.LockWait(ctx, lockStart)
+	for _, user := range users {
+		if _, ok := userCache[user.ID]; !ok {
+			added++
+		}
 		userCache[user.ID] = user
-		cacheMu.Unlock()
 	}
+	cacheMu.Unlock()
+	archive.Track(ctx, "cache", cacheStart)
 
-	incrementCounter()
+	slog.InfoContext(ctx, "created users", "count", count, "added", added)
+
+	requestCount.Inc()
+	updateStats(func(s *statsSnapshot) {
+		s.CacheSize += added
+		s.UsersCreated += uint64(count)
+	})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	respond.Write(w, r, map[string]interface{}{
 		"status":  "success",
 		"count":   count,
 		"message": fmt.Sprintf("Created %d users", count),
 	})
 }
 
+// lookupUsersHandler fetches users from the cache one at a time, the way a
+// handler resolving IDs in a loop would. Each lookup is archived as its own
+// "cache.get" phase, so /debug/requests/repeats reports it as a batching
+// candidate. It looks up at most a million users.
+func lookupUsersHandler(w http.ResponseWriter, r *http.Request) {
+	count, ok := intParam(w, r, "count", 100, 1_000_000)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	users := make([]*User, 0, count)
+	for id := 1; id <= count; id++ {
+		if clientGone(w, r, "cache.get") {
+			return
+		}
+		start := time.Now()
+		cacheMu.Lock()
+		timing.LockWait(ctx, start)
+		user, ok := userCache[id]
+		cacheMu.Unlock()
+		archive.Track(ctx, "cache.get", start)
+		cacheKey("users", strconv.Itoa(id))
+		if ok {
+			users = append(users, user)
+		}
+	}
+	slog.InfoContext(ctx, "looked up users", "requested", count, "found", len(users))
+
+	incrementCounter()
+
+	respond.Write(w, r, users)
+}
+
 func computeHandler(w http.ResponseWriter, r *http.Request) {
 	iterations := 1000000
 	if i := r.URL.Query().Get("iterations"); i != "" {
@@ -83,13 +153,17 @@ func computeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	start := time.Now()
-	result := fibonacciCompute(iterations)
+	result, err := fibonacciCompute(r.Context(), iterations)
 	duration := time.Since(start)
+	archive.Track(r.Context(), "compute", start)
+	if err != nil && clientGone(w, r, "compute") {
+		return
+	}
+	slog.InfoContext(r.Context(), "computed fibonacci", "iterations", iterations, "duration", duration)
 
 	incrementCounter()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	respond.Write(w, r, map[string]interface{}{
 		"status":     "success",
 		"iterations": iterations,
 		"result":     result,
@@ -98,28 +172,39 @@ func computeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func allocateHandler(w http.ResponseWriter, r *http.Request) {
-	size := 1000
-	if s := r.URL.Query().Get("size"); s != "" {
-		fmt.Sscanf(s, "%d", &size)
+	size, ok := intParam(w, r, "size", 1000, maxAllocateMB)
+	if !ok {
+		return
+	}
+
+	if err := memlimit.Reserve(r.Context(), int64(size)<<20, "allocate"); err != nil {
+		rejectMemory(w, err)
+		return
 	}
 
 	// Allocate large slices to stress memory
+	start := time.Now()
+	rng := random.Next("allocate")
 	var data [][]byte
 	for i := 0; i < size; i++ {
+		if clientGone(w, r, "allocate") {
+			return // data is garbage as soon as the handler returns
+		}
 		chunk := make([]byte, 1024*1024) // 1MB per chunk
 		for j := range chunk {
-			chunk[j] = byte(rand.Intn(256))
+			chunk[j] = byte(rng.IntN(256))
 		}
 		data = append(data, chunk)
 	}
+	archive.Track(r.Context(), "allocate", start)
+	slog.InfoContext(r.Context(), "allocated memory", "size_mb", size)
 
 	incrementCounter()
 
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	respond.Write(w, r, map[string]interface{}{
 		"status":         "success",
 		"allocated_mb":   size,
 		"heap_alloc_mb":  memStats.HeapAlloc / 1024 / 1024,
@@ -143,11 +228,11 @@ func goroutineLeakHandler(w http.ResponseWriter, r *http.Request) {
 			<-ch // Block forever
 		}(i)
 	}
+	slog.WarnContext(r.Context(), "leaked goroutines", "count", count)
 
 	incrementCounter()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	respond.Write(w, r, map[string]interface{}{
 		"status":            "success",
 		"leaked_goroutines": count,
 		"total_goroutines":  runtime.NumGoroutine(),
@@ -159,22 +244,101 @@ func statsHandler(w http.ResponseWriter, r *http.Request) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	cacheMu.RLock()
-	cacheSize := len(userCache)
-	cacheMu.RUnlock()
+	// One atomic load gives a consistent view of every counter
+	stats := loadStats()
 
-	countMu.Lock()
-	count := requestCount
-	countMu.Unlock()
+	var captured, skipped uint64
+	if slowCapture != nil {
+		captured, skipped = slowCapture.Stats()
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"goroutines":     runtime.NumGoroutine(),
-		"heap_alloc_mb":  memStats.HeapAlloc / 1024 / 1024,
-		"total_alloc_mb": memStats.TotalAlloc / 1024 / 1024,
-		"sys_mb":         memStats.Sys / 1024 / 1024,
-		"gc_runs":        memStats.NumGC,
-		"cache_size":     cacheSize,
-		"request_count":  count,
+	respond.Write(w, r, &Stats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocMB:    memStats.HeapAlloc / 1024 / 1024,
+		TotalAllocMB:   memStats.TotalAlloc / 1024 / 1024,
+		SysMB:          memStats.Sys / 1024 / 1024,
+		GCRuns:         memStats.NumGC,
+		CacheSize:      stats.CacheSize,
+		RequestCount:   stats.RequestCount,
+		UsersCreated:   stats.UsersCreated,
+		CacheEvictions: stats.Evictions,
+		StatsUpdatedAt: stats.UpdatedAt,
+		Latency:        requestLatency.Snapshot(),
+		SlowCaptured:   captured,
+		SlowSkipped:    skipped,
+		ClientGone:     stats.ClientGone,
+		Routes:         routeTimings.Snapshot(),
+		Sessions:       sessions.Stats(),
+		Memory:         memLimiter.Stats(),
+		Pressure:       currentPressure(),
+		Process:        currentProcess(),
 	})
 }
+
+func statsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	respond.Write(w, r, history.all())
+}
+
+// sloRow is an slo.Report flattened into export columns.
+type sloRow struct {
+	Time            time.Time     `json:"time" parquet:"time,timestamp(millisecond)"`
+	Route           string        `json:"route" parquet:"route"`
+	Objective       string        `json:"objective" parquet:"objective"`
+	Target          float64       `json:"target" parquet:"target"`
+	Latency         time.Duration `json:"latency_ns" parquet:"latency_ns"`
+	Requests        uint64        `json:"requests" parquet:"requests"`
+	Bad             uint64        `json:"bad" parquet:"bad"`
+	Compliance      float64       `json:"compliance" parquet:"compliance"`
+	BudgetRemaining float64       `json:"budget_remaining" parquet:"budget_remaining"`
+	// Firing is the names of the firing alerts, separated by commas.
+	Firing string `json:"firing" parquet:"firing"`
+}
+
+func sloRows(now time.Time) []sloRow {
+	var rows []sloRow
+	for _, rep := range sloTracker.Reports(now) {
+		rows = append(rows, sloRow{
+			Time: now, Route: rep.Route, Objective: rep.Objective, Target: rep.Target, Latency: rep.Latency,
+			Requests: rep.Requests, Bad: rep.Bad, Compliance: rep.Compliance, BudgetRemaining: rep.BudgetRemaining,
+			Firing: strings.Join(rep.Firing, ","),
+		})
+	}
+	return rows
+}
+
+// statsExportHandler writes one table for offline analysis: the stats
+// history, the requests in the archive, newest first, or the SLO reports as
+// of now.
+func statsExportHandler(w http.ResponseWriter, r *http.Request) {
+	table := cmp.Or(r.URL.Query().Get("table"), "stats")
+	if table != "stats" && table != "requests" && table != "slo" {
+		http.Error(w, "table must be stats, requests, or slo", http.StatusBadRequest)
+		return
+	}
+	format := export.CSV
+	if f := r.URL.Query().Get("format"); f != "" {
+		parsed, err := export.ParseFormat(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format = parsed
+	}
+
+	now := time.Now()
+	filename := fmt.Sprintf("%s-%s.%s", table, now.Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	var err error
+	switch table {
+	case "requests":
+		err = export.Write(w, format, requestArchive.Recent(*archiveSize, nil))
+	case "slo":
+		err = export.Write(w, format, sloRows(now))
+	default:
+		err = export.Write(w, format, history.all())
+	}
+	if err != nil {
+		log.Printf("export %s: %v", table, err)
+	}
+}
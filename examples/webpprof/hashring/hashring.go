@@ -0,0 +1,235 @@
+// Package hashring implements consistent hashing: nodes are placed on a ring
+// at many pseudo-random points (virtual nodes) and a key belongs to the
+// first node clockwise from its hash, so adding or removing a node only
+// moves the keys next to that node's points.
+package hashring
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultVirtualNodes is the number of ring points per node when New is
+// given zero. More points balance load more evenly at the cost of memory
+// and lookup time.
+const DefaultVirtualNodes = 128
+
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring is safe for concurrent use.
+type Ring struct {
+	vnodes int
+
+	mu     sync.RWMutex
+	points []point // sorted by hash
+	nodes  map[string]bool
+}
+
+// New returns an empty ring placing each node at vnodes points.
+func New(vnodes int) *Ring {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	return &Ring{vnodes: vnodes, nodes: make(map[string]bool)}
+}
+
+// Hash is the ring position of a key or virtual node label: 64-bit FNV-1a
+// followed by a mixing step, since FNV alone spreads similar keys poorly.
+func Hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	// splitmix64 finalizer
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Rebalance describes a change of the ring's membership.
+type Rebalance struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// Moved is the share of the key space whose owner changed, which is
+	// also the expected share of keys that have to move.
+	Moved float64 `json:"moved"`
+	// Points is the number of ring points after the change.
+	Points int `json:"points"`
+	// Duration is how long rebuilding the ring took.
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Add adds nodes to the ring; nodes already on it are ignored.
+func (r *Ring) Add(nodes ...string) Rebalance {
+	return r.change(nodes, nil)
+}
+
+// Remove removes nodes from the ring; unknown nodes are ignored.
+func (r *Ring) Remove(nodes ...string) Rebalance {
+	return r.change(nil, nodes)
+}
+
+func (r *Ring) change(add, remove []string) Rebalance {
+	start := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rb Rebalance
+	for _, n := range add {
+		if !r.nodes[n] {
+			r.nodes[n] = true
+			rb.Added = append(rb.Added, n)
+		}
+	}
+	for _, n := range remove {
+		if r.nodes[n] {
+			delete(r.nodes, n)
+			rb.Removed = append(rb.Removed, n)
+		}
+	}
+
+	old := r.points
+	points := make([]point, 0, len(r.nodes)*r.vnodes)
+	for n := range r.nodes {
+		for i := range r.vnodes {
+			points = append(points, point{Hash(n + "#" + strconv.Itoa(i)), n})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		if a.hash != b.hash {
+			return cmp.Compare(a.hash, b.hash)
+		}
+		return cmp.Compare(a.node, b.node) // deterministic on collisions
+	})
+	r.points = points
+
+	rb.Moved = moved(old, points)
+	rb.Points = len(points)
+	rb.Duration = time.Since(start)
+	return rb
+}
+
+// Get returns the node owning key, or "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	return r.points[r.search(Hash(key))].node
+}
+
+// GetN returns up to n distinct nodes for key in ring order: the owner
+// first, then the nodes that would take over if it left. They are where
+// replicas of the key go.
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n = min(n, len(r.nodes))
+	if n <= 0 {
+		return nil
+	}
+	out := make([]string, 0, n)
+	for i, start := 0, r.search(Hash(key)); len(out) < n && i < len(r.points); i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if !slices.Contains(out, node) {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// search returns the index of the first point at or after h, wrapping
+// around to 0.
+func (r *Ring) search(h uint64) int {
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int { return cmp.Compare(p.hash, h) })
+	if i == len(r.points) {
+		return 0
+	}
+	return i
+}
+
+// Nodes returns the ring's nodes, sorted.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make([]string, 0, len(r.nodes))
+	for n := range r.nodes {
+		nodes = append(nodes, n)
+	}
+	slices.Sort(nodes)
+	return nodes
+}
+
+// Shares returns the share of the key space each node owns; with enough
+// virtual nodes every share is close to 1/len(nodes).
+func (r *Ring) Shares() map[string]float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	shares := make(map[string]float64, len(r.nodes))
+	for i, p := range r.points {
+		// A point owns the arc from the previous point up to itself.
+		prev := r.points[(i+len(r.points)-1)%len(r.points)].hash
+		shares[p.node] += arc(prev, p.hash)
+	}
+	return shares
+}
+
+// arc is the share of the ring from a (exclusive) to b (inclusive).
+func arc(a, b uint64) float64 {
+	if a == b {
+		return 1 // a single point owns the whole ring
+	}
+	return float64(b-a) / (1 << 64) // wraps around correctly
+}
+
+// moved returns the share of the key space owned by a different node in
+// after than in before.
+func moved(before, after []point) float64 {
+	if len(before) == 0 || len(after) == 0 {
+		if len(before) == 0 && len(after) == 0 {
+			return 0
+		}
+		return 1
+	}
+	// Walk the union of both point sets; between two consecutive
+	// boundaries each ring has a single owner, the next point clockwise.
+	bounds := make([]uint64, 0, len(before)+len(after))
+	for _, p := range before {
+		bounds = append(bounds, p.hash)
+	}
+	for _, p := range after {
+		bounds = append(bounds, p.hash)
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	owner := func(points []point, h uint64) string {
+		i, _ := slices.BinarySearchFunc(points, h, func(p point, h uint64) int { return cmp.Compare(p.hash, h) })
+		return points[i%len(points)].node
+	}
+	if len(bounds) == 1 {
+		if owner(before, bounds[0]) != owner(after, bounds[0]) {
+			return 1
+		}
+		return 0
+	}
+	var share float64
+	for i, b := range bounds {
+		// The arc ending at b, inclusive, is owned by whoever owns b.
+		prev := bounds[(i+len(bounds)-1)%len(bounds)]
+		if owner(before, b) != owner(after, b) {
+			share += arc(prev, b)
+		}
+	}
+	return share
+}
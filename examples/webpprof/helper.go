@@ -1,13 +1,41 @@
 package main
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
 
-func fibonacciCompute(n int) uint64 {
+// intParam returns the query parameter name of r as an integer from 1 to
+// limit, or def when it is absent. Otherwise it fails the request with 400
+// and returns false. The bound keeps sizes computed from it from
+// overflowing before memlimit sees them.
+func intParam(w http.ResponseWriter, r *http.Request, name string, def, limit int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > limit {
+		http.Error(w, fmt.Sprintf("%s must be an integer from 1 to %d", name, limit), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// fibonacciCompute sums n rounds of fibonacci(20), stopping early with
+// ctx's error once ctx is done.
+func fibonacciCompute(ctx context.Context, n int) (uint64, error) {
 	var result uint64
 	for i := 0; i < n; i++ {
+		if i%100 == 0 && ctx.Err() != nil {
+			return result, ctx.Err()
+		}
 		result += fibonacci(20)
 	}
-	return result
+	return result, nil
 }
 
 func fibonacci(n int) uint64 {
@@ -18,25 +46,39 @@ func fibonacci(n int) uint64 {
 }
 
 func incrementCounter() {
-	countMu.Lock()
-	requestCount++
-	countMu.Unlock()
+	requestCount.Inc()
 }
 
-func backgroundWorker() {
+// backgroundWorker evicts a cached user every five seconds while the cache
+// holds more than 10000, until ctx is done.
+func backgroundWorker(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		// Simulate background work
+		evicted := 0
 		cacheMu.Lock()
 		// Clean old entries if cache is too large
 		if len(userCache) > 10000 {
 			for id := range userCache {
 				delete(userCache, id)
+				evicted++
 				break // Delete one at a time
 			}
 		}
 		cacheMu.Unlock()
+
+		if evicted > 0 {
+			updateStats(func(s *statsSnapshot) {
+				s.CacheSize -= evicted
+				s.Evictions += uint64(evicted)
+			})
+		}
 	}
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/striped"
+)
+
+// latencyBuckets are the upper bounds of the request latency histogram.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+var requestLatency = newLatencyHistogram(latencyBuckets)
+
+// latencyHistogram records durations into fixed buckets. Every bucket is a
+// striped counter so concurrent requests do not serialize on one lock.
+type latencyHistogram struct {
+	bounds []time.Duration
+	counts []*striped.Counter // len(bounds)+1, the last one is +Inf
+}
+
+func newLatencyHistogram(bounds []time.Duration) *latencyHistogram {
+	h := &latencyHistogram{bounds: bounds}
+	for range len(bounds) + 1 {
+		h.counts = append(h.counts, striped.NewCounter())
+	}
+	return h
+}
+
+func (h *latencyHistogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Inc()
+}
+
+// Snapshot returns the bucket counts keyed by their upper bound.
+func (h *latencyHistogram) Snapshot() map[string]uint64 {
+	out := make(map[string]uint64, len(h.counts))
+	for i, c := range h.counts {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = h.bounds[i].String()
+		}
+		out[le] = c.Load()
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+)
+
+// statsSample is one point of the runtime stats history.
+type statsSample struct {
+	Time         time.Time `json:"time" parquet:"time,timestamp(millisecond)"`
+	Goroutines   int64     `json:"goroutines" parquet:"goroutines"`
+	HeapAllocMB  uint64    `json:"heap_alloc_mb" parquet:"heap_alloc_mb"`
+	TotalAllocMB uint64    `json:"total_alloc_mb" parquet:"total_alloc_mb"`
+	SysMB        uint64    `json:"sys_mb" parquet:"sys_mb"`
+	GCRuns       uint32    `json:"gc_runs" parquet:"gc_runs"`
+	PauseTotalNs uint64    `json:"pause_total_ns" parquet:"pause_total_ns"`
+	CacheSize    int64     `json:"cache_size" parquet:"cache_size"`
+	RequestCount uint64    `json:"request_count" parquet:"request_count"`
+	ClientGone   uint64    `json:"client_gone" parquet:"client_gone"`
+	// MemoryRejected counts requests refused by the memory limiter.
+	MemoryRejected uint64 `json:"memory_rejected" parquet:"memory_rejected"`
+	// CPUPressure, MemoryPressure, and IOPressure are the "some" avg10
+	// percentages of the process's cgroup, or the machine's outside one.
+	CPUPressure    float64 `json:"cpu_pressure" parquet:"cpu_pressure"`
+	MemoryPressure float64 `json:"memory_pressure" parquet:"memory_pressure"`
+	IOPressure     float64 `json:"io_pressure" parquet:"io_pressure"`
+	// RSSMB, OpenFDs, and Threads come from the operating system; they are
+	// zero where it does not report them.
+	RSSMB   uint64 `json:"rss_mb" parquet:"rss_mb"`
+	OpenFDs int64  `json:"open_fds" parquet:"open_fds"`
+	Threads int64  `json:"threads" parquet:"threads"`
+}
+
+// statsHistory is a fixed-size ring of samples, oldest first when read.
+type statsHistory struct {
+	mu      sync.Mutex
+	samples []statsSample
+	next    int
+	full    bool
+}
+
+func newStatsHistory(size int) *statsHistory {
+	return &statsHistory{samples: make([]statsSample, size)}
+}
+
+func (h *statsHistory) add(s statsSample) {
+	h.mu.Lock()
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+	h.mu.Unlock()
+}
+
+func (h *statsHistory) all() []statsSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]statsSample(nil), h.samples[:h.next]...)
+	}
+	out := make([]statsSample, 0, len(h.samples))
+	out = append(out, h.samples[h.next:]...)
+	return append(out, h.samples[:h.next]...)
+}
+
+// prepend puts older samples before the current ones, as if they had been
+// taken first; the oldest are dropped if they do not all fit.
+func (h *statsHistory) prepend(older []statsSample) {
+	all := append(older, h.all()...)
+	all = all[max(len(all)-len(h.samples), 0):]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clear(h.samples)
+	h.next = copy(h.samples, all) % len(h.samples)
+	h.full = len(all) == len(h.samples)
+}
+
+// sampleStats returns a sample and the process stats it was taken with.
+func sampleStats() (statsSample, *procstats.Stats) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	stats := loadStats()
+	mem := memLimiter.Stats()
+	cpuPressure, memoryPressure, ioPressure := pressureAvg10()
+	proc := currentProcess()
+	var ps procstats.Stats
+	if proc != nil {
+		ps = *proc
+	}
+
+	return statsSample{
+		Time:           time.Now(),
+		Goroutines:     int64(runtime.NumGoroutine()),
+		HeapAllocMB:    memStats.HeapAlloc / 1024 / 1024,
+		TotalAllocMB:   memStats.TotalAlloc / 1024 / 1024,
+		SysMB:          memStats.Sys / 1024 / 1024,
+		GCRuns:         memStats.NumGC,
+		PauseTotalNs:   memStats.PauseTotalNs,
+		CacheSize:      int64(stats.CacheSize),
+		RequestCount:   stats.RequestCount,
+		ClientGone:     stats.ClientGone,
+		MemoryRejected: mem.RejectedCeiling + mem.RejectedBudget,
+		CPUPressure:    cpuPressure,
+		MemoryPressure: memoryPressure,
+		IOPressure:     ioPressure,
+		RSSMB:          ps.RSS / 1024 / 1024,
+		OpenFDs:        int64(ps.FDs),
+		Threads:        int64(ps.Threads),
+	}, proc
+}
+
+// historyRecorder samples the runtime stats every interval until ctx is
+// done.
+func historyRecorder(ctx context.Context, h *statsHistory, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s, proc := sampleStats()
+		checkDescriptors(proc)
+		h.add(s)
+		persistSample(s)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/hotkeys"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// cacheKey records a cache lookup in hotCacheKeys. Keys are prefixed with
+// the cache they belong to, so one report covers every cache.
+func cacheKey(cache, key string) {
+	hotCacheKeys.Add(cache + "/" + key)
+}
+
+// decayHotKeys halves the hot key counts every interval, so the reports
+// weigh recent traffic most, until ctx is done.
+func decayHotKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		hotRoutes.Decay()
+		hotCacheKeys.Decay()
+	}
+}
+
+// hotKeysHandler reports the most requested routes and cache keys,
+// /debug/hotkeys?top=20&key=users/1&format=text
+func hotKeysHandler(w http.ResponseWriter, r *http.Request) {
+	top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+	if top <= 0 {
+		top = 20
+	}
+	routes, keys := hotRoutes.Report(top), hotCacheKeys.Report(top)
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeHotKeys(w, "Routes", routes)
+		fmt.Fprintln(w)
+		writeHotKeys(w, "Cache keys", keys)
+		return
+	}
+	resp := map[string]any{"routes": routes, "cache_keys": keys}
+	if key := r.URL.Query().Get("key"); key != "" {
+		resp["estimate"] = map[string]any{"key": key, "count": hotCacheKeys.Estimate(key)}
+	}
+	respond.Write(w, r, resp)
+}
+
+func writeHotKeys(w io.Writer, title string, r hotkeys.Report) {
+	fmt.Fprintf(w, "%s: %d counted since %s, counts at most %d too high\n",
+		title, r.Total, r.Since.Format(time.RFC3339), r.MaxError)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SHARE\tCOUNT\t KEY")
+	for _, k := range r.Keys {
+		fmt.Fprintf(tw, "%.1f%%\t%d\t %s\n", 100*k.Share, k.Count, k.Key)
+	}
+	tw.Flush()
+}
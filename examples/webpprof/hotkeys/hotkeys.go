@@ -0,0 +1,96 @@
+// Package hotkeys finds the most frequent keys of a stream, such as cache
+// keys or routes, in bounded memory. A Tracker counts keys in a count-min
+// sketch and keeps the keys with the largest estimates in a top-k heap, so
+// a skewed access pattern shows up without counting every key exactly.
+package hotkeys
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	sketch *CountMin
+	top    *TopK
+	since  time.Time
+}
+
+// New returns a tracker reporting the k most frequent keys. Its sketch
+// overcounts any key by at most 0.1% of the total with 99% probability.
+func New(k int) *Tracker {
+	return &Tracker{
+		sketch: NewCountMinError(0.001, 0.01),
+		top:    NewTopK(k),
+		since:  time.Now(),
+	}
+}
+
+// Add counts one occurrence of key.
+func (t *Tracker) Add(key string) {
+	t.mu.Lock()
+	t.top.Offer(key, t.sketch.Add(key, 1))
+	t.mu.Unlock()
+}
+
+// Estimate returns how often key was counted, never less than the truth.
+func (t *Tracker) Estimate(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sketch.Estimate(key)
+}
+
+// Decay halves all counts, so keys that were hot a while ago make room for
+// the ones hot now. Calling it every interval weighs recent traffic most.
+func (t *Tracker) Decay() {
+	t.mu.Lock()
+	t.sketch.Halve()
+	t.top.Halve()
+	t.mu.Unlock()
+}
+
+// Report is a snapshot of a tracker's hottest keys.
+type Report struct {
+	Since time.Time `json:"since"`
+	// Total is every count added, after decay.
+	Total uint64 `json:"total"`
+	// MaxError is how much any count may be too high, with 99%
+	// probability.
+	MaxError    uint64   `json:"max_error"`
+	Keys        []HotKey `json:"keys"`
+	SketchBytes int      `json:"sketch_bytes"`
+}
+
+// HotKey is one of the hottest keys. Share is Count as a fraction of
+// Total.
+type HotKey struct {
+	Key   string  `json:"key"`
+	Count uint64  `json:"count"`
+	Share float64 `json:"share"`
+}
+
+// Report returns the n hottest keys (all kept keys if n <= 0).
+func (t *Tracker) Report(n int) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	items := t.top.Top()
+	if n > 0 && n < len(items) {
+		items = items[:n]
+	}
+	r := Report{
+		Since:       t.since,
+		Total:       t.sketch.Total(),
+		MaxError:    t.sketch.ErrorBound(),
+		Keys:        make([]HotKey, len(items)),
+		SketchBytes: t.sketch.SizeBytes(),
+	}
+	for i, it := range items {
+		r.Keys[i] = HotKey{Key: it.Key, Count: it.Count}
+		if r.Total > 0 {
+			r.Keys[i].Share = float64(it.Count) / float64(r.Total)
+		}
+	}
+	return r
+}
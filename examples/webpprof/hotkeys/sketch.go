@@ -0,0 +1,91 @@
+package hotkeys
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// CountMin is a count-min sketch: depth rows of width counters, each row
+// indexed by a different hash of the key. A key's estimate is the smallest
+// of its counters, which never undercounts and overcounts by at most
+// e/width of the total with probability 1-exp(-depth).
+type CountMin struct {
+	width uint64
+	rows  [][]uint64
+	seed  maphash.Seed
+	total uint64
+}
+
+// NewCountMin returns a sketch with depth rows of width counters.
+func NewCountMin(width, depth int) *CountMin {
+	width, depth = max(width, 1), max(depth, 1)
+	rows := make([][]uint64, depth)
+	for i := range rows {
+		rows[i] = make([]uint64, width)
+	}
+	return &CountMin{width: uint64(width), rows: rows, seed: maphash.MakeSeed()}
+}
+
+// NewCountMinError returns a sketch overcounting by at most eps of the
+// total with probability 1-delta.
+func NewCountMinError(eps, delta float64) *CountMin {
+	return NewCountMin(int(math.Ceil(math.E/eps)), int(math.Ceil(math.Log(1/delta))))
+}
+
+// index returns the counter of key in row i. The rows use double hashing
+// of the two halves of one 64-bit hash.
+func (s *CountMin) index(h uint64, i int) uint64 {
+	h1, h2 := h&0xffffffff, h>>32|1
+	return (h1 + uint64(i)*h2) % s.width
+}
+
+// Add counts n occurrences of key and returns its new estimate.
+func (s *CountMin) Add(key string, n uint64) uint64 {
+	h := maphash.String(s.seed, key)
+	est := uint64(math.MaxUint64)
+	for i, row := range s.rows {
+		c := &row[s.index(h, i)]
+		*c += n
+		est = min(est, *c)
+	}
+	s.total += n
+	return est
+}
+
+// Estimate returns how often key was counted, never less than the truth.
+func (s *CountMin) Estimate(key string) uint64 {
+	h := maphash.String(s.seed, key)
+	est := uint64(math.MaxUint64)
+	for i, row := range s.rows {
+		est = min(est, row[s.index(h, i)])
+	}
+	return est
+}
+
+// Total is the sum of all counts.
+func (s *CountMin) Total() uint64 { return s.total }
+
+// Halve divides every counter by two, so old traffic fades.
+func (s *CountMin) Halve() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] /= 2
+		}
+	}
+	s.total /= 2
+}
+
+// ErrorBound is how much an estimate may exceed the truth: e/width of the
+// total, with probability 1-exp(-depth).
+func (s *CountMin) ErrorBound() uint64 {
+	return uint64(math.Ceil(math.E / float64(s.width) * float64(s.total)))
+}
+
+// SizeBytes is the memory taken by the counters.
+func (s *CountMin) SizeBytes() int { return len(s.rows) * int(s.width) * 8 }
+
+// Width is the number of counters per row.
+func (s *CountMin) Width() int { return int(s.width) }
+
+// Depth is the number of rows.
+func (s *CountMin) Depth() int { return len(s.rows) }
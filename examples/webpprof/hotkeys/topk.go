@@ -0,0 +1,99 @@
+package hotkeys
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// entry is one key of a TopK.
+type entry struct {
+	key   string
+	count uint64
+	index int
+}
+
+// minHeap orders the entries by count, smallest first.
+type minHeap []*entry
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h minHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *minHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *minHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// TopK keeps the k keys with the largest counts offered to it. It does not
+// count by itself: the counts come from a frequency sketch, so a key that
+// is not kept can still enter once its count passes the smallest kept one.
+type TopK struct {
+	k    int
+	keys map[string]*entry
+	heap minHeap
+}
+
+// NewTopK returns a TopK keeping k keys.
+func NewTopK(k int) *TopK {
+	k = max(k, 1)
+	return &TopK{k: k, keys: make(map[string]*entry, k), heap: make(minHeap, 0, k)}
+}
+
+// Offer records that key is now counted count times, keeping it if it is
+// among the k largest.
+func (t *TopK) Offer(key string, count uint64) {
+	if e, ok := t.keys[key]; ok {
+		e.count = count
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+	if len(t.heap) < t.k {
+		e := &entry{key: key, count: count}
+		heap.Push(&t.heap, e)
+		t.keys[key] = e
+		return
+	}
+	e := t.heap[0]
+	if count <= e.count {
+		return
+	}
+	delete(t.keys, e.key)
+	e.key, e.count = key, count
+	t.keys[key] = e
+	heap.Fix(&t.heap, 0)
+}
+
+// Halve divides every count by two, keeping the heap order.
+func (t *TopK) Halve() {
+	for _, e := range t.heap {
+		e.count /= 2
+	}
+}
+
+// Item is a kept key and its count.
+type Item struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// Top returns the kept keys, largest count first.
+func (t *TopK) Top() []Item {
+	items := make([]Item, 0, len(t.heap))
+	for _, e := range t.heap {
+		items = append(items, Item{Key: e.key, Count: e.count})
+	}
+	slices.SortFunc(items, func(a, b Item) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Key, b.Key))
+	})
+	return items
+}
@@ -0,0 +1,273 @@
+// Package logctl controls slog output while the process runs. Every logger
+// has a level and a sampling rule, which can be changed for good or for a
+// while: debug logging for one subsystem can be turned on during an
+// investigation and turns itself off again, and a noisy message is cut down
+// to the first few records of every second and one in many after that.
+//
+// A logger is named after the package that logs, or, in package main, after
+// the source file, so "handler" is every record logged from handler.go and
+// "capture" every record of the capture package. No call site has to change.
+package logctl
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default names the rule of loggers without one of their own.
+const Default = ""
+
+// sampleWindow is the interval Sampling.First counts per.
+const sampleWindow = time.Second
+
+// Sampling passes the first First records of each message every second and
+// then one in Every. Zero First does not sample; zero Every drops everything
+// after the first First.
+type Sampling struct {
+	First int `json:"first"`
+	Every int `json:"every"`
+}
+
+// Rule is a logger's level and sampling.
+type Rule struct {
+	Level    slog.Level `json:"level"`
+	Sampling Sampling   `json:"sampling"`
+	// Until is when a temporary rule expires; zero lasts.
+	Until time.Time `json:"until,omitzero"`
+}
+
+// Counts are what a logger has written and dropped by sampling.
+type Counts struct {
+	Logged  uint64 `json:"logged"`
+	Sampled uint64 `json:"sampled"`
+}
+
+// Status is the current configuration and the counts of every logger seen.
+type Status struct {
+	Default Rule              `json:"default"`
+	Loggers map[string]Rule   `json:"loggers"`
+	Seen    map[string]Counts `json:"seen"`
+}
+
+type rule struct {
+	Rule
+	// revert is the rule to go back to when a temporary one expires, nil to
+	// fall back on the default.
+	revert *Rule
+}
+
+// Controller holds the rules shared by every Handler made with it.
+type Controller struct {
+	mu     sync.Mutex
+	rules  map[string]rule // Default is always present
+	counts map[string]*Counts
+	window time.Time
+	seen   map[string]int // logger and message -> records this window
+	// nextExpiry is the earliest Until of the temporary rules, zero without
+	// any, so records logged before it skip looking for expired rules.
+	nextExpiry time.Time
+
+	// lowest is the lowest level any rule lets through, so Enabled can
+	// turn records down without taking the lock.
+	lowest atomic.Int64
+}
+
+// New returns a controller whose default rule is level and sampling.
+func New(level slog.Level, sampling Sampling) *Controller {
+	c := &Controller{
+		rules:  map[string]rule{Default: {Rule: Rule{Level: level, Sampling: sampling}}},
+		counts: make(map[string]*Counts),
+		seen:   make(map[string]int),
+	}
+	c.update()
+	return c
+}
+
+// Set sets the rule of logger, or the default with Default. With d above
+// zero the rule lasts for d, after which the logger goes back to its
+// previous rule.
+func (c *Controller) Set(logger string, r Rule, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := rule{Rule: r}
+	if d > 0 {
+		next.Until = time.Now().Add(d)
+		if prev, ok := c.rules[logger]; ok {
+			next.revert = prev.current()
+		}
+	}
+	c.rules[logger] = next
+	c.update()
+}
+
+// Reset removes logger's rule, so it follows the default again.
+func (c *Controller) Reset(logger string) {
+	if logger == Default {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rules, logger)
+	c.update()
+}
+
+// current returns the rule to keep when another replaces it for a while:
+// itself, or what it goes back to if it is temporary too.
+func (r rule) current() *Rule {
+	if r.Until.IsZero() {
+		return &r.Rule
+	}
+	return r.revert
+}
+
+// Status returns the rules in effect and the counts.
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	s := Status{Default: c.rules[Default].Rule, Loggers: make(map[string]Rule), Seen: make(map[string]Counts)}
+	for name, r := range c.rules {
+		if name != Default {
+			s.Loggers[name] = r.Rule
+		}
+	}
+	for name, n := range c.counts {
+		s.Seen[name] = *n
+	}
+	return s
+}
+
+// expire replaces the temporary rules that have run out. c.mu must be held.
+func (c *Controller) expire(now time.Time) {
+	if c.nextExpiry.IsZero() || now.Before(c.nextExpiry) {
+		return
+	}
+	changed := false
+	for name, r := range c.rules {
+		if r.Until.IsZero() || now.Before(r.Until) {
+			continue
+		}
+		// The default always has a rule to go back to, set by New.
+		if r.revert != nil {
+			c.rules[name] = rule{Rule: *r.revert}
+		} else {
+			delete(c.rules, name)
+		}
+		changed = true
+	}
+	if changed {
+		c.update()
+	}
+}
+
+// update recomputes lowest and nextExpiry after the rules changed. c.mu
+// must be held.
+func (c *Controller) update() {
+	lowest := c.rules[Default].Level
+	c.nextExpiry = time.Time{}
+	for _, r := range c.rules {
+		lowest = min(lowest, r.Level)
+		if !r.Until.IsZero() && (c.nextExpiry.IsZero() || r.Until.Before(c.nextExpiry)) {
+			c.nextExpiry = r.Until
+		}
+	}
+	c.lowest.Store(int64(lowest))
+}
+
+// allow reports whether a record of logger at level with msg is written,
+// and counts it.
+func (c *Controller) allow(logger string, level slog.Level, msg string) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+	r, ok := c.rules[logger]
+	if !ok {
+		r = c.rules[Default]
+	}
+	if level < r.Level {
+		return false
+	}
+	n := c.counts[logger]
+	if n == nil {
+		n = new(Counts)
+		c.counts[logger] = n
+	}
+	if s := r.Sampling; s.First > 0 {
+		if now.Sub(c.window) >= sampleWindow {
+			c.window = now
+			clear(c.seen)
+		}
+		key := logger + "\x00" + msg
+		c.seen[key]++
+		if k := c.seen[key] - s.First; k > 0 && (s.Every == 0 || k%s.Every != 0) {
+			n.Sampled++
+			return false
+		}
+	}
+	n.Logged++
+	return true
+}
+
+// Handler filters and samples records by the controller's rules before
+// passing them to the next handler, whose own level is not consulted.
+type Handler struct {
+	c    *Controller
+	next slog.Handler
+}
+
+// NewHandler returns a Handler that forwards to next.
+func NewHandler(c *Controller, next slog.Handler) *Handler {
+	return &Handler{c: c, next: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	// The logger is only known from the record; let through anything some
+	// rule might want and decide in Handle.
+	return int64(level) >= h.c.lowest.Load()
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.c.allow(loggerName(r.PC), r.Level, r.Message) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{c: h.c, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{c: h.c, next: h.next.WithGroup(name)}
+}
+
+// names caches loggerName by program counter.
+var names sync.Map
+
+// loggerName names the logger of the call at pc: the last element of its
+// package path, or its file name in package main.
+func loggerName(pc uintptr) string {
+	if pc == 0 {
+		return "unknown"
+	}
+	if name, ok := names.Load(pc); ok {
+		return name.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	fn := frame.Function
+	pkg := fn[strings.LastIndexByte(fn, '/')+1:]
+	pkg, _, _ = strings.Cut(pkg, ".")
+	name := pkg
+	if pkg == "main" && frame.File != "" {
+		name = strings.TrimSuffix(filepath.Base(frame.File), ".go")
+	}
+	names.Store(pc, name)
+	return name
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/logctl"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// logLevelHandler reports the log levels and sampling of every logger and
+// how much each has logged and dropped.
+// GET /debug/loglevel
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	respond.Write(w, r, logControl.Status())
+}
+
+// setLogLevelHandler changes the level and sampling of one logger, or of
+// every logger without a rule of its own when logger is empty, for good or,
+// with for, for a while:
+// PUT /debug/loglevel?logger=handler&level=debug&first=10&every=100&for=5m
+// PUT /debug/loglevel?logger=handler&reset=true
+func setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	logger := q.Get("logger")
+	if q.Get("reset") == "true" {
+		logControl.Reset(logger)
+		respond.Write(w, r, logControl.Status())
+		return
+	}
+	current := logControl.Status()
+	rule, ok := current.Loggers[logger]
+	if !ok {
+		rule = current.Default
+	}
+	rule.Until = time.Time{}
+	if v := q.Get("level"); v != "" {
+		if err := rule.Level.UnmarshalText([]byte(v)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for name, dst := range map[string]*int{"first": &rule.Sampling.First, "every": &rule.Sampling.Every} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("invalid %s %q", name, v), http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+	var d time.Duration
+	if v := q.Get("for"); v != "" {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid for %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	logControl.Set(logger, rule, d)
+	respond.Write(w, r, logControl.Status())
+}
+
+// logSampling returns the default sampling from -log-sample-first and
+// -log-sample-every.
+func logSampling() logctl.Sampling {
+	return logctl.Sampling{First: *logSampleFirst, Every: *logSampleEvery}
+}
@@ -1,62 +1,402 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	_ "net/http/pprof"
+
+	"github.com/vdntruong/gosamurai/randsource"
+	"github.com/vdntruong/gosamurai/throttle"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/breaker"
+	"github.com/vdntruong/gosamurai/examples/webpprof/capture"
+	"github.com/vdntruong/gosamurai/examples/webpprof/chaos"
+	"github.com/vdntruong/gosamurai/examples/webpprof/codec"
+	"github.com/vdntruong/gosamurai/examples/webpprof/filter"
+	"github.com/vdntruong/gosamurai/examples/webpprof/hotkeys"
+	"github.com/vdntruong/gosamurai/examples/webpprof/logctl"
+	"github.com/vdntruong/gosamurai/examples/webpprof/memlimit"
+	"github.com/vdntruong/gosamurai/examples/webpprof/pressure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/rbac"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/secure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/session"
+	"github.com/vdntruong/gosamurai/examples/webpprof/slo"
+	"github.com/vdntruong/gosamurai/examples/webpprof/tsdb"
 )
 
 var (
-	// Global state to demonstrate memory allocations
+	// Global state to demonstrate memory allocations. cacheMu guards the map
+	// contents only; counters live in appStats and requestCount.
 	userCache = make(map[int]*User)
-	cacheMu   sync.RWMutex
+	cacheMu   sync.Mutex
+
+	// Runtime stats history, sampled in the background
+	history *statsHistory
+
+	historyInterval = flag.Duration("history-interval", 5*time.Second, "stats history sampling interval")
+	historySize     = flag.Int("history-size", 720, "number of stats history samples to keep")
+	restoreFile     = flag.String("restore", "", "load cached users, sessions, and stats history from a snapshot saved by /admin/snapshot")
+	// Recently served requests, addressable by request ID
+	requestArchive *archive.Archive
+
+	// Tail-based capture of slow requests, nil when disabled
+	slowCapture *capture.Capturer
+
+	slowThreshold    = flag.Duration("slow-threshold", time.Second, "capture trace and goroutines of requests slower than this (0 disables)")
+	slowCooldown     = flag.Duration("slow-cooldown", 10*time.Second, "minimum time between two slow request captures")
+	traceWindow      = flag.Duration("trace-window", 10*time.Second, "how much recent execution trace a slow request capture keeps")
+	archiveSize      = flag.Int("archive-size", 1000, "number of requests kept in the request archive")
+	metricsDir       = flag.String("metrics-dir", "", "directory for the persistent metrics store (disabled if empty)")
+	metricsRetention = flag.Duration("metrics-retention", 7*24*time.Hour, "how long persisted metrics are kept")
+	selfTest         = flag.Bool("selftest", false, "check the port, profilers, directories, and limits this configuration needs, then exit")
+	propTest         = flag.Bool("proptest", false, "check the properties of the caches and snapshot columns against random operations, then exit")
+	propRuns         = flag.Int("proptest-runs", 200, "random inputs or operation sequences -proptest tries per property")
+	codecName        = flag.String("codec", codec.Default, "default response codec: "+strings.Join(codec.Names(), ", "))
+
+	// Visitor sessions, used by the admin dashboard login
+	sessions          *session.Manager
+	dashboardPassword string
+
+	sessionDir   = flag.String("session-dir", "", "directory for the on-disk session store (in memory if empty)")
+	sessionRedis = flag.String("session-redis", "", "keep sessions in the Redis server at this URL, redis://[:password@]host:port/db, instead of -session-dir")
+	sessionIdle  = flag.Duration("session-idle", 30*time.Minute, "end sessions idle for this long")
+	sessionMax   = flag.Duration("session-max", 12*time.Hour, "end sessions this long after they started")
+	adminPass    = flag.String("admin-password", "", "admin dashboard password (random and logged if empty)")
+
+	rbacConfig = flag.String("rbac-config", "", "JSON file of users, client certificates, and tokens with their roles (no access control if empty)")
+	tlsCert    = flag.String("tls-cert", "", "serve HTTPS with this certificate file")
+	tlsKey     = flag.String("tls-key", "", "private key file for -tls-cert")
+	clientCA   = flag.String("client-ca", "", "verify client certificates signed by this CA file (needs -tls-cert)")
+
+	// accessConfig is the loaded -rbac-config, nil without one
+	accessConfig *rbac.Config
+
+	// Memory reserved by requests in flight
+	memLimiter *memlimit.Limiter
+
+	requestMemory = flag.Int64("request-memory", 0, "most memory in MB one request may reserve, unless -rbac-config sets memory_mb for its principal (0 is unlimited)")
+	memoryBudget  = flag.Int64("memory-budget", 0, "most memory in MB the requests in flight may reserve together (0 is unlimited)")
+
+	// Cache stampede demo
+	stampede *stampedeDemo
+
+	stampedeTTL   = flag.Duration("stampede-ttl", time.Second, "TTL of the /api/stampede cache entries")
+	stampedeDelay = flag.Duration("stampede-delay", 200*time.Millisecond, "latency of the /api/stampede backend")
+
+	// TTL jitter and negative caching demo
+	catalog *catalogDemo
+
+	catalogSize        = flag.Int("catalog-size", 5000, "number of items that exist in /api/catalog")
+	catalogTTL         = flag.Duration("catalog-ttl", 10*time.Second, "TTL of /api/catalog cache entries")
+	catalogNegativeTTL = flag.Duration("catalog-negative-ttl", 5*time.Second, "how long /api/catalog caches missing items")
+	catalogJitter      = flag.Float64("catalog-jitter", 0.5, "share of the TTL the jittered /api/catalog cache may shorten entries by")
+	catalogFilter      = flag.String("catalog-filter", "", "membership filter skipping /api/catalog lookups of missing items: "+strings.Join(filter.Kinds, ", ")+" (none if empty)")
+	catalogFilterFPR   = flag.Float64("catalog-filter-fpr", 0.01, "false-positive rate of -catalog-filter")
+
+	// Fault injection into the stampede and catalog backends, and the
+	// circuit breakers in front of them
+	faults *chaos.Injector
+
+	breakerFailures = flag.Int("breaker-failures", 5, "consecutive backend failures that open the /api/stampede and /api/catalog circuit breakers")
+	breakerCooldown = flag.Duration("breaker-cooldown", 5*time.Second, "how long an open circuit breaker fails calls before it lets a probe through")
+
+	// Cache shards addressed by a consistent hashing ring
+	shardCache *shardedCache
+
+	shardCount    = flag.Int("shards", 4, "number of /api/shards cache shards")
+	shardVNodes   = flag.Int("shard-vnodes", 128, "virtual nodes per cache shard on the hash ring")
+	shardCapacity = flag.Int("shard-capacity", 10000, "entries per cache shard")
+
+	// Inverted index over generated users
+	userSearch *searchDemo
+
+	searchUsers = flag.Int("search-users", 100000, "number of generated users indexed by /api/users/search")
+
+	// Long polling
+	polls *pollHub
+
+	pollHold    = flag.Duration("poll-hold", 30*time.Second, "how long /api/poll waits for an event by default")
+	pollMaxHold = flag.Duration("poll-max-hold", 2*time.Minute, "longest hold a /api/poll client may ask for")
+
+	batchMax = flag.Int("batch-max", 100, "most operations accepted by one /api/batch request")
+
+	// Hot routes and cache keys, see /debug/hotkeys
+	hotRoutes    *hotkeys.Tracker
+	hotCacheKeys *hotkeys.Tracker
+
+	hotKeysTop   = flag.Int("hotkeys-top", 100, "number of hot routes and cache keys tracked")
+	hotKeysDecay = flag.Duration("hotkeys-decay", time.Minute, "halve the hot key counts this often (0 never forgets)")
+
+	// Service level objectives of the API routes, see /debug/slo
+	sloTracker *slo.Tracker
 
-	// Counter for operations
-	requestCount uint64
-	countMu      sync.Mutex
+	sloPeriod = flag.Duration("slo-period", 30*24*time.Hour, "period the SLO error budgets of the API routes last")
+
+	// Seeded random streams for generated data and TTL jitter
+	random *randsource.Source
+
+	seed = flag.Uint64("seed", 0, "seed for generated users, allocations, key picks, and TTL jitter (0 picks one and prints it)")
+
+	// Pressure stall information, nil when disabled
+	pressureMonitor *pressure.Monitor
+
+	pressureInterval  = flag.Duration("pressure-interval", 2*time.Second, "how often to read /proc/pressure and the cgroup's pressure files (0 disables)")
+	pressureThreshold = flag.Float64("pressure-threshold", 20, "some avg10 percentage above which a resource is under pressure")
+	pressureSustain   = flag.Duration("pressure-sustain", 30*time.Second, "how long pressure must stay above -pressure-threshold to be captured")
+
+	fdWarn = flag.Float64("fd-warn", 0.8, "share of the open file descriptor limit at which to warn and capture (0 disables)")
+
+	downloadRate  = flag.Float64("download-rate", 0, "bandwidth per client for profile and artifact downloads in MB/s (0 is unlimited)")
+	downloadBurst = flag.Float64("download-burst", 0, "download burst per client in MB (default one second of -download-rate)")
+
+	// Log levels and sampling, changed at run time through /debug/loglevel
+	logControl *logctl.Controller
+
+	logLevel       = flag.String("log-level", "info", "level of every logger: debug, info, warn, or error")
+	logSampleFirst = flag.Int("log-sample-first", 0, "log the first N records of each message per second, then sample (0 disables sampling)")
+	logSampleEvery = flag.Int("log-sample-every", 100, "after -log-sample-first, log one record in N of each message")
 )
 
 func main() {
-	fmt.Println("Starting Web Application with pprof profiling...")
-	fmt.Println("pprof endpoints available at http://localhost:8080/debug/pprof/")
-	fmt.Println("")
-	fmt.Println("Available endpoints:")
-	fmt.Println("  http://localhost:8080/              - Home page")
-	fmt.Println("  http://localhost:8080/api/users     - Create users (GET)")
-	fmt.Println("  http://localhost:8080/api/compute   - CPU intensive task (GET)")
-	fmt.Println("  http://localhost:8080/api/allocate  - Memory intensive task (GET)")
-	fmt.Println("  http://localhost:8080/api/leak      - Simulate goroutine leak (GET)")
-	fmt.Println("  http://localhost:8080/api/stats     - Application statistics (GET)")
-	fmt.Println("")
-	fmt.Println("pprof profiles:")
-	fmt.Println("  http://localhost:8080/debug/pprof/              - Index")
-	fmt.Println("  http://localhost:8080/debug/pprof/heap          - Heap profile")
-	fmt.Println("  http://localhost:8080/debug/pprof/goroutine     - Goroutines")
-	fmt.Println("  http://localhost:8080/debug/pprof/profile       - CPU profile (30s)")
-	fmt.Println("  http://localhost:8080/debug/pprof/block         - Block profile")
-	fmt.Println("  http://localhost:8080/debug/pprof/mutex         - Mutex profile")
-	fmt.Println("  http://localhost:8080/debug/pprof/threadcreate  - Thread creation")
-	fmt.Println("  http://localhost:8080/debug/pprof/allocs        - All memory allocations")
+	flag.Parse()
+	if *selfTest {
+		runSelfTest()
+	}
+	if *propTest {
+		runPropertyTests()
+	}
+
+	if *historySize < 1 {
+		log.Fatal("-history-size must be at least 1")
+	}
+	if *archiveSize < 1 {
+		log.Fatal("-archive-size must be at least 1")
+	}
+	if *shardCount < 1 || *shardCount > 64 {
+		log.Fatal("-shards must be between 1 and 64")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal("-log-level: ", err)
+	}
+	logControl = logctl.New(level, logSampling())
+	slog.SetDefault(slog.New(archive.NewLogHandler(logctl.NewHandler(logControl, slog.NewTextHandler(os.Stderr, nil)))))
+	random = randsource.New(*seed)
+	requestArchive = archive.New(*archiveSize)
+
+	if *slowThreshold > 0 {
+		sc, err := capture.New(capture.Config{
+			Threshold:   *slowThreshold,
+			Cooldown:    *slowCooldown,
+			TraceWindow: *traceWindow,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		slowCapture = sc
+	}
+
+	c, err := codec.Get(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	respond.SetDefault(c)
+
+	if *metricsDir != "" {
+		store, err := tsdb.Open(*metricsDir, tsdb.Options{Retention: *metricsRetention})
+		if err != nil {
+			log.Fatal(err)
+		}
+		metricsStore = store
+	}
+
+	var sessionStore session.Store = session.NewMemoryStore()
+	switch {
+	case *sessionDir != "" && *sessionRedis != "":
+		log.Fatal("-session-dir and -session-redis cannot be combined")
+	case *sessionDir != "":
+		fs, err := session.NewFileStore(*sessionDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessionStore = fs
+	case *sessionRedis != "":
+		// Redis drops a session nobody sweeps once it could not be alive
+		rs, err := session.NewRedisStore(*sessionRedis, *sessionMax)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessionStore = rs
+	}
+	sessions = session.NewManager(sessionStore, session.Config{
+		IdleTimeout: *sessionIdle,
+		MaxLifetime: *sessionMax,
+	})
+	dashboardPassword = adminPassword()
+	userSearch = newSearchDemo(*searchUsers)
+	memLimiter = memlimit.New(*memoryBudget << 20)
+	polls = newPollHub()
+	hotRoutes, hotCacheKeys = hotkeys.New(*hotKeysTop), hotkeys.New(*hotKeysTop)
+	sloTracker = slo.New(slo.Config{Period: *sloPeriod})
+	faults = chaos.New(random.Shared("chaos"), "stampede", "catalog")
+	stampede = newStampedeDemo(*stampedeTTL, *stampedeDelay, breaker.New(breaker.Config{Failures: *breakerFailures, Cooldown: *breakerCooldown}))
+	shardCache = newShardedCache(*shardCount, *shardVNodes, *shardCapacity)
+	var catalogMembers filter.Filter
+	if *catalogFilter != "" {
+		f, err := filter.New(*catalogFilter, *catalogSize, *catalogFilterFPR)
+		if err != nil {
+			log.Fatal(err)
+		}
+		catalogMembers = f
+	}
+	catalog = newCatalogDemo(*catalogSize, *catalogTTL, *catalogNegativeTTL, 20*time.Millisecond, *catalogJitter, catalogMembers, breaker.New(breaker.Config{
+		Failures:  *breakerFailures,
+		Cooldown:  *breakerCooldown,
+		IsFailure: catalogFailure,
+	}))
 
 	// Enable profiling for blocking and mutex
 	runtime.SetBlockProfileRate(1)
 	runtime.SetMutexProfileFraction(1)
 
 	// Setup routes
-	http.HandleFunc("/", homeHandler)
-	http.HandleFunc("/api/users", createUsersHandler)
-	http.HandleFunc("/api/compute", computeHandler)
-	http.HandleFunc("/api/allocate", allocateHandler)
-	http.HandleFunc("/api/leak", goroutineLeakHandler)
-	http.HandleFunc("/api/stats", statsHandler)
+	handle(groupWorkload, "/", "Home page", http.HandlerFunc(homeHandler))
+	handle(groupWorkload, "/api/users", "Create users", instrument(createUsersHandler))
+	handle(groupWorkload, "/api/users/lookup", "Look up users one at a time", instrument(lookupUsersHandler))
+	handle(groupWorkload, "/api/users/search", "Search generated users through an inverted index (?q=)", instrument(searchHandler))
+	handle(groupWorkload, "/api/compute", "CPU intensive task", instrument(computeHandler))
+	handle(groupWorkload, "/api/allocate", "Memory intensive task", instrument(allocateHandler))
+	handle(groupWorkload, "/api/leak", "Simulate goroutine leak", instrument(goroutineLeakHandler))
+	handle(groupWorkload, "/api/cache/compare", "Compare the LRU and weak caches", instrument(cacheCompareHandler))
+	handle(groupWorkload, "/api/stampede", "Read a hot key through a coalescing cache (coalesce=false to disable)", instrument(stampedeHandler))
+	handle(groupWorkload, "/api/catalog", "Look up an item through fixed and jittered TTL caches (?id=N)", instrument(catalogHandler))
+	handle(groupWorkload, "/api/filters/compare", "Compare Bloom and cuckoo filters", instrument(filtersCompareHandler))
+	handle(groupWorkload, "/api/shards", "Cache shards on a consistent hashing ring", instrument(shardsHandler))
+	handle(groupWorkload, "/api/shards/load", "Time ring lookups of random keys", instrument(shardsLoadHandler))
+	handle(groupWorkload, "/api/shards/resize", "Change the number of shards (?n=)", instrument(shardsResizeHandler))
+	handle(groupWorkload, "/api/batch", "Run several API calls with bounded parallelism (POST)", instrument(batchHandler))
+	handle(groupWorkload, "/api/poll", "Long poll for events (?since=N)", instrument(pollHandler))
+	handle(groupWorkload, "/api/poll/publish", "Publish an event to long pollers (?message=)", instrument(pollPublishHandler))
+
+	handle(groupStats, "/api/stats", "Application statistics", instrument(statsHandler))
+	handle(groupStats, "/api/stats/history", "Sampled statistics history", instrument(statsHistoryHandler))
+	handle(groupStats, "/api/stats/export", "Export history, archived requests, or SLO reports as CSV or Parquet (?table=stats|requests|slo&format=csv|parquet)", instrument(statsExportHandler))
+	handle(groupStats, "GET /metrics", "Statistics and pressure stall information for Prometheus", http.HandlerFunc(prometheusHandler))
+	handle(groupStats, "/api/metrics", "Persisted metric names (needs -metrics-dir)", instrument(metricsListHandler))
+	handle(groupStats, "/api/metrics/query", "Query persisted metrics (needs -metrics-dir)", instrument(metricsQueryHandler))
+	handle(groupStats, "/api/metrics/expr", "Evaluate max_over_time(goroutines[5m])-style expressions over persisted metrics (needs -metrics-dir)", instrument(metricsExprHandler))
+
+	handle(groupAdmin, "GET /admin", "Admin dashboard (login with -admin-password)", admin(requireAdmin(dashboardHandler)))
+	handle(groupAdmin, "GET /admin/login", "Login form", admin(loginFormHandler))
+	handle(groupAdmin, "POST /admin/login", "Log in", admin(loginHandler))
+	handle(groupAdmin, "POST /admin/logout", "Log out", admin(logoutHandler))
+	handle(groupAdmin, "GET /admin/snapshot", "Download cached users, sessions, and stats history for -restore", admin(requireAdmin(snapshotHandler)))
+
+	handle(groupDebug, "GET /debug/guide", "This usage guide, generated from the registries (HTML or JSON)", http.HandlerFunc(guideHandler))
+	handle(groupDebug, "GET /debug/contention", "Mutex contention ranked by lock site", http.HandlerFunc(contentionHandler))
+	handle(groupDebug, "GET /debug/goroutines/diff", "Goroutines gained over ?seconds= by pprof label and start function (?label=&format=text)", http.HandlerFunc(goroutineDiffHandler))
+	handle(groupDebug, "GET /debug/pressure", "CPU, memory, and I/O pressure stall information (Linux)", http.HandlerFunc(pressureHandler))
+	handle(groupDebug, "GET /debug/loglevel", "Log levels, sampling, and counts per logger", http.HandlerFunc(logLevelHandler))
+	handle(groupDebug, "PUT /debug/loglevel", "Change a logger's level and sampling (?logger=&level=&first=&every=&for=)", http.HandlerFunc(setLogLevelHandler))
+	handle(groupDebug, "GET /debug/chaos", "Faults injected into the stampede and catalog backends, and their circuit breakers", http.HandlerFunc(chaosHandler))
+	handle(groupDebug, "PUT /debug/chaos", "Inject a fault into a backend (?backend=&fault=slow|reset|timeout|serialization&rate=&latency=&for=, or &reset=true)", http.HandlerFunc(setChaosHandler))
+	handle(groupDebug, "GET /debug/subtleties", "Source of the Go subtleties, syntax highlighted (?name=)", http.HandlerFunc(subtletiesHandler))
+	handle(groupDebug, "GET /debug/events", "Event taxonomy, counts, and recent occurrences (?name=prefix)", http.HandlerFunc(eventsHandler))
+	handle(groupDebug, "GET /debug/supervisor", "Health, restarts, and last error of the background components", http.HandlerFunc(supervisorHandler))
+	handle(groupDebug, "GET /debug/hotkeys", "Most requested routes and cache keys", http.HandlerFunc(hotKeysHandler))
+	handle(groupDebug, "GET /debug/slo", "SLO compliance, error budgets, and burn rates of the API routes (?format=text)", http.HandlerFunc(sloHandler))
+	handle(groupDebug, "GET /debug/requests", "Recently archived requests", http.HandlerFunc(requestArchive.ListHandler))
+	handle(groupDebug, "GET /debug/requests/repeats", "Batching candidates found in the archive", http.HandlerFunc(requestArchive.RepeatsHandler))
+	handle(groupDebug, "GET /debug/requests/{id}", "One archived request by ID", http.HandlerFunc(requestArchive.RecordHandler))
+	handle(groupDebug, "GET /debug/requests/{id}/artifacts/{name}", "A captured artifact of an archived request", http.HandlerFunc(requestArchive.ArtifactHandler))
+	declareObjectives()
+
+	fmt.Println("Starting Web Application with pprof profiling...")
+	fmt.Println("pprof endpoints available at http://localhost:8080/debug/pprof/")
+	fmt.Printf("Default response codec: %s\n", c.Name())
+	fmt.Printf("Random seed: %d (repeat the run with -seed=%[1]d)\n", random.Seed())
+	fmt.Println("")
+	printRoutes("http://localhost:8080")
+	fmt.Println("pprof profiles:")
+	for _, p := range pprofProfiles() {
+		fmt.Printf("  http://localhost:8080/debug/pprof/%-14s - %s\n", p.Name, p.Summary)
+	}
 
 	// Start background workers
-	go backgroundWorker()
+	history = newStatsHistory(*historySize)
+	if *restoreFile != "" {
+		st, err := restoreSnapshot(*restoreFile)
+		if err != nil {
+			log.Fatal("restore: ", err)
+		}
+		fmt.Printf("Restored %d users, %d sessions, %d history samples from %s (%d MB) in %s, live heap +%d MB\n",
+			st.Users, st.Sessions, st.History, *restoreFile, st.Bytes>>20, st.Decode+st.Apply, st.HeapGrowth>>20)
+		slog.Info("restored snapshot", "file", *restoreFile, "users", st.Users, "sessions", st.Sessions, "history", st.History,
+			"bytes", st.Bytes, "decode", st.Decode, "apply", st.Apply, "heap_growth", st.HeapGrowth)
+	}
+	if *pressureInterval > 0 {
+		pressureMonitor = pressure.NewMonitor(pressure.Config{
+			Interval:    *pressureInterval,
+			Threshold:   *pressureThreshold,
+			Sustain:     *pressureSustain,
+			OnSustained: onSustainedPressure,
+		})
+	}
+	startComponents()
+
+	// Start server; security headers are chosen per route group
+	headers := secure.Groups{
+		"/api/":    secure.API,
+		"/admin":   secure.UI,
+		"/debug/":  secure.Debug,
+		"/metrics": secure.API,
+	}
+	var handler http.Handler = http.DefaultServeMux
+	if *downloadRate > 0 {
+		handler = throttleDownloads(handler, throttle.NewLimiter(int64(*downloadRate*1e6), int64(*downloadBurst*1e6)))
+	}
+	if *rbacConfig != "" {
+		cfg, err := rbac.Load(*rbacConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		accessConfig = cfg
+		handler = cfg.Policy(accessRules).Handler(handler)
+	}
 
-	// Start server
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Serve until the server fails or a signal arrives, then stop the
+	// background components, dependents first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- listen(":8080", headers.Handler(handler, secure.UI)) }()
+	var serveErr error
+	select {
+	case serveErr = <-served:
+	case <-ctx.Done():
+		fmt.Println("Shutting down background components...")
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := components.Shutdown(shutdownCtx); err != nil {
+		log.Print(err)
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
 }
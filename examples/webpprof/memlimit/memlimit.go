@@ -0,0 +1,149 @@
+// Package memlimit refuses requests before they allocate more memory than
+// they are allowed. Handlers declare what they are about to allocate with
+// Reserve; a request going over its own ceiling fails with 413, and one
+// that would take the process over its shared budget fails with 503. The
+// accounting trusts the handlers' estimates; it does not measure the heap.
+package memlimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	// ErrRequestTooLarge means the request alone needs more than its
+	// ceiling.
+	ErrRequestTooLarge = errors.New("memlimit: request exceeds its memory ceiling")
+	// ErrOverloaded means the request would fit its ceiling, but the
+	// requests in flight already hold the process's budget.
+	ErrOverloaded = errors.New("memlimit: memory budget exhausted")
+	// ErrNegative means the handler asked for a negative size, most likely
+	// one computed from unchecked input that overflowed.
+	ErrNegative = errors.New("memlimit: negative reservation")
+)
+
+// Error describes a refused reservation.
+type Error struct {
+	What string
+	// Requested is the size of the refused reservation, Reserved what the
+	// request held before it, and Limit the ceiling or budget it hit.
+	Requested, Reserved, Limit int64
+	Err                        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s needs %d bytes, %d reserved, limit %d", e.Err, e.What, e.Requested, e.Reserved, e.Limit)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Status is the HTTP status the request should fail with.
+func (e *Error) Status() int {
+	switch {
+	case errors.Is(e.Err, ErrOverloaded):
+		return http.StatusServiceUnavailable
+	case errors.Is(e.Err, ErrNegative):
+		return http.StatusBadRequest
+	}
+	return http.StatusRequestEntityTooLarge
+}
+
+// Stats counts reservations since the limiter was created.
+type Stats struct {
+	Budget int64 `json:"budget_bytes"`
+	InUse  int64 `json:"in_use_bytes"`
+	Peak   int64 `json:"peak_bytes"`
+	// Reserved is the reservations granted; RejectedCeiling and
+	// RejectedBudget the requests refused with 413 and 503.
+	Reserved        uint64 `json:"reserved"`
+	RejectedCeiling uint64 `json:"rejected_ceiling"`
+	RejectedBudget  uint64 `json:"rejected_budget"`
+}
+
+// Limiter holds the process-wide budget shared by all requests.
+type Limiter struct {
+	budget int64
+
+	inUse           atomic.Int64
+	peak            atomic.Int64
+	reserved        atomic.Uint64
+	rejectedCeiling atomic.Uint64
+	rejectedBudget  atomic.Uint64
+}
+
+// New returns a limiter letting the requests in flight reserve budget
+// bytes together (no limit if budget <= 0).
+func New(budget int64) *Limiter {
+	return &Limiter{budget: max(budget, 0)}
+}
+
+// Stats returns the limiter's counters.
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		Budget:          l.budget,
+		InUse:           l.inUse.Load(),
+		Peak:            l.peak.Load(),
+		Reserved:        l.reserved.Load(),
+		RejectedCeiling: l.rejectedCeiling.Load(),
+		RejectedBudget:  l.rejectedBudget.Load(),
+	}
+}
+
+// account is one request's reservations.
+type account struct {
+	l        *Limiter
+	ceiling  int64
+	reserved atomic.Int64
+}
+
+type contextKey struct{}
+
+// Middleware gives every request an account with the ceiling returned by
+// ceiling (no ceiling if <= 0), and returns its reservations to the budget
+// when the request ends.
+func (l *Limiter) Middleware(next http.Handler, ceiling func(*http.Request) int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := &account{l: l, ceiling: ceiling(r)}
+		defer func() { l.inUse.Add(-a.reserved.Load()) }()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, a)))
+	})
+}
+
+// Reserve records that the request in ctx is about to allocate n bytes for
+// what. It returns an *Error, and the request should fail with its Status,
+// if that takes the request over its ceiling or the process over its
+// budget, or if n is negative. Requests outside a Middleware are not
+// limited.
+func Reserve(ctx context.Context, n int64, what string) error {
+	if n < 0 {
+		return &Error{What: what, Requested: n, Err: ErrNegative}
+	}
+	a, _ := ctx.Value(contextKey{}).(*account)
+	if a == nil || n == 0 {
+		return nil
+	}
+	l := a.l
+	held := a.reserved.Load()
+	if a.ceiling > 0 && held+n > a.ceiling {
+		l.rejectedCeiling.Add(1)
+		return &Error{What: what, Requested: n, Reserved: held, Limit: a.ceiling, Err: ErrRequestTooLarge}
+	}
+	for {
+		in := l.inUse.Load()
+		if l.budget > 0 && in+n > l.budget {
+			l.rejectedBudget.Add(1)
+			return &Error{What: what, Requested: n, Reserved: held, Limit: l.budget, Err: ErrOverloaded}
+		}
+		if l.inUse.CompareAndSwap(in, in+n) {
+			for p := l.peak.Load(); in+n > p && !l.peak.CompareAndSwap(p, in+n); p = l.peak.Load() {
+			}
+			break
+		}
+	}
+	a.reserved.Add(n)
+	l.reserved.Add(1)
+	return nil
+}
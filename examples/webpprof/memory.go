@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/memlimit"
+	"github.com/vdntruong/gosamurai/examples/webpprof/rbac"
+)
+
+// userSizeEstimate is roughly what one generated User takes on the heap:
+// the struct, its strings, and its metadata map.
+const userSizeEstimate = 512
+
+// maxUsers and maxAllocateMB bound the count of /api/users and the size of
+// /api/allocate. They are far above any ceiling; memlimit refuses what is
+// too large, the bounds only keep the reservation from overflowing.
+const (
+	maxUsers      = 1 << 30
+	maxAllocateMB = 1 << 30
+)
+
+// requestMemoryCeiling is the most a request may reserve: the ceiling of
+// its principal or role in the -rbac-config file, or -request-memory.
+func requestMemoryCeiling(r *http.Request) int64 {
+	if accessConfig != nil {
+		if c, ok := accessConfig.MemoryCeiling(rbac.FromContext(r.Context())); ok {
+			return c
+		}
+	}
+	return int64(*requestMemory) << 20
+}
+
+// rejectMemory fails a request whose reservation was refused.
+func rejectMemory(w http.ResponseWriter, err error) {
+	status := http.StatusServiceUnavailable
+	var e *memlimit.Error
+	if errors.As(err, &e) {
+		status = e.Status()
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/tsdb"
+)
+
+// metricsStore persists the stats history when -metrics-dir is set.
+var metricsStore *tsdb.Store
+
+func (s statsSample) values() map[string]float64 {
+	return map[string]float64{
+		"goroutines":      float64(s.Goroutines),
+		"heap_alloc_mb":   float64(s.HeapAllocMB),
+		"total_alloc_mb":  float64(s.TotalAllocMB),
+		"sys_mb":          float64(s.SysMB),
+		"gc_runs":         float64(s.GCRuns),
+		"pause_total_ns":  float64(s.PauseTotalNs),
+		"cache_size":      float64(s.CacheSize),
+		"request_count":   float64(s.RequestCount),
+		"client_gone":     float64(s.ClientGone),
+		"memory_rejected": float64(s.MemoryRejected),
+		"cpu_pressure":    s.CPUPressure,
+		"memory_pressure": s.MemoryPressure,
+		"io_pressure":     s.IOPressure,
+		"rss_mb":          float64(s.RSSMB),
+		"open_fds":        float64(s.OpenFDs),
+		"threads":         float64(s.Threads),
+	}
+}
+
+func persistSample(s statsSample) {
+	if metricsStore == nil {
+		return
+	}
+	if err := metricsStore.Append(tsdb.Sample{Time: s.Time, Values: s.values()}); err != nil {
+		log.Printf("persist stats sample: %v", err)
+	}
+}
+
+func metricsListHandler(w http.ResponseWriter, r *http.Request) {
+	if metricsStore == nil {
+		http.Error(w, "metrics store disabled, start with -metrics-dir", http.StatusNotFound)
+		return
+	}
+	names, err := metricsStore.Metrics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respond.Write(w, r, names)
+}
+
+// metricsQueryHandler serves
+// /api/metrics/query?metric=goroutines&from=-1h&to=now&step=1m&agg=max
+func metricsQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if metricsStore == nil {
+		http.Error(w, "metrics store disabled, start with -metrics-dir", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	metric := q.Get("metric")
+	if metric == "" {
+		http.Error(w, "missing metric parameter", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	from, err := parseQueryTime(q.Get("from"), now.Add(-time.Hour), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseQueryTime(q.Get("to"), now, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var step time.Duration
+	if s := q.Get("step"); s != "" {
+		if step, err = time.ParseDuration(s); err != nil {
+			http.Error(w, "invalid step: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	agg, err := tsdb.ParseAggregation(q.Get("agg"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := metricsStore.Query(metric, from, to, step, agg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respond.Write(w, r, map[string]interface{}{
+		"metric": metric,
+		"from":   from,
+		"to":     to,
+		"step":   step.String(),
+		"agg":    agg,
+		"points": points,
+	})
+}
+
+// maxEvalPoints bounds the times one expression query evaluates at.
+const maxEvalPoints = 11000
+
+// metricsExprHandler serves
+// /api/metrics/expr?query=max_over_time(goroutines[5m])&from=-6h&step=1m, or
+// &at=2024-05-01T10:00:00Z&around=15m for the context of an incident. The
+// step defaults to a 250th of the range, at least a second.
+func metricsExprHandler(w http.ResponseWriter, r *http.Request) {
+	if metricsStore == nil {
+		http.Error(w, "metrics store disabled, start with -metrics-dir", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	expr, err := tsdb.ParseExpr(q.Get("query"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	var from, to time.Time
+	if at := q.Get("at"); at != "" {
+		t, err := parseQueryTime(at, now, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		around := 15 * time.Minute
+		if s := q.Get("around"); s != "" {
+			if around, err = time.ParseDuration(s); err != nil || around <= 0 {
+				http.Error(w, fmt.Sprintf("invalid around %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		from, to = t.Add(-around), t.Add(around)
+	} else {
+		if from, err = parseQueryTime(q.Get("from"), now.Add(-time.Hour), now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if to, err = parseQueryTime(q.Get("to"), now, now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "to is before from", http.StatusBadRequest)
+		return
+	}
+	step := max(to.Sub(from)/250, time.Second).Truncate(time.Second)
+	if s := q.Get("step"); s != "" {
+		if step, err = time.ParseDuration(s); err != nil || step <= 0 {
+			http.Error(w, fmt.Sprintf("invalid step %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Sub(from)/step >= maxEvalPoints {
+		http.Error(w, fmt.Sprintf("step %s gives more than %d points over %s", step, maxEvalPoints, to.Sub(from)), http.StatusBadRequest)
+		return
+	}
+
+	points, err := metricsStore.Eval(expr, from, to, step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respond.Write(w, r, map[string]interface{}{
+		"query":  expr.String(),
+		"from":   from,
+		"to":     to,
+		"step":   step.String(),
+		"points": points,
+	})
+}
+
+// parseQueryTime accepts RFC 3339, "now", or a duration relative to now such
+// as "-15m".
+func parseQueryTime(s string, def, now time.Time) (time.Time, error) {
+	switch {
+	case s == "":
+		return def, nil
+	case s == "now":
+		return now, nil
+	case strings.HasPrefix(s, "-"):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %w", s, err)
+		}
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/timing"
+)
+
+// routeTimings aggregates the per-request time breakdown by route.
+var routeTimings = timing.NewAggregator()
+
+// instrument records the latency of every request served by next, splits it
+// into phases, keeps it in the request archive, and captures it in detail
+// when it is slow, and counts it against its route's SLOs. Every request
+// is served within its visitor's session. Profile samples taken while
+// serving it carry a "handler" label with the route pattern.
+func instrument(next http.HandlerFunc) http.HandlerFunc {
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		hotRoutes.Add(r.Pattern)
+		pprof.Do(r.Context(), pprof.Labels("handler", r.Pattern), func(ctx context.Context) {
+			next(w, r.WithContext(ctx))
+		})
+		requestLatency.Observe(time.Since(start))
+	})
+	h = timing.Middleware(routeTimings, h, func(r *http.Request, b timing.Breakdown) {
+		archive.FromContext(r.Context()).SetBreakdown(b.Map())
+	})
+	h = memLimiter.Middleware(h, requestMemoryCeiling)
+	h = sessions.Middleware(h)
+	if slowCapture != nil {
+		h = slowCapture.Middleware(h)
+	}
+	return sloTracker.Middleware(archive.Middleware(requestArchive, h)).ServeHTTP
+}
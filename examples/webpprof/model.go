@@ -1,6 +1,15 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/codec"
+	"github.com/vdntruong/gosamurai/examples/webpprof/memlimit"
+	"github.com/vdntruong/gosamurai/examples/webpprof/pressure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/session"
+	"github.com/vdntruong/gosamurai/examples/webpprof/timing"
+	"github.com/vdntruong/gosamurai/procstats"
+)
 
 // User represents a sample data structure
 type User struct {
@@ -10,3 +19,56 @@ type User struct {
 	CreatedAt time.Time              `json:"created_at"`
 	Metadata  map[string]interface{} `json:"metadata"`
 }
+
+// MarshalProto encodes u following the User message in model.proto.
+func (u *User) MarshalProto(p *codec.ProtoBuffer) {
+	p.Int64(1, int64(u.ID))
+	p.String(2, u.Name)
+	p.String(3, u.Email)
+	p.Timestamp(4, u.CreatedAt)
+}
+
+// Stats is the response of the statistics endpoint
+type Stats struct {
+	Goroutines     int               `json:"goroutines"`
+	HeapAllocMB    uint64            `json:"heap_alloc_mb"`
+	TotalAllocMB   uint64            `json:"total_alloc_mb"`
+	SysMB          uint64            `json:"sys_mb"`
+	GCRuns         uint32            `json:"gc_runs"`
+	CacheSize      int               `json:"cache_size"`
+	RequestCount   uint64            `json:"request_count"`
+	UsersCreated   uint64            `json:"users_created"`
+	CacheEvictions uint64            `json:"cache_evictions"`
+	StatsUpdatedAt time.Time         `json:"stats_updated_at"`
+	Latency        map[string]uint64 `json:"latency"`
+	SlowCaptured   uint64            `json:"slow_captured"`
+	SlowSkipped    uint64            `json:"slow_skipped"`
+	ClientGone     uint64            `json:"client_gone"`
+	// Routes, Sessions, Memory, Pressure, and Process are only encoded by the
+	// JSON and msgpack codecs.
+	Routes   map[string]timing.RouteStats `json:"routes"`
+	Sessions session.Stats                `json:"sessions"`
+	Memory   memlimit.Stats               `json:"memory"`
+	// Pressure is nil without PSI or with -pressure-interval=0.
+	Pressure *pressure.Reading `json:"pressure,omitempty"`
+	// Process is nil where the operating system's stats cannot be read.
+	Process *procstats.Stats `json:"process,omitempty"`
+}
+
+// MarshalProto encodes s following the Stats message in model.proto.
+func (s *Stats) MarshalProto(p *codec.ProtoBuffer) {
+	p.Int64(1, int64(s.Goroutines))
+	p.Uint64(2, s.HeapAllocMB)
+	p.Uint64(3, s.TotalAllocMB)
+	p.Uint64(4, s.SysMB)
+	p.Uint64(5, uint64(s.GCRuns))
+	p.Int64(6, int64(s.CacheSize))
+	p.Uint64(7, s.RequestCount)
+	p.Uint64(8, s.UsersCreated)
+	p.Uint64(9, s.CacheEvictions)
+	p.Timestamp(10, s.StatsUpdatedAt)
+	p.MapStringUint64(11, s.Latency)
+	p.Uint64(12, s.SlowCaptured)
+	p.Uint64(13, s.SlowSkipped)
+	p.Uint64(14, s.ClientGone)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// Long polling holds a request open until there is something to say or the
+// hold time runs out, so the handler must notice when nobody is listening
+// any more. The context of the request is the only signal net/http gives,
+// and it has limits worth knowing:
+//
+//   - The server cancels r.Context() when it sees the client close the
+//     connection. It learns that from a background read the connection
+//     starts once the request body has been read, so a handler that leaves
+//     a body unread sees the disconnect late or not at all. Poll requests
+//     are GETs without a body, which is the easy case.
+//   - A client that vanishes without closing (a laptop lid, a dropped
+//     mobile link) leaves a half-open TCP connection. Nothing arrives, the
+//     read never fails, and the context stays alive. Only the hold time
+//     bounds such a request, which is why it always has one.
+//   - Behind a proxy or load balancer, the connection the server sees is
+//     the proxy's. A client disconnect reaches the handler only if the
+//     proxy closes its side too, and the proxy's idle timeout must be
+//     longer than the hold time or it cuts every poll short.
+//   - A write to a connection that is already gone usually succeeds: it
+//     lands in a buffer, and the error surfaces on a later write or not at
+//     all. Write errors are no disconnect detector.
+//   - http.Server.WriteTimeout counts from the end of the request headers,
+//     so it must exceed the hold time. A server with a short default can
+//     extend it for one request with http.ResponseController's
+//     SetWriteDeadline.
+
+// pollEvent is a message published to long-polling clients.
+type pollEvent struct {
+	Seq     uint64    `json:"seq"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// pollHub keeps the latest events and wakes the clients waiting for them.
+type pollHub struct {
+	mu     sync.Mutex
+	events []pollEvent // the last pollKeep, oldest first
+	seq    uint64
+	// wake is closed and replaced on every publish, waking every waiter at
+	// once.
+	wake chan struct{}
+
+	waiting      atomic.Int64
+	delivered    atomic.Uint64
+	timedOut     atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+const pollKeep = 100
+
+func newPollHub() *pollHub {
+	return &pollHub{wake: make(chan struct{})}
+}
+
+func (h *pollHub) publish(message string) pollEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := pollEvent{Seq: h.seq, Message: message, Time: time.Now()}
+	h.events = append(h.events, ev)
+	if len(h.events) > pollKeep {
+		h.events = h.events[len(h.events)-pollKeep:]
+	}
+	close(h.wake)
+	h.wake = make(chan struct{})
+	return ev
+}
+
+// after returns the events newer than since and the channel closed by the
+// next publish. missed reports that events after since were already
+// dropped.
+func (h *pollHub) after(since uint64) (events []pollEvent, missed bool, wake <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, ev := range h.events {
+		if ev.Seq > since {
+			events = append(events, h.events[i:]...)
+			missed = ev.Seq > since+1
+			break
+		}
+	}
+	return events, missed, h.wake
+}
+
+// wait returns the events newer than since, waiting up to hold for one to
+// be published. It returns ctx's error if the client goes away first.
+func (h *pollHub) wait(ctx context.Context, since uint64, hold time.Duration) ([]pollEvent, bool, error) {
+	events, missed, wake := h.after(since)
+	if len(events) > 0 {
+		return events, missed, nil
+	}
+
+	h.waiting.Add(1)
+	defer h.waiting.Add(-1)
+	timer := time.NewTimer(hold)
+	defer timer.Stop()
+	select {
+	case <-wake:
+		events, missed, _ = h.after(since)
+		return events, missed, nil
+	case <-timer.C:
+		return nil, false, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// pollHandler waits for events newer than since,
+// /api/poll?since=0&hold=30s
+func pollHandler(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	hold := *pollHold
+	if h, err := time.ParseDuration(r.URL.Query().Get("hold")); err == nil && h > 0 {
+		hold = min(h, *pollMaxHold)
+	}
+
+	ctx := r.Context()
+	start := time.Now()
+	events, missed, err := polls.wait(ctx, since, hold)
+	archive.Track(ctx, "poll.wait", start)
+	if err != nil {
+		// Nobody is left to answer; the response written now would go
+		// nowhere.
+		polls.disconnected.Add(1)
+		clientGone(w, r, "poll.wait")
+		return
+	}
+
+	next := since
+	if events == nil {
+		events = []pollEvent{}
+	}
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+		polls.delivered.Add(1)
+	} else {
+		polls.timedOut.Add(1)
+	}
+	incrementCounter()
+	respond.Write(w, r, map[string]any{
+		"events":    events,
+		"next":      next,
+		"missed":    missed,
+		"timed_out": len(events) == 0,
+		"held_ns":   time.Since(start),
+	})
+}
+
+// pollPublishHandler publishes an event to the waiting clients and reports
+// the poll counters, /api/poll/publish?message=hello
+func pollPublishHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{}
+	if msg := r.URL.Query().Get("message"); msg != "" {
+		resp["event"] = polls.publish(msg)
+	}
+	resp["waiting"] = polls.waiting.Load()
+	resp["delivered"] = polls.delivered.Load()
+	resp["timed_out"] = polls.timedOut.Load()
+	resp["disconnected"] = polls.disconnected.Load()
+	incrementCounter()
+	respond.Write(w, r, resp)
+}
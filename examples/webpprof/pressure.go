@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/pressure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// onSustainedPressure captures what the process was doing while a resource
+// stayed under pressure: with -slow-threshold set, the goroutines and the
+// flight recorder window go into the request archive under a pressure-
+// record, next to the slow requests the pressure may have caused.
+func onSustainedPressure(e pressure.Event) {
+	slowCapture.Episode(requestArchive, fmt.Sprintf("pressure-%s-%d", e.Resource, time.Now().Unix()), "PRESSURE", "/"+e.Scope+"/"+e.Resource,
+		events.PressureSustained, events.Resource, e.Resource, events.Scope, e.Scope,
+		events.Avg10, e.Avg10, events.Threshold, *pressureThreshold, events.Since, e.Since)
+}
+
+// currentPressure returns the latest reading, or nil when the monitor is off
+// or the kernel has no PSI.
+func currentPressure() *pressure.Reading {
+	if pressureMonitor == nil {
+		return nil
+	}
+	r, err := pressureMonitor.Latest()
+	if err != nil || r.Time.IsZero() {
+		return nil
+	}
+	return &r
+}
+
+// pressureAvg10 returns the "some" avg10 of each resource in the scope
+// closest to the process, zero without a reading.
+func pressureAvg10() (cpu, memory, io float64) {
+	r := currentPressure()
+	if r == nil {
+		return 0, 0, 0
+	}
+	_, s := r.Scope()
+	return s["cpu"].Some.Avg10, s["memory"].Some.Avg10, s["io"].Some.Avg10
+}
+
+// PressureStatus is the /debug/pressure response.
+type PressureStatus struct {
+	Reading   *pressure.Reading `json:"reading"`
+	Error     string            `json:"error,omitempty"`
+	Threshold float64           `json:"threshold"`
+	Sustain   string            `json:"sustain"`
+	Events    map[string]uint64 `json:"events"`
+}
+
+// pressureHandler reports the latest pressure reading and how often each
+// resource has been under sustained pressure.
+// /debug/pressure
+func pressureHandler(w http.ResponseWriter, r *http.Request) {
+	if pressureMonitor == nil {
+		http.Error(w, "pressure monitor disabled, start with -pressure-interval", http.StatusNotFound)
+		return
+	}
+	status := PressureStatus{
+		Reading:   currentPressure(),
+		Threshold: *pressureThreshold,
+		Sustain:   pressureSustain.String(),
+		Events:    pressureMonitor.Events(),
+	}
+	if _, err := pressureMonitor.Latest(); err != nil {
+		status.Error = err.Error()
+	}
+	respond.Write(w, r, status)
+}
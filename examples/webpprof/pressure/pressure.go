@@ -0,0 +1,288 @@
+// Package pressure reads Linux pressure stall information (PSI): the share
+// of wall time in which tasks were ready to run but waited for a CPU, for
+// memory (reclaim, swap-in, thrashing), or for I/O. It reads the machine's
+// from /proc/pressure and the process's cgroup's from its cpu.pressure,
+// memory.pressure, and io.pressure files.
+//
+// Runtime metrics say what the Go program did; PSI says what the kernel did
+// not let it do. A latency spike with flat GC and scheduler metrics but
+// rising CPU pressure is a noisy neighbour or a CPU quota, not the program.
+package pressure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resources are the PSI resources, in the order they are reported.
+var Resources = []string{"cpu", "memory", "io"}
+
+// Stall is one line of a pressure file. Some counts the time at least one
+// task stalled, full the time all non-idle tasks stalled at once.
+type Stall struct {
+	// Avg10, Avg60, and Avg300 are the percentage of the last 10, 60, and
+	// 300 seconds spent stalled.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Total is the stall time accumulated since boot or cgroup creation.
+	Total time.Duration `json:"total_ns"`
+}
+
+// Resource is the pressure on one resource.
+type Resource struct {
+	Some Stall `json:"some"`
+	// Full is zero for the machine's CPU, where it is not defined.
+	Full Stall `json:"full"`
+}
+
+// Scope holds the pressure of every resource as seen by the machine or by a
+// cgroup, keyed by Resources.
+type Scope map[string]Resource
+
+// Reading is the pressure at one point in time.
+type Reading struct {
+	Time   time.Time `json:"time"`
+	System Scope     `json:"system"`
+	// Cgroup is nil when the process is in the root cgroup, or its cgroup
+	// has no pressure files (cgroup v1).
+	Cgroup Scope `json:"cgroup,omitempty"`
+}
+
+// Scope returns the cgroup's pressure when there is one, as the closest to
+// the process, and the machine's otherwise, with the name of the scope.
+func (r Reading) Scope() (string, Scope) {
+	if r.Cgroup != nil {
+		return "cgroup", r.Cgroup
+	}
+	return "system", r.System
+}
+
+// Read reads the current pressure. It returns an error wrapping
+// errors.ErrUnsupported where the kernel has no PSI (not Linux, older than
+// 4.20, or booted with psi=0).
+func Read() (Reading, error) {
+	r := Reading{Time: time.Now()}
+	system, err := readScope("/proc/pressure", "")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, fmt.Errorf("pressure: no PSI in this kernel: %w", errors.ErrUnsupported)
+		}
+		return r, err
+	}
+	r.System = system
+	if dir := cgroupDir(); dir != "" {
+		if cg, err := readScope(dir, ".pressure"); err == nil {
+			r.Cgroup = cg
+		}
+	}
+	return r, nil
+}
+
+// readScope reads dir/<resource><suffix> for every resource.
+func readScope(dir, suffix string) (Scope, error) {
+	s := make(Scope, len(Resources))
+	for _, name := range Resources {
+		f, err := os.Open(filepath.Join(dir, name+suffix))
+		if err != nil {
+			return nil, err
+		}
+		res, err := parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("pressure: %s: %w", f.Name(), err)
+		}
+		s[name] = res
+	}
+	return s, nil
+}
+
+// parse reads the "some" and "full" lines of a pressure file:
+//
+//	some avg10=1.53 avg60=0.87 avg300=0.28 total=8413953
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parse(r io.Reader) (Resource, error) {
+	var res Resource
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var st *Stall
+		switch fields[0] {
+		case "some":
+			st = &res.Some
+		case "full":
+			st = &res.Full
+		default:
+			continue
+		}
+		for _, f := range fields[1:] {
+			key, value, _ := strings.Cut(f, "=")
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return res, fmt.Errorf("invalid %q", f)
+			}
+			switch key {
+			case "avg10":
+				st.Avg10 = v
+			case "avg60":
+				st.Avg60 = v
+			case "avg300":
+				st.Avg300 = v
+			case "total":
+				st.Total = time.Duration(v) * time.Microsecond
+			}
+		}
+	}
+	return res, sc.Err()
+}
+
+// cgroupDir returns the cgroup v2 directory of the process, or "" when it
+// is in the root cgroup, whose pressure is the machine's. On hybrid hosts
+// the v2 hierarchy is mounted at /sys/fs/cgroup/unified.
+func cgroupDir() string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		path, ok := strings.CutPrefix(line, "0::")
+		if !ok || path == "/" {
+			continue
+		}
+		for _, root := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+			dir := filepath.Join(root, path)
+			if _, err := os.Stat(filepath.Join(dir, "cpu.pressure")); err == nil {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+// Event is pressure that stayed above the threshold for the sustain period.
+type Event struct {
+	Resource string    `json:"resource"`
+	Scope    string    `json:"scope"`
+	Avg10    float64   `json:"avg10"`
+	Since    time.Time `json:"since"`
+}
+
+// Config configures a Monitor.
+type Config struct {
+	// Interval is how often the pressure is read.
+	Interval time.Duration
+	// Threshold is the "some" avg10 percentage above which a resource is
+	// under pressure.
+	Threshold float64
+	// Sustain is how long a resource must stay above Threshold, on every
+	// reading, before OnSustained is called.
+	Sustain time.Duration
+	// OnSustained is called once per episode of sustained pressure; the
+	// resource must drop below Threshold before it fires again.
+	OnSustained func(Event)
+}
+
+// Monitor reads the pressure in the background and keeps the latest reading.
+type Monitor struct {
+	cfg Config
+
+	mu     sync.Mutex
+	latest Reading
+	err    error
+	above  map[string]time.Time // resource -> first reading above the threshold
+	fired  map[string]bool
+	events map[string]uint64
+}
+
+// NewMonitor returns a monitor; Run starts it.
+func NewMonitor(cfg Config) *Monitor {
+	return &Monitor{
+		cfg:    cfg,
+		above:  make(map[string]time.Time),
+		fired:  make(map[string]bool),
+		events: make(map[string]uint64),
+	}
+}
+
+// Run reads the pressure every interval until ctx is done. It stops early,
+// keeping the error for Latest, if the kernel has no PSI.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		r, err := Read()
+		m.record(r, err)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) record(r Reading, err error) {
+	var fire []Event
+	m.mu.Lock()
+	m.err = err
+	if err == nil {
+		m.latest = r
+		scope, s := r.Scope()
+		for _, name := range Resources {
+			avg := s[name].Some.Avg10
+			if avg < m.cfg.Threshold {
+				delete(m.above, name)
+				m.fired[name] = false
+				continue
+			}
+			since, ok := m.above[name]
+			if !ok {
+				m.above[name] = r.Time
+				since = r.Time
+			}
+			if !m.fired[name] && r.Time.Sub(since) >= m.cfg.Sustain {
+				m.fired[name] = true
+				m.events[name]++
+				fire = append(fire, Event{Resource: name, Scope: scope, Avg10: avg, Since: since})
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if m.cfg.OnSustained != nil {
+		for _, e := range fire {
+			m.cfg.OnSustained(e)
+		}
+	}
+}
+
+// Latest returns the most recent reading, or the error of the most recent
+// attempt.
+func (m *Monitor) Latest() (Reading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latest, m.err
+}
+
+// Events returns how many episodes of sustained pressure each resource has
+// had.
+func (m *Monitor) Events() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.events)
+}
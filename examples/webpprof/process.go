@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/procstats"
+)
+
+// fdsHigh is set while the open descriptors are above -fd-warn, so the
+// warning fires once per episode. Only the history recorder touches it.
+var fdsHigh bool
+
+// currentProcess reads the process's RSS, descriptors, sockets, and threads,
+// nil where the platform has none of them.
+func currentProcess() *procstats.Stats {
+	s, err := procstats.Read()
+	if err != nil {
+		return nil
+	}
+	return &s
+}
+
+// checkDescriptors warns when the open descriptors pass -fd-warn of the
+// limit, which at the rate a leak grows is well before accept and dial start
+// failing with "too many open files". With -slow-threshold set it captures
+// the goroutines, which show what holds the connections, under an fds-
+// record in the request archive.
+func checkDescriptors(s *procstats.Stats) {
+	if s == nil || *fdWarn <= 0 || s.FDLimit == 0 {
+		return
+	}
+	high := s.FDUsage() >= *fdWarn
+	if !high || fdsHigh {
+		fdsHigh = high
+		return
+	}
+	fdsHigh = true
+	slowCapture.Episode(requestArchive, fmt.Sprintf("fds-%d", time.Now().Unix()), "FDS", "/process/fds",
+		events.DescriptorsHigh, events.FDs, s.FDs, events.Limit, s.FDLimit, events.Sockets, s.Sockets)
+}
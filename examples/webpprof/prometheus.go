@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/breaker"
+	"github.com/vdntruong/gosamurai/examples/webpprof/chaos"
+	"github.com/vdntruong/gosamurai/examples/webpprof/pressure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/slo"
+)
+
+// promWriter writes the Prometheus text exposition format.
+type promWriter struct {
+	*bufio.Writer
+}
+
+// family starts a metric family with its help text and type.
+func (p promWriter) family(name, kind, help string) {
+	fmt.Fprintf(p, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// value writes one sample; labels are name="value" pairs, already quoted.
+func (p promWriter) value(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(p, "%s%s %g\n", name, labels, v)
+}
+
+func (p promWriter) single(name, kind, help string, v float64) {
+	p.family(name, kind, help)
+	p.value(name, "", v)
+}
+
+// prometheusHandler serves the application, runtime, and process statistics
+// and the pressure stall information for Prometheus to scrape.
+// /metrics
+func prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := loadStats()
+	mem := memLimiter.Stats()
+	var captured uint64
+	if slowCapture != nil {
+		captured, _ = slowCapture.Stats()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p := promWriter{bufio.NewWriter(w)}
+	defer p.Flush()
+
+	p.single("webpprof_goroutines", "gauge", "Goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	p.single("webpprof_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.", float64(m.HeapAlloc))
+	p.single("webpprof_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(m.Sys))
+	p.single("webpprof_allocated_bytes_total", "counter", "Bytes allocated for heap objects.", float64(m.TotalAlloc))
+	p.single("webpprof_gc_cycles_total", "counter", "Completed GC cycles.", float64(m.NumGC))
+	p.single("webpprof_gc_pause_seconds_total", "counter", "Stop-the-world GC pause time.", time.Duration(m.PauseTotalNs).Seconds())
+	p.single("webpprof_requests_total", "counter", "Requests served by the workload endpoints.", float64(stats.RequestCount))
+	p.single("webpprof_users_created_total", "counter", "Users created through /api/users.", float64(stats.UsersCreated))
+	p.single("webpprof_cache_size", "gauge", "Users in the cache.", float64(stats.CacheSize))
+	p.single("webpprof_cache_evictions_total", "counter", "Users evicted from the cache.", float64(stats.Evictions))
+	p.single("webpprof_client_gone_total", "counter", "Requests abandoned because the client went away.", float64(stats.ClientGone))
+	p.single("webpprof_memory_rejected_total", "counter", "Requests refused by the memory limiter.", float64(mem.RejectedCeiling+mem.RejectedBudget))
+	p.single("webpprof_slow_captured_total", "counter", "Captures of slow requests and sustained pressure.", float64(captured))
+
+	if proc := currentProcess(); proc != nil {
+		p.single("webpprof_resident_bytes", "gauge", "Resident set size reported by the operating system.", float64(proc.RSS))
+		p.single("webpprof_open_fds", "gauge", "Open file descriptors, or handles on Windows.", float64(proc.FDs))
+		if proc.FDLimit > 0 {
+			p.single("webpprof_fd_limit", "gauge", "Soft limit on open file descriptors.", float64(proc.FDLimit))
+		}
+		if proc.Threads > 0 {
+			p.single("webpprof_threads", "gauge", "OS threads.", float64(proc.Threads))
+		}
+		if proc.Sockets != nil {
+			p.family("webpprof_sockets", "gauge", "Sockets the process holds, by state.")
+			for _, state := range slices.Sorted(maps.Keys(proc.Sockets)) {
+				p.value("webpprof_sockets", fmt.Sprintf("state=%q", state), float64(proc.Sockets[state]))
+			}
+		}
+	}
+
+	breakers := backendBreakers()
+	backends := slices.Sorted(maps.Keys(breakers))
+	p.family("webpprof_breaker_state", "gauge", "1 for the state the backend's circuit breaker is in, 0 for the others.")
+	for _, name := range backends {
+		st := breakers[name].Stats()
+		for _, state := range []breaker.State{breaker.Closed, breaker.Open, breaker.HalfOpen} {
+			var v float64
+			if st.State == state {
+				v = 1
+			}
+			p.value("webpprof_breaker_state", fmt.Sprintf(`backend=%q,state=%q`, name, state), v)
+		}
+	}
+	p.family("webpprof_breaker_calls_total", "counter", "Backend calls through the circuit breaker, by whether they succeeded, failed, or were rejected while it was open.")
+	for _, name := range backends {
+		st := breakers[name].Stats()
+		p.value("webpprof_breaker_calls_total", fmt.Sprintf(`backend=%q,result="success"`, name), float64(st.Successes))
+		p.value("webpprof_breaker_calls_total", fmt.Sprintf(`backend=%q,result="failure"`, name), float64(st.Failures))
+		p.value("webpprof_breaker_calls_total", fmt.Sprintf(`backend=%q,result="rejected"`, name), float64(st.Rejected))
+	}
+	p.family("webpprof_breaker_opened_total", "counter", "Times the backend's circuit breaker opened.")
+	for _, name := range backends {
+		p.value("webpprof_breaker_opened_total", fmt.Sprintf(`backend=%q`, name), float64(breakers[name].Stats().Opened))
+	}
+	p.family("webpprof_chaos_injected_total", "counter", "Backend calls hit by a fault of /debug/chaos.")
+	injected := faults.Injected()
+	for _, name := range faults.Backends() {
+		for _, kind := range chaos.Kinds {
+			p.value("webpprof_chaos_injected_total", fmt.Sprintf(`backend=%q,fault=%q`, name, kind), float64(injected[name][kind]))
+		}
+	}
+
+	// The SLO counters count since start, so Prometheus can compute burn
+	// rates over any window; the gauges are the tracker's own view.
+	reports := sloTracker.Reports(time.Now())
+	sloFamily := func(name, kind, help string, v func(slo.Report) float64) {
+		p.family(name, kind, help)
+		for _, rep := range reports {
+			p.value(name, fmt.Sprintf(`route=%q,objective=%q`, rep.Route, rep.Objective), v(rep))
+		}
+	}
+	sloFamily("webpprof_slo_requests_total", "counter", "Requests counted against the SLO.", func(rep slo.Report) float64 { return float64(rep.TotalRequests) })
+	sloFamily("webpprof_slo_bad_requests_total", "counter", "Requests that missed the SLO.", func(rep slo.Report) float64 { return float64(rep.TotalBad) })
+	sloFamily("webpprof_slo_target", "gauge", "Share of requests the SLO requires to be good.", func(rep slo.Report) float64 { return rep.Target })
+	sloFamily("webpprof_slo_error_budget_remaining", "gauge", "Share of the error budget of -slo-period not spent, negative once missed.", func(rep slo.Report) float64 { return rep.BudgetRemaining })
+	p.family("webpprof_slo_burn_rate", "gauge", "Rate the error budget is spent at over the window, 1 spends it in exactly -slo-period.")
+	for _, rep := range reports {
+		for _, b := range rep.BurnRates {
+			p.value("webpprof_slo_burn_rate", fmt.Sprintf(`route=%q,objective=%q,window=%q`, rep.Route, rep.Objective, b.Window), b.Rate)
+		}
+	}
+
+	reading := currentPressure()
+	if reading == nil {
+		return
+	}
+	scopes := []struct {
+		name  string
+		scope pressure.Scope
+	}{{"system", reading.System}, {"cgroup", reading.Cgroup}}
+
+	p.family("webpprof_pressure_avg10_percent", "gauge", "Share of the last 10 seconds tasks stalled on the resource.")
+	for _, sc := range scopes {
+		for _, res := range pressure.Resources {
+			if st, ok := sc.scope[res]; ok {
+				p.value("webpprof_pressure_avg10_percent", fmt.Sprintf(`scope=%q,resource=%q,kind="some"`, sc.name, res), st.Some.Avg10)
+				p.value("webpprof_pressure_avg10_percent", fmt.Sprintf(`scope=%q,resource=%q,kind="full"`, sc.name, res), st.Full.Avg10)
+			}
+		}
+	}
+	p.family("webpprof_pressure_stalled_seconds_total", "counter", "Time tasks stalled on the resource.")
+	for _, sc := range scopes {
+		for _, res := range pressure.Resources {
+			if st, ok := sc.scope[res]; ok {
+				p.value("webpprof_pressure_stalled_seconds_total", fmt.Sprintf(`scope=%q,resource=%q,kind="some"`, sc.name, res), st.Some.Total.Seconds())
+				p.value("webpprof_pressure_stalled_seconds_total", fmt.Sprintf(`scope=%q,resource=%q,kind="full"`, sc.name, res), st.Full.Total.Seconds())
+			}
+		}
+	}
+	p.family("webpprof_pressure_events_total", "counter", "Episodes of pressure above -pressure-threshold for -pressure-sustain.")
+	events := pressureMonitor.Events()
+	for _, res := range pressure.Resources {
+		p.value("webpprof_pressure_events_total", fmt.Sprintf(`resource=%q`, res), float64(events[res]))
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/cache"
+	"github.com/vdntruong/gosamurai/examples/webpprof/proptest"
+)
+
+// userGen generates users like the ones the handlers make, from the
+// names the search index uses.
+var userGen = proptest.Map(proptest.Users(proptest.Names{
+	First: firstNames, Last: lastNames, Roles: roles, Cities: cities,
+}), func(u proptest.User) *User {
+	return &User{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt, Metadata: u.Metadata}
+})
+
+// property is one property of the example's data structures.
+type property struct {
+	name  string
+	check func(cfg proptest.Config) error
+}
+
+var properties = []property{
+	{"snapshot columns round trip", checkUserColumns},
+	{"cache.LRU matches its model", func(cfg proptest.Config) error { return lruMachine().Check(cfg) }},
+	{"cache.LRU matches its model in parallel", func(cfg proptest.Config) error { return lruMachine().CheckParallel(cfg, 2) }},
+	{"sharded cache keeps entries across resizes", func(cfg proptest.Config) error { return shardedCacheMachine().Check(cfg) }},
+	{"sharded cache keeps entries across parallel resizes", func(cfg proptest.Config) error { return shardedCacheMachine().CheckParallel(cfg, 2) }},
+}
+
+// runPropertyTests checks every property and exits non-zero if one does
+// not hold, printing the seed and the shrunk sequence that shows it.
+func runPropertyTests() {
+	cfg := proptest.Config{Seed: *seed, Runs: *propRuns}
+	for cfg.Seed == 0 {
+		cfg.Seed = rand.Uint64()
+	}
+	fmt.Printf("Seed %d (repeat with -seed=%[1]d), %d runs per property\n\n", cfg.Seed, cfg.Runs)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tPROPERTY\tTIME")
+	var failures []string
+	for _, p := range properties {
+		start := time.Now()
+		err := p.check(cfg)
+		status := "pass"
+		if err != nil {
+			status = "fail"
+			failures = append(failures, fmt.Sprintf("%s: %v", p.name, err))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, p.name, time.Since(start).Round(time.Millisecond))
+	}
+	tw.Flush()
+	for _, f := range failures {
+		fmt.Printf("\n%s\n", f)
+	}
+	if failures != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// checkUserColumns checks that users stored as snapshot columns come back
+// as they went in.
+func checkUserColumns(cfg proptest.Config) error {
+	return proptest.ForAll(cfg, proptest.SliceOf(userGen, 0, 20), func(users []*User) error {
+		c, err := newUserColumns(users)
+		if err != nil {
+			return err
+		}
+		back, err := c.users()
+		if err != nil {
+			return err
+		}
+		if len(back) != len(users) {
+			return fmt.Errorf("%d users came back of %d", len(back), len(users))
+		}
+		for i, u := range users {
+			b := back[i]
+			if b.ID != u.ID || b.Name != u.Name || b.Email != u.Email || !b.CreatedAt.Equal(u.CreatedAt) || !reflect.DeepEqual(b.Metadata, u.Metadata) {
+				return fmt.Errorf("user %d came back as %+v", i, *b)
+			}
+		}
+		return nil
+	})
+}
+
+// seen is the model of a sharded cache, described at shardedCacheMachine.
+type seen map[string]bool
+
+// lruModel is what an LRU of capacity entries holds: the keys, most
+// recently used first, and their values.
+type lruModel struct {
+	capacity int
+	keys     []int
+	values   map[int]*User
+}
+
+func (m *lruModel) touch(key int) {
+	m.keys = slices.DeleteFunc(m.keys, func(k int) bool { return k == key })
+	m.keys = slices.Insert(m.keys, 0, key)
+}
+
+// lruMachine runs random Gets, Sets, and Deletes on a small LRU, so it
+// evicts often, and after every step compares its entries and their order
+// with the model's.
+func lruMachine() proptest.Machine[*cache.LRU[int, *User], *lruModel] {
+	type (
+		lru  = *cache.LRU[int, *User]
+		step = proptest.Step[lru, *lruModel]
+		get  struct {
+			u  *User
+			ok bool
+		}
+	)
+	keys := proptest.Int(0, 7)
+	return proptest.Machine[lru, *lruModel]{
+		Init: func() (lru, *lruModel) {
+			return cache.NewLRU[int, *User](4), &lruModel{capacity: 4, values: make(map[int]*User)}
+		},
+		Ops: []proptest.Op[lru, *lruModel]{
+			{Weight: 3, Gen: func(r *rand.Rand) step {
+				key := keys(r)
+				return step{Name: fmt.Sprintf("Get(%d)", key), Call: func(c lru) any {
+					u, ok := c.Get(key)
+					return get{u, ok}
+				}, Check: func(m *lruModel, got any) error {
+					g := got.(get)
+					want, wantOK := m.values[key]
+					if wantOK {
+						m.touch(key)
+					}
+					if g.ok != wantOK || g.u != want {
+						return fmt.Errorf("Get(%d) = %v, %t; model has %v, %t", key, g.u, g.ok, want, wantOK)
+					}
+					return nil
+				}}
+			}},
+			{Weight: 3, Gen: func(r *rand.Rand) step {
+				key, u := keys(r), userGen(r)
+				return step{Name: fmt.Sprintf("Set(%d, user %d)", key, u.ID), Call: func(c lru) any {
+					c.Set(key, u)
+					return nil
+				}, Check: func(m *lruModel, _ any) error {
+					m.values[key] = u
+					m.touch(key)
+					if len(m.keys) > m.capacity {
+						delete(m.values, m.keys[m.capacity])
+						m.keys = m.keys[:m.capacity]
+					}
+					return nil
+				}}
+			}},
+			{Weight: 1, Gen: func(r *rand.Rand) step {
+				key := keys(r)
+				return step{Name: fmt.Sprintf("Delete(%d)", key), Call: func(c lru) any {
+					return c.Delete(key)
+				}, Check: func(m *lruModel, got any) error {
+					_, want := m.values[key]
+					delete(m.values, key)
+					m.keys = slices.DeleteFunc(m.keys, func(k int) bool { return k == key })
+					if got != want {
+						return fmt.Errorf("Delete(%d) = %t; model had it: %t", key, got, want)
+					}
+					return nil
+				}}
+			}},
+		},
+		Invariant: func(c lru, m *lruModel) error {
+			var order []int
+			c.Range(func(key int, _ *User) bool {
+				order = append(order, key)
+				return true
+			})
+			if !slices.Equal(order, m.keys) {
+				return fmt.Errorf("holds %v, most recent first; model holds %v", order, m.keys)
+			}
+			if c.Len() != len(m.keys) {
+				return fmt.Errorf("Len() = %d; model holds %d", c.Len(), len(m.keys))
+			}
+			return nil
+		},
+	}
+}
+
+// shardedCacheMachine runs random lookups and resizes on a sharded cache
+// too large to evict, so every key looked up must stay cached on the shard
+// the ring assigns it, however the shards change.
+//
+// The model holds the keys looked up: true for those looked up alone, which
+// must hit from then on, and false for those looked up in a parallel
+// section. Lookups of one key at once may all miss, as they wait on the
+// same fill, so those may miss until the next lookup alone.
+func shardedCacheMachine() proptest.Machine[*shardedCache, seen] {
+	type step = proptest.Step[*shardedCache, seen]
+	return proptest.Machine[*shardedCache, seen]{
+		Init: func() (*shardedCache, seen) {
+			return newShardedCache(3, 16, 1<<20), make(seen)
+		},
+		Ops: []proptest.Op[*shardedCache, seen]{
+			{Weight: 8, Gen: func(r *rand.Rand) step {
+				key := fmt.Sprintf("key-%d", r.IntN(64))
+				return step{Name: "get(" + key + ")", Run: func(c *shardedCache, m seen) error {
+					_, hit := c.get(key)
+					if _, want := m[key]; hit != want {
+						return fmt.Errorf("get(%s) hit = %t; model has it: %t", key, hit, want)
+					}
+					m[key] = true
+					return nil
+				}, Call: func(c *shardedCache) any {
+					_, hit := c.get(key)
+					return hit
+				}, Check: func(m seen, got any) error {
+					alone, ok := m[key]
+					if hit := got.(bool); hit && !ok || !hit && alone {
+						return fmt.Errorf("get(%s) hit = %t; model has it: %t", key, hit, ok)
+					}
+					if !ok {
+						m[key] = false
+					}
+					return nil
+				}}
+			}},
+			{Weight: 1, Gen: func(r *rand.Rand) step {
+				n := 1 + r.IntN(6)
+				return step{Name: fmt.Sprintf("resize(%d)", n), Run: func(c *shardedCache, m seen) error {
+					c.resize(n)
+					if len(c.shards) != n {
+						return fmt.Errorf("resize(%d) left %d shards", n, len(c.shards))
+					}
+					return nil
+				}, Call: func(c *shardedCache) any {
+					c.resize(n)
+					return nil
+				}, Check: func(seen, any) error { return nil }}
+			}},
+		},
+		Invariant: func(c *shardedCache, m seen) error {
+			held := 0
+			for name, s := range c.shards {
+				var misplaced []string
+				s.Range(func(key string, _ []byte) bool {
+					if owner := c.ring.Get(key); owner != name {
+						misplaced = append(misplaced, key+" belongs on "+owner)
+					}
+					return true
+				})
+				if misplaced != nil {
+					return fmt.Errorf("%s holds %s", name, strings.Join(misplaced, ", "))
+				}
+				held += s.Len()
+			}
+			if held != len(m) {
+				return fmt.Errorf("shards hold %d entries; model has %d keys: %v", held, len(m), slices.Sorted(maps.Keys(m)))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,155 @@
+package proptest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// parallelSteps is how many calls each goroutine of a parallel section
+// makes. Every interleaving of them may be replayed on the model, so the
+// sections stay short.
+const parallelSteps = 4
+
+// CheckParallel runs cfg.Runs random sequences on systems that are safe
+// for concurrent use. Each is a prefix of cfg.Steps steps, run as Check
+// runs them, then a parallel section: goroutines goroutines (at least 2)
+// that make parallelSteps Calls each on the system at once. The section
+// passes if some order of its calls that keeps each goroutine's own order
+// gives the results they saw when the model checks them, and the invariant
+// then holds between the system and that model.
+//
+// A failing prefix is shrunk as Check shrinks it; a failing parallel
+// section is reported whole, with what each call saw. Run it under the
+// race detector to catch the races a model cannot see.
+func (m Machine[S, M]) CheckParallel(cfg Config, goroutines int) error {
+	cfg = cfg.withDefaults()
+	goroutines = max(goroutines, 2)
+	for run := range cfg.Runs {
+		r := cfg.rand(run)
+		prefix := make([]Step[S, M], cfg.Steps)
+		for i := range prefix {
+			prefix[i] = m.draw(r)
+		}
+		sections := make([][]Step[S, M], goroutines)
+		for g := range sections {
+			// Steps without Call are left out, so a section may be short.
+			for range parallelSteps {
+				if st := m.draw(r); st.Call != nil {
+					sections[g] = append(sections[g], st)
+				}
+			}
+		}
+
+		s, _, n, err := m.start(prefix)
+		if err != nil {
+			return m.failure(cfg, run, prefix[:n+1], err)
+		}
+		got, err := callParallel(s, sections)
+		if err == nil {
+			err = m.explain(prefix, sections, got, s)
+		}
+		if err == nil {
+			continue
+		}
+		steps := names(prefix)
+		for g, section := range sections {
+			for i, st := range section {
+				steps = append(steps, fmt.Sprintf("goroutine %d: %s saw %+v", g+1, st.Name, got[g][i]))
+			}
+		}
+		return &Failure{Seed: cfg.Seed, Run: run, Steps: steps, Err: err}
+	}
+	return nil
+}
+
+// callParallel makes the calls of every section on s, a goroutine per
+// section, all released at once, and returns what each saw.
+func callParallel[S, M any](s S, sections [][]Step[S, M]) ([][]any, error) {
+	got := make([][]any, len(sections))
+	errs := make([]error, len(sections))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for g, section := range sections {
+		got[g] = make([]any, len(section))
+		wg.Go(func() {
+			<-start
+			errs[g] = protect(func() error {
+				for i, st := range section {
+					got[g][i] = st.Call(s)
+				}
+				return nil
+			})
+		})
+	}
+	close(start)
+	wg.Wait()
+	return got, errors.Join(errs...)
+}
+
+// explain looks for an order of the parallel calls that the model agrees
+// with, growing it a call at a place and dropping every order that starts
+// with one the model disagrees with. Each is checked on a new model brought
+// up to date by the prefix. It returns the error of the first order tried
+// if none holds.
+func (m Machine[S, M]) explain(prefix []Step[S, M], sections [][]Step[S, M], got [][]any, s S) error {
+	n := 0
+	for _, section := range sections {
+		n += len(section)
+	}
+	var first error
+	next := make([]int, len(sections))
+	order := make([][2]int, 0, n)
+	var try func() bool
+	try = func() bool {
+		if err := m.checkOrder(prefix, sections, got, order, s, len(order) == n); err != nil {
+			if first == nil {
+				first = err
+			}
+			return false
+		}
+		if len(order) == n {
+			return true
+		}
+		for g := range sections {
+			if next[g] == len(sections[g]) {
+				continue
+			}
+			order = append(order, [2]int{g, next[g]})
+			next[g]++
+			ok := try()
+			next[g]--
+			order = order[:len(order)-1]
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	if try() {
+		return nil
+	}
+	return fmt.Errorf("no order of the parallel calls explains what they saw; in the first tried: %w", first)
+}
+
+// checkOrder applies the parallel calls to a new model in order, after the
+// prefix, then, if the order is complete, checks the invariant between s
+// and that model.
+func (m Machine[S, M]) checkOrder(prefix []Step[S, M], sections [][]Step[S, M], got [][]any, order [][2]int, s S, complete bool) error {
+	_, model, _, err := m.start(prefix)
+	if err != nil {
+		return err
+	}
+	return protect(func() error {
+		for _, c := range order {
+			st := sections[c[0]][c[1]]
+			if err := st.Check(model, got[c[0]][c[1]]); err != nil {
+				return fmt.Errorf("goroutine %d: %w", c[0]+1, err)
+			}
+		}
+		if !complete {
+			return nil
+		}
+		return m.invariant(s, model)
+	})
+}
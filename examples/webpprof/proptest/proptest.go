@@ -0,0 +1,284 @@
+// Package proptest checks properties of code against many random inputs,
+// and checks stateful code against a model by running random sequences of
+// operations on both. A failing sequence is shrunk to the fewest steps that
+// still fail, and every failure names the seed that replays it.
+//
+// The generators are plain functions of a *rand.Rand, so they compose with
+// each other and with code that already draws from one.
+package proptest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Gen generates a random T.
+type Gen[T any] func(r *rand.Rand) T
+
+// Int generates ints in [lo, hi].
+func Int(lo, hi int) Gen[int] {
+	return func(r *rand.Rand) int { return lo + r.IntN(hi-lo+1) }
+}
+
+// Float generates float64s in [0, 1).
+func Float() Gen[float64] {
+	return func(r *rand.Rand) float64 { return r.Float64() }
+}
+
+// Bool generates true and false equally often.
+func Bool() Gen[bool] {
+	return func(r *rand.Rand) bool { return r.IntN(2) == 0 }
+}
+
+// OneOf picks one of values.
+func OneOf[T any](values ...T) Gen[T] {
+	return func(r *rand.Rand) T { return values[r.IntN(len(values))] }
+}
+
+// String generates strings of minLen to maxLen characters of alphabet.
+func String(alphabet string, minLen, maxLen int) Gen[string] {
+	chars := []rune(alphabet)
+	return func(r *rand.Rand) string {
+		var b strings.Builder
+		for range minLen + r.IntN(maxLen-minLen+1) {
+			b.WriteRune(chars[r.IntN(len(chars))])
+		}
+		return b.String()
+	}
+}
+
+// SliceOf generates slices of minLen to maxLen values of g.
+func SliceOf[T any](g Gen[T], minLen, maxLen int) Gen[[]T] {
+	return func(r *rand.Rand) []T {
+		s := make([]T, minLen+r.IntN(maxLen-minLen+1))
+		for i := range s {
+			s[i] = g(r)
+		}
+		return s
+	}
+}
+
+// Map generates f of the values of g.
+func Map[T, U any](g Gen[T], f func(T) U) Gen[U] {
+	return func(r *rand.Rand) U { return f(g(r)) }
+}
+
+// Config sets how much a check tries.
+type Config struct {
+	// Seed seeds every run; 0 picks one, which a Failure reports.
+	Seed uint64
+	// Runs is the number of inputs or sequences tried (default 200).
+	Runs int
+	// Steps is the length of each sequence of operations (default 50).
+	Steps int
+}
+
+func (c Config) withDefaults() Config {
+	for c.Seed == 0 {
+		c.Seed = rand.Uint64()
+	}
+	if c.Runs <= 0 {
+		c.Runs = 200
+	}
+	if c.Steps <= 0 {
+		c.Steps = 50
+	}
+	return c
+}
+
+// rand returns the generator of run, which depends only on the seed and
+// the run, so a failure replays from the two.
+func (c Config) rand(run int) *rand.Rand {
+	return rand.New(rand.NewPCG(c.Seed, uint64(run)))
+}
+
+// Failure is a property found false.
+type Failure struct {
+	Seed uint64
+	Run  int
+	// Input is the failing input of ForAll, and Steps the shrunk
+	// sequence of Machine.Check, one line per step.
+	Input string
+	Steps []string
+	Err   error
+}
+
+func (f *Failure) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "run %d of seed %d: %v", f.Run, f.Seed, f.Err)
+	if f.Input != "" {
+		fmt.Fprintf(&b, "\ninput: %s", f.Input)
+	}
+	if len(f.Steps) > 0 {
+		fmt.Fprintf(&b, "\nafter %d steps:", len(f.Steps))
+		for i, s := range f.Steps {
+			fmt.Fprintf(&b, "\n  %d. %s", i+1, s)
+		}
+	}
+	return b.String()
+}
+
+func (f *Failure) Unwrap() error { return f.Err }
+
+// ForAll checks prop for cfg.Runs values of g and returns a *Failure for
+// the first it does not hold for.
+func ForAll[T any](cfg Config, g Gen[T], prop func(T) error) error {
+	cfg = cfg.withDefaults()
+	for run := range cfg.Runs {
+		v := g(cfg.rand(run))
+		if err := protect(func() error { return prop(v) }); err != nil {
+			return &Failure{Seed: cfg.Seed, Run: run, Input: fmt.Sprintf("%+v", v), Err: err}
+		}
+	}
+	return nil
+}
+
+// Step is one operation, with its arguments already drawn, on a system S
+// and its model M. Run applies it to both and returns an error when the
+// system's result differs from the model's.
+//
+// Call and Check split Run for Machine.CheckParallel, which calls the
+// system from several goroutines at once and applies the calls to the
+// model afterwards: Call runs the step on the system alone and returns
+// what it saw, and Check applies the step to the model and returns an
+// error when the model would not have seen got. A step with both needs no
+// Run; one without Call is left out of parallel sections.
+type Step[S, M any] struct {
+	Name  string
+	Run   func(s S, m M) error
+	Call  func(s S) any
+	Check func(m M, got any) error
+}
+
+func (st Step[S, M]) run(s S, m M) error {
+	if st.Run != nil {
+		return st.Run(s, m)
+	}
+	return st.Check(m, st.Call(s))
+}
+
+// Op draws steps of one kind of operation. Weight is how often it is picked
+// against the other ops; 0 counts as 1.
+type Op[S, M any] struct {
+	Weight int
+	Gen    func(r *rand.Rand) Step[S, M]
+}
+
+// Machine describes a system to check against a model.
+type Machine[S, M any] struct {
+	// Init returns a new system and its model, as they start.
+	Init func() (S, M)
+	Ops  []Op[S, M]
+	// Invariant, if set, is checked after every step.
+	Invariant func(s S, m M) error
+}
+
+// Check runs cfg.Runs random sequences of cfg.Steps steps, each on a new
+// system and model. For the first sequence that fails it returns a
+// *Failure with the sequence shrunk: cut after the failing step, then
+// without every step the failure does not need.
+func (m Machine[S, M]) Check(cfg Config) error {
+	cfg = cfg.withDefaults()
+	for run := range cfg.Runs {
+		steps := make([]Step[S, M], cfg.Steps)
+		r := cfg.rand(run)
+		for i := range steps {
+			steps[i] = m.draw(r)
+		}
+		n, err := m.replay(steps)
+		if err == nil {
+			continue
+		}
+		return m.failure(cfg, run, steps[:n+1], err)
+	}
+	return nil
+}
+
+// draw picks an op by weight and draws a step of it.
+func (m Machine[S, M]) draw(r *rand.Rand) Step[S, M] {
+	total := 0
+	for _, op := range m.Ops {
+		total += max(op.Weight, 1)
+	}
+	pick := r.IntN(total)
+	for _, op := range m.Ops {
+		if pick -= max(op.Weight, 1); pick < 0 {
+			return op.Gen(r)
+		}
+	}
+	panic("unreachable")
+}
+
+// failure shrinks the failing steps and returns the *Failure naming them.
+func (m Machine[S, M]) failure(cfg Config, run int, steps []Step[S, M], err error) *Failure {
+	steps, err = m.shrink(steps, err)
+	return &Failure{Seed: cfg.Seed, Run: run, Steps: names(steps), Err: err}
+}
+
+func names[S, M any](steps []Step[S, M]) []string {
+	out := make([]string, len(steps))
+	for i, s := range steps {
+		out[i] = s.Name
+	}
+	return out
+}
+
+// replay runs steps on a new system and model, and returns the index of
+// the step that failed with its error.
+func (m Machine[S, M]) replay(steps []Step[S, M]) (int, error) {
+	_, _, n, err := m.start(steps)
+	return n, err
+}
+
+// start runs steps on a new system and model and returns both, with the
+// index of the step that failed and its error.
+func (m Machine[S, M]) start(steps []Step[S, M]) (S, M, int, error) {
+	s, model := m.Init()
+	for i, step := range steps {
+		err := protect(func() error {
+			if err := step.run(s, model); err != nil {
+				return err
+			}
+			return m.invariant(s, model)
+		})
+		if err != nil {
+			return s, model, i, err
+		}
+	}
+	return s, model, len(steps), nil
+}
+
+func (m Machine[S, M]) invariant(s S, model M) error {
+	if m.Invariant == nil {
+		return nil
+	}
+	return m.Invariant(s, model)
+}
+
+// shrink drops steps from a failing sequence, one at a time from the end,
+// for as long as the sequence without them still fails.
+func (m Machine[S, M]) shrink(steps []Step[S, M], err error) ([]Step[S, M], error) {
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for i := len(steps) - 1; i >= 0 && len(steps) > 1; i-- {
+			candidate := append(steps[:i:i], steps[i+1:]...)
+			if n, e := m.replay(candidate); e != nil {
+				steps, err, shrunk = candidate[:n+1], e, true
+				i = min(i, len(steps))
+			}
+		}
+	}
+	return steps, err
+}
+
+// protect turns a panic in f into an error, so a panicking system fails the
+// check like a wrong result does.
+func protect(f func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return f()
+}
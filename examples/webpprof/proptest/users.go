@@ -0,0 +1,68 @@
+package proptest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// User is a user record like the ones the example serves, for properties of
+// code that stores or encodes them. Map turns it into a program's own type.
+type User struct {
+	ID        int
+	Name      string
+	Email     string
+	CreatedAt time.Time
+	Metadata  map[string]any
+}
+
+// Names are the words Users draws from. Each list must not be empty.
+type Names struct {
+	First, Last   []string
+	Roles, Cities []string
+}
+
+// Users generates users with ids up to a million, a first and last name,
+// an email address made of both, a creation time between 1970 and 2033,
+// and Metadata.
+func Users(names Names) Gen[User] {
+	first, last, md := OneOf(names.First...), OneOf(names.Last...), Metadata(names)
+	return func(r *rand.Rand) User {
+		f, l := first(r), last(r)
+		id := r.IntN(1_000_000) + 1
+		return User{
+			ID:        id,
+			Name:      f + " " + l,
+			Email:     fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(f), strings.ToLower(l), id),
+			CreatedAt: time.Unix(0, r.Int64N(2e18)),
+			Metadata:  md(r),
+		}
+	}
+}
+
+// Metadata generates up to four entries of user metadata, with a value of
+// every type JSON decodes to but null: a role and a city string, an int
+// score, a float64 weight, and a bool.
+func Metadata(names Names) Gen[map[string]any] {
+	keys := OneOf("role", "city", "score", "weight", "active")
+	role, city := OneOf(names.Roles...), OneOf(names.Cities...)
+	return func(r *rand.Rand) map[string]any {
+		md := make(map[string]any)
+		for range r.IntN(5) {
+			switch key := keys(r); key {
+			case "role":
+				md[key] = role(r)
+			case "city":
+				md[key] = city(r)
+			case "score":
+				md[key] = r.IntN(100)
+			case "weight":
+				md[key] = r.Float64()
+			case "active":
+				md[key] = r.IntN(2) == 0
+			}
+		}
+		return md
+	}
+}
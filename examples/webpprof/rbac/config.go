@@ -0,0 +1,65 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config is the JSON form of a Policy's principals:
+//
+//	{
+//	  "anonymous": "none",
+//	  "users":  {"alice": {"password_sha256": "…", "role": "admin"}},
+//	  "certs":  {"spiffe://example.org/oncall": "operator"},
+//	  "tokens": {"<sha256 of token>": {"sub": "grafana", "role": "viewer"}},
+//	  "memory_mb": {"grafana": 16, "operator": 512}
+//	}
+type Config struct {
+	Anonymous Role       `json:"anonymous"`
+	Users     BasicAuth  `json:"users"`
+	Certs     ClientCert `json:"certs"`
+	Tokens    Tokens     `json:"tokens"`
+	// MemoryMB is the most memory one request may reserve, in MB, by
+	// principal name or role.
+	MemoryMB map[string]int64 `json:"memory_mb"`
+}
+
+// Load reads a Config file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("rbac: %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// MemoryCeiling returns the memory ceiling of p in bytes: the one set for
+// its name, else the one for its role.
+func (c *Config) MemoryCeiling(p Principal) (int64, bool) {
+	mb, ok := c.MemoryMB[p.Name]
+	if !ok || p.Name == "" {
+		mb, ok = c.MemoryMB[p.Role.String()]
+	}
+	return mb << 20, ok
+}
+
+// Policy returns a policy enforcing rules with the configured principals.
+// Client certificates are tried first, then bearer tokens, then basic auth.
+func (c *Config) Policy(rules Rules) *Policy {
+	p := &Policy{Rules: rules, Anonymous: c.Anonymous}
+	if len(c.Certs) > 0 {
+		p.Extractors = append(p.Extractors, c.Certs)
+	}
+	if len(c.Tokens) > 0 {
+		p.Extractors = append(p.Extractors, c.Tokens)
+	}
+	if len(c.Users) > 0 {
+		p.Extractors = append(p.Extractors, c.Users)
+	}
+	return p
+}
@@ -0,0 +1,103 @@
+package rbac
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// An Extractor recognizes the principal of a request. It returns ok false
+// when the request carries no credentials of its kind, and an error when it
+// carries ones that are invalid.
+type Extractor interface {
+	Extract(r *http.Request) (p Principal, ok bool, err error)
+}
+
+// ErrBadCredentials is returned by extractors for unknown users, wrong
+// passwords, and unknown tokens.
+var ErrBadCredentials = errors.New("rbac: bad credentials")
+
+// User is a basic auth account.
+type User struct {
+	// PasswordSHA256 is the hex SHA-256 of the password.
+	PasswordSHA256 string `json:"password_sha256"`
+	Role           Role   `json:"role"`
+}
+
+// BasicAuth recognizes HTTP basic auth users.
+type BasicAuth map[string]User
+
+// Extract implements Extractor.
+func (b BasicAuth) Extract(r *http.Request) (Principal, bool, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, false, nil
+	}
+	u, known := b[name]
+	sum := sha256.Sum256([]byte(password))
+	// Compare even for unknown users so timing does not reveal which exist.
+	match := subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(u.PasswordSHA256))) == 1
+	if !known || !match {
+		return Principal{}, false, ErrBadCredentials
+	}
+	return Principal{Name: name, Role: u.Role, Via: "basic"}, true, nil
+}
+
+// ClientCert recognizes verified TLS client certificates by their subject
+// alternative names: DNS names, URIs (such as SPIFFE IDs), and email
+// addresses. Certificates with no listed SAN are treated as anonymous.
+type ClientCert map[string]Role
+
+// Extract implements Extractor.
+func (c ClientCert) Extract(r *http.Request) (Principal, bool, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return Principal{}, false, nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+
+	best := Principal{Role: None}
+	for _, san := range sans {
+		if role, ok := c[san]; ok && (best.Name == "" || role > best.Role) {
+			best = Principal{Name: san, Role: role, Via: "mtls"}
+		}
+	}
+	return best, best.Name != "", nil
+}
+
+// Claims are what a bearer token stands for.
+type Claims struct {
+	Subject string `json:"sub"`
+	Role    Role   `json:"role"`
+}
+
+// Tokens recognizes bearer tokens in the Authorization header, keyed by the
+// hex SHA-256 of the token so the configuration holds no usable secrets.
+type Tokens map[string]Claims
+
+// Extract implements Extractor.
+func (t Tokens) Extract(r *http.Request) (Principal, bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, false, nil
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	c, known := t[hex.EncodeToString(sum[:])]
+	if !known {
+		return Principal{}, false, ErrBadCredentials
+	}
+	return Principal{Name: c.Subject, Role: c.Role, Via: "token"}, true, nil
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(r *http.Request) (Principal, bool, error)
+
+// Extract implements Extractor.
+func (f ExtractorFunc) Extract(r *http.Request) (Principal, bool, error) { return f(r) }
@@ -0,0 +1,154 @@
+// Package rbac restricts the debug and admin endpoints by role. Requests are
+// mapped to a Principal by pluggable extractors (basic auth, client
+// certificate, bearer token), and each route group requires a minimum role.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+)
+
+// Role is an access level; each role includes the ones below it.
+type Role int
+
+const (
+	// None is the role of requests no extractor recognizes, unless
+	// Policy.Anonymous says otherwise.
+	None Role = iota
+	// Viewer may read profiles, the request archive, and other debug data.
+	Viewer
+	// Operator may also run profilers that slow the service down, such as
+	// CPU profiles and execution traces.
+	Operator
+	// Admin may do everything, including the admin dashboard.
+	Admin
+)
+
+var roleNames = []string{"none", "viewer", "operator", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole parses a role name as returned by Role.String.
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return Role(i), nil
+		}
+	}
+	return None, fmt.Errorf("unknown role %q", s)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	*r = role
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r Role) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+// Principal is the identity a request was made with.
+type Principal struct {
+	// Name is the user, certificate SAN, or token subject; empty for
+	// anonymous requests.
+	Name string
+	Role Role
+	// Via names the extractor that recognized the request.
+	Via string
+}
+
+type contextKey struct{}
+
+// FromContext returns the principal Policy.Handler attached to the request
+// context, or an anonymous one without a role.
+func FromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(contextKey{}).(Principal)
+	return p
+}
+
+// Rules maps path prefixes to the minimum role they require. The longest
+// matching prefix wins; paths matching no prefix are open to everyone.
+type Rules map[string]Role
+
+// Required returns the role the path requires.
+func (rs Rules) Required(path string) Role {
+	role, best := None, ""
+	for prefix, r := range rs {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
+			role, best = r, prefix
+		}
+	}
+	return role
+}
+
+// Policy decides who may call what.
+type Policy struct {
+	// Extractors are tried in order; the first to recognize the request
+	// decides its principal.
+	Extractors []Extractor
+	Rules      Rules
+	// Anonymous is the role of requests no extractor recognizes.
+	Anonymous Role
+}
+
+// Principal returns the principal of r. An error means the request carried
+// credentials that were wrong, which is not the same as carrying none.
+func (p *Policy) Principal(r *http.Request) (Principal, error) {
+	for _, e := range p.Extractors {
+		pr, ok, err := e.Extract(r)
+		if err != nil {
+			return Principal{}, err
+		}
+		if ok {
+			return pr, nil
+		}
+	}
+	return Principal{Role: p.Anonymous, Via: "anonymous"}, nil
+}
+
+// Handler serves next to requests whose principal has the role the path
+// requires. Anonymous requests that fall short get 401 with a basic auth
+// challenge, identified ones get 403.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pr, err := p.Principal(r)
+		if err != nil {
+			events.Emit(r.Context(), events.CredentialsRejected, events.Path, r.URL.Path, events.Remote, r.RemoteAddr, events.Err, err)
+			p.challenge(w)
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		if need := p.Rules.Required(r.URL.Path); pr.Role < need {
+			if pr.Name == "" {
+				p.challenge(w)
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			events.Emit(r.Context(), events.AccessDenied, events.Path, r.URL.Path, events.Principal, pr.Name, events.Role, pr.Role, events.Required, need)
+			http.Error(w, fmt.Sprintf("%s role required", need), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, pr)))
+	})
+}
+
+// challenge asks browsers for a password when basic auth is configured.
+func (p *Policy) challenge(w http.ResponseWriter) {
+	for _, e := range p.Extractors {
+		if _, ok := e.(BasicAuth); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="webpprof", charset="UTF-8"`)
+			return
+		}
+	}
+}
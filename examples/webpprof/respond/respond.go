@@ -0,0 +1,128 @@
+// Package respond writes API responses in the format the client asked for,
+// choosing among the registered codecs from the Accept header.
+package respond
+
+import (
+	"bytes"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/codec"
+	"github.com/vdntruong/gosamurai/examples/webpprof/timing"
+)
+
+var defaultCodec atomic.Pointer[codec.Codec]
+
+// SetDefault sets the codec used when the request has no Accept header, the
+// header allows anything, or no registered codec matches.
+func SetDefault(c codec.Codec) {
+	defaultCodec.Store(&c)
+}
+
+// Default returns the codec configured with SetDefault.
+func Default() codec.Codec {
+	if c := defaultCodec.Load(); c != nil {
+		return *c
+	}
+	c, _ := codec.Get(codec.Default)
+	return c
+}
+
+// Write encodes v with the negotiated codec.
+func Write(w http.ResponseWriter, r *http.Request, v any) {
+	WriteStatus(w, r, http.StatusOK, v)
+}
+
+// WriteStatus is like Write but sets the response status code. The body is
+// encoded before the header is written, so a value the codec fails on is
+// answered with a 500 rather than an empty response with status.
+func WriteStatus(w http.ResponseWriter, r *http.Request, status int, v any) {
+	c := Negotiate(r, v)
+	var buf bytes.Buffer
+	done := timing.StartSerialize(r.Context())
+	err := c.Encode(&buf, v)
+	done()
+	if err != nil {
+		log.Printf("encode response with %s: %v", c.Name(), err)
+		http.Error(w, "could not encode the response as "+c.Name(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// Negotiate returns the codec to encode v for r. Media ranges are tried in
+// order of preference, and codecs that cannot encode v are skipped. When
+// nothing matches it is the default codec, or JSON if the default cannot
+// encode v either, as protobuf cannot encode values without a schema.
+func Negotiate(r *http.Request, v any) codec.Codec {
+	def := Default()
+	for _, mediaRange := range parseAccept(r.Header.Get("Accept")) {
+		if matches(mediaRange, def.ContentType()) && codec.CanEncode(def, v) {
+			return def
+		}
+		for _, c := range codec.All() {
+			if matches(mediaRange, c.ContentType()) && codec.CanEncode(c, v) {
+				return c
+			}
+		}
+	}
+	if !codec.CanEncode(def, v) {
+		if c, err := codec.Get(codec.Default); err == nil {
+			return c
+		}
+	}
+	return def
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of an Accept header sorted by
+// descending quality, dropping the ones with q=0.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for part := range strings.SplitSeq(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b acceptRange) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	return ranges
+}
+
+func matches(r acceptRange, contentType string) bool {
+	if r.mediaType == "*/*" || r.mediaType == contentType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(r.mediaType, "/*")
+	return ok && strings.HasPrefix(contentType, prefix+"/")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// route is one registered endpoint. The startup banner and /debug/guide are
+// generated from routes, so an endpoint is documented where it is registered.
+type route struct {
+	Pattern string `json:"pattern"`
+	Group   string `json:"group"`
+	Summary string `json:"summary"`
+}
+
+// Route groups, in the order the banner and the guide list them.
+const (
+	groupWorkload = "workloads"
+	groupStats    = "statistics"
+	groupAdmin    = "admin"
+	groupDebug    = "debug"
+)
+
+var routeGroups = []string{groupWorkload, groupStats, groupAdmin, groupDebug}
+
+var routes []route
+
+// handle registers h on the default mux and records the route.
+func handle(group, pattern, summary string, h http.Handler) {
+	http.Handle(pattern, h)
+	routes = append(routes, route{Pattern: pattern, Group: group, Summary: summary})
+}
+
+// routesIn returns the routes of a group in registration order.
+func routesIn(group string) []route {
+	var in []route
+	for _, rt := range routes {
+		if rt.Group == group {
+			in = append(in, rt)
+		}
+	}
+	return in
+}
+
+// splitPattern splits a pattern into its method and path,
+// "GET /admin" -> "GET", "/admin". The method is empty for patterns that
+// match any method.
+func splitPattern(pattern string) (method, path string) {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method, path
+	}
+	return "", pattern
+}
+
+// printRoutes writes the startup banner's endpoint list.
+func printRoutes(base string) {
+	for _, group := range routeGroups {
+		fmt.Printf("%s%s:\n", strings.ToUpper(group[:1]), group[1:])
+		for _, rt := range routesIn(group) {
+			method, path := splitPattern(rt.Pattern)
+			fmt.Printf("  %-4s %-52s - %s\n", method, base+path, rt.Summary)
+		}
+		fmt.Println("")
+	}
+}
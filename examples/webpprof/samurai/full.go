@@ -0,0 +1,262 @@
+//go:build !samurai_minimal
+
+package samurai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/capture"
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/pressure"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/supervisor"
+)
+
+// Minimal reports whether this is a samurai_minimal build, without the
+// flight recorder, the watchdog, and the dashboard.
+const Minimal = false
+
+// full is the flight recorder and the watchdog.
+type full struct {
+	capturer   *capture.Capturer // nil without a flight recorder
+	monitor    *pressure.Monitor // nil without a watchdog
+	components *supervisor.Supervisor
+}
+
+// startFull starts the flight recorder and the watchdog.
+func (t *Toolkit) startFull() error {
+	if t.opts.SlowThreshold > 0 {
+		c, err := capture.New(capture.Config{
+			Threshold:   t.opts.SlowThreshold,
+			Cooldown:    t.opts.SlowCooldown,
+			TraceWindow: t.opts.TraceWindow,
+		})
+		if err != nil {
+			return fmt.Errorf("samurai: %w", err)
+		}
+		t.full.capturer = c
+	}
+	if err := t.startWatchdog(); err != nil {
+		if t.full.capturer != nil {
+			t.full.capturer.Stop()
+		}
+		return err
+	}
+	return nil
+}
+
+// attachFull registers the dashboard and the endpoints of the flight
+// recorder and the watchdog.
+func (t *Toolkit) attachFull(r Router) {
+	t.handle(r, "", "Dashboard linking everything below", http.HandlerFunc(t.dashboardHandler), false)
+	t.handle(r, "/pressure", "Pressure stall information and watchdog episodes (Linux)", http.HandlerFunc(t.pressureHandler), false)
+	t.handle(r, "/supervisor", "Health of the watchdog components", http.HandlerFunc(t.supervisorHandler), false)
+	t.handle(r, "/flightrecorder", "Download the flight recorder window ending now", http.HandlerFunc(t.flightRecorderHandler), true)
+}
+
+// capture captures the requests served by next that are slow.
+func (t *Toolkit) capture(next http.Handler) http.Handler {
+	if t.full.capturer == nil {
+		return next
+	}
+	return t.full.capturer.Middleware(next)
+}
+
+// captureStats reports the captures and the captures skipped.
+func (t *Toolkit) captureStats() (captured, skipped uint64) {
+	if t.full.capturer == nil {
+		return 0, 0
+	}
+	return t.full.capturer.Stats()
+}
+
+// stopFull stops the watchdog and then the flight recorder.
+func (t *Toolkit) stopFull(ctx context.Context) error {
+	if err := t.full.components.Shutdown(ctx); err != nil {
+		return err
+	}
+	if t.full.capturer != nil {
+		t.full.capturer.Stop()
+	}
+	return nil
+}
+
+// startWatchdog supervises the pressure monitor and the descriptor check.
+func (t *Toolkit) startWatchdog() error {
+	t.full.components = supervisor.New(supervisor.Config{OnFailure: func(f supervisor.Failure) {
+		events.Emit(context.Background(), events.ComponentFailed, events.Component, f.Component, events.Err, f.Err,
+			events.Restarts, f.Restarts, events.Backoff, f.Backoff)
+	}})
+	if t.opts.PressureInterval > 0 {
+		t.full.monitor = pressure.NewMonitor(pressure.Config{
+			Interval:  t.opts.PressureInterval,
+			Threshold: t.opts.PressureThreshold,
+			Sustain:   t.opts.PressureSustain,
+			OnSustained: func(e pressure.Event) {
+				t.full.capturer.Episode(t.archive, fmt.Sprintf("pressure-%s-%d", e.Resource, time.Now().Unix()), "PRESSURE", "/"+e.Scope+"/"+e.Resource,
+					events.PressureSustained, events.Resource, e.Resource, events.Scope, e.Scope,
+					events.Avg10, e.Avg10, events.Threshold, t.opts.PressureThreshold, events.Since, e.Since)
+			},
+		})
+		if err := t.full.components.Add(supervisor.Component{Name: "pressure", Run: func(ctx context.Context) error {
+			t.full.monitor.Run(ctx)
+			return nil
+		}}); err != nil {
+			return err
+		}
+		if t.opts.FDWarn > 0 {
+			if err := t.full.components.Add(supervisor.Component{Name: "descriptors", Run: t.watchDescriptors}); err != nil {
+				return err
+			}
+		}
+	}
+	return t.full.components.Start(context.Background())
+}
+
+// watchDescriptors captures once each time the open descriptors pass
+// Options.FDWarn of the limit.
+func (t *Toolkit) watchDescriptors(ctx context.Context) error {
+	ticker := time.NewTicker(t.opts.PressureInterval)
+	defer ticker.Stop()
+	var high bool
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		s, err := procstats.Read()
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil || s.FDLimit == 0 {
+			continue
+		}
+		now := s.FDUsage() >= t.opts.FDWarn
+		if now && !high {
+			t.full.capturer.Episode(t.archive, fmt.Sprintf("fds-%d", time.Now().Unix()), "FDS", "/process/fds",
+				events.DescriptorsHigh, events.FDs, s.FDs, events.Limit, s.FDLimit, events.Sockets, s.Sockets)
+		}
+		high = now
+	}
+}
+
+// pressureStatus is the pressure endpoint's response.
+type pressureStatus struct {
+	Reading   *pressure.Reading `json:"reading"`
+	Error     string            `json:"error,omitempty"`
+	Threshold float64           `json:"threshold"`
+	Sustain   string            `json:"sustain"`
+	Events    map[string]uint64 `json:"events"`
+}
+
+func (t *Toolkit) pressureHandler(w http.ResponseWriter, r *http.Request) {
+	if t.full.monitor == nil {
+		http.Error(w, "watchdog disabled, set Options.PressureInterval", http.StatusNotFound)
+		return
+	}
+	status := pressureStatus{Threshold: t.opts.PressureThreshold, Sustain: t.opts.PressureSustain.String(), Events: t.full.monitor.Events()}
+	if reading, err := t.full.monitor.Latest(); err != nil {
+		status.Error = err.Error()
+	} else if !reading.Time.IsZero() {
+		status.Reading = &reading
+	}
+	respond.Write(w, r, status)
+}
+
+// supervisorReport is the supervisor endpoint's response.
+type supervisorReport struct {
+	Healthy    bool                `json:"healthy"`
+	Components []supervisor.Status `json:"components"`
+}
+
+// healthy reports the background components and whether all are healthy.
+func (t *Toolkit) healthy() supervisorReport {
+	rep := supervisorReport{Healthy: true, Components: t.full.components.Status()}
+	for _, s := range rep.Components {
+		rep.Healthy = rep.Healthy && s.Healthy()
+	}
+	return rep
+}
+
+// supervisorHandler answers 503 while a component waits to be restarted.
+func (t *Toolkit) supervisorHandler(w http.ResponseWriter, r *http.Request) {
+	rep := t.healthy()
+	status := http.StatusOK
+	if !rep.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	respond.WriteStatus(w, r, status, rep)
+}
+
+// flightRecorderHandler serves the flight recorder window as an execution
+// trace to open with go tool trace.
+func (t *Toolkit) flightRecorderHandler(w http.ResponseWriter, r *http.Request) {
+	if t.full.capturer == nil {
+		http.Error(w, "flight recorder disabled, set Options.SlowThreshold", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="flightrecorder.trace"`)
+	if err := t.full.capturer.WriteTrace(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<html>
+<head><title>Diagnostics</title></head>
+<body>
+	<h1>Diagnostics</h1>
+	<p>Up {{.Stats.Uptime}}: {{.Stats.Goroutines}} goroutines on {{.Stats.GOMAXPROCS}} Ps,
+	{{.Stats.HeapAllocMB}} MB heap of {{.Stats.SysMB}} MB from the OS, {{.Stats.GCRuns}} GC runs pausing {{.Stats.PauseTotal}}.
+	{{with .Stats.Process}}{{.Threads}} threads, {{.FDs}} open descriptors.{{end}}</p>
+	<p>Captured {{.Stats.Captured}} slow requests and watchdog episodes, {{.Stats.Skipped}} skipped by the cooldown.</p>
+
+	<h2>Background Components</h2>
+	<table>
+		{{range .Health.Components}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td>{{.Restarts}} restarts</td><td>{{.LastError}}</td></tr>
+		{{else}}<tr><td>none</td></tr>{{end}}
+	</table>
+
+	<h2>Captured Requests</h2>
+	<table>
+		{{range .Captured}}<tr><td><a href="{{$.Prefix}}/requests/{{.ID}}">{{.ID}}</a></td><td>{{.Method}} {{.Path}}</td><td>{{.Duration}}</td><td>{{.Artifacts}} artifacts</td></tr>
+		{{else}}<tr><td>none yet</td></tr>{{end}}
+	</table>
+
+	<h2>Endpoints</h2>
+	<table>
+		{{range .Routes}}<tr><td><a href="{{.Pattern}}">{{.Pattern}}</a></td><td>{{.Summary}}</td>{{if $.Access}}<td>{{.Role}}</td>{{end}}</tr>
+		{{end}}
+	</table>
+</body>
+</html>`))
+
+// dashboardHandler renders the statistics, the background components, the
+// captured requests, and links to every endpoint on one page.
+func (t *Toolkit) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardPage.Execute(w, struct {
+		Prefix   string
+		Access   bool
+		Stats    Stats
+		Health   supervisorReport
+		Captured []archive.Summary
+		Routes   []Route
+	}{
+		Prefix:   t.opts.Prefix,
+		Access:   t.policy != nil,
+		Stats:    t.stats(),
+		Health:   t.healthy(),
+		Captured: t.archive.Recent(20, func(s archive.Summary) bool { return s.Artifacts > 0 }),
+		Routes:   t.routes,
+	})
+}
@@ -0,0 +1,120 @@
+package samurai
+
+import (
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	"github.com/vdntruong/gosamurai/procstats"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// Stats is the stats endpoint's response.
+type Stats struct {
+	Uptime       string           `json:"uptime"`
+	Goroutines   int              `json:"goroutines"`
+	GOMAXPROCS   int              `json:"gomaxprocs"`
+	HeapAllocMB  uint64           `json:"heap_alloc_mb"`
+	TotalAllocMB uint64           `json:"total_alloc_mb"`
+	SysMB        uint64           `json:"sys_mb"`
+	GCRuns       uint32           `json:"gc_runs"`
+	PauseTotal   string           `json:"pause_total"`
+	Process      *procstats.Stats `json:"process,omitempty"`
+	// Captured and Skipped count the slow request and watchdog captures,
+	// and those the cooldown skipped.
+	Captured uint64 `json:"captured"`
+	Skipped  uint64 `json:"skipped"`
+}
+
+// stats reads the runtime and the process now.
+func (t *Toolkit) stats() Stats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s := Stats{
+		Uptime:       time.Since(t.started).Round(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		HeapAllocMB:  m.HeapAlloc >> 20,
+		TotalAllocMB: m.TotalAlloc >> 20,
+		SysMB:        m.Sys >> 20,
+		GCRuns:       m.NumGC,
+		PauseTotal:   time.Duration(m.PauseTotalNs).String(),
+	}
+	if ps, err := procstats.Read(); err == nil {
+		s.Process = &ps
+	}
+	s.Captured, s.Skipped = t.captureStats()
+	return s
+}
+
+func (t *Toolkit) statsHandler(w http.ResponseWriter, r *http.Request) {
+	respond.Write(w, r, t.stats())
+}
+
+// Histogram is a runtime/metrics histogram in the metrics response, cut
+// down to its count and quantiles, each the upper bound of the bucket it
+// falls in.
+type Histogram struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// metricsHandler serves every supported runtime/metrics value by name.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for i, d := range descs {
+		samples[i].Name = d.Name
+	}
+	metrics.Read(samples)
+	out := make(map[string]any, len(samples))
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			out[s.Name] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			out[s.Name] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			out[s.Name] = summarize(s.Value.Float64Histogram())
+		}
+	}
+	respond.Write(w, r, out)
+}
+
+// summarize cuts a histogram down to a Histogram. An unbounded last bucket
+// is reported at its lower bound, which JSON can encode.
+func summarize(h *metrics.Float64Histogram) Histogram {
+	var out Histogram
+	for _, c := range h.Counts {
+		out.Count += c
+	}
+	bound := func(i int) float64 {
+		if b := h.Buckets[i+1]; !math.IsInf(b, 1) {
+			return b
+		}
+		return h.Buckets[i]
+	}
+	var seen uint64
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		seen += c
+		for _, q := range []struct {
+			at  float64
+			dst *float64
+		}{{0.5, &out.P50}, {0.9, &out.P90}, {0.99, &out.P99}} {
+			if *q.dst == 0 && float64(seen) >= q.at*float64(out.Count) {
+				*q.dst = bound(i)
+			}
+		}
+		out.Max = bound(i)
+	}
+	return out
+}
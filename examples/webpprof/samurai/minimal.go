@@ -0,0 +1,22 @@
+//go:build samurai_minimal
+
+package samurai
+
+import (
+	"context"
+	"net/http"
+)
+
+// Minimal reports whether this is a samurai_minimal build, without the
+// flight recorder, the watchdog, and the dashboard.
+const Minimal = true
+
+// full is empty: a minimal build has no flight recorder and no watchdog,
+// and the options that configure them are ignored.
+type full struct{}
+
+func (t *Toolkit) startFull() error                         { return nil }
+func (t *Toolkit) attachFull(r Router)                      {}
+func (t *Toolkit) capture(next http.Handler) http.Handler   { return next }
+func (t *Toolkit) captureStats() (captured, skipped uint64) { return 0, 0 }
+func (t *Toolkit) stopFull(ctx context.Context) error       { return nil }
@@ -0,0 +1,179 @@
+package samurai
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The pprof endpoints are served from runtime/pprof and runtime/trace
+// rather than net/http/pprof, whose import registers them on
+// http.DefaultServeMux, so that Attach can use the default mux too and
+// nothing is served outside Options.Access. They answer as net/http/pprof
+// does, so go tool pprof reads them the same way.
+
+// pprofIndex lists the profiles at /pprof/, and serves the one named by the
+// rest of the path below it.
+func (t *Toolkit) pprofIndex(w http.ResponseWriter, r *http.Request) {
+	if name, ok := strings.CutPrefix(r.URL.Path, t.opts.Prefix+"/pprof/"); ok && name != "" {
+		profileHandler(name).ServeHTTP(w, r)
+		return
+	}
+
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var b bytes.Buffer
+	b.WriteString("<html>\n<head><title>pprof</title></head>\n<body>\n<h1>pprof</h1>\n<table>\n<tr><th>Count</th><th>Profile</th></tr>\n")
+	for _, p := range profiles {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(&b, "<tr><td>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), name, name)
+	}
+	b.WriteString("<tr><td></td><td><a href=\"profile\">profile</a> (CPU, ?seconds=30)</td></tr>\n")
+	b.WriteString("<tr><td></td><td><a href=\"trace?seconds=5\">trace</a> (execution trace)</td></tr>\n")
+	b.WriteString("</table>\n<p><a href=\"goroutine?debug=2\">Full goroutine stack dump</a></p>\n</body>\n</html>\n")
+	b.WriteTo(w)
+}
+
+// profileHandler serves the named runtime/pprof profile: in the
+// binary format, or as text with ?debug=1 or 2. ?gc=1 runs a garbage
+// collection before a heap profile.
+func profileHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		p := pprof.Lookup(name)
+		if p == nil {
+			http.Error(w, "Unknown profile", http.StatusNotFound)
+			return
+		}
+		if name == "heap" && r.FormValue("gc") != "" {
+			runtime.GC()
+		}
+		debug, _ := strconv.Atoi(r.FormValue("debug"))
+		if debug != 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		}
+		p.WriteTo(w, debug)
+	})
+}
+
+// pprofCmdline serves the command line, its arguments separated by NUL.
+func pprofCmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// pprofProfile serves a CPU profile of the next ?seconds (default 30).
+func pprofProfile(w http.ResponseWriter, r *http.Request) {
+	d, ok := profileDuration(w, r, 30)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Could not enable CPU profiling: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, d)
+	pprof.StopCPUProfile()
+}
+
+// pprofTrace serves an execution trace of the next ?seconds (default 1).
+func pprofTrace(w http.ResponseWriter, r *http.Request) {
+	d, ok := profileDuration(w, r, 1)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Could not enable tracing: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, d)
+	trace.Stop()
+}
+
+// profileDuration reads ?seconds, rejecting durations the server's write
+// timeout would cut short.
+func profileDuration(w http.ResponseWriter, r *http.Request, def float64) (time.Duration, bool) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	sec := def
+	if v := r.FormValue("seconds"); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil || s <= 0 {
+			http.Error(w, "Bad Request: invalid seconds", http.StatusBadRequest)
+			return 0, false
+		}
+		sec = s
+	}
+	d := time.Duration(sec * float64(time.Second))
+	if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.WriteTimeout > 0 && d >= srv.WriteTimeout {
+		http.Error(w, "Bad Request: profile duration exceeds server's WriteTimeout", http.StatusBadRequest)
+		return 0, false
+	}
+	return d, true
+}
+
+// sleep waits for d or until the client goes away.
+func sleep(r *http.Request, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+}
+
+// pprofSymbol looks up the program counters go tool pprof sends, separated
+// by +, in the query or the POST body, and answers each with its function.
+func pprofSymbol(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	var in *bufio.Reader
+	if r.Method == http.MethodPost {
+		in = bufio.NewReader(r.Body)
+	} else {
+		in = bufio.NewReader(strings.NewReader(r.URL.RawQuery))
+	}
+	var buf bytes.Buffer
+	for {
+		word, err := in.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1]
+		}
+		if pc, _ := strconv.ParseUint(string(word), 0, 64); pc != 0 {
+			if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+				fmt.Fprintf(&buf, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(&buf, "reading request: %v\n", err)
+			}
+			break
+		}
+	}
+	// go tool pprof only checks that symbols are available.
+	fmt.Fprintf(w, "num_symbols: 1\n")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,281 @@
+// Package samurai attaches the webpprof diagnostics to a service of your
+// own in one call: the pprof endpoints behind role-based access control,
+// runtime statistics and metrics, a flight recorder with slow request
+// capture into a request archive, a pressure and descriptor watchdog, and a
+// dashboard linking it all.
+//
+//	diag, err := samurai.Attach(mux, samurai.Options{Access: policy})
+//	...
+//	http.ListenAndServe(":8080", diag.Middleware(mux))
+//
+// Attach takes any router with a Handle(pattern, http.Handler) method, such
+// as *http.ServeMux or a chi router; RouterFunc adapts others, such as echo.
+// Patterns have no method and use {name} wildcards, so they read the same in
+// net/http and chi.
+//
+// Unlike net/http/pprof, importing the package registers nothing, so the
+// pprof endpoints are only served where Attach puts them, behind
+// Options.Access. Attach fails, rather than panics, when the router already
+// has one of its patterns, as http.DefaultServeMux does in a program that
+// imports net/http/pprof.
+//
+// Built with the samurai_minimal tag, the package leaves out the flight
+// recorder, the slow request capture, the watchdog, and the dashboard, and
+// with them runtime/trace's flight recorder, html/template, and the
+// supervisor, for binaries with a tight size or dependency budget. The
+// pprof, stats, metrics, and archive endpoints remain; Minimal reports
+// which build this is.
+package samurai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/gosamurai/throttle"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/rbac"
+	"github.com/vdntruong/gosamurai/examples/webpprof/secure"
+)
+
+// Router is what Attach registers its endpoints on.
+type Router interface {
+	Handle(pattern string, h http.Handler)
+}
+
+// RouterFunc adapts a registration function to Router, for routers whose
+// Handle method has another signature or whose wildcards are written
+// otherwise. The function translates the {name} wildcards and sets them on
+// the request with SetPathValue, where the archive handlers read them; the
+// webpprof README has one for echo.
+type RouterFunc func(pattern string, h http.Handler)
+
+// Handle calls f.
+func (f RouterFunc) Handle(pattern string, h http.Handler) { f(pattern, h) }
+
+// Options configures Attach. The zero value attaches everything under
+// /debug with the webpprof defaults and no access control.
+type Options struct {
+	// Prefix is the path the endpoints are attached under, default /debug.
+	Prefix string
+	// Access, if set, guards every endpoint. A policy without Rules gets
+	// AccessRules(Prefix). Without it the endpoints are open to anyone who
+	// can reach the router, so attach them to one served only internally.
+	Access *rbac.Policy
+
+	// SlowThreshold is the latency above which a request served through
+	// Middleware is captured, default 1s; negative disables the flight
+	// recorder and every capture.
+	SlowThreshold time.Duration
+	// SlowCooldown is the least time between two captures, default 10s.
+	SlowCooldown time.Duration
+	// TraceWindow is how much recent execution trace a capture keeps,
+	// default 10s.
+	TraceWindow time.Duration
+	// ArchiveSize is the number of requests kept in the archive, default
+	// 1000.
+	ArchiveSize int
+
+	// PressureInterval is how often the watchdog reads the pressure stall
+	// information and the open descriptors, default 2s; negative disables
+	// the watchdog.
+	PressureInterval time.Duration
+	// PressureThreshold is the some avg10 percentage above which a resource
+	// is under pressure, default 20.
+	PressureThreshold float64
+	// PressureSustain is how long the pressure must stay above the
+	// threshold to be captured, default 30s.
+	PressureSustain time.Duration
+	// FDWarn is the share of the descriptor limit at which the watchdog
+	// captures, default 0.8; negative disables it.
+	FDWarn float64
+
+	// BlockProfileRate and MutexProfileFraction, if not zero, are set with
+	// runtime.SetBlockProfileRate and runtime.SetMutexProfileFraction.
+	BlockProfileRate     int
+	MutexProfileFraction int
+	// DownloadRate caps the bandwidth of each client's profile and artifact
+	// downloads in bytes a second, with a burst of one second; zero is
+	// unlimited.
+	DownloadRate int64
+}
+
+// withDefaults fills in the zero fields of o.
+func (o Options) withDefaults() Options {
+	if o.Prefix == "" {
+		o.Prefix = "/debug"
+	}
+	o.Prefix = strings.TrimSuffix(o.Prefix, "/")
+	if o.SlowThreshold == 0 {
+		o.SlowThreshold = time.Second
+	}
+	if o.SlowCooldown == 0 {
+		o.SlowCooldown = 10 * time.Second
+	}
+	if o.TraceWindow == 0 {
+		o.TraceWindow = 10 * time.Second
+	}
+	if o.ArchiveSize == 0 {
+		o.ArchiveSize = 1000
+	}
+	if o.PressureInterval == 0 {
+		o.PressureInterval = 2 * time.Second
+	}
+	if o.PressureThreshold == 0 {
+		o.PressureThreshold = 20
+	}
+	if o.PressureSustain == 0 {
+		o.PressureSustain = 30 * time.Second
+	}
+	if o.FDWarn == 0 {
+		o.FDWarn = 0.8
+	}
+	return o
+}
+
+// AccessRules is the minimum role of each endpoint under prefix, the rules
+// webpprof's -rbac-config applies to /debug: viewers may read, operators may
+// also run the CPU profiler, the execution tracer, and the flight recorder,
+// which slow the service down or expose what it is doing right now.
+func AccessRules(prefix string) rbac.Rules {
+	return rbac.Rules{
+		prefix:                     rbac.Viewer,
+		prefix + "/pprof/profile":  rbac.Operator,
+		prefix + "/pprof/trace":    rbac.Operator,
+		prefix + "/flightrecorder": rbac.Operator,
+	}
+}
+
+// Route is one attached endpoint.
+type Route struct {
+	Pattern string    `json:"pattern"`
+	Summary string    `json:"summary"`
+	Role    rbac.Role `json:"role"` // the role it needs with Options.Access
+}
+
+// Toolkit is an attached diagnostics suite.
+type Toolkit struct {
+	opts      Options
+	policy    *rbac.Policy
+	downloads *throttle.Limiter
+	archive   *archive.Archive
+	full      full // the parts samurai_minimal builds leave out
+	routes    []Route
+	started   time.Time
+	err       error // the first pattern the router refused
+}
+
+// Attach registers the diagnostics endpoints on r and starts the flight
+// recorder and the watchdog. Requests served through the returned
+// toolkit's Middleware are archived and captured when slow; Close stops
+// the background work.
+func Attach(r Router, opts Options) (*Toolkit, error) {
+	opts = opts.withDefaults()
+	t := &Toolkit{opts: opts, archive: archive.New(opts.ArchiveSize), started: time.Now()}
+	if opts.Access != nil {
+		p := *opts.Access
+		if p.Rules == nil {
+			p.Rules = AccessRules(opts.Prefix)
+		}
+		t.policy = &p
+	}
+	if opts.DownloadRate > 0 {
+		t.downloads = throttle.NewLimiter(opts.DownloadRate, opts.DownloadRate)
+	}
+	if opts.BlockProfileRate != 0 {
+		runtime.SetBlockProfileRate(opts.BlockProfileRate)
+	}
+	if opts.MutexProfileFraction != 0 {
+		runtime.SetMutexProfileFraction(opts.MutexProfileFraction)
+	}
+	if err := t.startFull(); err != nil {
+		return nil, err
+	}
+
+	t.attachFull(r)
+	t.handle(r, "/pprof/", "pprof profile index", http.HandlerFunc(t.pprofIndex), true)
+	t.handle(r, "/pprof/cmdline", "Command line of the process", http.HandlerFunc(pprofCmdline), false)
+	t.handle(r, "/pprof/profile", "CPU profile (?seconds=)", http.HandlerFunc(pprofProfile), true)
+	t.handle(r, "/pprof/symbol", "Symbol lookup for go tool pprof", http.HandlerFunc(pprofSymbol), false)
+	t.handle(r, "/pprof/trace", "Execution trace (?seconds=)", http.HandlerFunc(pprofTrace), true)
+	// The index serves the named profiles too, but only where the router
+	// matches /pprof/ as a subtree, as http.ServeMux does.
+	for _, name := range []string{"goroutine", "heap", "allocs", "block", "mutex", "threadcreate"} {
+		t.handle(r, "/pprof/"+name, name+" profile", profileHandler(name), true)
+	}
+	t.handle(r, "/stats", "Runtime and process statistics", http.HandlerFunc(t.statsHandler), false)
+	t.handle(r, "/metrics", "Every runtime/metrics value", http.HandlerFunc(metricsHandler), false)
+	t.handle(r, "/requests", "Recently archived requests", http.HandlerFunc(t.archive.ListHandler), false)
+	t.handle(r, "/requests/repeats", "Batching candidates found in the archive", http.HandlerFunc(t.archive.RepeatsHandler), false)
+	t.handle(r, "/requests/{id}", "One archived request by ID", http.HandlerFunc(t.archive.RecordHandler), false)
+	t.handle(r, "/requests/{id}/artifacts/{name}", "A captured artifact of an archived request", http.HandlerFunc(t.archive.ArtifactHandler), true)
+	if t.err != nil {
+		t.stopFull(context.Background())
+		return nil, t.err
+	}
+	return t, nil
+}
+
+// handle registers h under the prefix behind the security headers, the
+// access policy, and, for downloads, the bandwidth limit.
+func (t *Toolkit) handle(r Router, path, summary string, h http.Handler, download bool) {
+	pattern := t.opts.Prefix + path
+	if download && t.downloads != nil {
+		h = t.downloads.Handler(h)
+	}
+	if t.policy != nil {
+		h = t.policy.Handler(h)
+	}
+	if err := register(r, pattern, secure.Debug.Middleware(h)); err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return
+	}
+	route := Route{Pattern: pattern, Summary: summary}
+	if t.policy != nil {
+		route.Role = t.policy.Rules.Required(pattern)
+	}
+	t.routes = append(t.routes, route)
+}
+
+// register calls r.Handle, turning the panic of a pattern r already has,
+// as http.ServeMux reports one, into an error.
+func register(r Router, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("samurai: attach %s: %v", pattern, p)
+		}
+	}()
+	r.Handle(pattern, h)
+	return nil
+}
+
+// Routes returns the attached endpoints in registration order.
+func (t *Toolkit) Routes() []Route {
+	return t.routes
+}
+
+// Archive returns the request archive, for handlers that add phases, log
+// lines, or artifacts to their record.
+func (t *Toolkit) Archive() *archive.Archive {
+	return t.archive
+}
+
+// Middleware archives every request served by next under its request ID
+// and, with a flight recorder, captures the goroutines and the recent
+// execution trace of those slower than Options.SlowThreshold.
+func (t *Toolkit) Middleware(next http.Handler) http.Handler {
+	return archive.Middleware(t.archive, t.capture(next))
+}
+
+// Close stops the watchdog and then the flight recorder. If ctx ends
+// before the watchdog has stopped, Close returns the error and leaves the
+// flight recorder running.
+func (t *Toolkit) Close(ctx context.Context) error {
+	return t.stopFull(ctx)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/search"
+	"github.com/vdntruong/gosamurai/examples/webpprof/timing"
+)
+
+var (
+	firstNames = strings.Fields("Ada Alan Barbara Charles Claude Dennis Donald Edsger Frances Grace " +
+		"Guido Hedy Ivan John Ken Leslie Linus Margaret Niklaus Radia Rob Robert Ruth Shafi Sophie " +
+		"Tim Tony Vint Whitfield Yukihiro")
+	lastNames = strings.Fields("Allen Backus Berners-Lee Cerf Dijkstra Diffie Goldwasser Hamilton " +
+		"Hopper Hoare Kay Knuth Lamarr Lamport Liskov Lovelace Matsumoto McCarthy Perlman Pike " +
+		"Ritchie Rossum Shannon Sutherland Teitelbaum Thompson Torvalds Turing Wilson Wirth")
+	cities      = strings.Fields("Amsterdam Berlin Boston Hanoi Lagos Lima London Madrid Nairobi Osaka Oslo Paris Seoul Sydney Toronto")
+	departments = strings.Fields("billing compilers databases design infrastructure kernels networking research security support")
+	roles       = strings.Fields("admin engineer manager intern viewer")
+)
+
+// searchDemo is an inverted index over generated users, built on the first
+// query and rebuilt on request.
+type searchDemo struct {
+	size int
+
+	// mu serializes builds; queries read the current index and users.
+	mu    sync.RWMutex
+	users []*User
+	index *search.Index
+	built time.Duration
+}
+
+func newSearchDemo(size int) *searchDemo {
+	return &searchDemo{size: size}
+}
+
+// generateSearchUsers makes n users with names, cities, and departments
+// drawn from small lists by r, so common terms have long posting lists.
+func generateSearchUsers(n int, r *rand.Rand) []*User {
+	users := make([]*User, n)
+	now := time.Now()
+	for i := range users {
+		first, last := firstNames[r.IntN(len(firstNames))], lastNames[r.IntN(len(lastNames))]
+		users[i] = &User{
+			ID:        i + 1,
+			Name:      first + " " + last,
+			Email:     fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), i+1),
+			CreatedAt: now,
+			Metadata: map[string]interface{}{
+				"role":       roles[r.IntN(len(roles))],
+				"city":       cities[r.IntN(len(cities))],
+				"department": departments[r.IntN(len(departments))],
+			},
+		}
+	}
+	return users
+}
+
+// build generates the users and indexes them, recording both as phases of
+// the request in ctx. Without force, it does nothing if another request
+// built the index while this one waited.
+func (d *searchDemo) build(ctx context.Context, force bool) {
+	lockStart := time.Now()
+	d.mu.Lock()
+	timing.LockWait(ctx, lockStart)
+	defer d.mu.Unlock()
+	if d.index != nil && !force {
+		return
+	}
+
+	start := time.Now()
+	users := generateSearchUsers(d.size, random.Stream("search"))
+	archive.Track(ctx, "search.generate", start)
+
+	indexStart := time.Now()
+	b := search.NewBuilder()
+	for _, u := range users {
+		b.Add(uint32(u.ID), u.Name, u.Email,
+			u.Metadata["role"].(string), u.Metadata["city"].(string), u.Metadata["department"].(string))
+	}
+	d.index = b.Build()
+	d.users = users
+	d.built = time.Since(indexStart)
+	archive.Track(ctx, "search.index", indexStart)
+}
+
+// current returns the index and its users, building them if needed.
+func (d *searchDemo) current(ctx context.Context, rebuild bool) (*search.Index, []*User, time.Duration) {
+	d.mu.RLock()
+	ix, users, built := d.index, d.users, d.built
+	d.mu.RUnlock()
+	if ix != nil && !rebuild {
+		return ix, users, built
+	}
+	d.build(ctx, rebuild)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.index, d.users, d.built
+}
+
+// searchHandler finds the generated users matching every term of q,
+// /api/users/search?q=grace+hop*&limit=20&rebuild=true
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	ctx := r.Context()
+	ix, users, built := userSearch.current(ctx, r.URL.Query().Get("rebuild") == "true")
+
+	start := time.Now()
+	ids, qs := ix.Search(q)
+	archive.Track(ctx, "search.query", start)
+
+	fetchStart := time.Now()
+	matches := make([]*User, 0, min(limit, len(ids)))
+	for _, id := range ids[:min(limit, len(ids))] {
+		matches = append(matches, users[id-1])
+	}
+	archive.Track(ctx, "search.fetch", fetchStart)
+
+	incrementCounter()
+	respond.Write(w, r, map[string]any{
+		"query":      q,
+		"total":      len(ids),
+		"users":      matches,
+		"query_cost": qs,
+		"index":      ix.Stats(),
+		"build_ns":   built,
+	})
+}
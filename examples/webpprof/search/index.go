@@ -0,0 +1,201 @@
+// Package search is a small in-memory inverted index: documents are split
+// into lowercase terms, each term maps to the sorted list of documents
+// containing it, and queries intersect and merge those posting lists.
+package search
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lowercase terms at every character that is not
+// a letter or digit.
+func Tokenize(text string) []string {
+	terms := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, t := range terms {
+		terms[i] = strings.ToLower(t)
+	}
+	return terms
+}
+
+// Builder collects documents for an Index. Documents must be added in
+// increasing ID order, which keeps every posting list sorted as it grows.
+type Builder struct {
+	postings map[string][]uint32
+	docs     int
+}
+
+// NewBuilder returns an empty builder.
+func NewBuilder() *Builder {
+	return &Builder{postings: make(map[string][]uint32)}
+}
+
+// Add indexes the fields of document id.
+func (b *Builder) Add(id uint32, fields ...string) {
+	for _, f := range fields {
+		for _, t := range Tokenize(f) {
+			list := b.postings[t]
+			if n := len(list); n > 0 && list[n-1] == id {
+				continue // term repeated within the document
+			}
+			b.postings[t] = append(list, id)
+		}
+	}
+	b.docs++
+}
+
+// Build returns the index of the documents added so far.
+func (b *Builder) Build() *Index {
+	ix := &Index{terms: make([]string, 0, len(b.postings)), docs: b.docs}
+	for t := range b.postings {
+		ix.terms = append(ix.terms, t)
+	}
+	slices.Sort(ix.terms)
+	ix.postings = make([][]uint32, len(ix.terms))
+	for i, t := range ix.terms {
+		ix.postings[i] = slices.Clip(b.postings[t])
+	}
+	return ix
+}
+
+// Index is immutable and safe for concurrent use.
+type Index struct {
+	terms    []string // sorted
+	postings [][]uint32
+	docs     int
+}
+
+// IndexStats describes the size of an index.
+type IndexStats struct {
+	Docs     int `json:"docs"`
+	Terms    int `json:"terms"`
+	Postings int `json:"postings"`
+}
+
+// Stats returns the size of the index.
+func (ix *Index) Stats() IndexStats {
+	s := IndexStats{Docs: ix.docs, Terms: len(ix.terms)}
+	for _, p := range ix.postings {
+		s.Postings += len(p)
+	}
+	return s
+}
+
+// Lookup returns the posting list of term, nil if no document has it.
+func (ix *Index) Lookup(term string) []uint32 {
+	if i, ok := slices.BinarySearch(ix.terms, term); ok {
+		return ix.postings[i]
+	}
+	return nil
+}
+
+// Prefix returns the posting lists of every term starting with prefix.
+func (ix *Index) Prefix(prefix string) [][]uint32 {
+	i, _ := slices.BinarySearch(ix.terms, prefix)
+	var lists [][]uint32
+	for ; i < len(ix.terms) && strings.HasPrefix(ix.terms[i], prefix); i++ {
+		lists = append(lists, ix.postings[i])
+	}
+	return lists
+}
+
+// QueryStats counts the work a query did.
+type QueryStats struct {
+	Terms int `json:"terms"`
+	// Lists is the posting lists read, and Postings their total length.
+	Lists    int `json:"lists"`
+	Postings int `json:"postings"`
+}
+
+// Search returns the documents matching every term of query, in ID order.
+// A term ending in "*" matches every term with that prefix.
+func (ix *Index) Search(query string) ([]uint32, QueryStats) {
+	var st QueryStats
+	var lists [][]uint32
+	for _, field := range strings.Fields(query) {
+		prefix := strings.HasSuffix(field, "*")
+		terms := Tokenize(field)
+		for i, t := range terms {
+			st.Terms++
+			var list []uint32
+			if prefix && i == len(terms)-1 {
+				matches := ix.Prefix(t)
+				for _, m := range matches {
+					st.Lists++
+					st.Postings += len(m)
+				}
+				list = Union(matches...)
+			} else {
+				list = ix.Lookup(t)
+				st.Lists++
+				st.Postings += len(list)
+			}
+			lists = append(lists, list)
+		}
+	}
+	if len(lists) == 0 {
+		return nil, st
+	}
+	// Intersecting the shortest lists first keeps the intermediate
+	// results small.
+	slices.SortFunc(lists, func(a, b []uint32) int { return len(a) - len(b) })
+	result := lists[0]
+	for _, l := range lists[1:] {
+		if len(result) == 0 {
+			break
+		}
+		result = Intersect(result, l)
+	}
+	return result, st
+}
+
+// Intersect returns the IDs in both sorted lists.
+func Intersect(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, min(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Union merges sorted lists into one sorted list without duplicates.
+func Union(lists ...[]uint32) []uint32 {
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+	mid := len(lists) / 2
+	a, b := Union(lists[:mid]...), Union(lists[mid:]...)
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
@@ -0,0 +1,90 @@
+package secure
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/session"
+)
+
+const (
+	// TokenField is the form field carrying the CSRF token.
+	TokenField = "csrf_token"
+	// TokenHeader carries the CSRF token for requests made from scripts.
+	TokenHeader = "X-CSRF-Token"
+
+	sessionKey = "csrf"
+)
+
+// Token returns the CSRF token of the request's session, creating it on first
+// use. Pages put it in a hidden TokenField of every form that posts back.
+func Token(r *http.Request) string {
+	s := session.FromContext(r.Context())
+	if s == nil {
+		return ""
+	}
+	if t := s.Get(sessionKey); t != "" {
+		return t
+	}
+	var b [32]byte
+	rand.Read(b[:])
+	t := hex.EncodeToString(b[:])
+	s.Set(sessionKey, t)
+	return t
+}
+
+// CSRF rejects state-changing requests (anything but GET, HEAD, OPTIONS, and
+// TRACE) that do not carry the session's token, or that a browser reports as
+// coming from another origin. It must run inside session.Manager.Middleware.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !sameOrigin(r) || !validToken(r) {
+			events.Emit(r.Context(), events.CrossSiteRejected, events.Method, r.Method, events.Path, r.URL.Path)
+			http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validToken(r *http.Request) bool {
+	s := session.FromContext(r.Context())
+	if s == nil {
+		return false
+	}
+	want := s.Get(sessionKey)
+	got := r.Header.Get(TokenHeader)
+	if got == "" {
+		got = r.PostFormValue(TokenField)
+	}
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// sameOrigin checks the Origin header browsers send with POSTs; requests
+// without one (non-browser clients) are left to the token check.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// ResetToken drops the session's token so the next Token call issues a new
+// one. Call it when the session's privileges change, such as on login.
+func ResetToken(r *http.Request) {
+	if s := session.FromContext(r.Context()); s != nil {
+		s.Delete(sessionKey)
+	}
+}
@@ -0,0 +1,97 @@
+// Package secure adds browser-facing protections: standard security
+// response headers, chosen per route group, and CSRF tokens for
+// state-changing requests made from the admin UI.
+package secure
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers is a set of security response headers. Empty fields are not sent.
+type Headers struct {
+	ContentSecurityPolicy string
+	// HSTSMaxAge enables Strict-Transport-Security on TLS requests.
+	HSTSMaxAge     time.Duration
+	FrameOptions   string
+	ReferrerPolicy string
+	// NoSniff sends X-Content-Type-Options: nosniff.
+	NoSniff bool
+}
+
+var (
+	// API suits endpoints returning data that is never rendered as a page.
+	API = Headers{
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		NoSniff:               true,
+	}
+	// UI suits server-rendered pages without inline scripts or styles.
+	UI = Headers{
+		ContentSecurityPolicy: "default-src 'self'; frame-ancestors 'none'; form-action 'self'; base-uri 'none'",
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "same-origin",
+		NoSniff:               true,
+	}
+	// Debug suits the pprof and debug pages, which are downloaded or
+	// opened directly, so only framing and sniffing are restricted.
+	Debug = Headers{
+		FrameOptions:   "DENY",
+		ReferrerPolicy: "no-referrer",
+		NoSniff:        true,
+	}
+)
+
+// Set writes the headers to w.
+func (h Headers) Set(w http.ResponseWriter, r *http.Request) {
+	hdr := w.Header()
+	if h.ContentSecurityPolicy != "" {
+		hdr.Set("Content-Security-Policy", h.ContentSecurityPolicy)
+	}
+	if h.HSTSMaxAge > 0 && r.TLS != nil {
+		hdr.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(h.HSTSMaxAge.Seconds()))+"; includeSubDomains")
+	}
+	if h.FrameOptions != "" {
+		hdr.Set("X-Frame-Options", h.FrameOptions)
+	}
+	if h.ReferrerPolicy != "" {
+		hdr.Set("Referrer-Policy", h.ReferrerPolicy)
+	}
+	if h.NoSniff {
+		hdr.Set("X-Content-Type-Options", "nosniff")
+	}
+}
+
+// Middleware sets the headers on every response of next.
+func (h Headers) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Set(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Groups picks the headers of a request by the longest matching path prefix,
+// so a whole route group is configured in one place:
+//
+//	secure.Groups{"/api/": secure.API, "/admin": secure.UI}.Handler(mux, secure.UI)
+type Groups map[string]Headers
+
+// Handler serves next with the headers of each request's group, or fallback
+// when no prefix matches.
+func (g Groups) Handler(next http.Handler, fallback Headers) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, best := fallback, ""
+		for prefix, headers := range g {
+			if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(best) {
+				h, best = headers, prefix
+			}
+		}
+		h.Set(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
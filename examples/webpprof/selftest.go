@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+
+	"github.com/vdntruong/gosamurai/preflight"
+)
+
+// runSelfTest checks the environment the flags describe and exits non-zero
+// if a check failed.
+func runSelfTest() {
+	checks := []preflight.Check{
+		preflight.Port(":8080"),
+		preflight.ProfileRates(),
+		preflight.CPUProfiler(),
+		preflight.Writable(""),
+	}
+	for _, dir := range []string{*metricsDir, *sessionDir} {
+		if dir != "" {
+			checks = append(checks, preflight.Creatable(dir))
+		}
+	}
+	for _, path := range []string{*rbacConfig, *tlsCert, *tlsKey, *clientCA} {
+		if path != "" {
+			checks = append(checks, preflight.Readable(path))
+		}
+	}
+	checks = append(checks, preflight.Cgroup(), preflight.ClockResolution())
+
+	report := preflight.Run(checks...)
+	report.WriteText(os.Stdout)
+	if !report.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
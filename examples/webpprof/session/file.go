@@ -0,0 +1,151 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FileStore keeps one JSON file per session in a directory, so sessions
+// survive restarts and can be shared by processes on the same host.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex // serializes writes, and a sweep's recheck with them
+	n   atomic.Int64
+}
+
+// NewFileStore opens or creates a store in dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("session: create dir: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	f := &FileStore{dir: dir}
+	f.n.Store(int64(len(files)))
+	return f, nil
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+// Load implements Store.
+func (f *FileStore) Load(id string) (*Session, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session: %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Save implements Store. The file is replaced atomically.
+func (f *FileStore) Save(s *Session) error {
+	path, err := f.path(s.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, statErr := os.Stat(path)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if errors.Is(statErr, os.ErrNotExist) {
+		f.n.Add(1)
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (f *FileStore) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.removeLocked(path)
+}
+
+func (f *FileStore) removeLocked(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err == nil {
+		f.n.Add(-1)
+	}
+	return err
+}
+
+// Sweep implements Store.
+func (f *FileStore) Sweep(expired func(*Session) bool) (int, error) {
+	files, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, path := range files {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		if s, err := f.Load(id); err != nil || !expired(s) {
+			continue
+		}
+		// A Save since the Load may have refreshed the session, so it is
+		// read again with writes held off before it goes.
+		removed, err := f.removeExpired(id, path, expired)
+		if err != nil {
+			return n, err
+		}
+		if removed {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *FileStore) removeExpired(id, path string, expired func(*Session) bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, err := f.Load(id)
+	if err != nil || !expired(s) {
+		return false, nil
+	}
+	return true, f.removeLocked(path)
+}
+
+// Len implements Store.
+func (f *FileStore) Len() int {
+	return int(f.n.Load())
+}
@@ -0,0 +1,341 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisTimeout bounds every exchange with the server, dialing included.
+const redisTimeout = 5 * time.Second
+
+// RedisStore keeps each session as a JSON string in Redis under
+// "session:<id>", and the IDs in the set "session:ids" for Len and Sweep, so
+// any number of processes can share the sessions. It speaks the Redis
+// protocol itself over a small pool of connections. Every Save sets a TTL,
+// so Redis drops the sessions no sweep got to.
+type RedisStore struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	ttl      time.Duration
+	idle     chan *redisConn
+}
+
+// NewRedisStore connects to the server at rawURL,
+// redis://[[user]:password@]host[:port][/db]. A session expires from Redis
+// ttl after its last Save; the Manager's sweep usually ends it long before,
+// and ttl <= 0 leaves it to the sweep alone.
+func NewRedisStore(rawURL string, ttl time.Duration) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("session: invalid Redis URL %q, want redis://host:port/db", rawURL)
+	}
+	r := &RedisStore{addr: u.Host, ttl: ttl, idle: make(chan *redisConn, 8)}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("session: invalid Redis database %q", db)
+		}
+	}
+	if err := r.with(func(c *redisConn) error { return c.do("PING").err }); err != nil {
+		return nil, fmt.Errorf("session: redis %s: %w", r.addr, err)
+	}
+	return r, nil
+}
+
+const (
+	redisPrefix = "session:"
+	redisIDs    = redisPrefix + "ids"
+)
+
+// Load implements Store.
+func (r *RedisStore) Load(id string) (*Session, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	var s *Session
+	err := r.with(func(c *redisConn) (err error) {
+		s, err = c.load(id)
+		return err
+	})
+	return s, err
+}
+
+// Save implements Store.
+func (r *RedisStore) Save(s *Session) error {
+	if !validID(s.ID) {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	set := []string{"SET", redisPrefix + s.ID, string(data)}
+	if r.ttl > 0 {
+		set = append(set, "PX", strconv.FormatInt(r.ttl.Milliseconds(), 10))
+	}
+	return r.with(func(c *redisConn) error {
+		return c.pipeline(set, []string{"SADD", redisIDs, s.ID})
+	})
+}
+
+// Delete implements Store.
+func (r *RedisStore) Delete(id string) error {
+	if !validID(id) {
+		return nil
+	}
+	return r.with(func(c *redisConn) error {
+		return c.pipeline([]string{"DEL", redisPrefix + id}, []string{"SREM", redisIDs, id})
+	})
+}
+
+// Sweep implements Store. Sessions whose key Redis has expired count as
+// deleted as well. An expired session is deleted in a transaction watching
+// its key, so a Save from another request or process since it was read
+// keeps it.
+func (r *RedisStore) Sweep(expired func(*Session) bool) (int, error) {
+	n := 0
+	err := r.with(func(c *redisConn) error {
+		cursor := "0"
+		for {
+			rep := c.do("SSCAN", redisIDs, cursor, "COUNT", "100")
+			if rep.err != nil {
+				return rep.err
+			}
+			if len(rep.array) != 2 {
+				return errors.New("unexpected SSCAN reply")
+			}
+			cursor = rep.array[0].str
+			for _, id := range rep.array[1].array {
+				removed, err := c.removeExpired(id.str, expired)
+				if err != nil {
+					return err
+				}
+				if removed {
+					n++
+				}
+			}
+			if cursor == "0" {
+				return nil
+			}
+		}
+	})
+	return n, err
+}
+
+// Len implements Store. It is the size of the ID set, which still holds
+// the sessions Redis expired since the last sweep.
+func (r *RedisStore) Len() int {
+	var n int64
+	r.with(func(c *redisConn) error {
+		rep := c.do("SCARD", redisIDs)
+		n = rep.int
+		return rep.err
+	})
+	return int(n)
+}
+
+// with runs fn on an idle connection, or a new one, and returns it to the
+// pool unless the exchange failed below the protocol.
+func (r *RedisStore) with(fn func(c *redisConn) error) error {
+	var c *redisConn
+	select {
+	case c = <-r.idle:
+	default:
+		var err error
+		if c, err = r.dial(); err != nil {
+			return err
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	err := fn(c)
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		c.conn.Close()
+		return err
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+	return err
+}
+
+func (r *RedisStore) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", r.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	var setup [][]string
+	switch {
+	case r.user != "":
+		setup = append(setup, []string{"AUTH", r.user, r.password})
+	case r.password != "":
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	if err := c.pipeline(setup...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the session id, ErrNotFound if its key is gone.
+func (c *redisConn) load(id string) (*Session, error) {
+	rep := c.do("GET", redisPrefix+id)
+	if rep.err != nil {
+		return nil, rep.err
+	}
+	if rep.null {
+		return nil, ErrNotFound
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(rep.str), &s); err != nil {
+		return nil, fmt.Errorf("session: redis %s: %w", redisPrefix+id, err)
+	}
+	return &s, nil
+}
+
+// removeExpired deletes the session id if Redis has expired its key or
+// expired returns true, unless the key changes between the check and the
+// delete.
+func (c *redisConn) removeExpired(id string, expired func(*Session) bool) (bool, error) {
+	if rep := c.do("WATCH", redisPrefix+id); rep.err != nil {
+		return false, rep.err
+	}
+	s, err := c.load(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.do("UNWATCH")
+		return false, err
+	}
+	if s != nil && !expired(s) {
+		return false, c.do("UNWATCH").err
+	}
+	if err := c.pipeline([]string{"MULTI"}, []string{"DEL", redisPrefix + id}, []string{"SREM", redisIDs, id}); err != nil {
+		return false, err
+	}
+	rep := c.do("EXEC")
+	// A null reply means the key changed and nothing was deleted.
+	return rep.err == nil && !rep.null, rep.err
+}
+
+// redisConn is one connection speaking RESP, the Redis protocol.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisReply is a decoded reply. A bulk string or array of length -1 is
+// null; an error reply is err, a redisError.
+type redisReply struct {
+	str   string
+	int   int64
+	array []redisReply
+	null  bool
+	err   error
+}
+
+// redisError is an error reply of the server. The connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do sends one command and reads its reply.
+func (c *redisConn) do(args ...string) redisReply {
+	c.write(args)
+	if err := c.w.Flush(); err != nil {
+		return redisReply{err: err}
+	}
+	return c.read()
+}
+
+// pipeline sends the commands in one write and reads their replies,
+// returning the first error.
+func (c *redisConn) pipeline(cmds ...[]string) error {
+	for _, args := range cmds {
+		c.write(args)
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	var first error
+	for range cmds {
+		if rep := c.read(); rep.err != nil && first == nil {
+			first = rep.err
+		}
+	}
+	return first
+}
+
+func (c *redisConn) write(args []string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+func (c *redisConn) read() redisReply {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return redisReply{err: err}
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return redisReply{err: errors.New("redis: empty reply")}
+	}
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return redisReply{str: body}
+	case '-':
+		return redisReply{err: redisError(body)}
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		return redisReply{int: n, err: err}
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return redisReply{null: true, err: err}
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return redisReply{err: err}
+		}
+		return redisReply{str: string(buf[:n])}
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return redisReply{null: true, err: err}
+		}
+		rep := redisReply{array: make([]redisReply, n)}
+		for i := range rep.array {
+			if rep.array[i] = c.read(); rep.array[i].err != nil && rep.err == nil {
+				rep.err = rep.array[i].err
+			}
+		}
+		return rep
+	}
+	return redisReply{err: fmt.Errorf("redis: unexpected reply %q", line)}
+}
@@ -0,0 +1,307 @@
+// Package session keeps per-visitor state behind an unguessable cookie.
+// Sessions expire after an idle timeout and an absolute lifetime, are kept in
+// a pluggable Store (in memory, on disk, or in Redis), and the manager counts
+// how many are alive, so session-store growth can be watched like any other
+// memory pattern.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for an unknown session ID.
+var ErrNotFound = errors.New("session: not found")
+
+// Session is one visitor's state.
+type Session struct {
+	ID       string            `json:"id"`
+	Values   map[string]string `json:"values,omitempty"`
+	Created  time.Time         `json:"created"`
+	LastSeen time.Time         `json:"last_seen"`
+
+	mu sync.Mutex
+}
+
+// Get returns a value of the session.
+func (s *Session) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Values[key]
+}
+
+// Set stores a value in the session; it is saved when the request ends.
+func (s *Session) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+	s.Values[key] = value
+}
+
+// Delete removes a value from the session.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Values, key)
+}
+
+func (s *Session) clone() *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Session{ID: s.ID, Values: maps.Clone(s.Values), Created: s.Created, LastSeen: s.LastSeen}
+}
+
+// Config configures a Manager. Zero values select the defaults.
+type Config struct {
+	// CookieName defaults to "session".
+	CookieName string
+	// IdleTimeout ends a session not seen for this long (default 30m).
+	IdleTimeout time.Duration
+	// MaxLifetime ends a session this long after it was created, however
+	// active it is (default 12h).
+	MaxLifetime time.Duration
+	// Secure sets the cookie's Secure attribute even on plain HTTP requests;
+	// it is always set on TLS requests.
+	Secure bool
+	// SweepInterval is how often expired sessions are removed from the
+	// store (default 1m).
+	SweepInterval time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.CookieName == "" {
+		c.CookieName = "session"
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 30 * time.Minute
+	}
+	if c.MaxLifetime <= 0 {
+		c.MaxLifetime = 12 * time.Hour
+	}
+	if c.SweepInterval <= 0 {
+		c.SweepInterval = time.Minute
+	}
+}
+
+// Stats counts sessions since the manager started.
+type Stats struct {
+	Active  int    `json:"active"`
+	Peak    int    `json:"peak"`
+	Created uint64 `json:"created"`
+	Expired uint64 `json:"expired"`
+	Ended   uint64 `json:"ended"`
+}
+
+// Manager loads and saves the session of every request it serves.
+type Manager struct {
+	cfg   Config
+	store Store
+
+	created atomic.Uint64
+	expired atomic.Uint64
+	ended   atomic.Uint64
+	peak    atomic.Int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewManager returns a manager keeping sessions in store and starts its
+// expiry sweeper.
+func NewManager(store Store, cfg Config) *Manager {
+	cfg.setDefaults()
+	m := &Manager{
+		cfg:   cfg,
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go m.sweepLoop()
+	return m
+}
+
+// Close stops the sweeper.
+func (m *Manager) Close() {
+	close(m.stop)
+	<-m.done
+}
+
+type sessionKey struct{}
+
+// FromContext returns the session of the request being served, or nil.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Middleware attaches the visitor's session to the request context, starting
+// a new one when the cookie is missing, unknown, or expired, and saves it
+// after next returns.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		s := m.load(r, now)
+		if s == nil {
+			s = m.start(w, r, now)
+		}
+		s.LastSeen = now
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, s)))
+
+		if s.ID != "" {
+			m.store.Save(s.clone())
+		}
+	})
+}
+
+func (m *Manager) load(r *http.Request, now time.Time) *Session {
+	c, err := r.Cookie(m.cfg.CookieName)
+	if err != nil {
+		return nil
+	}
+	s, err := m.store.Load(c.Value)
+	if err != nil {
+		return nil
+	}
+	if m.expiredAt(s, now) {
+		m.store.Delete(s.ID)
+		m.expired.Add(1)
+		return nil
+	}
+	return s
+}
+
+func (m *Manager) start(w http.ResponseWriter, r *http.Request, now time.Time) *Session {
+	s := &Session{ID: newID(), Created: now}
+	m.created.Add(1)
+	m.setCookie(w, r, s.ID, now)
+	if n := int64(m.store.Len() + 1); n > m.peak.Load() {
+		m.peak.Store(n)
+	}
+	return s
+}
+
+// Renew gives the request's session a new ID, keeping its values. Call it
+// when the visitor's privileges change, such as on login, so an ID planted
+// before login is worthless afterwards.
+func (m *Manager) Renew(w http.ResponseWriter, r *http.Request) {
+	s := FromContext(r.Context())
+	if s == nil {
+		return
+	}
+	m.store.Delete(s.ID)
+	s.mu.Lock()
+	s.ID = newID()
+	s.mu.Unlock()
+	m.setCookie(w, r, s.ID, time.Now())
+}
+
+// End deletes the request's session and its cookie.
+func (m *Manager) End(w http.ResponseWriter, r *http.Request) {
+	s := FromContext(r.Context())
+	if s == nil {
+		return
+	}
+	m.store.Delete(s.ID)
+	m.ended.Add(1)
+	s.mu.Lock()
+	s.ID = "" // not saved again by the middleware
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name: m.cfg.CookieName, Value: "", Path: "/", MaxAge: -1,
+		HttpOnly: true, Secure: m.cfg.Secure || r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, r *http.Request, id string, now time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  now.Add(m.cfg.MaxLifetime),
+		HttpOnly: true,
+		Secure:   m.cfg.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (m *Manager) expiredAt(s *Session, now time.Time) bool {
+	return now.Sub(s.LastSeen) > m.cfg.IdleTimeout || now.Sub(s.Created) > m.cfg.MaxLifetime
+}
+
+// Stats returns the session counters.
+func (m *Manager) Stats() Stats {
+	return Stats{
+		Active:  m.store.Len(),
+		Peak:    int(m.peak.Load()),
+		Created: m.created.Load(),
+		Expired: m.expired.Load(),
+		Ended:   m.ended.Load(),
+	}
+}
+
+// Export returns a copy of every stored session, expired or not, for a
+// snapshot of the application's state.
+func (m *Manager) Export() ([]*Session, error) {
+	var all []*Session
+	// A sweep that expires nothing visits every session.
+	_, err := m.store.Sweep(func(s *Session) bool {
+		all = append(all, s.clone())
+		return false
+	})
+	return all, err
+}
+
+// Import saves sessions taken by Export into the store. Expired ones are
+// removed by the next sweep, as if they had been kept all along.
+func (m *Manager) Import(all []*Session) error {
+	for _, s := range all {
+		if err := m.store.Save(s); err != nil {
+			return err
+		}
+	}
+	if n := int64(m.store.Len()); n > m.peak.Load() {
+		m.peak.Store(n)
+	}
+	return nil
+}
+
+func (m *Manager) sweepLoop() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			n, _ := m.store.Sweep(func(s *Session) bool { return m.expiredAt(s, now) })
+			m.expired.Add(uint64(n))
+		}
+	}
+}
+
+// newID returns 32 random bytes, hex encoded.
+func newID() string {
+	var b [32]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validID reports whether id looks like one newID made. IDs come from
+// cookies, so stores only accept those before using one as a file name or
+// a key.
+func validID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 64
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"maps"
+	"sync"
+)
+
+// Store persists sessions. Implementations must be safe for concurrent use
+// and must not retain the *Session passed to Save: the caller may keep
+// changing it, so a store that keeps sessions as they are stores a copy.
+type Store interface {
+	// Load returns the session with the given ID, or ErrNotFound.
+	Load(id string) (*Session, error)
+	Save(s *Session) error
+	Delete(id string) error
+	// Sweep deletes the sessions for which expired returns true and reports
+	// how many it deleted.
+	Sweep(expired func(*Session) bool) (int, error)
+	// Len is the number of stored sessions.
+	Len() int
+}
+
+// MemoryStore keeps sessions in a map.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(id string) (*Session, error) {
+	m.mu.RLock()
+	s, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Session{ID: s.ID, Values: maps.Clone(s.Values), Created: s.Created, LastSeen: s.LastSeen}, nil
+}
+
+// Save implements Store. It stores a copy of s.
+func (m *MemoryStore) Save(s *Session) error {
+	c := s.clone()
+	m.mu.Lock()
+	m.sessions[c.ID] = c
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// Sweep implements Store.
+func (m *MemoryStore) Sweep(expired func(*Session) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, s := range m.sessions {
+		if expired(s) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Len implements Store.
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/cache"
+	"github.com/vdntruong/gosamurai/examples/webpprof/hashring"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// shardedCache is a set of in-process cache shards addressed by a
+// consistent hashing ring, standing in for a cache cluster.
+type shardedCache struct {
+	capacity int
+
+	// flight coalesces concurrent misses for a key, so a hot key missing
+	// from its shard is filled from the store once rather than by every
+	// request that missed it.
+	flight           cache.Group[string, []byte]
+	fills, coalesced atomic.Uint64
+
+	// mu is held exclusively while shards are added, removed, and
+	// rebalanced, so lookups wait for a rebalance to finish.
+	mu     sync.RWMutex
+	ring   *hashring.Ring
+	shards map[string]*cache.LRU[string, []byte]
+}
+
+func newShardedCache(n, vnodes, capacity int) *shardedCache {
+	c := &shardedCache{
+		capacity: capacity,
+		ring:     hashring.New(vnodes),
+		shards:   make(map[string]*cache.LRU[string, []byte]),
+	}
+	c.resize(n)
+	return c
+}
+
+func shardName(i int) string { return "shard-" + strconv.Itoa(i) }
+
+// get looks key up on its shard, filling it on a miss.
+func (c *shardedCache) get(key string) (shard string, hit bool) {
+	c.mu.RLock()
+	shard = c.ring.Get(key)
+	_, hit = c.shards[shard].Get(key)
+	c.mu.RUnlock()
+	if hit {
+		return shard, true
+	}
+	_, _, shared := c.flight.Do(key, func() ([]byte, error) { return c.fill(key), nil })
+	if shared {
+		c.coalesced.Add(1)
+	}
+	return shard, false
+}
+
+// fill reads key from the store, a zeroed value here, and stores it on the
+// shard that owns the key now, which a resize may have changed.
+func (c *shardedCache) fill(key string) []byte {
+	c.fills.Add(1)
+	v := make([]byte, 256)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.shards[c.ring.Get(key)].Set(key, v)
+	return v
+}
+
+// ShardResize reports what changing the number of shards cost.
+type ShardResize struct {
+	Ring hashring.Rebalance `json:"ring"`
+	// EntriesMoved is the cached entries that changed shard, and
+	// Migration how long moving them took with lookups blocked.
+	EntriesMoved int           `json:"entries_moved"`
+	Migration    time.Duration `json:"migration_ns"`
+}
+
+// resize adds or removes shards until there are n, moving cached entries
+// to their new owners. Removed shards hand over their entries first.
+func (c *shardedCache) resize(n int) ShardResize {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res ShardResize
+	var add, remove []string
+	for i := range max(n, len(c.shards)) {
+		name := shardName(i)
+		_, exists := c.shards[name]
+		switch {
+		case i < n && !exists:
+			add = append(add, name)
+			c.shards[name] = cache.NewLRU[string, []byte](c.capacity)
+		case i >= n && exists:
+			remove = append(remove, name)
+		}
+	}
+	switch {
+	case len(add) > 0:
+		res.Ring = c.ring.Add(add...)
+	case len(remove) > 0:
+		res.Ring = c.ring.Remove(remove...)
+	}
+
+	start := time.Now()
+	type move struct {
+		key   string
+		value []byte
+		to    string
+	}
+	for name, s := range c.shards {
+		var moves []move
+		s.Range(func(key string, value []byte) bool {
+			if owner := c.ring.Get(key); owner != name {
+				moves = append(moves, move{key, value, owner})
+			}
+			return true
+		})
+		for _, m := range moves {
+			s.Delete(m.key)
+			c.shards[m.to].Set(m.key, m.value)
+		}
+		res.EntriesMoved += len(moves)
+	}
+	for _, name := range remove {
+		delete(c.shards, name)
+	}
+	res.Migration = time.Since(start)
+	return res
+}
+
+// ShardStats describes one shard.
+type ShardStats struct {
+	Name string `json:"name"`
+	// Share is the share of the key space the shard owns.
+	Share float64     `json:"share"`
+	Len   int         `json:"len"`
+	Stats cache.Stats `json:"stats"`
+}
+
+func (c *shardedCache) stats() []ShardStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	shares := c.ring.Shares()
+	out := make([]ShardStats, 0, len(c.shards))
+	for _, name := range c.ring.Nodes() {
+		s := c.shards[name]
+		out = append(out, ShardStats{Name: name, Share: shares[name], Len: s.Len(), Stats: s.Stats()})
+	}
+	return out
+}
+
+// shardsHandler reports every shard, and with key, where that key and its
+// replicas live.
+// /api/shards?key=user:42
+func shardsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{"shards": shardCache.stats(), "fills": shardCache.fills.Load(), "coalesced": shardCache.coalesced.Load()}
+	if key := r.URL.Query().Get("key"); key != "" {
+		shard, hit := shardCache.get(key)
+		cacheKey("shards", key)
+		resp["key"] = key
+		resp["shard"] = shard
+		resp["hit"] = hit
+		resp["replicas"] = shardCache.ring.GetN(key, 3)
+	}
+	incrementCounter()
+	respond.Write(w, r, resp)
+}
+
+// shardsLoadHandler runs requests lookups of random keys and reports how
+// much of their time the ring lookup took, up to ten million lookups over
+// up to a million keys.
+// /api/shards/load?requests=100000&keys=50000
+func shardsLoadHandler(w http.ResponseWriter, r *http.Request) {
+	requests, ok := intParam(w, r, "requests", 100000, 10_000_000)
+	if !ok {
+		return
+	}
+	keys, ok := intParam(w, r, "keys", 50000, 1_000_000)
+	if !ok {
+		return
+	}
+
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = "user:" + strconv.Itoa(i)
+	}
+
+	var hits int
+	rng := random.Next("shards.load")
+	start := time.Now()
+	for i := range requests {
+		if i%4096 == 0 && clientGone(w, r, "shards.load") {
+			return
+		}
+		if _, hit := shardCache.get(names[rng.IntN(keys)]); hit {
+			hits++
+		}
+	}
+	total := time.Since(start)
+
+	// Time the ring alone over the same number of lookups.
+	start = time.Now()
+	for i := range requests {
+		shardCache.ring.Get(names[i%keys])
+	}
+	ring := time.Since(start)
+
+	incrementCounter()
+	respond.Write(w, r, map[string]any{
+		"requests":        requests,
+		"hit_rate":        float64(hits) / float64(max(requests, 1)),
+		"duration":        total.String(),
+		"ns_per_lookup":   total.Nanoseconds() / int64(max(requests, 1)),
+		"ring_ns_per_get": ring.Nanoseconds() / int64(max(requests, 1)),
+		"fills":           shardCache.fills.Load(),
+		"coalesced":       shardCache.coalesced.Load(),
+		"shards":          shardCache.stats(),
+	})
+}
+
+// shardsResizeHandler changes the number of shards.
+// /api/shards/resize?n=5
+func shardsResizeHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 1 || n > 64 {
+		http.Error(w, "n must be between 1 and 64", http.StatusBadRequest)
+		return
+	}
+	res := shardCache.resize(n)
+	incrementCounter()
+	respond.Write(w, r, map[string]any{"resize": res, "shards": shardCache.stats()})
+}
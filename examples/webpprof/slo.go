@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/slo"
+)
+
+// availability is the error objective every API route declares.
+var availability = slo.Objective{Name: "availability", Target: 0.999}
+
+// routeObjectives are the SLOs of the workload routes, what their users
+// would be promised. They are promises, not measurements: /api/compute at
+// its default million iterations misses its latency on purpose, and the
+// slow requests it archives have the profiles that show why.
+var routeObjectives = map[string][]slo.Objective{
+	"/api/users":        {availability, {Name: "latency", Target: 0.99, Latency: 250 * time.Millisecond}},
+	"/api/users/lookup": {availability, {Name: "latency", Target: 0.99, Latency: 100 * time.Millisecond}},
+	"/api/users/search": {availability, {Name: "latency", Target: 0.99, Latency: 100 * time.Millisecond}},
+	"/api/compute":      {availability, {Name: "latency", Target: 0.95, Latency: time.Second}},
+	"/api/allocate":     {availability, {Name: "latency", Target: 0.95, Latency: 500 * time.Millisecond}},
+	"/api/stampede":     {availability, {Name: "latency", Target: 0.99, Latency: 300 * time.Millisecond}},
+	"/api/catalog":      {availability, {Name: "latency", Target: 0.99, Latency: 50 * time.Millisecond}},
+	"/api/batch":        {availability},
+}
+
+// declareObjectives declares routeObjectives in the order of routes.
+func declareObjectives() {
+	for _, rt := range routes {
+		if objectives, ok := routeObjectives[rt.Pattern]; ok {
+			sloTracker.Declare(rt.Pattern, objectives...)
+		}
+	}
+}
+
+// sloReport is an slo.Report with the archive query listing its bad
+// requests, whose slow ones have captured traces and goroutines.
+type sloReport struct {
+	slo.Report
+	BadRequests string `json:"bad_requests"`
+}
+
+// sloHandler reports the compliance, error budget, and burn rates of every
+// objective, /debug/slo?format=text
+func sloHandler(w http.ResponseWriter, r *http.Request) {
+	reports := sloTracker.Reports(time.Now())
+	out := make([]sloReport, len(reports))
+	for i, rep := range reports {
+		out[i] = sloReport{Report: rep, BadRequests: badRequestsQuery(rep)}
+	}
+
+	if r.URL.Query().Get("format") != "text" {
+		respond.Write(w, r, out)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tOBJECTIVE\tTARGET\tREQUESTS\tCOMPLIANCE\tBUDGET LEFT\tBURN RATES\tFIRING")
+	for _, rep := range out {
+		objective := rep.Objective
+		if rep.Latency > 0 {
+			objective += " < " + rep.Latency.String()
+		}
+		var burns []string
+		for _, b := range rep.BurnRates {
+			burns = append(burns, fmt.Sprintf("%s %.1f", b.Window, b.Rate))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.2f%%\t%d\t%.3f%%\t%.1f%%\t%s\t%s\n",
+			rep.Route, objective, 100*rep.Target, rep.Requests, 100*rep.Compliance,
+			100*rep.BudgetRemaining, strings.Join(burns, ", "), strings.Join(rep.Firing, ","))
+	}
+	tw.Flush()
+}
+
+// badRequestsQuery is the request archive query listing the bad requests
+// of an objective: those slower than its latency, or those that failed.
+func badRequestsQuery(rep slo.Report) string {
+	_, path := splitPattern(rep.Route)
+	q := url.Values{"path": {path}}
+	if rep.Latency > 0 {
+		q.Set("min_duration", rep.Latency.String())
+	} else {
+		q.Set("min_status", strconv.Itoa(http.StatusInternalServerError))
+	}
+	return "/debug/requests?" + q.Encode()
+}
@@ -0,0 +1,108 @@
+package slo
+
+import (
+	"slices"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/tsdb"
+)
+
+// Report is the state of one objective.
+type Report struct {
+	Route     string        `json:"route"`
+	Objective string        `json:"objective"`
+	Target    float64       `json:"target"`
+	Latency   time.Duration `json:"latency_ns,omitempty"`
+
+	// Requests and Bad count the requests of the last Config.Period, and
+	// Compliance is the share of them that were good, 1 without requests.
+	Requests   uint64  `json:"requests"`
+	Bad        uint64  `json:"bad"`
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the share of the error budget, the bad requests
+	// the target allows among Requests, that is not spent; it is negative
+	// once the objective is missed.
+	BudgetRemaining float64 `json:"budget_remaining"`
+	BurnRates       []Burn  `json:"burn_rates"`
+	// Firing names the alerts whose burn rates are exceeded.
+	Firing []string `json:"firing,omitempty"`
+
+	// TotalRequests and TotalBad count every request since the tracker
+	// started, for Prometheus counters.
+	TotalRequests uint64 `json:"total_requests"`
+	TotalBad      uint64 `json:"total_bad"`
+}
+
+// Burn is the burn rate over one window: the share of bad requests in it
+// divided by the share the target allows. 1 spends the budget in exactly
+// the period.
+type Burn struct {
+	Window string  `json:"window"`
+	Rate   float64 `json:"rate"`
+}
+
+// Reports returns the state of every objective as of now, in declaration
+// order.
+func (t *Tracker) Reports(now time.Time) []Report {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var out []Report
+	for _, route := range t.order {
+		for _, o := range t.routes[route] {
+			out = append(out, t.report(route, o, now))
+		}
+	}
+	return out
+}
+
+func (t *Tracker) report(route string, o *objective, now time.Time) Report {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	allowed := 1 - o.Target
+	rep := Report{
+		Route:         route,
+		Objective:     o.Name,
+		Target:        o.Target,
+		Latency:       o.Latency,
+		Compliance:    1,
+		TotalRequests: o.total,
+		TotalBad:      o.bad,
+	}
+	rep.Requests, rep.Bad = o.period.sum(now, t.cfg.Period)
+	rep.BudgetRemaining = 1
+	if rep.Requests > 0 {
+		rep.Compliance = 1 - float64(rep.Bad)/float64(rep.Requests)
+		if allowed > 0 {
+			rep.BudgetRemaining = 1 - float64(rep.Bad)/(allowed*float64(rep.Requests))
+		}
+	}
+
+	burn := make(map[time.Duration]float64, len(t.windows))
+	for _, w := range t.windows {
+		total, bad := o.recent.sum(now, w)
+		var rate float64
+		if total > 0 && allowed > 0 {
+			rate = float64(bad) / float64(total) / allowed
+		}
+		burn[w] = rate
+		rep.BurnRates = append(rep.BurnRates, Burn{Window: tsdb.FormatWindow(w), Rate: rate})
+	}
+	for _, a := range t.cfg.Alerts {
+		if burn[a.Long] > a.Burn && burn[a.Short] > a.Burn {
+			rep.Firing = append(rep.Firing, a.Name)
+		}
+	}
+	return rep
+}
+
+// alertWindows returns the distinct windows of alerts, shortest first.
+func alertWindows(alerts []Alert) []time.Duration {
+	var ws []time.Duration
+	for _, a := range alerts {
+		ws = append(ws, a.Long, a.Short)
+	}
+	slices.Sort(ws)
+	return slices.Compact(ws)
+}
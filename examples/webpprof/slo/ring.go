@@ -0,0 +1,57 @@
+package slo
+
+import (
+	"time"
+
+	"github.com/vdntruong/gosamurai/invariant"
+)
+
+// ring counts requests in fixed-width time buckets over a span, reusing
+// each bucket once the span has moved past it.
+type ring struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+type bucket struct {
+	slot       int64 // the bucket's start divided by the width
+	total, bad uint64
+}
+
+func newRing(width, span time.Duration) *ring {
+	n := max(1, int((span+width-1)/width))
+	return &ring{width: width, buckets: make([]bucket, n)}
+}
+
+func (r *ring) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(r.width)
+}
+
+func (r *ring) add(now time.Time, bad bool) {
+	s := r.slot(now)
+	b := &r.buckets[s%int64(len(r.buckets))]
+	if b.slot != s {
+		*b = bucket{slot: s}
+	}
+	b.total++
+	if bad {
+		b.bad++
+	}
+}
+
+// sum counts the requests of the last window up to now, in whole buckets:
+// the current one, partly filled, and as many before it as fit in the
+// window, at most the span.
+func (r *ring) sum(now time.Time, window time.Duration) (total, bad uint64) {
+	n := min(len(r.buckets), max(1, int(window/r.width)))
+	s := r.slot(now)
+	for i := range int64(n) {
+		b := r.buckets[(s-i)%int64(len(r.buckets))]
+		if b.slot == s-i {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	invariant.Assert(func() bool { return bad <= total }, "more bad requests than requests")
+	return total, bad
+}
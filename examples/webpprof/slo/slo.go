@@ -0,0 +1,175 @@
+// Package slo tracks service level objectives of HTTP routes: the share of
+// requests that must succeed, or finish within a latency, over a period.
+// Each route declares its objectives; Middleware classifies every request
+// as good or bad against them, and Reports gives, per objective, the
+// compliance and the error budget left over the period, and the burn rate,
+// how fast the budget is being spent, over the windows the alerts look at.
+//
+// A burn rate of 1 spends the budget in exactly the period; the default
+// alerts fire when both a long and a short window burn far faster, as in
+// the multiwindow, multi-burn-rate alerts of the Google SRE workbook, so
+// they catch a fast burn within minutes and stop firing soon after it ends.
+package slo
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Objective is one SLO of a route. With Latency zero it is an error
+// objective: a request is bad when it fails with a 5xx status. Otherwise it
+// is a latency objective: a request is bad when it takes longer than
+// Latency, whatever its status.
+type Objective struct {
+	// Name identifies the objective within its route, such as
+	// "availability" or "latency".
+	Name string
+	// Target is the share of requests that must be good, such as 0.999.
+	Target float64
+	// Latency is the most a good request may take.
+	Latency time.Duration
+}
+
+// Alert fires when the burn rate over both Long and Short is above Burn.
+// The long window keeps one bad minute from paging, and the short one
+// stops the alert soon after the burn ends.
+type Alert struct {
+	Name  string
+	Long  time.Duration
+	Short time.Duration
+	Burn  float64
+}
+
+// DefaultAlerts page when 2% of a 30-day budget is spent in an hour, and
+// open a ticket when 5% is spent in six hours.
+var DefaultAlerts = []Alert{
+	{Name: "page", Long: time.Hour, Short: 5 * time.Minute, Burn: 14.4},
+	{Name: "ticket", Long: 6 * time.Hour, Short: 30 * time.Minute, Burn: 6},
+}
+
+// Config configures a Tracker. The zero value tracks 30-day budgets with
+// DefaultAlerts.
+type Config struct {
+	// Period is how long an error budget lasts, default 30 days.
+	Period time.Duration
+	// Alerts are the burn rate alerts evaluated in reports, default
+	// DefaultAlerts. Their windows are the ones reports give burn rates
+	// for.
+	Alerts []Alert
+}
+
+// Tracker records the requests of the routes that declared objectives. It
+// is safe for concurrent use.
+type Tracker struct {
+	cfg     Config
+	windows []time.Duration // the alert windows, shortest first
+
+	mu     sync.RWMutex
+	routes map[string][]*objective
+	order  []string // routes in declaration order
+}
+
+// objective is an Objective and the requests counted against it.
+type objective struct {
+	Objective
+	mu     sync.Mutex
+	recent *ring // one-minute buckets covering the longest alert window
+	period *ring // buckets covering the period
+	total  uint64
+	bad    uint64
+}
+
+// New returns a tracker with no objectives.
+func New(cfg Config) *Tracker {
+	if cfg.Period <= 0 {
+		cfg.Period = 30 * 24 * time.Hour
+	}
+	if cfg.Alerts == nil {
+		cfg.Alerts = DefaultAlerts
+	}
+	return &Tracker{cfg: cfg, windows: alertWindows(cfg.Alerts), routes: make(map[string][]*objective)}
+}
+
+// Declare adds objectives to route, the pattern the route is registered
+// with, as http.Request.Pattern gives it.
+func (t *Tracker) Declare(route string, objectives ...Objective) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.routes[route]; !ok {
+		t.order = append(t.order, route)
+	}
+	longest := time.Minute
+	if n := len(t.windows); n > 0 {
+		longest = max(longest, t.windows[n-1])
+	}
+	for _, o := range objectives {
+		t.routes[route] = append(t.routes[route], &objective{
+			Objective: o,
+			recent:    newRing(time.Minute, longest),
+			period:    newRing(max(time.Minute, t.cfg.Period/720), t.cfg.Period),
+		})
+	}
+}
+
+// Record counts one request to route that ended with status after d. Routes
+// without objectives are ignored.
+func (t *Tracker) Record(route string, status int, d time.Duration, now time.Time) {
+	t.mu.RLock()
+	objectives := t.routes[route]
+	t.mu.RUnlock()
+
+	for _, o := range objectives {
+		bad := status >= 500
+		if o.Latency > 0 {
+			bad = d > o.Latency
+		}
+		o.mu.Lock()
+		o.recent.add(now, bad)
+		o.period.add(now, bad)
+		o.total++
+		if bad {
+			o.bad++
+		}
+		o.mu.Unlock()
+	}
+}
+
+// Middleware records every request served by next against the objectives
+// of its route. It reads the route from http.Request.Pattern, so it must
+// run after the request has been routed, such as around the handler given
+// to the mux.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		t.Record(r.Pattern, sw.status, time.Since(start), time.Now())
+	})
+}
+
+// statusWriter remembers the status code written by the handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
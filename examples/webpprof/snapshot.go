@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/session"
+)
+
+// snapshotVersion is bumped when stateSnapshot changes incompatibly.
+const snapshotVersion = 1
+
+// stateSnapshot is the in-memory state saved by /admin/snapshot and loaded
+// by -restore: the user cache, the session store, and the stats history.
+// Restoring a million cached users this way takes a fraction of the time
+// generating them through /api/users does, which makes large states cheap to
+// set up for demos and tests.
+type stateSnapshot struct {
+	Version  int
+	Taken    time.Time
+	Users    userColumns
+	Sessions []*session.Session
+	History  []statsSample
+}
+
+// userColumns stores users a field at a time. Gob decodes a slice of
+// strings or integers far faster than a million structs, and each user's
+// map[string]interface{} metadata would otherwise carry the type name of
+// every value.
+type userColumns struct {
+	IDs      []int
+	Names    []string
+	Emails   []string
+	Created  []int64 // UnixNano
+	Metadata map[string]*metaColumn
+}
+
+// metaColumn holds one metadata key of every user; Kinds[i] says which
+// slice has user i's value, or that the user has none.
+type metaColumn struct {
+	Kinds   []metaKind
+	Strings []string
+	Ints    []int64
+	Floats  []float64
+}
+
+type metaKind uint8
+
+const (
+	metaMissing metaKind = iota
+	metaString
+	metaInt
+	metaFloat
+	metaTrue
+	metaFalse
+)
+
+func newUserColumns(users []*User) (userColumns, error) {
+	n := len(users)
+	c := userColumns{
+		IDs:      make([]int, n),
+		Names:    make([]string, n),
+		Emails:   make([]string, n),
+		Created:  make([]int64, n),
+		Metadata: make(map[string]*metaColumn),
+	}
+	for i, u := range users {
+		c.IDs[i], c.Names[i], c.Emails[i], c.Created[i] = u.ID, u.Name, u.Email, u.CreatedAt.UnixNano()
+		for k, v := range u.Metadata {
+			col := c.Metadata[k]
+			if col == nil {
+				col = &metaColumn{Kinds: make([]metaKind, n), Strings: make([]string, n), Ints: make([]int64, n), Floats: make([]float64, n)}
+				c.Metadata[k] = col
+			}
+			switch v := v.(type) {
+			case string:
+				col.Kinds[i], col.Strings[i] = metaString, v
+			case int:
+				col.Kinds[i], col.Ints[i] = metaInt, int64(v)
+			case float64:
+				col.Kinds[i], col.Floats[i] = metaFloat, v
+			case bool:
+				col.Kinds[i] = metaFalse
+				if v {
+					col.Kinds[i] = metaTrue
+				}
+			default:
+				return userColumns{}, fmt.Errorf("user %d: metadata %q has unsupported type %T", u.ID, k, v)
+			}
+		}
+	}
+	return c, nil
+}
+
+// users turns the columns back into users. Every column must have one
+// value per user, as newUserColumns writes them; a snapshot whose columns
+// differ in length is corrupt.
+func (c userColumns) users() ([]*User, error) {
+	n := len(c.IDs)
+	if len(c.Names) != n || len(c.Emails) != n || len(c.Created) != n {
+		return nil, fmt.Errorf("user columns differ in length: %d IDs, %d names, %d emails, %d creation times", n, len(c.Names), len(c.Emails), len(c.Created))
+	}
+	for k, col := range c.Metadata {
+		if col == nil || len(col.Kinds) != n || len(col.Strings) != n || len(col.Ints) != n || len(col.Floats) != n {
+			return nil, fmt.Errorf("metadata column %q does not have a value for each of %d users", k, n)
+		}
+	}
+	users := make([]*User, n)
+	for i := range users {
+		md := make(map[string]interface{}, len(c.Metadata))
+		for k, col := range c.Metadata {
+			switch col.Kinds[i] {
+			case metaString:
+				md[k] = col.Strings[i]
+			case metaInt:
+				md[k] = int(col.Ints[i])
+			case metaFloat:
+				md[k] = col.Floats[i]
+			case metaTrue:
+				md[k] = true
+			case metaFalse:
+				md[k] = false
+			}
+		}
+		users[i] = &User{ID: c.IDs[i], Name: c.Names[i], Email: c.Emails[i], CreatedAt: time.Unix(0, c.Created[i]), Metadata: md}
+	}
+	return users, nil
+}
+
+// restoreStats reports what loading a snapshot cost.
+type restoreStats struct {
+	Users, Sessions, History int
+	Bytes                    int64
+	Decode, Apply            time.Duration
+	// HeapGrowth is the live heap after the restore minus before it.
+	HeapGrowth int64
+}
+
+func takeSnapshot() (*stateSnapshot, error) {
+	snap := &stateSnapshot{Version: snapshotVersion, Taken: time.Now()}
+
+	cacheMu.Lock()
+	users := make([]*User, 0, len(userCache))
+	for _, u := range userCache {
+		users = append(users, u)
+	}
+	cacheMu.Unlock()
+	cols, err := newUserColumns(users)
+	if err != nil {
+		return nil, err
+	}
+	snap.Users = cols
+
+	all, err := sessions.Export()
+	if err != nil {
+		return nil, err
+	}
+	snap.Sessions = all
+	snap.History = history.all()
+	return snap, nil
+}
+
+// restoreSnapshot loads a snapshot written by /admin/snapshot. Cached users
+// and stored sessions are added to the current ones; the history samples go
+// before any taken since startup.
+func restoreSnapshot(path string) (restoreStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return restoreStats{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return restoreStats{}, err
+	}
+
+	heapBefore := liveHeap()
+	// Everything decoded stays live, so collections during the load find
+	// nothing to free; GOMEMLIMIT still applies.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	start := time.Now()
+	var snap stateSnapshot
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&snap); err != nil {
+		return restoreStats{}, fmt.Errorf("decode snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return restoreStats{}, fmt.Errorf("snapshot version %d, want %d", snap.Version, snapshotVersion)
+	}
+	users, err := snap.Users.users()
+	if err != nil {
+		return restoreStats{}, fmt.Errorf("decode snapshot: %w", err)
+	}
+	st := restoreStats{
+		Users:    len(users),
+		Sessions: len(snap.Sessions),
+		History:  len(snap.History),
+		Bytes:    info.Size(),
+		Decode:   time.Since(start),
+	}
+
+	start = time.Now()
+	cacheMu.Lock()
+	if len(userCache) == 0 {
+		userCache = make(map[int]*User, len(users)) // skip growing it a million times
+	}
+	added := 0
+	for _, u := range users {
+		if _, ok := userCache[u.ID]; !ok {
+			added++
+		}
+		userCache[u.ID] = u
+	}
+	cacheMu.Unlock()
+	updateStats(func(s *statsSnapshot) { s.CacheSize += added })
+
+	if err := sessions.Import(snap.Sessions); err != nil {
+		return restoreStats{}, err
+	}
+	history.prepend(snap.History)
+	st.Apply = time.Since(start)
+
+	st.HeapGrowth = int64(liveHeap()) - int64(heapBefore)
+	return st, nil
+}
+
+// snapshotHandler downloads the application's state for -restore. It holds
+// the session IDs of every visitor, so it is an admin route.
+// /admin/snapshot
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	snap, err := takeSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="webpprof.snapshot"`)
+
+	start := time.Now()
+	events.Do(r.Context(), events.SnapshotWritten, func(context.Context) {
+		bw := bufio.NewWriter(w)
+		if err = gob.NewEncoder(bw).Encode(snap); err == nil {
+			err = bw.Flush()
+		}
+	})
+	if err != nil {
+		slog.WarnContext(r.Context(), "write snapshot", "err", err)
+		return
+	}
+	events.Emit(r.Context(), events.SnapshotWritten,
+		events.Users, len(snap.Users.IDs), events.Sessions, len(snap.Sessions), events.History, len(snap.History), events.Elapsed, time.Since(start))
+}
+
+// liveHeap returns the heap in use after a collection, so garbage from
+// before a measurement does not count toward it.
+func liveHeap() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
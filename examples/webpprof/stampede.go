@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/archive"
+	"github.com/vdntruong/gosamurai/examples/webpprof/breaker"
+	"github.com/vdntruong/gosamurai/examples/webpprof/cache"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// stampedeDemo serves the same slow backend through two read-through caches,
+// one coalescing concurrent misses and one not, so the effect of a hot entry
+// expiring under load can be compared.
+type stampedeDemo struct {
+	delay   time.Duration
+	breaker *breaker.Breaker
+
+	protected, unprotected *cache.Loader[string, string]
+
+	// Backend load, across both caches
+	calls    atomic.Uint64
+	inFlight atomic.Int64
+	peak     atomic.Int64
+}
+
+func newStampedeDemo(ttl, delay time.Duration, b *breaker.Breaker) *stampedeDemo {
+	d := &stampedeDemo{delay: delay, breaker: b}
+	d.protected = cache.NewLoader(d.backend, cache.LoaderConfig{Capacity: 1000, TTL: ttl, Coalesce: true})
+	d.unprotected = cache.NewLoader(d.backend, cache.LoaderConfig{Capacity: 1000, TTL: ttl})
+	return d
+}
+
+// backend stands in for a slow database query or downstream call, behind
+// the demo's circuit breaker and the faults of /debug/chaos.
+func (d *stampedeDemo) backend(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	defer archive.Track(ctx, "backend", start)
+	err := d.breaker.Do(ctx, func(ctx context.Context) error {
+		d.calls.Add(1)
+		n := d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+		for p := d.peak.Load(); n > p && !d.peak.CompareAndSwap(p, n); p = d.peak.Load() {
+		}
+
+		return faults.Call(ctx, "stampede", func(ctx context.Context) error {
+			if _, err := fibonacciCompute(ctx, 100); err != nil { // a few ms of CPU, like decoding a result
+				return err
+			}
+			select {
+			case <-time.After(d.delay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%s", key, start.Format(time.RFC3339Nano)), nil
+}
+
+// StampedeStats is reported by /api/stampede.
+type StampedeStats struct {
+	Protected    cache.LoaderStats `json:"protected"`
+	Unprotected  cache.LoaderStats `json:"unprotected"`
+	BackendCalls uint64            `json:"backend_calls"`
+	// PeakInFlight is the most backend calls that ran at once.
+	PeakInFlight int64         `json:"peak_in_flight"`
+	Breaker      breaker.Stats `json:"breaker"`
+}
+
+func (d *stampedeDemo) stats() StampedeStats {
+	return StampedeStats{
+		Protected:    d.protected.Stats(),
+		Unprotected:  d.unprotected.Stats(),
+		BackendCalls: d.calls.Load(),
+		PeakInFlight: d.peak.Load(),
+		Breaker:      d.breaker.Stats(),
+	}
+}
+
+// stampedeHandler reads key (default "hot") through the coalescing cache, or
+// through the unprotected one with coalesce=false, and returns the value
+// with the counters of both caches.
+// /api/stampede?key=hot&coalesce=false
+func stampedeHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "hot"
+	}
+	loader := stampede.protected
+	if r.URL.Query().Get("coalesce") == "false" {
+		loader = stampede.unprotected
+	}
+
+	start := time.Now()
+	value, err := loader.Get(r.Context(), key)
+	archive.Track(r.Context(), "cache.get", start)
+	cacheKey("stampede", key)
+	if err != nil && clientGone(w, r, "cache.get") {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), backendErrorStatus(err))
+		return
+	}
+
+	incrementCounter()
+	respond.Write(w, r, map[string]any{
+		"key":   key,
+		"value": value,
+		"stats": stampede.stats(),
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/striped"
+)
+
+// statsSnapshot is an immutable point-in-time view of the application
+// counters. Writers never modify a published snapshot; they publish a new one.
+type statsSnapshot struct {
+	// RequestCount is filled in by loadStats from requestCount; it is never
+	// part of a published snapshot.
+	RequestCount uint64
+	CacheSize    int
+	UsersCreated uint64
+	Evictions    uint64
+	// ClientGone counts requests abandoned because the client went away.
+	ClientGone uint64
+	UpdatedAt  time.Time
+}
+
+// appStats holds the current snapshot. Readers get a consistent view of all
+// fields with a single atomic load and never take a lock.
+var appStats atomic.Pointer[statsSnapshot]
+
+// requestCount counts the requests every workload handler serves. It is
+// bumped on every request, so it stays out of the snapshot: a striped
+// counter takes the increments without them all retrying on appStats.
+var requestCount = striped.NewCounter()
+
+func init() {
+	appStats.Store(&statsSnapshot{UpdatedAt: time.Now()})
+}
+
+// updateStats applies fn to a copy of the current snapshot and publishes the
+// copy, retrying if another writer published in the meantime. fn may run more
+// than once, so it must only apply deltas.
+func updateStats(fn func(s *statsSnapshot)) {
+	for {
+		old := appStats.Load()
+		next := *old
+		fn(&next)
+		next.UpdatedAt = time.Now()
+		if appStats.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+// loadStats returns the current snapshot with the request count read into
+// it. The count is read after the snapshot, so it may include a request
+// whose other counters are not in it yet.
+func loadStats() statsSnapshot {
+	s := *appStats.Load()
+	s.RequestCount = requestCount.Load()
+	return s
+}
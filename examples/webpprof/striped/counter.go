@@ -0,0 +1,53 @@
+package striped
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+)
+
+type paddedUint64 struct {
+	atomic.Uint64
+	_ [cacheLine - 8]byte
+}
+
+// Counter is a monotonically increasing counter sharded roughly per P.
+//
+// The runtime does not expose the current P to user code, so each Add picks
+// a shard from the runtime's per-thread random source. That is enough to keep
+// concurrent writers off the same cache line most of the time, which is what
+// matters for contention; Load pays by summing every shard.
+type Counter struct {
+	shards []paddedUint64
+	mask   uint64
+}
+
+// NewCounter returns a Counter with one shard per GOMAXPROCS, rounded up to a
+// power of two.
+func NewCounter() *Counter {
+	size := nextPowerOfTwo(runtime.GOMAXPROCS(0))
+	return &Counter{
+		shards: make([]paddedUint64, size),
+		mask:   uint64(size - 1),
+	}
+}
+
+// Add adds delta to the counter.
+func (c *Counter) Add(delta uint64) {
+	c.shards[rand.Uint64()&c.mask].Add(delta)
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Load returns the sum of all shards. Concurrent Adds may or may not be
+// included in the result.
+func (c *Counter) Load() uint64 {
+	var total uint64
+	for i := range c.shards {
+		total += c.shards[i].Load()
+	}
+	return total
+}
@@ -0,0 +1,87 @@
+// Package striped provides lock and counter primitives that spread
+// contention over several cache-line padded stripes instead of a single
+// shared word.
+package striped
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// cacheLine is the assumed CPU cache line size used for padding.
+const cacheLine = 64
+
+type paddedRWMutex struct {
+	sync.RWMutex
+	_ [cacheLine - unsafe.Sizeof(sync.RWMutex{})%cacheLine]byte
+}
+
+// Mutex is a set of RWMutexes selected by key. Operations on keys that land
+// on different stripes never contend with each other.
+type Mutex struct {
+	stripes []paddedRWMutex
+	mask    uint64
+}
+
+// NewMutex returns a Mutex with n stripes rounded up to a power of two.
+// If n <= 0, the number of stripes defaults to 4*GOMAXPROCS.
+func NewMutex(n int) *Mutex {
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	size := nextPowerOfTwo(n)
+	return &Mutex{
+		stripes: make([]paddedRWMutex, size),
+		mask:    uint64(size - 1),
+	}
+}
+
+// Stripes returns the number of stripes.
+func (m *Mutex) Stripes() int {
+	return len(m.stripes)
+}
+
+// Stripe returns the stripe index used for key.
+func (m *Mutex) Stripe(key uint64) int {
+	return int(mix(key) & m.mask)
+}
+
+func (m *Mutex) Lock(key uint64)    { m.stripes[m.Stripe(key)].Lock() }
+func (m *Mutex) Unlock(key uint64)  { m.stripes[m.Stripe(key)].Unlock() }
+func (m *Mutex) RLock(key uint64)   { m.stripes[m.Stripe(key)].RLock() }
+func (m *Mutex) RUnlock(key uint64) { m.stripes[m.Stripe(key)].RUnlock() }
+
+// LockAll acquires every stripe in index order. It is meant for rare
+// whole-structure operations such as resizing or full scans.
+func (m *Mutex) LockAll() {
+	for i := range m.stripes {
+		m.stripes[i].Lock()
+	}
+}
+
+// UnlockAll releases every stripe acquired by LockAll.
+func (m *Mutex) UnlockAll() {
+	for i := len(m.stripes) - 1; i >= 0; i-- {
+		m.stripes[i].Unlock()
+	}
+}
+
+// mix is the splitmix64 finalizer; it keeps sequential keys such as user IDs
+// from clustering on neighbouring stripes.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func nextPowerOfTwo(n int) int {
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	return size
+}
@@ -0,0 +1,110 @@
+package striped
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The benchmarks compare the striped primitives with the single lock or word
+// they replace, under RunParallel. Run them with -cpu 1,4,16 to see the
+// single ones slow down as writers are added, and with -mutexprofile to see
+// where the waiting goes:
+//
+//	go test -bench . -cpu 1,4,16 -mutexprofile mutex.prof ./striped
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 1000 {
+				c.Inc()
+			}
+		})
+	}
+	wg.Wait()
+	if got := c.Load(); got != 8000 {
+		t.Errorf("Load() = %d, want 8000", got)
+	}
+}
+
+func TestMutexStripes(t *testing.T) {
+	m := NewMutex(5)
+	if got := m.Stripes(); got != 8 {
+		t.Errorf("Stripes() = %d, want 5 rounded up to 8", got)
+	}
+	seen := make(map[int]bool)
+	for key := range uint64(64) {
+		seen[m.Stripe(key)] = true
+	}
+	if len(seen) != m.Stripes() {
+		t.Errorf("64 sequential keys used %d of %d stripes", len(seen), m.Stripes())
+	}
+}
+
+func BenchmarkCounter(b *testing.B) {
+	b.Run("mutex", func(b *testing.B) {
+		var (
+			mu sync.Mutex
+			n  uint64
+		)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("atomic", func(b *testing.B) {
+		var n atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				n.Add(1)
+			}
+		})
+	})
+	b.Run("striped", func(b *testing.B) {
+		c := NewCounter()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.Inc()
+			}
+		})
+	})
+}
+
+// BenchmarkMutex writes to a map of counters by key, the pattern the striped
+// mutex is for: every key under one RWMutex, or each under its stripe's.
+func BenchmarkMutex(b *testing.B) {
+	const keys = 1024
+	b.Run("rwmutex", func(b *testing.B) {
+		var mu sync.RWMutex
+		counts := make([]uint64, keys)
+		var start atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			key := start.Add(keys / 16) // apart from the other goroutines
+			for pb.Next() {
+				key = (key + 7) % keys
+				mu.Lock()
+				counts[key]++
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("striped", func(b *testing.B) {
+		m := NewMutex(0)
+		counts := make([]uint64, keys)
+		var start atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			key := start.Add(keys / 16) // apart from the other goroutines
+			for pb.Next() {
+				key = (key + 7) % keys
+				m.Lock(key)
+				counts[key]++
+				m.Unlock(key)
+			}
+		})
+	})
+}
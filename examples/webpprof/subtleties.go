@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/gosamurai/subtleties"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+)
+
+// subtletyView is one subtlety as /debug/subtleties shows it.
+type subtletyView struct {
+	Name    string            `json:"name"`
+	Summary string            `json:"summary"`
+	Source  subtleties.Source `json:"source"`
+	Code    template.HTML     `json:"-"`
+	Err     string            `json:"error,omitempty"`
+}
+
+func subtletyViews(name string) []subtletyView {
+	var views []subtletyView
+	for _, s := range subtleties.Catalog {
+		if name != "" && s.Name != name {
+			continue
+		}
+		v := subtletyView{Name: s.Name, Summary: s.Summary}
+		src, err := s.Source()
+		if err != nil {
+			v.Err = err.Error()
+		}
+		v.Source, v.Code = src, highlightGo(src.Code)
+		views = append(views, v)
+	}
+	return views
+}
+
+// tokenClass names the CSS class highlightGo gives a token, or "" for plain
+// text.
+func tokenClass(tok token.Token, lit string) string {
+	switch {
+	case tok == token.COMMENT:
+		return "comment"
+	case tok.IsKeyword():
+		return "keyword"
+	case tok == token.STRING || tok == token.CHAR:
+		return "string"
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return "number"
+	case tok == token.IDENT && types.Universe.Lookup(lit) != nil:
+		return "builtin"
+	}
+	return ""
+}
+
+// highlightGo marks up Go source for the page, with go/scanner, so it
+// tokenizes exactly as the compiler does.
+func highlightGo(src string) template.HTML {
+	var b strings.Builder
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // inserted by the scanner, not in the source
+		}
+		off := file.Offset(pos)
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		b.WriteString(template.HTMLEscapeString(src[last:off]))
+		if class := tokenClass(tok, lit); class != "" {
+			fmt.Fprintf(&b, `<span class="%s">%s</span>`, class, template.HTMLEscapeString(text))
+		} else {
+			b.WriteString(template.HTMLEscapeString(text))
+		}
+		last = off + len(text)
+	}
+	b.WriteString(template.HTMLEscapeString(src[last:]))
+	return template.HTML(b.String())
+}
+
+var subtletiesPage = template.Must(template.New("subtleties").Parse(`<html>
+<head><title>webpprof subtleties</title>
+<style>
+	pre { background: #f6f8fa; padding: 1em; }
+	.keyword { color: #cf222e; } .string { color: #0a3069; } .number { color: #0550ae; }
+	.comment { color: #6e7781; font-style: italic; } .builtin { color: #8250df; }
+</style>
+</head>
+<body>
+	<h1>Go subtleties</h1>
+	<p>The code below is read from the source compiled into this binary, so it is the code that runs. JSON: <a href="/debug/subtleties?format=json">/debug/subtleties?format=json</a>.</p>
+	{{range .}}
+	<h2 id="{{.Name}}">{{.Name}}</h2>
+	<p>{{.Summary}}</p>
+	{{if .Err}}<p>{{.Err}}</p>{{else}}
+	<p><code>subtleties/{{.Source.File}}:{{.Source.Line}}</code></p>
+	<pre>{{.Code}}</pre>
+	{{range .Source.Notes}}<pre class="comment">{{.}}</pre>
+	{{end}}{{end}}
+	{{end}}
+</body>
+</html>
+`))
+
+// subtletiesHandler shows the source of every subtlety, or only the one
+// named, syntax highlighted to browsers and through the response codecs
+// otherwise.
+// /debug/subtleties?name=DoneAfter&format=html
+func subtletiesHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	views := subtletyViews(name)
+	if name != "" && views == nil {
+		http.Error(w, fmt.Sprintf("no subtlety %q", name), http.StatusNotFound)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "html" || format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := subtletiesPage.Execute(w, views); err != nil {
+			fmt.Fprintln(w, err)
+		}
+		return
+	}
+	respond.Write(w, r, views)
+}
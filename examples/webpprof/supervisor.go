@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"github.com/vdntruong/gosamurai/examples/webpprof/events"
+	"github.com/vdntruong/gosamurai/examples/webpprof/respond"
+	"github.com/vdntruong/gosamurai/examples/webpprof/supervisor"
+)
+
+// components supervises the background work: the stats history, the cache
+// evictor, the hot key decay, the pressure monitor, and the metrics store.
+var components *supervisor.Supervisor
+
+// startComponents starts the background work under components. The stats
+// history samples the pressure and persists into the metrics store, so it
+// depends on both and is stopped before them.
+func startComponents() {
+	components = supervisor.New(supervisor.Config{OnFailure: onComponentFailure})
+	add := func(c supervisor.Component) {
+		if err := components.Add(c); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var historyDeps []string
+	if metricsStore != nil {
+		add(supervisor.Component{Name: "metrics-store", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			if err := metricsStore.Close(); err != nil {
+				slog.Error("close metrics store", "err", err)
+			}
+			return nil
+		}})
+		historyDeps = append(historyDeps, "metrics-store")
+	}
+	if pressureMonitor != nil {
+		add(supervisor.Component{Name: "pressure", Run: func(ctx context.Context) error {
+			pressureMonitor.Run(ctx)
+			return nil
+		}})
+		historyDeps = append(historyDeps, "pressure")
+	}
+	add(supervisor.Component{Name: "history", DependsOn: historyDeps, Run: func(ctx context.Context) error {
+		historyRecorder(ctx, history, *historyInterval)
+		return nil
+	}})
+	add(supervisor.Component{Name: "cache-evictor", Run: func(ctx context.Context) error {
+		backgroundWorker(ctx)
+		return nil
+	}})
+	if *hotKeysDecay > 0 {
+		add(supervisor.Component{Name: "hotkeys-decay", Run: func(ctx context.Context) error {
+			decayHotKeys(ctx, *hotKeysDecay)
+			return nil
+		}})
+	}
+	if err := components.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// onComponentFailure logs a failed component with the panicking
+// goroutine's stack, if it panicked, before the supervisor restarts it.
+func onComponentFailure(f supervisor.Failure) {
+	events.Emit(context.Background(), events.ComponentFailed, events.Component, f.Component, events.Err, f.Err,
+		events.Restarts, f.Restarts, events.Backoff, f.Backoff)
+	if f.Stack != nil {
+		slog.Error("component panic stack", events.Component, f.Component, "stack", string(f.Stack))
+	}
+}
+
+// supervisorReport is the /debug/supervisor response.
+type supervisorReport struct {
+	Healthy    bool                `json:"healthy"`
+	Components []supervisor.Status `json:"components"`
+}
+
+// supervisorHandler reports the state, restarts, and last error of every
+// background component, in start order. It answers 503 while a component
+// is waiting out the backoff before a restart.
+// /debug/supervisor
+func supervisorHandler(w http.ResponseWriter, r *http.Request) {
+	rep := supervisorReport{Healthy: true, Components: components.Status()}
+	for _, s := range rep.Components {
+		rep.Healthy = rep.Healthy && s.Healthy()
+	}
+	status := http.StatusOK
+	if !rep.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	respond.WriteStatus(w, r, status, rep)
+}
@@ -0,0 +1,318 @@
+// Package supervisor runs the long-lived background components of a server,
+// each on a goroutine of its own, and keeps them running: a component that
+// panics or returns an error is restarted after a backoff that doubles with
+// every failure in a row. Components name the ones they depend on, which are
+// started before them and stopped after them, so a component can use its
+// dependencies for as long as it runs.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Component is one supervised piece of background work.
+type Component struct {
+	Name string
+	// DependsOn names the components that must be running before this one
+	// starts, and that keep running until it has stopped.
+	DependsOn []string
+	// Run does the work until ctx is done. Returning nil before that means
+	// the component has nothing left to do and is not restarted; returning
+	// an error, or panicking, restarts it after the backoff.
+	Run func(ctx context.Context) error
+}
+
+// Config configures a Supervisor.
+type Config struct {
+	// MinBackoff is the wait before the first restart after a failure,
+	// default 1s; each further failure in a row doubles it.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait, default 1m. A run that lasts longer than
+	// MaxBackoff resets the wait to MinBackoff.
+	MaxBackoff time.Duration
+	// OnFailure, if set, is called on the component's goroutine after every
+	// failure, before the backoff.
+	OnFailure func(Failure)
+}
+
+// Failure is one failed run of a component.
+type Failure struct {
+	Component string
+	Err       error
+	// Stack is the panicking goroutine's stack, nil when Run returned an
+	// error.
+	Stack    []byte
+	Restarts int           // restarts before this failure
+	Backoff  time.Duration // wait before the next restart
+}
+
+// State is where a component is in its life.
+type State string
+
+const (
+	Pending  State = "pending"  // not started yet
+	Running  State = "running"  // in Run
+	Backoff  State = "backoff"  // failed, waiting to restart
+	Exited   State = "exited"   // Run returned nil; not restarted
+	Stopping State = "stopping" // stopped, Run has yet to return
+	Stopped  State = "stopped"  // stopped by Shutdown
+)
+
+// Status is the health of one component.
+type Status struct {
+	Name      string    `json:"name"`
+	DependsOn []string  `json:"depends_on,omitempty"`
+	State     State     `json:"state"`
+	Since     time.Time `json:"since"` // when it entered State
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	// LastFailure is when it last failed, zero if it never has.
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	// NextRestart is when it restarts, in the Backoff state only.
+	NextRestart time.Time `json:"next_restart,omitzero"`
+}
+
+// Healthy reports whether the component is doing what it should: running,
+// or done, not waiting out a backoff.
+func (s Status) Healthy() bool {
+	return s.State != Backoff
+}
+
+// child is a component and its supervision state.
+type child struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (c *child) set(f func(*Status)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(&c.status)
+}
+
+// Supervisor starts, restarts, and stops a set of components.
+type Supervisor struct {
+	cfg Config
+
+	mu       sync.Mutex
+	children []*child // in start order once started
+	started  bool
+	stopped  bool
+}
+
+// New returns a supervisor with no components; Add them, then Start it.
+func New(cfg Config) *Supervisor {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(time.Minute, cfg.MinBackoff)
+	}
+	return &Supervisor{cfg: cfg}
+}
+
+// Add registers a component. Components are added before Start.
+func (s *Supervisor) Add(c Component) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("supervisor: add %q after start", c.Name)
+	}
+	if c.Name == "" || c.Run == nil {
+		return errors.New("supervisor: a component needs a name and a Run function")
+	}
+	for _, ch := range s.children {
+		if ch.Name == c.Name {
+			return fmt.Errorf("supervisor: component %q added twice", c.Name)
+		}
+	}
+	ch := &child{Component: c, done: make(chan struct{})}
+	ch.status = Status{Name: c.Name, DependsOn: c.DependsOn, State: Pending, Since: time.Now()}
+	s.children = append(s.children, ch)
+	return nil
+}
+
+// Start starts every component, dependencies first. It fails, starting
+// none, if a component depends on one that was not added or the
+// dependencies form a cycle. The components' contexts derive from ctx,
+// for its values; Shutdown, not ctx, stops them.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("supervisor: already started")
+	}
+	order, err := startOrder(s.children)
+	if err != nil {
+		return err
+	}
+	s.children, s.started = order, true
+	ctx = context.WithoutCancel(ctx)
+	for _, c := range s.children {
+		var cctx context.Context
+		cctx, c.cancel = context.WithCancel(ctx)
+		go s.supervise(cctx, c)
+	}
+	return nil
+}
+
+// startOrder sorts children so that every one comes after its
+// dependencies, keeping the order they were added in otherwise.
+func startOrder(children []*child) ([]*child, error) {
+	byName := make(map[string]*child, len(children))
+	for _, c := range children {
+		byName[c.Name] = c
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	mark := make(map[string]int, len(children))
+	var order []*child
+	var visit func(c *child, path []string) error
+	visit = func(c *child, path []string) error {
+		switch mark[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("supervisor: dependency cycle %v", append(path, c.Name))
+		}
+		mark[c.Name] = visiting
+		for _, dep := range c.DependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("supervisor: %q depends on unknown component %q", c.Name, dep)
+			}
+			if err := visit(d, append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+		mark[c.Name] = visited
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range children {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// supervise runs c until it exits or ctx is done, restarting it after
+// every failure. Its goroutine carries a component=<name> pprof label, so a
+// goroutine or CPU profile tells the components apart.
+func (s *Supervisor) supervise(ctx context.Context, c *child) {
+	defer close(c.done)
+	pprof.Do(ctx, pprof.Labels("component", c.Name), func(ctx context.Context) {
+		backoff := s.cfg.MinBackoff
+		for {
+			start := time.Now()
+			c.set(func(st *Status) { st.State, st.Since, st.NextRestart = Running, start, time.Time{} })
+			stack, err := runOnce(ctx, c.Run)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				c.set(func(st *Status) { st.State, st.Since = Exited, time.Now() })
+				return
+			}
+
+			if time.Since(start) > s.cfg.MaxBackoff {
+				backoff = s.cfg.MinBackoff
+			}
+			now := time.Now()
+			var restarts int
+			c.set(func(st *Status) {
+				restarts = st.Restarts
+				st.State, st.Since = Backoff, now
+				st.LastError, st.LastFailure, st.NextRestart = err.Error(), now, now.Add(backoff)
+			})
+			if s.cfg.OnFailure != nil {
+				s.cfg.OnFailure(Failure{Component: c.Name, Err: err, Stack: stack, Restarts: restarts, Backoff: backoff})
+			}
+
+			t := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			c.set(func(st *Status) { st.Restarts++ })
+			backoff = min(2*backoff, s.cfg.MaxBackoff)
+		}
+	})
+}
+
+// runOnce calls run, turning a panic into an error with the stack.
+func runOnce(ctx context.Context, run func(context.Context) error) (stack []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack, err = debug.Stack(), fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return nil, run(ctx)
+}
+
+// Shutdown stops the components in the reverse of their start order,
+// dependents before their dependencies, waiting for each to return before
+// stopping the next. If ctx ends first, the components not yet stopped are
+// left running and Shutdown returns an error naming the one it was waiting
+// for.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started || s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	children := slices.Clone(s.children)
+	s.mu.Unlock()
+
+	for _, c := range slices.Backward(children) {
+		c.set(func(st *Status) {
+			if st.State != Exited {
+				st.State, st.Since = Stopping, time.Now()
+			}
+		})
+		c.cancel()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return fmt.Errorf("supervisor: stopping %q: %w", c.Name, context.Cause(ctx))
+		}
+		c.set(func(st *Status) {
+			if st.State != Exited {
+				st.State, st.Since = Stopped, time.Now()
+			}
+		})
+	}
+	return nil
+}
+
+// Status returns the health of every component, in start order once
+// started.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	children := slices.Clone(s.children)
+	s.mu.Unlock()
+	out := make([]Status, len(children))
+	for i, c := range children {
+		c.mu.Lock()
+		out[i] = c.status
+		c.mu.Unlock()
+	}
+	return out
+}
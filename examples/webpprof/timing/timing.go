@@ -0,0 +1,228 @@
+// Package timing splits each request's wall time into where it went: reading
+// the body, waiting on locks, running the handler, serializing the response,
+// and writing it to the client. Breakdowns are aggregated per route.
+package timing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Breakdown is the split of one request's wall time. Handler is what remains
+// after the measured phases are subtracted from Total.
+type Breakdown struct {
+	ReadBody  time.Duration `json:"read_body_ns"`
+	LockWait  time.Duration `json:"lock_wait_ns"`
+	Handler   time.Duration `json:"handler_ns"`
+	Serialize time.Duration `json:"serialize_ns"`
+	Write     time.Duration `json:"write_ns"`
+	Total     time.Duration `json:"total_ns"`
+}
+
+// Map returns the phases keyed by name.
+func (b Breakdown) Map() map[string]time.Duration {
+	return map[string]time.Duration{
+		"read_body": b.ReadBody,
+		"lock_wait": b.LockWait,
+		"handler":   b.Handler,
+		"serialize": b.Serialize,
+		"write":     b.Write,
+		"total":     b.Total,
+	}
+}
+
+// Recorder accumulates the measured phases of one request.
+type Recorder struct {
+	readBody  atomic.Int64
+	lockWait  atomic.Int64
+	serialize atomic.Int64
+	write     atomic.Int64
+}
+
+type recorderKey struct{}
+
+// FromContext returns the recorder of the request being served, or nil. All
+// Recorder methods are safe to call on nil.
+func FromContext(ctx context.Context) *Recorder {
+	rec, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return rec
+}
+
+// LockWait records time spent waiting to acquire a lock since start.
+func LockWait(ctx context.Context, start time.Time) {
+	if rec := FromContext(ctx); rec != nil {
+		rec.lockWait.Add(int64(time.Since(start)))
+	}
+}
+
+// StartSerialize marks the start of response encoding and returns a function
+// that ends it. Time spent writing to the client while encoding is excluded,
+// since streaming encoders interleave the two.
+func StartSerialize(ctx context.Context) (done func()) {
+	rec := FromContext(ctx)
+	if rec == nil {
+		return func() {}
+	}
+	start := time.Now()
+	writeBefore := rec.write.Load()
+	return func() {
+		written := rec.write.Load() - writeBefore
+		rec.serialize.Add(int64(time.Since(start)) - written)
+	}
+}
+
+func (rec *Recorder) breakdown(total time.Duration) Breakdown {
+	b := Breakdown{
+		ReadBody:  time.Duration(rec.readBody.Load()),
+		LockWait:  time.Duration(rec.lockWait.Load()),
+		Serialize: time.Duration(rec.serialize.Load()),
+		Write:     time.Duration(rec.write.Load()),
+		Total:     total,
+	}
+	b.Handler = max(0, total-b.ReadBody-b.LockWait-b.Serialize-b.Write)
+	return b
+}
+
+// Middleware measures every request served by next and adds its breakdown to
+// agg. If done is non-nil it is called with the breakdown of each request,
+// before the middleware returns.
+func Middleware(agg *Aggregator, next http.Handler, done func(*http.Request, Breakdown)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &Recorder{}
+		r = r.WithContext(context.WithValue(r.Context(), recorderKey{}, rec))
+		if r.Body != nil {
+			r.Body = &timedBody{ReadCloser: r.Body, rec: rec}
+		}
+
+		start := time.Now()
+		next.ServeHTTP(&timedWriter{ResponseWriter: w, rec: rec}, r)
+		b := rec.breakdown(time.Since(start))
+
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+		agg.Add(route, b)
+		if done != nil {
+			done(r, b)
+		}
+	})
+}
+
+type timedBody struct {
+	io.ReadCloser
+	rec *Recorder
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	b.rec.readBody.Add(int64(time.Since(start)))
+	return n, err
+}
+
+type timedWriter struct {
+	http.ResponseWriter
+	rec *Recorder
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.ResponseWriter.Write(p)
+	w.rec.write.Add(int64(time.Since(start)))
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *timedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// RouteStats is the aggregate of all breakdowns recorded for a route.
+type RouteStats struct {
+	Count uint64    `json:"count"`
+	Total Breakdown `json:"total"`
+	Mean  Breakdown `json:"mean"`
+	Max   Breakdown `json:"max"`
+}
+
+// Aggregator collects breakdowns per route.
+type Aggregator struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+}
+
+// NewAggregator returns an empty Aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{routes: make(map[string]*RouteStats)}
+}
+
+// Add records one breakdown for route.
+func (a *Aggregator) Add(route string, b Breakdown) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rs := a.routes[route]
+	if rs == nil {
+		rs = &RouteStats{}
+		a.routes[route] = rs
+	}
+	rs.Count++
+	rs.Total = add(rs.Total, b)
+	rs.Max = maxOf(rs.Max, b)
+}
+
+// Snapshot returns the per-route statistics with their means filled in.
+func (a *Aggregator) Snapshot() map[string]RouteStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make(map[string]RouteStats, len(a.routes))
+	for route, rs := range a.routes {
+		s := *rs
+		s.Mean = divide(s.Total, s.Count)
+		out[route] = s
+	}
+	return out
+}
+
+func add(a, b Breakdown) Breakdown {
+	return Breakdown{
+		ReadBody:  a.ReadBody + b.ReadBody,
+		LockWait:  a.LockWait + b.LockWait,
+		Handler:   a.Handler + b.Handler,
+		Serialize: a.Serialize + b.Serialize,
+		Write:     a.Write + b.Write,
+		Total:     a.Total + b.Total,
+	}
+}
+
+func maxOf(a, b Breakdown) Breakdown {
+	return Breakdown{
+		ReadBody:  max(a.ReadBody, b.ReadBody),
+		LockWait:  max(a.LockWait, b.LockWait),
+		Handler:   max(a.Handler, b.Handler),
+		Serialize: max(a.Serialize, b.Serialize),
+		Write:     max(a.Write, b.Write),
+		Total:     max(a.Total, b.Total),
+	}
+}
+
+func divide(b Breakdown, n uint64) Breakdown {
+	if n == 0 {
+		return Breakdown{}
+	}
+	d := time.Duration(n)
+	return Breakdown{
+		ReadBody:  b.ReadBody / d,
+		LockWait:  b.LockWait / d,
+		Handler:   b.Handler / d,
+		Serialize: b.Serialize / d,
+		Write:     b.Write / d,
+		Total:     b.Total / d,
+	}
+}
@@ -0,0 +1,175 @@
+package tsdb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Lookback is how far back a bare metric expression looks for its last
+// point, as a Prometheus instant selector does.
+const Lookback = 5 * time.Minute
+
+// MaxWindow bounds the window of a function. Eval reads the store once, but
+// every value it computes walks the points of its whole window, and the
+// *_over_time functions copy them, so a month-long window over thousands of
+// steps would copy a month of points for each of them.
+const MaxWindow = 24 * time.Hour
+
+// overTime maps the *_over_time functions to the aggregation they apply to
+// the points of their window.
+var overTime = map[string]Aggregation{
+	"avg_over_time":   Avg,
+	"min_over_time":   Min,
+	"max_over_time":   Max,
+	"sum_over_time":   Sum,
+	"last_over_time":  Last,
+	"count_over_time": Count,
+}
+
+// counterFuncs need two points in their window.
+var counterFuncs = map[string]bool{"rate": true, "increase": true, "delta": true}
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	funcCall   = regexp.MustCompile(`^([a-z_]+)\(\s*([^\[\]()\s]+)\s*\[\s*([^\]\s]+)\s*\]\s*\)$`)
+)
+
+// Expr is a query expression in a small subset of PromQL: a bare metric,
+// whose value at a time is its last point within Lookback, or one function
+// over the points of a window ending at that time.
+//
+//	goroutines
+//	max_over_time(goroutines[5m])
+//	rate(request_count[1m])
+//
+// The functions are avg_over_time, min_over_time, max_over_time,
+// sum_over_time, last_over_time, count_over_time; increase, the growth of
+// a counter with its resets to zero counted back in; rate, the increase
+// per second of the window; and delta, the last point minus the first.
+type Expr struct {
+	// Func is empty for a bare metric.
+	Func   string
+	Metric string
+	Window time.Duration
+}
+
+// ParseExpr parses a query expression.
+func ParseExpr(s string) (Expr, error) {
+	s = strings.TrimSpace(s)
+	if metricName.MatchString(s) {
+		return Expr{Metric: s}, nil
+	}
+	m := funcCall.FindStringSubmatch(s)
+	if m == nil {
+		return Expr{}, fmt.Errorf("tsdb: %q is not a metric or func(metric[window])", s)
+	}
+	e := Expr{Func: m[1], Metric: m[2]}
+	if _, ok := overTime[e.Func]; !ok && !counterFuncs[e.Func] {
+		return Expr{}, fmt.Errorf("tsdb: unknown function %q", e.Func)
+	}
+	if !metricName.MatchString(e.Metric) {
+		return Expr{}, fmt.Errorf("tsdb: invalid metric name %q", e.Metric)
+	}
+	w, err := time.ParseDuration(m[3])
+	if err != nil || w <= 0 {
+		return Expr{}, fmt.Errorf("tsdb: invalid window %q", m[3])
+	}
+	if w > MaxWindow {
+		return Expr{}, fmt.Errorf("tsdb: window %s is longer than %s", FormatWindow(w), FormatWindow(MaxWindow))
+	}
+	e.Window = w
+	return e, nil
+}
+
+func (e Expr) String() string {
+	if e.Func == "" {
+		return e.Metric
+	}
+	return fmt.Sprintf("%s(%s[%s])", e.Func, e.Metric, FormatWindow(e.Window))
+}
+
+// Eval evaluates e at from, from+step, ... up to to. Each value is computed
+// from the points in the window, or the lookback, ending at its time;
+// times without enough points in it are left out.
+func (s *Store) Eval(e Expr, from, to time.Time, step time.Duration) ([]Point, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("tsdb: step must be positive")
+	}
+	window := e.Window
+	if e.Func == "" {
+		window = Lookback
+	}
+	points, err := s.Range(e.Metric, from.Add(-window), to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    []Point
+		lo, hi int
+	)
+	for t := from; !t.After(to); t = t.Add(step) {
+		for hi < len(points) && !points[hi].Time.After(t) {
+			hi++
+		}
+		for lo < hi && !points[lo].Time.After(t.Add(-window)) {
+			lo++
+		}
+		if v, ok := e.apply(points[lo:hi]); ok {
+			out = append(out, Point{Time: t, Value: v})
+		}
+	}
+	return out, nil
+}
+
+// apply computes e over the time-ordered points of one window.
+func (e Expr) apply(points []Point) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	if e.Func == "" {
+		return points[len(points)-1].Value, true
+	}
+	if agg, ok := overTime[e.Func]; ok {
+		values := make([]float64, len(points))
+		for i, p := range points {
+			values[i] = p.Value
+		}
+		return agg.apply(values), true
+	}
+	if len(points) < 2 {
+		return 0, false
+	}
+	if e.Func == "delta" {
+		return points[len(points)-1].Value - points[0].Value, true
+	}
+	var increase float64
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1].Value, points[i].Value
+		if cur < prev {
+			// A restart set the counter back to zero.
+			increase += cur
+		} else {
+			increase += cur - prev
+		}
+	}
+	if e.Func == "rate" {
+		return increase / e.Window.Seconds(), true
+	}
+	return increase, true
+}
+
+// FormatWindow formats a window as PromQL writes it, whole hours and
+// minutes without their zero parts: 5m rather than 5m0s.
+func FormatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
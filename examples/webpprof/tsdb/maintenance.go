@@ -0,0 +1,112 @@
+package tsdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+func (s *Store) maintenanceLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.opts.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Maintain(time.Now()); err != nil {
+			log.Printf("tsdb: maintenance: %v", err)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain applies retention and downsampling relative to now. It runs
+// periodically in the background and can also be called directly, though
+// not while another call is rewriting the same segments. A pass that takes
+// longer than MaintenanceInterval falls behind the loop.
+func (s *Store) Maintain(now time.Time) error {
+	s.maintaining.Enter()
+	defer s.maintaining.Exit()
+
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, seg := range segs {
+		end := seg.start.Add(s.opts.SegmentDuration)
+		switch {
+		case now.Sub(end) > s.opts.Retention:
+			errs = append(errs, os.Remove(seg.path))
+		case !seg.downsampled && now.Sub(end) > s.opts.DownsampleAfter:
+			errs = append(errs, s.downsampleSegment(seg))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// downsampleSegment rewrites a raw segment with every metric averaged over
+// DownsampleStep, then replaces the raw file.
+func (s *Store) downsampleSegment(seg segment) error {
+	type bucket struct {
+		sums   map[string]float64
+		counts map[string]int
+	}
+	buckets := make(map[time.Time]*bucket)
+	err := readSegment(seg.path, func(sample Sample) {
+		t := sample.Time.Truncate(s.opts.DownsampleStep)
+		b := buckets[t]
+		if b == nil {
+			b = &bucket{sums: make(map[string]float64), counts: make(map[string]int)}
+			buckets[t] = b
+		}
+		for name, v := range sample.Values {
+			b.sums[name] += v
+			b.counts[name]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	times := make([]time.Time, 0, len(buckets))
+	for t := range buckets {
+		times = append(times, t)
+	}
+	slices.SortFunc(times, time.Time.Compare)
+
+	tmp := s.segmentPath(seg.start, downsampledSuffix) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, t := range times {
+		b := buckets[t]
+		values := make(map[string]float64, len(b.sums))
+		for name, sum := range b.sums {
+			values[name] = sum / float64(b.counts[name])
+		}
+		if err := enc.Encode(Sample{Time: t, Values: values}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.segmentPath(seg.start, downsampledSuffix)); err != nil {
+		return err
+	}
+	return os.Remove(seg.path)
+}
@@ -0,0 +1,366 @@
+// Package tsdb is a small append-only time-series store for runtime metric
+// samples. It keeps history across restarts without running Prometheus.
+//
+// Samples are appended as JSON lines to segment files that each cover a fixed
+// time window. Segments older than the downsample age are rewritten at a
+// coarser resolution, and segments older than the retention are deleted.
+package tsdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/gosamurai/invariant"
+)
+
+const (
+	rawSuffix         = ".jsonl"
+	downsampledSuffix = ".ds.jsonl"
+)
+
+// Options configures a Store. Zero values select the defaults.
+type Options struct {
+	// SegmentDuration is the time window covered by one segment file.
+	SegmentDuration time.Duration
+	// Retention is how long samples are kept.
+	Retention time.Duration
+	// DownsampleAfter is the age after which a segment is downsampled.
+	DownsampleAfter time.Duration
+	// DownsampleStep is the resolution of downsampled segments.
+	DownsampleStep time.Duration
+	// MaintenanceInterval is how often retention and downsampling run.
+	MaintenanceInterval time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.SegmentDuration <= 0 {
+		o.SegmentDuration = time.Hour
+	}
+	if o.Retention <= 0 {
+		o.Retention = 7 * 24 * time.Hour
+	}
+	if o.DownsampleAfter <= 0 {
+		o.DownsampleAfter = 24 * time.Hour
+	}
+	if o.DownsampleStep <= 0 {
+		o.DownsampleStep = time.Minute
+	}
+	if o.MaintenanceInterval <= 0 {
+		o.MaintenanceInterval = 10 * time.Minute
+	}
+}
+
+// Sample is a set of metric values observed at the same instant.
+type Sample struct {
+	Time   time.Time          `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// Point is one value of a single metric.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Store is safe for concurrent use.
+type Store struct {
+	dir  string
+	opts Options
+
+	mu           sync.Mutex
+	current      *os.File
+	currentStart time.Time
+	buf          *bufio.Writer
+
+	// maintaining guards Maintain, which rewrites segments in place.
+	maintaining invariant.NotConcurrent
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens or creates a store in dir and starts its maintenance loop.
+func Open(dir string, opts Options) (*Store, error) {
+	opts.setDefaults()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("tsdb: create dir: %w", err)
+	}
+
+	s := &Store{
+		dir:  dir,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.maintenanceLoop()
+	return s, nil
+}
+
+// Append writes a sample to the segment covering its time.
+func (s *Store) Append(sample Sample) error {
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := sample.Time.Truncate(s.opts.SegmentDuration)
+	if s.current == nil || !start.Equal(s.currentStart) {
+		if err := s.rotateLocked(start); err != nil {
+			return err
+		}
+	}
+	if _, err := s.buf.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.buf.Flush()
+}
+
+func (s *Store) rotateLocked(start time.Time) error {
+	if err := s.closeCurrentLocked(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.segmentPath(start, rawSuffix), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("tsdb: open segment: %w", err)
+	}
+	s.current = f
+	s.currentStart = start
+	s.buf = bufio.NewWriter(f)
+	return nil
+}
+
+func (s *Store) closeCurrentLocked() error {
+	if s.current == nil {
+		return nil
+	}
+	err := errors.Join(s.buf.Flush(), s.current.Close())
+	s.current, s.buf = nil, nil
+	return err
+}
+
+// Close stops maintenance and closes the open segment.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeCurrentLocked()
+}
+
+func (s *Store) segmentPath(start time.Time, suffix string) string {
+	return filepath.Join(s.dir, strconv.FormatInt(start.Unix(), 10)+suffix)
+}
+
+type segment struct {
+	path        string
+	start       time.Time
+	downsampled bool
+}
+
+// segments lists the segment files ordered by start time.
+func (s *Store) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []segment
+	for _, e := range entries {
+		name := e.Name()
+		base, downsampled := strings.CutSuffix(name, downsampledSuffix)
+		if !downsampled {
+			var ok bool
+			if base, ok = strings.CutSuffix(name, rawSuffix); !ok {
+				continue
+			}
+		}
+		sec, err := strconv.ParseInt(base, 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, segment{
+			path:        filepath.Join(s.dir, name),
+			start:       time.Unix(sec, 0),
+			downsampled: downsampled,
+		})
+	}
+	slices.SortFunc(segs, func(a, b segment) int { return a.start.Compare(b.start) })
+	return segs, nil
+}
+
+// Metrics returns the names of all metrics seen in the newest segment.
+func (s *Store) Metrics() ([]string, error) {
+	segs, err := s.segments()
+	if err != nil || len(segs) == 0 {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	err = readSegment(segs[len(segs)-1].path, func(sample Sample) {
+		for name := range sample.Values {
+			names[name] = struct{}{}
+		}
+	})
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return out, err
+}
+
+// Range returns the raw points of metric in [from, to].
+func (s *Store) Range(metric string, from, to time.Time) ([]Point, error) {
+	s.mu.Lock()
+	if s.buf != nil {
+		s.buf.Flush()
+	}
+	s.mu.Unlock()
+
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for _, seg := range segs {
+		if seg.start.After(to) || seg.start.Add(s.opts.SegmentDuration).Before(from) {
+			continue
+		}
+		err := readSegment(seg.path, func(sample Sample) {
+			if sample.Time.Before(from) || sample.Time.After(to) {
+				return
+			}
+			if v, ok := sample.Values[metric]; ok {
+				points = append(points, Point{Time: sample.Time, Value: v})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// Query returns metric in [from, to] aggregated into buckets of step. A step
+// of zero returns the raw points.
+func (s *Store) Query(metric string, from, to time.Time, step time.Duration, agg Aggregation) ([]Point, error) {
+	points, err := s.Range(metric, from, to)
+	if err != nil || step <= 0 {
+		return points, err
+	}
+	return Downsample(points, step, agg), nil
+}
+
+func readSegment(path string, fn func(Sample)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by maintenance while we were listing.
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var sample Sample
+		if err := json.Unmarshal(sc.Bytes(), &sample); err != nil {
+			// A torn last line after a crash; skip it.
+			continue
+		}
+		fn(sample)
+	}
+	return sc.Err()
+}
+
+// Aggregation combines the points that fall into one bucket.
+type Aggregation string
+
+const (
+	Avg   Aggregation = "avg"
+	Min   Aggregation = "min"
+	Max   Aggregation = "max"
+	Sum   Aggregation = "sum"
+	Last  Aggregation = "last"
+	Count Aggregation = "count"
+)
+
+// ParseAggregation validates an aggregation name, defaulting to Avg.
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(s); a {
+	case "":
+		return Avg, nil
+	case Avg, Min, Max, Sum, Last, Count:
+		return a, nil
+	}
+	return "", fmt.Errorf("tsdb: unknown aggregation %q", s)
+}
+
+func (a Aggregation) apply(values []float64) float64 {
+	switch a {
+	case Min:
+		return slices.Min(values)
+	case Max:
+		return slices.Max(values)
+	case Sum:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case Last:
+		return values[len(values)-1]
+	case Count:
+		return float64(len(values))
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Downsample groups time-ordered points into buckets of step, each reported at
+// the bucket start.
+func Downsample(points []Point, step time.Duration, agg Aggregation) []Point {
+	var (
+		out    []Point
+		bucket time.Time
+		values []float64
+	)
+	flush := func() {
+		if len(values) > 0 {
+			out = append(out, Point{Time: bucket, Value: agg.apply(values)})
+			values = values[:0]
+		}
+	}
+	for _, p := range points {
+		b := p.Time.Truncate(step)
+		if !b.Equal(bucket) {
+			flush()
+			bucket = b
+		}
+		if !math.IsNaN(p.Value) {
+			values = append(values, p.Value)
+		}
+	}
+	flush()
+	return out
+}
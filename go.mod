@@ -1,3 +1,8 @@
 module github.com/vdntruong/gosamurai
 
 go 1.25.0
+
+require (
+	github.com/google/pprof v0.0.0-20260926063103-aaccee046517
+	golang.org/x/exp v0.0.0-20260112195511-716be5621a96
+)
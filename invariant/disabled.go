@@ -0,0 +1,23 @@
+//go:build !invariant
+
+package invariant
+
+// Enabled reports whether the checks are made, in builds with the
+// invariant tag.
+const Enabled = false
+
+// NotConcurrent guards a function that must not run concurrently with
+// itself. See the invariant build for the checking version.
+type NotConcurrent struct{}
+
+func (*NotConcurrent) Enter() {}
+func (*NotConcurrent) Exit()  {}
+
+// Owner ties state to the goroutine that created it.
+type Owner struct{}
+
+func (*Owner) Init()  {}
+func (*Owner) Check() {}
+
+// Assert does nothing, and does not call cond.
+func Assert(cond func() bool, msg string) {}
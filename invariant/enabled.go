@@ -0,0 +1,85 @@
+//go:build invariant
+
+package invariant
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// Enabled reports whether the checks are made, in builds with the
+// invariant tag.
+const Enabled = true
+
+// NotConcurrent guards a function that must not run concurrently with
+// itself, usually because it is the only writer of some state:
+//
+//	s.maintaining.Enter()
+//	defer s.maintaining.Exit()
+//
+// The zero value is ready to use.
+type NotConcurrent struct {
+	active atomic.Int32
+}
+
+// Enter reports a violation when another call is between Enter and Exit.
+func (n *NotConcurrent) Enter() {
+	if c := n.active.Add(1); c > 1 {
+		fail(1, "called while %d other calls are in progress", c-1)
+	}
+}
+
+// Exit ends the call Enter started.
+func (n *NotConcurrent) Exit() {
+	n.active.Add(-1)
+}
+
+// Owner ties state to the goroutine that created it, for state such as a
+// per-goroutine buffer that is unsynchronized by design. The zero value has
+// no owner until Init.
+type Owner struct {
+	id atomic.Uint64
+}
+
+// Init makes the calling goroutine the owner.
+func (o *Owner) Init() {
+	o.id.Store(goid())
+}
+
+// Check reports a violation when the calling goroutine is not the owner.
+func (o *Owner) Check() {
+	owner := o.id.Load()
+	if owner == 0 {
+		fail(1, "checked before Init")
+		return
+	}
+	if g := goid(); g != owner {
+		fail(1, "called on goroutine %d, owned by goroutine %d", g, owner)
+	}
+}
+
+// Assert reports a violation with msg when cond returns false. The
+// condition is a function so that, without the tag, it is not evaluated:
+//
+//	invariant.Assert(func() bool { return len(q.items) <= q.max }, "queue over its bound")
+func Assert(cond func() bool, msg string) {
+	if !cond() {
+		fail(1, "%s", msg)
+	}
+}
+
+// goid returns the ID of the calling goroutine, from the first line of its
+// stack trace, "goroutine 18 [running]:". The runtime does not export it,
+// which is why only debug builds pay to read it.
+func goid() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,72 @@
+// Package invariant checks concurrency invariants at run time: that a
+// function is not called concurrently with itself, that it runs on the
+// goroutine that owns its state, that a condition holds. The checks are
+// executable documentation of what the code assumes, so they only state
+// what cannot happen in a correct program: a slow disk or a busy machine
+// must never trip one.
+//
+// They are only made in builds with the invariant tag:
+//
+//	go run -tags invariant .
+//
+// Without it every check is an empty function on an empty struct, which the
+// compiler removes, so they cost nothing in a normal build and can stay on
+// hot paths. Assert takes its condition as a function for the same reason:
+// an argument is evaluated even when the call does nothing, a function's
+// body only when it is called.
+package invariant
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+// Violation is an invariant found broken.
+type Violation struct {
+	// Func is the function whose invariant was broken.
+	Func string
+	Msg  string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("invariant violated in %s: %s", v.Func, v.Msg)
+}
+
+var handler atomic.Pointer[func(*Violation)]
+
+// SetHandler sets the function violations are reported to. The default,
+// and nil, panics with the *Violation, so a debug build stops at the first
+// broken invariant with the stack that broke it.
+func SetHandler(h func(*Violation)) {
+	if h == nil {
+		handler.Store(nil)
+		return
+	}
+	handler.Store(&h)
+}
+
+// fail reports a violation in the function skip frames above its caller.
+func fail(skip int, format string, args ...any) {
+	report(&Violation{Func: caller(skip + 1), Msg: fmt.Sprintf(format, args...)})
+}
+
+func report(v *Violation) {
+	if h := handler.Load(); h != nil {
+		(*h)(v)
+		return
+	}
+	panic(v)
+}
+
+// caller names the function skip frames above caller's caller.
+func caller(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "?"
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		return fn.Name()
+	}
+	return "?"
+}
@@ -0,0 +1,106 @@
+// Package pluginapi is what a clipprof plugin builds against: the types of
+// the workloads, sinks, and analyzers it adds. A plugin is a Go plugin, a
+// main package built with -buildmode=plugin, that exports
+//
+//	func Register(r *pluginapi.Registry)
+//
+// which clipprof, built with -tags plugins, looks up and calls once when it
+// loads the plugin with -plugin. A plugin can add workloads that are not
+// open source, or send the profiles of a run where a team keeps them,
+// without a fork.
+//
+// Go plugins are loaded into the process, so they must be built with the
+// same Go version, the same build flags, and the same versions of every
+// package they share with clipprof, this one included: build both from one
+// checkout. They need cgo, and work on Linux, macOS, and FreeBSD only.
+package pluginapi
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Symbol is the name of the function a plugin exports.
+const Symbol = "Register"
+
+// Registry collects what a plugin's Register adds.
+type Registry struct {
+	Workloads []Workload
+	Sinks     []Sink
+	Analyzers []Analyzer
+}
+
+// AddWorkload adds a workload.
+func (r *Registry) AddWorkload(w Workload) { r.Workloads = append(r.Workloads, w) }
+
+// AddSink adds a sink.
+func (r *Registry) AddSink(s Sink) { r.Sinks = append(r.Sinks, s) }
+
+// AddAnalyzer adds an analyzer.
+func (r *Registry) AddAnalyzer(a Analyzer) { r.Analyzers = append(r.Analyzers, a) }
+
+// Workload is a -workload value a plugin adds. It runs like the built-in
+// ones, under a workload=<name> pprof label and trace task, so it can be
+// mixed with them, profiled, and swept.
+type Workload struct {
+	Name    string
+	Summary string
+	// Run does the work until ctx is done or Options.Duration has passed.
+	Run func(ctx context.Context, opts Options)
+}
+
+// Options are the clipprof settings a plugin workload runs with.
+type Options struct {
+	Duration   time.Duration // -duration
+	Goroutines int           // -goroutines
+	Seed       uint64        // -seed, to generate repeatable data from
+	// Stream returns the random stream of -seed named name, as the built-in
+	// workloads draw theirs: its numbers depend only on the seed, the
+	// workload, and the name. A stream is not safe for concurrent use, so
+	// goroutines that draw take one each, named after the goroutine.
+	Stream func(name string) *rand.Rand
+	// Args are the -plugin-args given as name=value.
+	Args map[string]string
+	// Work counts n units of finished work, a request served or an item
+	// processed, for the throughput of -runs and -sweep-gomaxprocs.
+	Work func(n uint64)
+}
+
+// Run is one finished clipprof run, as a sink gets it.
+type Run struct {
+	Workload    string
+	Started     time.Time
+	Elapsed     time.Duration
+	Interrupted bool
+	// Dir is the -outdir directory of the run, empty without one.
+	Dir string
+	// Files are the files the run wrote, by kind: cpu, heap, block, mutex,
+	// goroutine, wall, trace, flamegraph, and the reports: stats, bench,
+	// metadata, scenario (the results of the -config steps), and analysis
+	// (what the analyzers found). The other files in Dir, those of the
+	// child processes of -procs, -runs, and -sweep-gomaxprocs or of
+	// -pitfall, are listed by their slash-separated path in it, such as
+	// "proc-1/cpu.prof".
+	Files map[string]string
+}
+
+// Sink takes the files of a run somewhere once it has finished: an object
+// store, a profile service, a ticket.
+type Sink struct {
+	Name string
+	Send func(ctx context.Context, run Run) error
+}
+
+// Analyzer reads the profiles of a run once they are written and reports
+// what it finds to w, after clipprof's own summaries.
+type Analyzer struct {
+	Name string
+	// Kinds are the profiles it reads, as in Run.Files; empty is every
+	// pprof profile of the run.
+	Kinds   []string
+	Analyze func(w io.Writer, kind string, p *profile.Profile) error
+}
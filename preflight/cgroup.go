@@ -0,0 +1,94 @@
+package preflight
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Cgroup reports the CPU and memory limits of the process's cgroup, and
+// warns when the Go runtime is not set up to respect them: GOMAXPROCS above
+// the CPU quota causes throttling that shows up as latency, not as CPU
+// time, and a memory limit without GOMEMLIMIT lets the heap grow until the
+// kernel kills the process instead of collecting sooner.
+func Cgroup() Check {
+	return Check{Name: "cgroup limits", Run: func() (Status, string) {
+		if runtime.GOOS != "linux" {
+			return Pass, "not linux, no cgroup"
+		}
+		cpus, cpuOK := cgroupCPUs()
+		mem, memOK := cgroupMemory()
+		if !cpuOK && !memOK {
+			return Pass, "no cgroup limits found"
+		}
+
+		var details, warnings []string
+		procs := runtime.GOMAXPROCS(0)
+		if cpuOK {
+			details = append(details, fmt.Sprintf("cpu quota %.2f (GOMAXPROCS %d)", cpus, procs))
+			if float64(procs) > math.Ceil(cpus) {
+				warnings = append(warnings, "GOMAXPROCS exceeds the CPU quota")
+			}
+		}
+		if memOK {
+			details = append(details, fmt.Sprintf("memory limit %d MiB", mem>>20))
+			if debug.SetMemoryLimit(-1) == math.MaxInt64 {
+				warnings = append(warnings, "GOMEMLIMIT is not set")
+			}
+		}
+		detail := strings.Join(details, ", ")
+		if len(warnings) > 0 {
+			return Warn, detail + "; " + strings.Join(warnings, "; ")
+		}
+		return Pass, detail
+	}}
+}
+
+// cgroupCPUs returns the CPU quota in CPUs, from cgroup v2's cpu.max or
+// v1's cfs quota and period.
+func cgroupCPUs() (float64, bool) {
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		f := strings.Fields(string(data))
+		if len(f) == 2 && f[0] != "max" {
+			quota, err1 := strconv.ParseFloat(f[0], 64)
+			period, err2 := strconv.ParseFloat(f[1], 64)
+			if err1 == nil && err2 == nil && period > 0 {
+				return quota / period, true
+			}
+		}
+		return 0, false
+	}
+	quota, err1 := readInt("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	period, err2 := readInt("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
+
+// cgroupMemory returns the memory limit in bytes, from cgroup v2's
+// memory.max or v1's limit_in_bytes. v1 reports "no limit" as a huge
+// number rather than "max".
+func cgroupMemory() (int64, bool) {
+	if data, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		return v, err == nil
+	}
+	v, err := readInt("/sys/fs/cgroup/memory/memory.limit_in_bytes")
+	if err != nil || v >= 1<<62 {
+		return 0, false
+	}
+	return v, true
+}
+
+func readInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,170 @@
+package preflight
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// CPUProfiler starts the CPU profiler for a moment of busy work and checks
+// that it delivered samples. The profiler fails to start if something else
+// in the process is already using it, and delivers nothing where the OS
+// denies the profiling timer.
+func CPUProfiler() Check {
+	return Check{Name: "cpu profiler", Run: func() (Status, string) {
+		var buf bytes.Buffer
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return Fail, err.Error()
+		}
+		spin(200 * time.Millisecond)
+		pprof.StopCPUProfile()
+
+		p, err := profile.Parse(&buf)
+		if err != nil {
+			return Fail, "unreadable profile: " + err.Error()
+		}
+		// At the default 100 Hz, 200ms of work is about 20 samples.
+		if n := len(p.Sample); n < 5 {
+			return Warn, fmt.Sprintf("%d samples in 200ms, expected about 20; the profiling timer may be throttled", n)
+		}
+		return Pass, fmt.Sprintf("%d samples in 200ms", len(p.Sample))
+	}}
+}
+
+func spin(d time.Duration) {
+	var x uint64
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		for i := range 10000 {
+			x += uint64(i) * x
+		}
+	}
+	_ = x
+}
+
+// ProfileRates sets the block and mutex profile rates and reads the mutex
+// fraction back. It restores the mutex fraction but leaves block profiling
+// off, since its rate cannot be read, so run it before enabling profiling.
+func ProfileRates() Check {
+	return Check{Name: "profile rates", Run: func() (Status, string) {
+		prev := runtime.SetMutexProfileFraction(1)
+		got := runtime.SetMutexProfileFraction(prev)
+		if got != 1 {
+			return Fail, fmt.Sprintf("mutex profile fraction reads back as %d after setting 1", got)
+		}
+		// The block profile rate cannot be read back; setting it either
+		// works or panics, so there is nothing more to check.
+		runtime.SetBlockProfileRate(1)
+		runtime.SetBlockProfileRate(0)
+		return Pass, "block and mutex profiling can be enabled"
+	}}
+}
+
+// Writable creates and removes a file in dir. An empty dir checks the
+// temporary directory.
+func Writable(dir string) Check {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return Check{Name: "writable " + dir, Run: func() (Status, string) {
+		return writeProbe(dir)
+	}}
+}
+
+// Creatable checks that dir can be created: it is writable if it exists,
+// and otherwise its nearest existing parent is.
+func Creatable(dir string) Check {
+	return Check{Name: "creatable " + dir, Run: func() (Status, string) {
+		parent := dir
+		for {
+			if _, err := os.Stat(parent); err == nil {
+				break
+			}
+			next := filepath.Dir(parent)
+			if next == parent {
+				break
+			}
+			parent = next
+		}
+		status, detail := writeProbe(parent)
+		if status == Pass && parent != dir {
+			detail += ", where it will be created"
+		}
+		return status, detail
+	}}
+}
+
+// writeProbe creates, writes, and removes a file in dir.
+func writeProbe(dir string) (Status, string) {
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return Fail, err.Error()
+	}
+	name := f.Name()
+	_, werr := f.Write(make([]byte, 64<<10))
+	cerr := f.Close()
+	os.Remove(name)
+	if werr != nil {
+		return Fail, werr.Error()
+	}
+	if cerr != nil {
+		return Fail, cerr.Error()
+	}
+	abs, _ := filepath.Abs(dir)
+	return Pass, "wrote 64KiB to " + abs
+}
+
+// Readable checks that a file exists and can be read.
+func Readable(path string) Check {
+	return Check{Name: "readable " + path, Run: func() (Status, string) {
+		f, err := os.Open(path)
+		if err != nil {
+			return Fail, err.Error()
+		}
+		f.Close()
+		return Pass, "ok"
+	}}
+}
+
+// Port checks that addr can be listened on, and releases it again.
+func Port(addr string) Check {
+	return Check{Name: "port " + addr, Run: func() (Status, string) {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return Fail, err.Error()
+		}
+		got := l.Addr().String()
+		l.Close()
+		return Pass, "bound " + got
+	}}
+}
+
+// ClockResolution measures the smallest step time.Now takes. Timings below
+// a few steps are noise; above a millisecond, latency histograms and
+// request breakdowns are not worth reading.
+func ClockResolution() Check {
+	return Check{Name: "clock resolution", Run: func() (Status, string) {
+		smallest := time.Duration(1<<63 - 1)
+		for range 1000 {
+			start := time.Now()
+			var d time.Duration
+			for d == 0 {
+				d = time.Since(start)
+			}
+			smallest = min(smallest, d)
+		}
+		switch {
+		case smallest > time.Millisecond:
+			return Fail, fmt.Sprintf("clock steps by %s", smallest)
+		case smallest > time.Microsecond:
+			return Warn, fmt.Sprintf("clock steps by %s; sub-%s timings are unreliable", smallest, 10*smallest)
+		}
+		return Pass, fmt.Sprintf("clock steps by %s", smallest)
+	}}
+}
@@ -0,0 +1,73 @@
+// Package preflight checks that the environment can support a profiling
+// run before it starts: that the profilers can be switched on, files and
+// ports are usable, the container limits are known, and the clock is fine
+// grained enough for the timings. Each check passes, warns, or fails, and
+// a Report lists them all.
+package preflight
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	// Warn means the run can go ahead, but some results may be off.
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is one named preflight check.
+type Check struct {
+	Name string
+	Run  func() (Status, string)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Detail   string        `json:"detail"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Report is the outcome of a set of checks. OK is false if any failed.
+type Report struct {
+	Results []Result `json:"results"`
+	OK      bool     `json:"ok"`
+}
+
+// Run runs the checks in order.
+func Run(checks ...Check) Report {
+	r := Report{OK: true}
+	for _, c := range checks {
+		start := time.Now()
+		status, detail := c.Run()
+		r.Results = append(r.Results, Result{Name: c.Name, Status: status, Detail: detail, Duration: time.Since(start)})
+		if status == Fail {
+			r.OK = false
+		}
+	}
+	return r
+}
+
+// WriteText writes the report as a table followed by a summary line.
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tDETAIL")
+	counts := map[Status]int{}
+	for _, res := range r.Results {
+		counts[res.Status]++
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Status, res.Name, res.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n", counts[Pass], counts[Warn], counts[Fail])
+	return err
+}
@@ -0,0 +1,33 @@
+// Package procstats reads what the operating system knows about the current
+// process that the Go runtime does not: its resident memory, its open file
+// descriptors and sockets, and its threads. runtime.MemStats says nothing
+// about a leaked connection until the process hits its descriptor limit;
+// the descriptor count shows it growing long before.
+package procstats
+
+// Stats is a snapshot of the process. Counts the platform cannot provide
+// are zero; Read documents which.
+type Stats struct {
+	// RSS is the resident set size in bytes: the process's memory actually
+	// in RAM, heap, stacks, binary, and mapped files alike.
+	RSS uint64 `json:"rss"`
+	// FDs is the number of open file descriptors (handles on Windows).
+	FDs int `json:"fds"`
+	// FDLimit is the soft limit on open descriptors, zero when unknown.
+	FDLimit uint64 `json:"fd_limit,omitempty"`
+	// Threads is the number of OS threads.
+	Threads int `json:"threads"`
+	// Sockets counts the process's sockets by state: TCP states such as
+	// ESTABLISHED and CLOSE_WAIT, UDP, and UNIX. Nil where it cannot be
+	// read.
+	Sockets map[string]int `json:"sockets,omitempty"`
+}
+
+// FDUsage returns the share of the descriptor limit in use, zero when the
+// limit is unknown.
+func (s Stats) FDUsage() float64 {
+	if s.FDLimit == 0 {
+		return 0
+	}
+	return float64(s.FDs) / float64(s.FDLimit)
+}
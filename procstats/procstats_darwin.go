@@ -0,0 +1,28 @@
+package procstats
+
+import (
+	"os"
+	"syscall"
+)
+
+// Read reads the process's stats. Without cgo macOS offers no current
+// resident size, so RSS is the peak getrusage reports; Threads and Sockets
+// are not available.
+func Read() (Stats, error) {
+	var s Stats
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return s, err
+	}
+	s.RSS = uint64(ru.Maxrss) // bytes on macOS, unlike Linux
+	entries, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		return s, err
+	}
+	s.FDs = len(entries) - 1 // the directory itself
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err == nil {
+		s.FDLimit = lim.Cur
+	}
+	return s, nil
+}
@@ -0,0 +1,113 @@
+package procstats
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// tcpStates names the st column of /proc/net/tcp (include/net/tcp_states.h).
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+	"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+	"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+// Read reads the process's stats from /proc/self. Sockets holds only the
+// sockets the process has a descriptor for, so TIME_WAIT, which the kernel
+// keeps after the descriptor is closed, does not appear.
+func Read() (Stats, error) {
+	var s Stats
+	if err := readStatus(&s); err != nil {
+		return s, err
+	}
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return s, err
+	}
+	// The directory was open while it was read; do not count it.
+	s.FDs = len(entries) - 1
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err == nil {
+		s.FDLimit = lim.Cur
+	}
+
+	inodes := make(map[string]bool)
+	for _, e := range entries {
+		target, err := os.Readlink("/proc/self/fd/" + e.Name())
+		if err != nil {
+			continue // closed since ReadDir
+		}
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok {
+			inodes[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+	s.Sockets = make(map[string]int)
+	if len(inodes) > 0 {
+		for _, name := range []string{"tcp", "tcp6"} {
+			countSockets(s.Sockets, "/proc/net/"+name, inodes, func(state string) string { return tcpStates[state] })
+		}
+		for _, name := range []string{"udp", "udp6"} {
+			countSockets(s.Sockets, "/proc/net/"+name, inodes, func(string) string { return "UDP" })
+		}
+		countSockets(s.Sockets, "/proc/net/unix", inodes, func(string) string { return "UNIX" })
+	}
+	return s, nil
+}
+
+// readStatus fills RSS and Threads from /proc/self/status:
+//
+//	VmRSS:	   12345 kB
+//	Threads:	7
+func readStatus(s *Stats) error {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, _ := strings.Cut(sc.Text(), ":")
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[0], 10, 64)
+		switch key {
+		case "VmRSS":
+			s.RSS = n << 10
+		case "Threads":
+			s.Threads = int(n)
+		}
+	}
+	return sc.Err()
+}
+
+// countSockets adds the sockets of a /proc/net table whose inode is one of
+// the process's. The tables have a header line; the state is the fourth
+// column and the inode the tenth, except in unix, where they are the sixth
+// and seventh.
+func countSockets(counts map[string]int, path string, inodes map[string]bool, state func(string) string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return // no IPv6, or no such protocol
+	}
+	defer f.Close()
+	stateCol, inodeCol := 3, 9
+	if strings.HasSuffix(path, "/unix") {
+		stateCol, inodeCol = 5, 6
+	}
+	sc := bufio.NewScanner(f)
+	sc.Scan()
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) <= inodeCol || !inodes[fields[inodeCol]] {
+			continue
+		}
+		if name := state(fields[stateCol]); name != "" {
+			counts[name]++
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package procstats
+
+import "errors"
+
+// Read reads the process's stats. It is implemented on Linux, macOS, and
+// Windows only.
+func Read() (Stats, error) {
+	return Stats{}, errors.ErrUnsupported
+}
@@ -0,0 +1,50 @@
+package procstats
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+	procK32GetProcessMemInfo  = kernel32.NewProc("K32GetProcessMemoryInfo")
+)
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+// Read reads the process's stats. RSS is the working set and FDs the
+// number of open handles, which includes events, threads, and registry
+// keys as well as files and sockets; Windows has no descriptor limit to
+// speak of. Threads and Sockets are not available.
+func Read() (Stats, error) {
+	var s Stats
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return s, err
+	}
+	var mem processMemoryCounters
+	mem.cb = uint32(unsafe.Sizeof(mem))
+	if r, _, err := procK32GetProcessMemInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.cb)); r == 0 {
+		return s, err
+	}
+	s.RSS = uint64(mem.workingSetSize)
+	var handles uint32
+	if r, _, err := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&handles))); r == 0 {
+		return s, err
+	}
+	s.FDs = int(handles)
+	return s, nil
+}
@@ -0,0 +1,37 @@
+package profilestore
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// BuildTags returns the release version and VCS commit embedded in a Go
+// binary's build info. Development builds have no release version, so the
+// version is empty for "(devel)".
+func BuildTags(bi *debug.BuildInfo) (version, commit string) {
+	if bi == nil {
+		return "", ""
+	}
+	if v := bi.Main.Version; v != "" && v != "(devel)" {
+		version = v
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			commit = s.Value
+		}
+	}
+	return version, commit
+}
+
+// MatchesRef reports whether the profile was collected from the release or
+// commit ref: an exact version, or a commit hash of at least seven
+// characters, possibly abbreviated.
+func (m Meta) MatchesRef(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	if m.Version == ref {
+		return true
+	}
+	return len(ref) >= 7 && m.Commit != "" && strings.HasPrefix(m.Commit, ref)
+}
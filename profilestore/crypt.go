@@ -0,0 +1,307 @@
+package profilestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Profiles are encrypted at rest with envelope encryption: each profile gets
+// its own random AES-256 data key, the file holds nonce || AES-GCM
+// ciphertext, and the data key itself is stored in the metadata wrapped by
+// a key-encryption key from Keys. Rotating the key-encryption key only
+// rewraps data keys; profile files are not rewritten.
+
+// Environment variables read by LoadKeys.
+const (
+	// KeysEnv holds comma-separated id:base64 AES-256 key-encryption keys;
+	// the first wraps new data keys, the others only unwrap.
+	KeysEnv = "PROFILESTORE_KEYS"
+	// KMSCommandEnv names a plugin program that wraps and unwraps data keys
+	// (see CommandKeys); it takes precedence over KeysEnv.
+	KMSCommandEnv = "PROFILESTORE_KMS_COMMAND"
+)
+
+// ErrNoKeys is returned when reading an encrypted profile from a store
+// without keys.
+var ErrNoKeys = errors.New("profilestore: profile is encrypted but no keys are configured")
+
+// WrappedKey is a data key encrypted with the key-encryption key ID.
+type WrappedKey struct {
+	ID   string `json:"id"`
+	Data []byte `json:"data"`
+}
+
+// Keys wraps and unwraps data keys. Implementations may call out to a KMS,
+// and must give up when ctx is done.
+type Keys interface {
+	// Wrap encrypts a data key with the current key-encryption key.
+	Wrap(ctx context.Context, dataKey []byte) (WrappedKey, error)
+	// Unwrap decrypts a data key wrapped by any known key-encryption key.
+	Unwrap(ctx context.Context, w WrappedKey) ([]byte, error)
+}
+
+// LoadKeys returns the keys configured in the environment, or nil if none.
+func LoadKeys() (Keys, error) {
+	if cmd := os.Getenv(KMSCommandEnv); cmd != "" {
+		return CommandKeys{Path: cmd}, nil
+	}
+	if spec := os.Getenv(KeysEnv); spec != "" {
+		return ParseKeys(spec)
+	}
+	return nil, nil
+}
+
+// StaticKeys holds key-encryption keys in memory.
+type StaticKeys struct {
+	// Primary is the ID of the key that wraps new data keys.
+	Primary string
+	Keys    map[string][]byte
+}
+
+// ParseKeys parses the KeysEnv format.
+func ParseKeys(spec string) (*StaticKeys, error) {
+	k := &StaticKeys{Keys: make(map[string][]byte)}
+	for entry := range strings.SplitSeq(spec, ",") {
+		id, enc, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("profilestore: key %q is not id:base64", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("profilestore: key %s is not a base64 32-byte key", id)
+		}
+		if k.Primary == "" {
+			k.Primary = id
+		}
+		k.Keys[id] = key
+	}
+	return k, nil
+}
+
+// NewKey returns a random key in the KeysEnv format.
+func NewKey(id string) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(randomBytes(32))
+}
+
+// Wrap implements Keys.
+func (k *StaticKeys) Wrap(_ context.Context, dataKey []byte) (WrappedKey, error) {
+	sealed, err := seal(k.Keys[k.Primary], dataKey, []byte(k.Primary))
+	return WrappedKey{ID: k.Primary, Data: sealed}, err
+}
+
+// Unwrap implements Keys.
+func (k *StaticKeys) Unwrap(_ context.Context, w WrappedKey) ([]byte, error) {
+	kek, ok := k.Keys[w.ID]
+	if !ok {
+		return nil, fmt.Errorf("profilestore: unknown key %q", w.ID)
+	}
+	return unseal(kek, w.Data, []byte(w.ID))
+}
+
+// CommandKeys delegates to a plugin program, typically a thin wrapper around
+// a cloud KMS. `<path> wrap` reads a raw data key on stdin and writes a
+// WrappedKey as JSON; `<path> unwrap` reads a WrappedKey as JSON and writes
+// the raw data key. The program is killed when the context of the call is
+// done.
+type CommandKeys struct {
+	Path string
+}
+
+// Wrap implements Keys.
+func (c CommandKeys) Wrap(ctx context.Context, dataKey []byte) (WrappedKey, error) {
+	var w WrappedKey
+	out, err := c.run(ctx, "wrap", dataKey)
+	if err == nil {
+		err = json.Unmarshal(out, &w)
+	}
+	return w, err
+}
+
+// Unwrap implements Keys.
+func (c CommandKeys) Unwrap(ctx context.Context, w WrappedKey) ([]byte, error) {
+	in, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	return c.run(ctx, "unwrap", in)
+}
+
+func (c CommandKeys) run(ctx context.Context, op string, stdin []byte) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, op)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("profilestore: %s %s: %w", c.Path, op, context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("profilestore: %s %s: %v: %s", c.Path, op, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// encrypt seals data under a new data key and returns the ciphertext and
+// the wrapped data key. id is bound to the ciphertext so a file cannot be
+// swapped for another profile's.
+func encrypt(ctx context.Context, keys Keys, id string, data []byte) ([]byte, *WrappedKey, error) {
+	dataKey := randomBytes(32)
+	wrapped, err := keys.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := seal(dataKey, data, []byte(id))
+	return sealed, &wrapped, err
+}
+
+func decrypt(ctx context.Context, keys Keys, m Meta, data []byte) ([]byte, error) {
+	if m.Key == nil {
+		return data, nil
+	}
+	if keys == nil {
+		return nil, ErrNoKeys
+	}
+	dataKey, err := keys.Unwrap(ctx, *m.Key)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(dataKey, data, []byte(m.ID))
+}
+
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := randomBytes(gcm.NonceSize())
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func unseal(key, sealed, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("profilestore: ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("profilestore: decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// RotateResult reports what RotateKeys changed.
+type RotateResult struct {
+	// Rewrapped counts data keys rewrapped with the current key.
+	Rewrapped int `json:"rewrapped"`
+	// Encrypted counts profiles that were stored unencrypted.
+	Encrypted int `json:"encrypted"`
+}
+
+// RotateKeys rewraps every data key that the current key-encryption key did
+// not wrap, so retired keys can then be removed from the configuration. With
+// encryptPlain, profiles stored before encryption was enabled are encrypted
+// too. Key IDs must change when keys do; a KMS plugin should use the key
+// version as ID. Profiles whose data key the current key already wraps are
+// skipped without calling Keys. If ctx is done part way, the profiles rotated so far stay
+// rotated and RotateKeys returns the context's error; running it again
+// finishes the job.
+func (s *Store) RotateKeys(ctx context.Context, encryptPlain bool) (RotateResult, error) {
+	var res RotateResult
+	if s.keys == nil {
+		return res, errors.New("profilestore: no keys configured")
+	}
+	// Wrapping a throwaway key names the current key-encryption key.
+	current, err := s.keys.Wrap(ctx, randomBytes(32))
+	if err != nil {
+		return res, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metas := make([]Meta, 0, len(s.index))
+	for _, m := range s.index {
+		metas = append(metas, m)
+	}
+	sortByTime(metas)
+
+	for _, m := range metas {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		switch {
+		case m.Key != nil:
+			if m.Key.ID == current.ID {
+				continue
+			}
+			dataKey, err := s.keys.Unwrap(ctx, *m.Key)
+			if err != nil {
+				return res, fmt.Errorf("%s: %w", m.ID, err)
+			}
+			wrapped, err := s.keys.Wrap(ctx, dataKey)
+			if err != nil {
+				return res, err
+			}
+			m.Key = &wrapped
+			if err := s.writeMetaLocked(m); err != nil {
+				return res, err
+			}
+			s.addLocked(m)
+			res.Rewrapped++
+
+		case encryptPlain:
+			plainPath := s.profilePath(m)
+			data, err := os.ReadFile(plainPath)
+			if err != nil {
+				return res, err
+			}
+			sealed, key, err := encrypt(ctx, s.keys, m.ID, data)
+			if err != nil {
+				return res, err
+			}
+			// Write the encrypted file, then point the metadata at it, then
+			// remove the plain file; an interruption at any point leaves a
+			// readable profile and at most an orphan for Compact.
+			m.Key = key
+			if err := os.WriteFile(s.profilePath(m), sealed, 0o644); err != nil {
+				return res, err
+			}
+			if err := s.writeMetaLocked(m); err != nil {
+				return res, err
+			}
+			s.addLocked(m)
+			if err := os.Remove(plainPath); err != nil {
+				return res, err
+			}
+			res.Encrypted++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package profilestore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// Fingerprint hashes the normalized sample set of p: sample types, and per
+// sample its stack as function names and lines, its labels, and its values.
+// Addresses, mappings, and timestamps are left out, so the same profile
+// fetched twice, or re-encoded by another tool, has the same fingerprint.
+func Fingerprint(p *profile.Profile) string {
+	values := make(map[string][]int64, len(p.Sample))
+	for _, s := range p.Sample {
+		key := sampleKey(s)
+		if v, ok := values[key]; ok {
+			for i := range v {
+				v[i] += s.Value[i]
+			}
+			continue
+		}
+		values[key] = slices.Clone(s.Value)
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	h := sha256.New()
+	for _, st := range p.SampleType {
+		h.Write([]byte(st.Type + "/" + st.Unit + "\n"))
+	}
+	var num [8]byte
+	for _, k := range keys {
+		h.Write([]byte(k))
+		for _, v := range values[k] {
+			binary.LittleEndian.PutUint64(num[:], uint64(v))
+			h.Write(num[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func sampleKey(s *profile.Sample) string {
+	var b strings.Builder
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				b.WriteString(line.Function.Name)
+			}
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatInt(line.Line, 10))
+			b.WriteByte(';')
+		}
+	}
+	b.WriteByte('|')
+	for _, k := range sortedKeys(s.Label) {
+		b.WriteString(k + "=" + strings.Join(s.Label[k], ",") + ";")
+	}
+	for _, k := range sortedKeys(s.NumLabel) {
+		b.WriteString(k + "=")
+		for _, v := range s.NumLabel[k] {
+			b.WriteString(strconv.FormatInt(v, 10) + ",")
+		}
+		b.WriteByte(';')
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,86 @@
+package profilestore
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ListHandler serves the metadata of stored profiles as JSON, newest last.
+// Supported query parameters: service, type, labels (k=v,k=v), ref (release
+// or commit), and since (e.g. 24h).
+func (s *Store) ListHandler(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	q := Query{Service: v.Get("service"), Type: v.Get("type"), Ref: v.Get("ref")}
+	if l := v.Get("labels"); l != "" {
+		q.Labels = make(map[string]string)
+		for pair := range strings.SplitSeq(l, ",") {
+			k, val, _ := strings.Cut(pair, "=")
+			q.Labels[k] = val
+		}
+	}
+	if since, err := time.ParseDuration(v.Get("since")); err == nil {
+		q.From = time.Now().Add(-since)
+	}
+	metas, err := s.List(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, metas)
+}
+
+// MetaHandler serves the metadata of one profile; it must be registered
+// with an {id} path wildcard.
+func (s *Store) MetaHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	m, err := s.findLocked(r.PathValue("id"))
+	s.mu.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, m)
+}
+
+// DownloadHandler serves the gzipped protobuf of one profile, so
+// `go tool pprof` can fetch it by URL; it must be registered with an {id}
+// path wildcard. Stored files never change, so the file's SHA-256 is a
+// strong ETag, and Range requests (with If-Range) let interrupted downloads
+// resume where they stopped.
+func (s *Store) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	digest, err := s.Digest(r.Context(), id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	m, f, err := s.File(r.Context(), id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", `"`+digest+`"`)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+m.ID+profileSuffix+`"`)
+	http.ServeContent(w, r, "", m.Time, f)
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
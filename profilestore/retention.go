@@ -0,0 +1,275 @@
+package profilestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const policiesFile = "retention.json"
+
+// DefaultPolicy is the key of the policy applied to services without one.
+const DefaultPolicy = "*"
+
+// Policy bounds the profiles kept for a service. Zero fields do not limit.
+type Policy struct {
+	// MaxAge removes profiles collected longer ago than this.
+	MaxAge time.Duration `json:"max_age_ns,omitempty"`
+	// MaxCount keeps at most this many of the newest profiles per type.
+	MaxCount int `json:"max_count,omitempty"`
+	// MaxBytes removes the oldest profiles once the service's profiles take
+	// more space than this.
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// Policies maps services, or DefaultPolicy, to their retention policy.
+type Policies map[string]Policy
+
+func (p Policies) forService(service string) Policy {
+	if pol, ok := p[service]; ok {
+		return pol
+	}
+	return p[DefaultPolicy]
+}
+
+func readPolicies(dir string) (Policies, error) {
+	data, err := os.ReadFile(filepath.Join(dir, policiesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Policies{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := Policies{}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("profilestore: %s: %w", policiesFile, err)
+	}
+	return p, nil
+}
+
+// Policies returns the configured retention policies.
+func (s *Store) Policies() Policies {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(Policies, len(s.policies))
+	for k, v := range s.policies {
+		out[k] = v
+	}
+	return out
+}
+
+// SetPolicy sets, or with a zero Policy removes, the retention policy of a
+// service and saves it in the store.
+func (s *Store) SetPolicy(service string, p Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p == (Policy{}) {
+		delete(s.policies, service)
+	} else {
+		s.policies[service] = p
+	}
+	data, err := json.MarshalIndent(s.policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, policiesFile), data, 0o644)
+}
+
+// Removal is a profile removed, or to be removed, by compaction.
+type Removal struct {
+	Meta   Meta   `json:"meta"`
+	Reason string `json:"reason"`
+}
+
+// CompactResult reports what a compaction did.
+type CompactResult struct {
+	Removed []Removal `json:"removed"`
+	// Fingerprinted counts profiles stored before fingerprinting existed
+	// that were fingerprinted now.
+	Fingerprinted int `json:"fingerprinted"`
+	// Orphans counts profile files without metadata, left by interrupted
+	// writes.
+	Orphans    int   `json:"orphans"`
+	FreedBytes int64 `json:"freed_bytes"`
+}
+
+// Compact fingerprints profiles that lack one, removing those identical to
+// a profile already fingerprinted, deletes orphaned files, and applies the
+// retention policies as of now. With dryRun, it only reports what it would
+// remove. If ctx is done part way, Compact stops with the context's error
+// and what it removed so far.
+func (s *Store) Compact(ctx context.Context, now time.Time, dryRun bool) (CompactResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res CompactResult
+	if err := s.fingerprintLocked(ctx, &res, dryRun); err != nil {
+		return res, err
+	}
+	if err := s.orphansLocked(&res, dryRun); err != nil {
+		return res, err
+	}
+
+	duplicates := make(map[string]bool, len(res.Removed))
+	for _, rm := range res.Removed {
+		duplicates[rm.Meta.ID] = true
+	}
+	byService := make(map[string][]Meta)
+	for _, m := range s.index {
+		if !duplicates[m.ID] {
+			byService[m.Service] = append(byService[m.Service], m)
+		}
+	}
+	for service, metas := range byService {
+		sortByTime(metas)
+		res.Removed = append(res.Removed, retain(metas, s.policies.forService(service), now)...)
+	}
+
+	for _, rm := range res.Removed {
+		res.FreedBytes += int64(rm.Meta.Size)
+		if dryRun {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := s.removeLocked(rm.Meta); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// fingerprintLocked fingerprints profiles that have none, oldest first, and
+// marks each one identical to an already fingerprinted profile for removal.
+// A dry run does not store the fingerprints, so it keeps those it computes
+// itself to find the same duplicates a real run does.
+func (s *Store) fingerprintLocked(ctx context.Context, res *CompactResult, dryRun bool) error {
+	var missing []Meta
+	for _, m := range s.index {
+		if m.Fingerprint == "" {
+			missing = append(missing, m)
+		}
+	}
+	sortByTime(missing)
+
+	printed := make(map[string]string)
+	for _, m := range missing {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := s.readLocked(ctx, m)
+		if err != nil {
+			return err
+		}
+		p, err := parse(data)
+		if err != nil {
+			return err
+		}
+		m.Fingerprint = Fingerprint(p)
+		res.Fingerprinted++
+
+		key := m.Service + "/" + m.Fingerprint
+		id, ok := s.byPrint[key]
+		if !ok {
+			id, ok = printed[key]
+		}
+		if ok && id != m.ID {
+			res.Removed = append(res.Removed, Removal{Meta: m, Reason: "duplicate of " + id})
+			continue
+		}
+		printed[key] = m.ID
+		if dryRun {
+			continue
+		}
+		if err := s.writeMetaLocked(m); err != nil {
+			return err
+		}
+		s.addLocked(m)
+	}
+	return nil
+}
+
+// orphansLocked removes profile files whose metadata is missing, or whose
+// metadata names the other of the plain and encrypted file.
+func (s *Store) orphansLocked(res *CompactResult, dryRun bool) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*", "*"+profileSuffix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		id, _, _ := strings.Cut(filepath.Base(f), profileSuffix)
+		if m, ok := s.index[id]; ok && s.profilePath(m) == f {
+			continue
+		}
+		res.Orphans++
+		if info, err := os.Stat(f); err == nil {
+			res.FreedBytes += info.Size()
+		}
+		if !dryRun {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// retain returns the profiles of one service, sorted oldest first, that
+// the policy does not keep.
+func retain(metas []Meta, p Policy, now time.Time) []Removal {
+	var out []Removal
+	removed := make(map[string]bool)
+	drop := func(m Meta, reason string) {
+		if !removed[m.ID] {
+			removed[m.ID] = true
+			out = append(out, Removal{Meta: m, Reason: reason})
+		}
+	}
+
+	if p.MaxAge > 0 {
+		for _, m := range metas {
+			if now.Sub(m.Time) > p.MaxAge {
+				drop(m, fmt.Sprintf("older than %s", p.MaxAge))
+			}
+		}
+	}
+	if p.MaxCount > 0 {
+		byType := make(map[string]int)
+		for i := len(metas) - 1; i >= 0; i-- {
+			m := metas[i]
+			if removed[m.ID] {
+				continue
+			}
+			byType[m.Type]++
+			if byType[m.Type] > p.MaxCount {
+				drop(m, fmt.Sprintf("more than %d %s profiles", p.MaxCount, m.Type))
+			}
+		}
+	}
+	if p.MaxBytes > 0 {
+		var total int64
+		for _, m := range metas {
+			if !removed[m.ID] {
+				total += int64(m.Size)
+			}
+		}
+		for _, m := range metas {
+			if total <= p.MaxBytes {
+				break
+			}
+			if !removed[m.ID] {
+				total -= int64(m.Size)
+				drop(m, fmt.Sprintf("service over %d bytes", p.MaxBytes))
+			}
+		}
+	}
+	return out
+}
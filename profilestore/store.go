@@ -0,0 +1,444 @@
+// Package profilestore keeps pprof profiles on disk together with metadata
+// (service, profile type, labels, collection time) so profiles gathered at
+// different times and places can be listed and compared later.
+//
+// Each profile is stored as <dir>/<service>/<id>.pb.gz with its metadata in
+// <id>.json next to it, or as <id>.pb.gz.enc when encrypted at rest (see
+// Keys). Profiles are fingerprinted so identical ones are only
+// stored once, and per-service retention policies keep the store bounded
+// (see Compact).
+//
+// Every Store method that may block, on a KMS for the keys of encrypted
+// profiles or on the disk for a whole store, takes a context and gives up
+// when it is done.
+package profilestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	profileSuffix = ".pb.gz"
+	sealedSuffix  = ".enc" // appended to profileSuffix for encrypted profiles
+	metaSuffix    = ".json"
+)
+
+var (
+	// ErrNotFound is returned for an unknown profile ID.
+	ErrNotFound = errors.New("profilestore: profile not found")
+	// ErrDuplicate is returned by Put, together with the metadata of the
+	// stored profile, when an identical profile of the service is stored.
+	ErrDuplicate = errors.New("profilestore: identical profile already stored")
+)
+
+// Meta describes a stored profile.
+type Meta struct {
+	ID      string `json:"id"`
+	Service string `json:"service"`
+	// Type is the profile's default sample type, such as "cpu" or
+	// "inuse_space".
+	Type     string            `json:"type"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Time     time.Time         `json:"time"`
+	Duration time.Duration     `json:"duration_ns,omitempty"`
+	Size     int               `json:"size"`
+	// Source is where the profile came from, such as the imported file name.
+	Source string `json:"source,omitempty"`
+	// Version and Commit tag the build the profile was collected from (see
+	// BuildTags).
+	Version string `json:"version,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	// Fingerprint identifies the profile's samples (see Fingerprint).
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// SHA256 is the hex digest of the gzipped protobuf, used as its ETag.
+	SHA256 string `json:"sha256,omitempty"`
+	// Key is the profile's wrapped data key if it is encrypted at rest.
+	Key *WrappedKey `json:"key,omitempty"`
+}
+
+// Query selects profiles. Zero fields match everything.
+type Query struct {
+	Service string
+	Type    string
+	Labels  map[string]string
+	// Ref selects profiles by release version or commit (see Meta.MatchesRef).
+	Ref  string
+	From time.Time
+	To   time.Time
+}
+
+func (q Query) matches(m Meta) bool {
+	if q.Service != "" && m.Service != q.Service {
+		return false
+	}
+	if q.Type != "" && m.Type != q.Type {
+		return false
+	}
+	if q.Ref != "" && !m.MatchesRef(q.Ref) {
+		return false
+	}
+	if !q.From.IsZero() && m.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && m.Time.After(q.To) {
+		return false
+	}
+	for k, v := range q.Labels {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Store is safe for concurrent use within one process. The metadata of every
+// profile is kept in memory; only profile data is read from disk on demand.
+type Store struct {
+	dir  string
+	keys Keys // nil stores profiles unencrypted
+
+	mu       sync.RWMutex
+	index    map[string]Meta   // by ID
+	byPrint  map[string]string // service + fingerprint -> ID
+	policies Policies
+}
+
+// Open opens or creates a store in dir and loads its metadata and retention
+// policies.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("profilestore: create dir: %w", err)
+	}
+	s := &Store{
+		dir:     dir,
+		index:   make(map[string]Meta),
+		byPrint: make(map[string]string),
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"+metaSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		m, err := readMeta(f)
+		if err != nil {
+			return nil, err
+		}
+		s.addLocked(m)
+	}
+	if s.policies, err = readPolicies(dir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) addLocked(m Meta) {
+	s.index[m.ID] = m
+	if m.Fingerprint != "" {
+		s.byPrint[m.Service+"/"+m.Fingerprint] = m.ID
+	}
+}
+
+func (s *Store) forgetLocked(m Meta) {
+	delete(s.index, m.ID)
+	if key := m.Service + "/" + m.Fingerprint; s.byPrint[key] == m.ID {
+		delete(s.byPrint, key)
+	}
+}
+
+// Put stores a profile in any format profile.Parse accepts. Service is
+// required; ID, Type, Time, Duration, and Size are filled in from the profile
+// when left empty. Labels, Source, Version, and Commit are kept as given.
+func (s *Store) Put(ctx context.Context, data []byte, meta Meta) (Meta, error) {
+	if meta.Service == "" {
+		return Meta{}, errors.New("profilestore: service is required")
+	}
+	if strings.ContainsAny(meta.Service, `/\`) || meta.Service == "." || meta.Service == ".." {
+		return Meta{}, fmt.Errorf("profilestore: invalid service name %q", meta.Service)
+	}
+	p, err := parse(data)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	if meta.Type == "" {
+		meta.Type = defaultType(p)
+	}
+	if meta.Time.IsZero() {
+		meta.Time = time.Now()
+		if p.TimeNanos > 0 {
+			meta.Time = time.Unix(0, p.TimeNanos)
+		}
+	}
+	if meta.Duration == 0 {
+		meta.Duration = time.Duration(p.DurationNanos)
+	}
+	if meta.ID == "" {
+		meta.ID = newID(meta.Time)
+	}
+	meta.Fingerprint = Fingerprint(p)
+
+	// Store the canonical gzipped protobuf, whatever the input format was.
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return Meta{}, err
+	}
+	meta.Size = buf.Len()
+	sum := sha256.Sum256(buf.Bytes())
+	meta.SHA256 = hex.EncodeToString(sum[:])
+	stored := buf.Bytes()
+	meta.Key = nil
+	if s.keys != nil {
+		if stored, meta.Key, err = encrypt(ctx, s.keys, meta.ID, stored); err != nil {
+			return Meta{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.byPrint[meta.Service+"/"+meta.Fingerprint]; ok {
+		return s.index[id], ErrDuplicate
+	}
+
+	dir := filepath.Join(s.dir, meta.Service)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Meta{}, err
+	}
+	if err := os.WriteFile(s.profilePath(meta), stored, 0o644); err != nil {
+		return Meta{}, err
+	}
+	// The metadata is written last; a profile without it is an orphan that
+	// Compact removes.
+	if err := s.writeMetaLocked(meta); err != nil {
+		return Meta{}, err
+	}
+	s.addLocked(meta)
+	return meta, nil
+}
+
+// List returns the metadata of the profiles matching q, oldest first.
+func (s *Store) List(q Query) ([]Meta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []Meta
+	for _, m := range s.index {
+		if q.matches(m) {
+			out = append(out, m)
+		}
+	}
+	sortByTime(out)
+	return out, nil
+}
+
+func sortByTime(metas []Meta) {
+	slices.SortFunc(metas, func(a, b Meta) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// SetKeys makes the store encrypt profiles it stores from now on with keys,
+// and decrypt encrypted ones it reads. It must be called before the store
+// is used.
+func (s *Store) SetKeys(keys Keys) {
+	s.keys = keys
+}
+
+// Get returns the metadata and gzipped protobuf of a profile.
+func (s *Store) Get(ctx context.Context, id string) (Meta, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, err := s.findLocked(id)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	data, err := s.readLocked(ctx, m)
+	return m, data, err
+}
+
+// File opens the gzipped protobuf of a profile for reading, so large
+// profiles can be streamed. Encrypted profiles are decrypted into memory
+// first. The caller closes the file.
+func (s *Store) File(ctx context.Context, id string) (Meta, io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, err := s.findLocked(id)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	if m.Key == nil {
+		f, err := os.Open(s.profilePath(m))
+		return m, f, err
+	}
+	data, err := s.readLocked(ctx, m)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	return m, nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func (s *Store) readLocked(ctx context.Context, m Meta) ([]byte, error) {
+	data, err := os.ReadFile(s.profilePath(m))
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(ctx, s.keys, m, data)
+}
+
+// Digest returns the SHA-256 of a profile's gzipped protobuf, computing and recording it
+// for profiles stored before digests were.
+func (s *Store) Digest(ctx context.Context, id string) (string, error) {
+	s.mu.RLock()
+	m, err := s.findLocked(id)
+	s.mu.RUnlock()
+	if err != nil || m.SHA256 != "" {
+		return m.SHA256, err
+	}
+
+	_, f, err := s.File(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, err = s.findLocked(id); err != nil {
+		return "", err
+	}
+	m.SHA256 = digest
+	if err := s.writeMetaLocked(m); err != nil {
+		return "", err
+	}
+	s.addLocked(m)
+	return digest, nil
+}
+
+// Profile returns a stored profile parsed.
+func (s *Store) Profile(ctx context.Context, id string) (Meta, *profile.Profile, error) {
+	m, data, err := s.Get(ctx, id)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	p, err := profile.ParseData(data)
+	return m, p, err
+}
+
+// Delete removes a profile.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.findLocked(id)
+	if err != nil {
+		return err
+	}
+	return s.removeLocked(m)
+}
+
+func (s *Store) removeLocked(m Meta) error {
+	if err := os.Remove(s.metaPath(m)); err != nil {
+		return err
+	}
+	s.forgetLocked(m)
+	if err := os.Remove(s.profilePath(m)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) findLocked(id string) (Meta, error) {
+	m, ok := s.index[id]
+	if !ok {
+		return Meta{}, ErrNotFound
+	}
+	return m, nil
+}
+
+func (s *Store) writeMetaLocked(m Meta) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.metaPath(m), data, 0o644)
+}
+
+func (s *Store) metaPath(m Meta) string {
+	return filepath.Join(s.dir, m.Service, m.ID+metaSuffix)
+}
+
+func (s *Store) profilePath(m Meta) string {
+	if m.Key != nil {
+		return filepath.Join(s.dir, m.Service, m.ID+profileSuffix+sealedSuffix)
+	}
+	return filepath.Join(s.dir, m.Service, m.ID+profileSuffix)
+}
+
+func parse(data []byte) (*profile.Profile, error) {
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return nil, fmt.Errorf("profilestore: parse profile: %w", err)
+	}
+	return p, nil
+}
+
+func readMeta(path string) (Meta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Meta{}, err
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Meta{}, fmt.Errorf("profilestore: %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// defaultType names a profile by its default sample type, or its last one,
+// the same one pprof shows by default.
+func defaultType(p *profile.Profile) string {
+	if p.DefaultSampleType != "" {
+		return p.DefaultSampleType
+	}
+	if n := len(p.SampleType); n > 0 {
+		return p.SampleType[n-1].Type
+	}
+	return "unknown"
+}
+
+// newID returns a time-ordered, unique profile ID.
+func newID(t time.Time) string {
+	var b [4]byte
+	rand.Read(b[:])
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,87 @@
+// Package randsource hands out the random numbers the examples draw, all
+// derived from one seed. Two runs with the same seed generate the same users,
+// allocations, and request sequences, so their profiles can be compared
+// without the data itself being a difference.
+//
+// Every consumer takes its own named stream. A stream's numbers depend only
+// on the seed and its name, not on how much other code has drawn before it,
+// so adding a random call in one place does not shift the sequence elsewhere.
+package randsource
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+)
+
+// Source derives named streams from a seed.
+type Source struct {
+	seed uint64
+
+	mu    sync.Mutex
+	drawn map[string]uint64 // Next calls so far, by name
+}
+
+// New returns a source for seed. Seed 0 picks a random seed; Seed reports it,
+// so the run can be repeated.
+func New(seed uint64) *Source {
+	for seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &Source{seed: seed}
+}
+
+// Seed returns the seed of the source.
+func (s *Source) Seed() uint64 {
+	return s.seed
+}
+
+// Stream returns the generator named name. Each call starts the stream from
+// its beginning. The generator is not safe for concurrent use; give each
+// goroutine its own, named after it.
+func (s *Source) Stream(name string) *rand.Rand {
+	return rand.New(s.pcg(name))
+}
+
+// Next returns a new generator of the streams named name each call: the
+// first call's is the stream "name#1", the second's "name#2", and so on.
+// It is for handlers that draw afresh for every request, which would
+// otherwise all get the same numbers from Stream. The nth request gets the
+// same numbers in every run with the seed, though which request is nth
+// depends on the order they arrive in.
+func (s *Source) Next(name string) *rand.Rand {
+	s.mu.Lock()
+	if s.drawn == nil {
+		s.drawn = make(map[string]uint64)
+	}
+	s.drawn[name]++
+	n := s.drawn[name]
+	s.mu.Unlock()
+	return s.Stream(name + "#" + strconv.FormatUint(n, 10))
+}
+
+// Shared is like Stream but safe for concurrent use. Goroutines drawing from
+// it together get the stream's numbers in whatever order they interleave.
+func (s *Source) Shared(name string) *rand.Rand {
+	return rand.New(&lockedSource{src: s.pcg(name)})
+}
+
+// pcg seeds a PCG with the source seed and a hash of the name. The hash must
+// be the same in every process, which rules out hash/maphash.
+func (s *Source) pcg(name string) *rand.PCG {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.NewPCG(s.seed, h.Sum64())
+}
+
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (l *lockedSource) Uint64() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.src.Uint64()
+}
@@ -0,0 +1,202 @@
+// Package schedtest runs a small concurrent program many times under
+// varied schedules, to flush out results that depend on how its goroutines
+// interleave. Each run gets a GOMAXPROCS value and a perturbation seed: at
+// every yield point the program offers, the seed decides whether the
+// goroutine carries on, yields its P with runtime.Gosched, or sleeps for a
+// few microseconds. Runs whose results differ are grouped by result, with
+// the schedules that produced each.
+//
+// The Go scheduler cannot be driven step by step, so a schedule does not
+// force an interleaving; it makes some far more likely. Replaying a run
+// draws the same perturbations from its seed, which usually, not always,
+// gets the same result again.
+package schedtest
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Program is a concurrent program under test. It calls yield wherever a
+// switch to another goroutine could change its result, and returns the
+// result as text, such as "count=200".
+type Program func(yield func()) string
+
+// Config sets the schedules Explore tries.
+type Config struct {
+	// Runs is the number of runs per GOMAXPROCS value (default 100).
+	Runs int
+	// Procs are the GOMAXPROCS values to run under (default 1, 2, 4, and
+	// the number of CPUs).
+	Procs []int
+	// Seed seeds the perturbations; 0 picks one, which the report keeps.
+	Seed uint64
+	// YieldRate and SleepRate are the chances that a yield point yields
+	// or sleeps (defaults 0.3 and 0.05). MaxSleep bounds a sleep
+	// (default 50µs).
+	YieldRate, SleepRate float64
+	MaxSleep             time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Runs <= 0 {
+		c.Runs = 100
+	}
+	if len(c.Procs) == 0 {
+		c.Procs = []int{1, 2, 4}
+		if n := runtime.NumCPU(); n > 4 {
+			c.Procs = append(c.Procs, n)
+		}
+	}
+	for c.Seed == 0 {
+		c.Seed = rand.Uint64()
+	}
+	if c.YieldRate == 0 {
+		c.YieldRate = 0.3
+	}
+	if c.SleepRate == 0 {
+		c.SleepRate = 0.05
+	}
+	if c.MaxSleep <= 0 {
+		c.MaxSleep = 50 * time.Microsecond
+	}
+	return c
+}
+
+// Schedule identifies one run: its GOMAXPROCS and its index, from which
+// the perturbation seed is derived.
+type Schedule struct {
+	GOMAXPROCS int `json:"gomaxprocs"`
+	Run        int `json:"run"`
+}
+
+func (s Schedule) String() string {
+	return fmt.Sprintf("GOMAXPROCS=%d run=%d", s.GOMAXPROCS, s.Run)
+}
+
+// Outcome is one distinct result and the runs that produced it.
+type Outcome struct {
+	Result string `json:"result"`
+	Count  int    `json:"count"`
+	// ByProcs counts the runs per GOMAXPROCS value.
+	ByProcs map[int]int `json:"by_procs"`
+	// First is the first schedule that produced the result.
+	First Schedule `json:"first"`
+	// Yields and Sleeps are the perturbations of that run.
+	Yields int `json:"yields"`
+	Sleeps int `json:"sleeps"`
+}
+
+// Report is the outcomes of every run, most frequent first.
+type Report struct {
+	Seed     uint64    `json:"seed"`
+	Runs     int       `json:"runs"`
+	Outcomes []Outcome `json:"outcomes"`
+}
+
+// Divergent reports whether the runs did not all produce the same result.
+func (r *Report) Divergent() bool {
+	return len(r.Outcomes) > 1
+}
+
+// Explore runs p cfg.Runs times under every GOMAXPROCS value of cfg and
+// groups the runs by result. GOMAXPROCS is restored afterwards.
+func Explore(p Program, cfg Config) *Report {
+	cfg = cfg.withDefaults()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	r := &Report{Seed: cfg.Seed}
+	byResult := make(map[string]*Outcome)
+	for _, procs := range cfg.Procs {
+		runtime.GOMAXPROCS(procs)
+		for run := range cfg.Runs {
+			s := Schedule{GOMAXPROCS: procs, Run: run}
+			result, yields, sleeps := Replay(p, cfg, s)
+			o := byResult[result]
+			if o == nil {
+				o = &Outcome{Result: result, ByProcs: make(map[int]int), First: s, Yields: yields, Sleeps: sleeps}
+				byResult[result] = o
+			}
+			o.Count++
+			o.ByProcs[procs]++
+			r.Runs++
+		}
+	}
+	for _, o := range byResult {
+		r.Outcomes = append(r.Outcomes, *o)
+	}
+	slices.SortFunc(r.Outcomes, func(a, b Outcome) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Result, b.Result))
+	})
+	return r
+}
+
+// Replay runs p once with the perturbations of schedule s and returns its
+// result and how many times it yielded and slept. It runs under the
+// current GOMAXPROCS; set it to s.GOMAXPROCS first to replay a run of
+// Explore. The perturbations depend on the order in which goroutines reach
+// their yield points, so they repeat as long as that order does.
+func Replay(p Program, cfg Config, s Schedule) (result string, yields, sleeps int) {
+	cfg = cfg.withDefaults()
+	var mu sync.Mutex
+	rng := rand.New(rand.NewPCG(cfg.Seed, uint64(s.GOMAXPROCS)<<32|uint64(s.Run)))
+	yield := func() {
+		mu.Lock()
+		x := rng.Float64()
+		var sleep time.Duration
+		switch {
+		case x < cfg.SleepRate:
+			sleep = time.Duration(rng.Int64N(int64(cfg.MaxSleep)) + 1)
+			sleeps++
+		case x < cfg.SleepRate+cfg.YieldRate:
+			yields++
+		default:
+			mu.Unlock()
+			return
+		}
+		mu.Unlock()
+		if sleep > 0 {
+			time.Sleep(sleep)
+		} else {
+			runtime.Gosched()
+		}
+	}
+	result = p(yield)
+	mu.Lock()
+	defer mu.Unlock()
+	return result, yields, sleeps
+}
+
+// WriteText writes the outcomes as a table, with the GOMAXPROCS values
+// that produced each and the first schedule to replay it.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tRUNS\tSHARE\tBY GOMAXPROCS\tFIRST SCHEDULE")
+	for _, o := range r.Outcomes {
+		procs := slices.Sorted(maps.Keys(o.ByProcs))
+		parts := make([]string, len(procs))
+		for i, p := range procs {
+			parts[i] = fmt.Sprintf("%d:%d", p, o.ByProcs[p])
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%s\t%s (%d yields, %d sleeps)\n", o.Result, o.Count,
+			100*float64(o.Count)/float64(r.Runs), strings.Join(parts, " "), o.First, o.Yields, o.Sleeps)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	verdict := "deterministic"
+	if r.Divergent() {
+		verdict = fmt.Sprintf("divergent: %d results", len(r.Outcomes))
+	}
+	_, err := fmt.Fprintf(w, "%d runs, seed %d, %s\n", r.Runs, r.Seed, verdict)
+	return err
+}
@@ -0,0 +1,40 @@
+package subtleties
+
+import "fmt"
+
+// Subtlety is one runnable example of a Go language subtlety.
+type Subtlety struct {
+	// Name is the function the example is in, by which Source finds its
+	// code.
+	Name    string
+	Summary string
+	Run     func()
+}
+
+// Catalog lists the runnable subtleties, so tools can show and run them
+// without knowing the functions by name.
+var Catalog = []Subtlety{
+	{
+		Name:    "DoneAfter",
+		Summary: "time.After in a select sets a deadline for another goroutine",
+		Run:     DoneAfter,
+	},
+	{
+		Name:    "RangeOverInteger",
+		Summary: "range over an integer counts from 0 to n-1",
+		Run:     func() { RangeOverInteger(10) },
+	},
+	{
+		Name:    "IndexedBasedString",
+		Summary: "%[n]s picks format arguments by index, so one can be used twice",
+		Run:     IndexedBasedString,
+	},
+	{
+		Name:    "BuildMessage",
+		Summary: "the ~ constraint accepts any type whose underlying type is string",
+		Run:     func() { fmt.Println(BuildMessage(greeting("hello"))) },
+	},
+}
+
+// greeting is a typed string, accepted by BuildMessage through ~string.
+type greeting string
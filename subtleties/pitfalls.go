@@ -0,0 +1,120 @@
+package subtleties
+
+import (
+	"strings"
+	"time"
+)
+
+// Pitfall is a subtlety with a broken and a fixed way to write it, which
+// compute the same thing, so a harness can run both and measure what the
+// mistake costs. Each variant is one short round, meant to be repeated.
+type Pitfall struct {
+	Name    string
+	Summary string
+	Broken  func()
+	Fixed   func()
+}
+
+// Pitfalls lists the pitfalls with both variants.
+var Pitfalls = []Pitfall{
+	{
+		Name:    "DoneAfter",
+		Summary: "a goroutine sending on an unbuffered channel leaks once the receiver has timed out",
+		Broken:  func() { DoneAfterUnbuffered(2*time.Millisecond, time.Millisecond) },
+		Fixed:   func() { DoneAfterBuffered(2*time.Millisecond, time.Millisecond) },
+	},
+	{
+		Name:    "StringConcat",
+		Summary: "+= on a string copies it every time; strings.Builder grows one buffer",
+		Broken:  func() { sinkString = ConcatPlus(words) },
+		Fixed:   func() { sinkString = ConcatBuilder(words) },
+	},
+	{
+		Name:    "AppendGrow",
+		Summary: "append to a nil slice reallocates as it grows; make with the final capacity allocates once",
+		Broken:  func() { sinkInts = AppendGrow(4096) },
+		Fixed:   func() { sinkInts = AppendPrealloc(4096) },
+	},
+}
+
+// sinkString and sinkInts keep the results alive, so the compiler cannot
+// drop the work.
+var (
+	sinkString string
+	sinkInts   []int
+)
+
+var words = strings.Fields(strings.Repeat("the quick brown fox jumps over the lazy dog ", 50))
+
+// DoneAfterUnbuffered waits deadline for work done by another goroutine.
+// When the deadline passes first, nobody ever receives from ch, and the
+// goroutine blocks on its send forever.
+func DoneAfterUnbuffered(work, deadline time.Duration) bool {
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(work)
+		ch <- struct{}{}
+	}()
+	select {
+	case <-ch:
+		return true
+	case <-time.After(deadline):
+		return false
+	}
+}
+
+// DoneAfterBuffered is DoneAfterUnbuffered with room for the result in the
+// channel, so the goroutine's send completes, and it exits, whether or not
+// anybody is still waiting.
+func DoneAfterBuffered(work, deadline time.Duration) bool {
+	ch := make(chan struct{}, 1)
+	go func() {
+		time.Sleep(work)
+		ch <- struct{}{}
+	}()
+	select {
+	case <-ch:
+		return true
+	case <-time.After(deadline):
+		return false
+	}
+}
+
+// ConcatPlus joins words with +=, copying the string built so far on every
+// word: quadratic in the length.
+func ConcatPlus(words []string) string {
+	var s string
+	for _, w := range words {
+		s += w + " "
+	}
+	return s
+}
+
+// ConcatBuilder joins words into one growing buffer.
+func ConcatBuilder(words []string) string {
+	var b strings.Builder
+	for _, w := range words {
+		b.WriteString(w)
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// AppendGrow appends n ints to a nil slice, which is reallocated and copied
+// each time it runs out of capacity.
+func AppendGrow(n int) []int {
+	var s []int
+	for i := range n {
+		s = append(s, i)
+	}
+	return s
+}
+
+// AppendPrealloc appends n ints to a slice made with room for all of them.
+func AppendPrealloc(n int) []int {
+	s := make([]int, 0, n)
+	for i := range n {
+		s = append(s, i)
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package subtleties
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Race is a small concurrent program whose result depends on how its
+// goroutines interleave, for a schedule explorer such as schedtest to run
+// many times. Run calls yield where a switch to another goroutine exposes
+// the bug, and returns its result as text. A correct program returns the
+// same result under every schedule.
+type Race struct {
+	Name    string
+	Summary string
+	Run     func(yield func()) string
+}
+
+// Races lists the programs, broken ones next to their fixes.
+var Races = []Race{
+	{
+		Name:    "LostUpdate",
+		Summary: "a load and a store are two steps, so two goroutines incrementing a counter lose updates",
+		Run:     LostUpdate,
+	},
+	{
+		Name:    "AtomicAdd",
+		Summary: "atomic.Int64.Add increments in one step, so no update is lost",
+		Run:     AtomicAdd,
+	},
+	{
+		Name:    "CheckThenAct",
+		Summary: "checking a map under a lock, then inserting under another, lets two goroutines both initialize",
+		Run:     CheckThenAct,
+	},
+	{
+		Name:    "WaitGroupAddInside",
+		Summary: "wg.Add inside the goroutine lets Wait return before the goroutine has started",
+		Run:     WaitGroupAddInside,
+	},
+	{
+		Name:    "SelectBothReady",
+		Summary: "select picks among ready cases at random, whatever their order",
+		Run:     SelectBothReady,
+	},
+	{
+		Name:    "DeadlineRace",
+		Summary: "work that takes about as long as its deadline finishes first under some schedules only",
+		Run:     DeadlineRace,
+	},
+}
+
+// LostUpdate has two goroutines add 100 each to a counter with a separate
+// load and store. The atomics only keep the race detector quiet: the
+// increment as a whole is still not atomic.
+func LostUpdate(yield func()) string {
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			for range 100 {
+				v := n.Load()
+				yield()
+				n.Store(v + 1)
+			}
+		})
+	}
+	wg.Wait()
+	return fmt.Sprintf("count=%d", n.Load())
+}
+
+// AtomicAdd is LostUpdate with the increment in one step.
+func AtomicAdd(yield func()) string {
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			for range 100 {
+				yield()
+				n.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	return fmt.Sprintf("count=%d", n.Load())
+}
+
+// CheckThenAct has two goroutines initialize a map entry when they find it
+// missing, releasing the lock between the check and the insert.
+func CheckThenAct(yield func()) string {
+	var mu sync.Mutex
+	m := make(map[string]int)
+	var inits atomic.Int64
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			mu.Lock()
+			_, ok := m["config"]
+			mu.Unlock()
+			yield()
+			if !ok {
+				inits.Add(1)
+				mu.Lock()
+				m["config"] = 1
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return fmt.Sprintf("inits=%d", inits.Load())
+}
+
+// WaitGroupAddInside starts a goroutine that adds itself to the
+// WaitGroup, and reports whether it had finished when Wait returned.
+func WaitGroupAddInside(yield func()) string {
+	var wg sync.WaitGroup
+	var done atomic.Bool
+	go func() {
+		yield()
+		wg.Add(1)
+		defer wg.Done()
+		done.Store(true)
+	}()
+	yield()
+	wg.Wait()
+	finished := done.Load()
+	if !finished {
+		// Let the goroutine finish before the next run.
+		for !done.Load() {
+			time.Sleep(time.Microsecond)
+		}
+	}
+	return fmt.Sprintf("finished=%t", finished)
+}
+
+// SelectBothReady selects on two channels that both hold a value.
+func SelectBothReady(yield func()) string {
+	a, b := make(chan string, 1), make(chan string, 1)
+	a <- "a"
+	b <- "b"
+	yield()
+	select {
+	case v := <-a:
+		return "picked=" + v
+	case v := <-b:
+		return "picked=" + v
+	}
+}
+
+// DeadlineRace is DoneAfterBuffered with work as long as the deadline.
+func DeadlineRace(yield func()) string {
+	ch := make(chan struct{}, 1)
+	go func() {
+		yield()
+		time.Sleep(50 * time.Microsecond)
+		ch <- struct{}{}
+	}()
+	yield()
+	select {
+	case <-ch:
+		return "result=done"
+	case <-time.After(50 * time.Microsecond):
+		return "result=timeout"
+	}
+}
@@ -0,0 +1,117 @@
+package subtleties
+
+import (
+	"embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// files is the package's own source, compiled into the binary so the code
+// shown for a subtlety is always the code that runs.
+//
+//go:embed *.go
+var files embed.FS
+
+// Source is the code of a subtlety as it was compiled.
+type Source struct {
+	// File is the file the function is in, and Line the line it starts on.
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Code is the function with its doc comment.
+	Code string `json:"code"`
+	// Notes are the comments of the file that belong to no declaration,
+	// such as the expected output or an explanation after the function.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Source returns the code of the function the subtlety is named after.
+func (s Subtlety) Source() (Source, error) {
+	funcs, err := parseFiles()
+	if err != nil {
+		return Source{}, err
+	}
+	src, ok := funcs[s.Name]
+	if !ok {
+		return Source{}, fmt.Errorf("subtleties: no function %s in the package source", s.Name)
+	}
+	return src, nil
+}
+
+// parseFiles finds every function of the package in the embedded source,
+// once.
+var parseFiles = sync.OnceValues(func() (map[string]Source, error) {
+	names, err := fs.Glob(files, "*.go")
+	if err != nil {
+		return nil, err
+	}
+	funcs := make(map[string]Source)
+	fset := token.NewFileSet()
+	for _, name := range names {
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, name, data, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		notes := freeComments(f)
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			start := fn.Pos()
+			if fn.Doc != nil {
+				start = fn.Doc.Pos()
+			}
+			funcs[fn.Name.Name] = Source{
+				File:  name,
+				Line:  fset.Position(start).Line,
+				Code:  string(data[fset.Position(start).Offset:fset.Position(fn.End()).Offset]),
+				Notes: notes,
+			}
+		}
+	}
+	return funcs, nil
+})
+
+// freeComments returns the text of the comments in f outside every
+// declaration and its doc comment, and after the package clause.
+func freeComments(f *ast.File) []string {
+	var notes []string
+	for _, c := range f.Comments {
+		if c.Pos() < f.Name.End() || inDecl(f, c) {
+			continue
+		}
+		if text := strings.TrimSpace(c.Text()); text != "" {
+			notes = append(notes, text)
+		}
+	}
+	return notes
+}
+
+func inDecl(f *ast.File, c *ast.CommentGroup) bool {
+	for _, d := range f.Decls {
+		start := d.Pos()
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+		}
+		if c.Pos() >= start && c.End() <= d.End() {
+			return true
+		}
+	}
+	return false
+}
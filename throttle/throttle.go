@@ -0,0 +1,192 @@
+// Package throttle limits download bandwidth with token buckets, one per
+// client, so a large profile download cannot saturate the serving process's
+// own network link.
+package throttle
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket of bytes. Tokens refill at Rate per second up to
+// Burst; a write that finds too few waits until they have refilled.
+type Bucket struct {
+	rate  float64 // bytes per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket refilling at rate bytes per second. A burst
+// below 1 is raised to one second's worth of rate, and a rate below 1 byte
+// per second to 1, so every write makes progress.
+func NewBucket(rate, burst int64) *Bucket {
+	rate = max(rate, 1)
+	if burst < 1 {
+		burst = rate
+	}
+	return &Bucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refillLocked adds the tokens earned since the last call.
+func (b *Bucket) refillLocked(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Wait takes n tokens, blocking until they are available or ctx is done.
+// Tokens are reserved up front, so concurrent writers sharing a bucket queue
+// behind each other rather than all waking at once.
+func (b *Bucket) Wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	b.refillLocked(time.Now())
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+	if deficit <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens += float64(n) // give back what was not sent
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// full reports whether the bucket has refilled completely, in which case
+// forgetting it loses nothing.
+func (b *Bucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked(now)
+	return b.tokens >= b.burst
+}
+
+// chunk bounds the size of one throttled write, so a large Write is spread
+// across time instead of waiting once and then bursting.
+const chunk = 32 << 10
+
+// Writer returns a writer that writes to w no faster than b allows.
+func Writer(ctx context.Context, w io.Writer, b *Bucket) io.Writer {
+	return &writer{ctx: ctx, w: w, b: b, chunk: max(1, min(chunk, int(b.burst)))}
+}
+
+type writer struct {
+	ctx   context.Context
+	w     io.Writer
+	b     *Bucket
+	chunk int
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := min(len(p), w.chunk)
+		if err := w.b.Wait(w.ctx, n); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Limiter hands out a bucket per client, keyed by remote IP, so each client
+// gets Rate bytes per second however many downloads it runs in parallel.
+type Limiter struct {
+	rate, burst int64
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type client struct {
+	bucket *Bucket
+	active int
+}
+
+// NewLimiter returns a limiter allowing each client rate bytes per second
+// with bursts of up to burst bytes.
+func NewLimiter(rate, burst int64) *Limiter {
+	return &Limiter{rate: rate, burst: burst, clients: make(map[string]*client)}
+}
+
+// Handler serves next with its response body throttled per client.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		c := l.acquire(key)
+		defer l.release(key)
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, body: Writer(r.Context(), w, c.bucket)}, r)
+	})
+}
+
+// Clients reports how many clients have a bucket that has not refilled yet.
+func (l *Limiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.clients)
+}
+
+func (l *Limiter) acquire(key string) *client {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget idle clients whose buckets have refilled; a new bucket would
+	// start out just as full.
+	now := time.Now()
+	for k, c := range l.clients {
+		if c.active == 0 && c.bucket.full(now) {
+			delete(l.clients, k)
+		}
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{bucket: NewBucket(l.rate, l.burst)}
+		l.clients[key] = c
+	}
+	c.active++
+	return c
+}
+
+func (l *Limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clients[key].active--
+}
+
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	body io.Writer
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) { return w.body.Write(p) }
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }